@@ -3,7 +3,7 @@ import ContainerfyCore
 import Foundation
 
 // CLI vs GUI mode detection:
-// If argv contains "pack", run CLI mode (no NSApplication).
+// If argv contains "pack", "validate", "lint", "verify", "inspect", "uninstall", "doctor" or "completion", run CLI mode (no NSApplication).
 // Otherwise, launch GUI as normal.
 
 @main
@@ -18,14 +18,47 @@ enum ContainerfyApp {
             switch CommandLine.arguments[1] {
             case "pack":
                 let packArgs = Array(CommandLine.arguments.dropFirst(2))
+                InterruptCleanup.shared.installSignalHandlers()
                 let command = PackCommand()
                 let code = command.run(arguments: packArgs)
                 exit(code)
+            case "validate":
+                let validateArgs = Array(CommandLine.arguments.dropFirst(2))
+                exit(ValidateCommand().run(arguments: validateArgs))
+            case "lint":
+                let lintArgs = Array(CommandLine.arguments.dropFirst(2))
+                exit(LintCommand().run(arguments: lintArgs))
+            case "verify":
+                let verifyArgs = Array(CommandLine.arguments.dropFirst(2))
+                exit(VerifyCommand().run(arguments: verifyArgs))
+            case "inspect":
+                let inspectArgs = Array(CommandLine.arguments.dropFirst(2))
+                exit(InspectCommand().run(arguments: inspectArgs))
+            case "uninstall":
+                let uninstallArgs = Array(CommandLine.arguments.dropFirst(2))
+                exit(UninstallCommand().run(arguments: uninstallArgs))
+            case "doctor":
+                let doctorArgs = Array(CommandLine.arguments.dropFirst(2))
+                exit(DoctorCommand().run(arguments: doctorArgs))
+            case "completion":
+                let completionArgs = Array(CommandLine.arguments.dropFirst(2))
+                exit(CompletionCommand().run(arguments: completionArgs))
+            case "version", "--version":
+                print(ContainerfyVersion.description)
+                exit(0)
             case "--help", "-h":
                 print("Usage: containerfy <command> [flags]")
                 print("")
                 print("Commands:")
                 print("  pack           Build a distributable .app bundle from a docker-compose.yml")
+                print("  validate       Check a docker-compose.yml and print the resolved config, without building")
+                print("  lint           Report best-practice findings for a docker-compose.yml")
+                print("  verify         Check a packed .app's compose file against its pack-time digest")
+                print("  inspect        Show what a packed .app contains and how it is signed")
+                print("  uninstall      Remove a packed .app's VM and Application Support files")
+                print("  doctor         Check this Mac has what pack needs before building")
+                print("  completion     Print a bash, zsh or fish completion script")
+                print("  version        Print the containerfy version, commit and build date")
                 print("")
                 print("Run 'containerfy pack --help' for details.")
                 print("")
@@ -42,7 +75,11 @@ enum ContainerfyApp {
         let app = NSApplication.shared
         let delegate = AppDelegate()
         app.delegate = delegate
-        app.setActivationPolicy(.accessory) // Menu-bar only, no dock icon
+        // Menu-bar only unless the bundle was packed with x-containerfy.ui.background: false,
+        // which leaves LSUIElement out of Info.plist
+        let background = Bundle.main.bundleIdentifier == nil
+            || (Bundle.main.object(forInfoDictionaryKey: "LSUIElement") as? Bool) == true
+        app.setActivationPolicy(background ? .accessory : .regular)
         app.run()
     }
 }
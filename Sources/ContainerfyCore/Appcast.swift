@@ -0,0 +1,77 @@
+import Foundation
+
+/// Sparkle appcast generation for packed DMGs.
+///
+/// Sparkle also expects an EdDSA `sparkle:edSignature` on each enclosure; that needs the
+/// developer's private key, so it is left for Sparkle's `sign_update` tool to add.
+enum Appcast {
+
+    /// Stand-in for the download URL, which isn't known at pack time.
+    static let placeholderBaseURL = "https://REPLACE-WITH-DOWNLOAD-URL"
+
+    /// One `<item>` describing a release DMG. `build` is the app's CFBundleVersion, which Sparkle
+    /// compares to order releases; nil when it is the same as `version`.
+    static func item(
+        title: String,
+        version: String,
+        build: String? = nil,
+        dmgPath: String,
+        minimumSystemVersion: String,
+        date: Date = Date()
+    ) throws -> String {
+        let attrs = try FileManager.default.attributesOfItem(atPath: dmgPath)
+        guard let length = (attrs[.size] as? NSNumber)?.int64Value, length > 0 else {
+            throw BundleAssembler.AssemblyError.writeFailed("appcast: \(dmgPath) is empty")
+        }
+        let fileName = (dmgPath as NSString).lastPathComponent
+
+        let formatter = DateFormatter()
+        formatter.locale = Locale(identifier: "en_US_POSIX")
+        formatter.dateFormat = "EEE, dd MMM yyyy HH:mm:ss Z"
+
+        return """
+                <item>
+                    <title>\(escape(title)) \(escape(version))</title>
+                    <pubDate>\(formatter.string(from: date))</pubDate>
+                    <sparkle:version>\(escape(build ?? version))</sparkle:version>
+                    <sparkle:shortVersionString>\(escape(version))</sparkle:shortVersionString>
+                    <sparkle:minimumSystemVersion>\(escape(minimumSystemVersion))</sparkle:minimumSystemVersion>
+                    <enclosure url="\(placeholderBaseURL)/\(escape(fileName))" length="\(length)" type="application/octet-stream"/>
+                </item>
+        """
+    }
+
+    /// Appends `item` to the appcast at `path`, creating a new feed if the file doesn't exist.
+    static func write(item: String, title: String, to path: String) throws {
+        let fm = FileManager.default
+        var feed: String
+        if fm.fileExists(atPath: path) {
+            feed = try String(contentsOfFile: path, encoding: .utf8)
+            guard let close = feed.range(of: "</channel>", options: .backwards) else {
+                throw BundleAssembler.AssemblyError.writeFailed("appcast: \(path) has no </channel> to append to")
+            }
+            // Insert on its own line, before the line holding </channel>
+            let lineStart = feed[..<close.lowerBound].lastIndex(of: "\n").map { feed.index(after: $0) } ?? close.lowerBound
+            feed.insert(contentsOf: item + "\n", at: lineStart)
+        } else {
+            feed = """
+            <?xml version="1.0" encoding="utf-8"?>
+            <rss version="2.0" xmlns:sparkle="http://www.andymatuschak.org/xml-namespaces/sparkle">
+                <channel>
+                    <title>\(escape(title))</title>
+            \(item)
+                </channel>
+            </rss>
+
+            """
+        }
+        try feed.write(toFile: path, atomically: true, encoding: .utf8)
+    }
+
+    private static func escape(_ text: String) -> String {
+        text.replacingOccurrences(of: "&", with: "&amp;")
+            .replacingOccurrences(of: "<", with: "&lt;")
+            .replacingOccurrences(of: ">", with: "&gt;")
+            .replacingOccurrences(of: "\"", with: "&quot;")
+    }
+}
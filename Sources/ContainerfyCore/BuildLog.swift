@@ -0,0 +1,55 @@
+import Foundation
+
+/// `pack --log-file`: a timestamped record of a build — step events, progress, errors, and every
+/// external command with its output — written whatever the console shows with `--quiet`.
+///
+/// Each line goes straight to the file with no buffering, so the log is complete up to the
+/// point a build fails or is interrupted.
+final class BuildLog: @unchecked Sendable {
+
+    let path: String
+
+    private let handle: FileHandle
+    private let lock = NSLock()
+    private var closed = false
+    private let formatter: ISO8601DateFormatter = {
+        let formatter = ISO8601DateFormatter()
+        formatter.formatOptions = [.withInternetDateTime, .withFractionalSeconds]
+        return formatter
+    }()
+
+    /// Creates (or truncates) the file at `path`, and its directory if needed.
+    init(path: String) throws {
+        let fm = FileManager.default
+        let dir = (path as NSString).deletingLastPathComponent
+        if !dir.isEmpty {
+            try fm.createDirectory(atPath: dir, withIntermediateDirectories: true)
+        }
+        guard fm.createFile(atPath: path, contents: nil) else {
+            throw CocoaError(.fileWriteNoPermission, userInfo: [NSFilePathErrorKey: path])
+        }
+        self.path = path
+        self.handle = try FileHandle(forWritingTo: URL(fileURLWithPath: path))
+    }
+
+    /// Writes each line of `text` with a timestamp. Ignored once the log is closed.
+    func write(_ text: String, date: Date = Date()) {
+        lock.lock(); defer { lock.unlock() }
+        guard !closed else { return }
+        let stamp = formatter.string(from: date)
+        let lines = text.split(separator: "\n", omittingEmptySubsequences: false)
+        let entry = lines.map { "\(stamp) \($0)\n" }.joined()
+        handle.write(Data(entry.utf8))
+    }
+
+    /// Writes a last line saying how the build ended, then syncs and closes the file.
+    /// Later calls do nothing, so the interrupt handler and the normal exit path can both call it.
+    func close(status: String) {
+        write("pack \(status)")
+        lock.lock(); defer { lock.unlock() }
+        guard !closed else { return }
+        closed = true
+        try? handle.synchronize()
+        try? handle.close()
+    }
+}
@@ -0,0 +1,128 @@
+import Foundation
+
+/// `<name>.build-manifest.json`, written next to the final artifact by `pack --build-manifest`:
+/// a machine-readable record of what was packed, for auditing and release tooling. Keys are
+/// only ever added; `schema_version` changes if one is renamed or removed.
+struct BuildManifest: Encodable, Equatable, Sendable {
+
+    struct Image: Encodable, Equatable, Sendable {
+        var service: String
+        var reference: String
+        /// The `@sha256:` digest when the reference is pinned by one. Tags are resolved by
+        /// podman when the app first starts, so there is no digest to record for them.
+        var digest: String?
+    }
+
+    struct VM: Encodable, Equatable, Sendable {
+        var cpu: Int?
+        var memoryMB: Int?
+        var diskMB: Int?
+
+        enum CodingKeys: String, CodingKey {
+            case cpu
+            case memoryMB = "memory_mb"
+            case diskMB = "disk_mb"
+        }
+    }
+
+    struct Artifact: Encodable, Equatable, Sendable {
+        /// File name of the .dmg, or of the .app for builds without one.
+        var name: String
+        var sha256: String
+        var bytes: UInt64
+    }
+
+    static let currentSchemaVersion = 1
+    static let fileSuffix = ".build-manifest.json"
+
+    var schemaVersion: Int
+    var containerfyVersion: String
+    var name: String
+    var version: String
+    var identifier: String
+    /// `ContainerfyConfigSHA256` from Info.plist: the bundled compose file plus env files.
+    var configSHA256: String?
+    var images: [Image]
+    /// Recommended VM sizing, which is what the app starts with when the Mac allows it.
+    var vm: VM
+    /// SHA-256 fingerprint of each `--ca-cert` certificate bundled for the VM trust store.
+    var caCertificates: [String]
+    var appBytes: UInt64
+    var artifact: Artifact
+    var signed: Bool
+    var notarized: Bool
+
+    enum CodingKeys: String, CodingKey {
+        case schemaVersion = "schema_version"
+        case containerfyVersion = "containerfy_version"
+        case name
+        case version
+        case identifier
+        case configSHA256 = "config_sha256"
+        case images
+        case vm
+        case caCertificates = "ca_certificates"
+        case appBytes = "app_bytes"
+        case artifact
+        case signed
+        case notarized
+    }
+
+    /// Describes the finished build. `artifactPath` is the .dmg, or `appPath` itself.
+    static func make(
+        config: ComposeConfig, appPath: String, artifactPath: String,
+        caCertificates: [CACertificates.Certificate] = [], signed: Bool, notarized: Bool
+    ) throws -> BuildManifest {
+        let plistPath = (appPath as NSString).appendingPathComponent("Contents/Info.plist")
+        let plist = FileManager.default.contents(atPath: plistPath)
+            .flatMap { try? PropertyListSerialization.propertyList(from: $0, format: nil) as? [String: Any] }
+
+        let appBytes = BundleAssembler.fileSizes(under: appPath).reduce(0) { $0 + $1.bytes }
+        let artifactBytes = artifactPath == appPath
+            ? appBytes
+            : (try FileManager.default.attributesOfItem(atPath: artifactPath)[.size] as? UInt64) ?? 0
+
+        // A certificate given twice is bundled once, so it is listed once
+        var seen = Set<String>()
+        let fingerprints = caCertificates.map(\.fingerprint).filter { seen.insert($0).inserted }
+
+        return BuildManifest(
+            schemaVersion: currentSchemaVersion,
+            containerfyVersion: ContainerfyVersion.current,
+            name: config.name ?? "Containerfy",
+            version: config.version ?? "1.0.0",
+            identifier: config.identifier ?? "unknown",
+            configSHA256: plist?[BundleAssembler.configDigestKey] as? String,
+            images: config.serviceSpecs.compactMap { spec in
+                spec.image.map { Image(service: spec.name, reference: $0, digest: digest(of: $0)) }
+            },
+            vm: VM(cpu: config.cpuRecommended, memoryMB: config.memoryMBRecommended, diskMB: config.diskMB),
+            caCertificates: fingerprints,
+            appBytes: appBytes,
+            artifact: Artifact(
+                name: (artifactPath as NSString).lastPathComponent,
+                sha256: try Checksum.sha256(atPath: artifactPath),
+                bytes: artifactBytes
+            ),
+            signed: signed,
+            notarized: notarized
+        )
+    }
+
+    /// `sha256:<hex>` from a reference like `nginx@sha256:<hex>`, or nil.
+    static func digest(of reference: String) -> String? {
+        guard let at = reference.range(of: "@sha256:") else { return nil }
+        return String(reference[reference.index(after: at.lowerBound)...])
+    }
+
+    /// Writes `<name>.build-manifest.json` into the artifact's directory and returns its path.
+    @discardableResult
+    func write(nextTo artifactPath: String) throws -> String {
+        let dir = (artifactPath as NSString).deletingLastPathComponent
+        let path = ((dir.isEmpty ? "." : dir) as NSString).appendingPathComponent(name + Self.fileSuffix)
+        let encoder = JSONEncoder()
+        encoder.outputFormatting = [.prettyPrinted, .sortedKeys, .withoutEscapingSlashes]
+        try encoder.encode(self).write(to: URL(fileURLWithPath: path))
+        return path
+    }
+}
@@ -0,0 +1,72 @@
+import Foundation
+
+/// `pack --archive`: the .app as a single compressed file, for builds that are moved off the
+/// build machine (a CI runner, say) before being signed or wrapped in a .dmg on a Mac.
+/// Both formats keep file modes and symlinks, so the 0755 bits on podman, gvproxy and vfkit
+/// survive a round trip through `extract` — or plain `tar -xzpf` / `ditto -x -k`.
+enum BundleArchive {
+
+    enum Format: String, CaseIterable, Sendable {
+        case tarGz = "tar.gz"
+        case zip
+    }
+
+    enum ArchiveError: LocalizedError {
+        case failed(String)
+
+        var errorDescription: String? {
+            switch self {
+            case .failed(let reason): return "Archive failed: \(reason)"
+            }
+        }
+    }
+
+    /// Writes `<appName>.<format>` into `outputDir`, with the .app as its single top-level entry,
+    /// and returns its path.
+    static func create(appPath: String, appName: String, format: Format, outputDir: String, shell: ShellExecutor = SystemShellExecutor()) throws -> String {
+        let archivePath = (outputDir as NSString).appendingPathComponent("\(appName).\(format.rawValue)")
+        let fm = FileManager.default
+        if fm.fileExists(atPath: archivePath) { try fm.removeItem(atPath: archivePath) }
+        // A half-written archive is unusable
+        InterruptCleanup.shared.track(archivePath)
+        defer { InterruptCleanup.shared.untrack(archivePath) }
+
+        let parent = (appPath as NSString).deletingLastPathComponent
+        let arguments: [String]
+        let executable: String
+        switch format {
+        case .tarGz:
+            executable = "/usr/bin/tar"
+            arguments = ["-czf", archivePath, "-C", parent.isEmpty ? "." : parent, (appPath as NSString).lastPathComponent]
+        case .zip:
+            // ditto, unlike zip(1), keeps symlinks, modes and extended attributes
+            executable = "/usr/bin/ditto"
+            arguments = ["-c", "-k", "--keepParent", appPath, archivePath]
+        }
+        try run(executable, arguments, shell: shell)
+        return archivePath
+    }
+
+    /// Unpacks an archive written by `create` into `directory`, restoring file modes.
+    static func extract(archivePath: String, format: Format, into directory: String, shell: ShellExecutor = SystemShellExecutor()) throws {
+        try FileManager.default.createDirectory(atPath: directory, withIntermediateDirectories: true)
+        switch format {
+        case .tarGz:
+            try run("/usr/bin/tar", ["-xzpf", archivePath, "-C", directory], shell: shell)
+        case .zip:
+            try run("/usr/bin/ditto", ["-x", "-k", archivePath, directory], shell: shell)
+        }
+    }
+
+    private static func run(_ executable: String, _ arguments: [String], shell: ShellExecutor) throws {
+        let result: ProcessResult
+        do {
+            result = try shell.run(executable: executable, arguments: arguments)
+        } catch {
+            throw ArchiveError.failed("\(executable) could not be run (\(error.localizedDescription))")
+        }
+        guard result.exitCode == 0 else {
+            throw ArchiveError.failed("\((executable as NSString).lastPathComponent) exited \(result.exitCode): \(result.stderr)")
+        }
+    }
+}
@@ -9,19 +9,44 @@ import Foundation
 ///   +-- MacOS/vfkit
 ///   +-- MacOS/gvproxy
 ///   +-- Resources/
+///   |   +-- layout.json (resource roles -> paths, see BundleLayout)
 ///   |   +-- docker-compose.yml
+///   |   +-- runtime.json (resolved config the app runs from, see RuntimeConfig)
 ///   |   +-- *.env
+///   |   +-- labels.json (if x-containerfy.labels is set)
+///   |   +-- LICENSE.txt (if x-containerfy.license is set)
+///   |   +-- AppIcon.icns (if x-containerfy.icon is set)
+///   |   +-- ca-certificates/*.pem (if --ca-cert is given)
+///   |   +-- installed-paths.json (what the app creates outside the bundle, see InstalledPaths)
+///   |   +-- manifest.json (SHA-256 and size of every other file here, see BundleManifest)
 ///   +-- Info.plist
 enum BundleAssembler {
 
     enum AssemblyError: LocalizedError {
         case missingArtifact(String)
         case writeFailed(String)
+        case overBudget(path: String, bytes: UInt64, budgetMB: Int, largest: [(path: String, bytes: UInt64)])
+        case insufficientSpace(path: String, neededBytes: UInt64, freeBytes: UInt64)
+        case verificationFailed(String)
+        case wrongArchitecture(path: String, found: [String], expected: String)
 
         var errorDescription: String? {
             switch self {
             case .missingArtifact(let name): return "Missing: \(name)"
             case .writeFailed(let reason): return "Bundle assembly failed: \(reason)"
+            case .overBudget(let path, let bytes, let budgetMB, let largest):
+                let name = (path as NSString).lastPathComponent
+                var lines = ["\(name) is \(BundleAssembler.formatMB(bytes)) MB, over the \(budgetMB) MB budget. Largest contributors:"]
+                lines += largest.map { "  \(BundleAssembler.formatMB($0.bytes)) MB  \($0.path)" }
+                return lines.joined(separator: "\n")
+            case .insufficientSpace(let path, let needed, let free):
+                return "Not enough free space in \(path): need \(BundleAssembler.formatMB(needed)) MB, have \(BundleAssembler.formatMB(free)) MB"
+                    + " — free some space, or point --output or --tmpdir at a roomier volume"
+            case .verificationFailed(let reason):
+                return "Bundle self-test failed: \(reason)"
+            case .wrongArchitecture(let path, let found, let expected):
+                return "\(path) is built for \(found.joined(separator: ", ")), but the bundle targets \(expected)"
+                    + " — the app would fail to launch as damaged; use an \(expected) or universal containerfy build"
             }
         }
     }
@@ -46,7 +71,117 @@ enum BundleAssembler {
         return (podman, gvproxy, vfkit)
     }
 
-    /// Assembles a .app bundle.
+    /// podman, gvproxy and vfkit from `dir` for `pack --artifacts`, e.g. binaries fetched by an
+    /// earlier CI stage. Each must be a non-empty executable file.
+    static func prebuiltBinaries(in dir: String) throws -> (podman: String, gvproxy: String, vfkit: String) {
+        let fm = FileManager.default
+        var isDir: ObjCBool = false
+        guard fm.fileExists(atPath: dir, isDirectory: &isDir), isDir.boolValue else {
+            throw AssemblyError.missingArtifact("--artifacts: \(dir) is not a directory")
+        }
+        func binary(_ name: String) throws -> String {
+            let path = (dir as NSString).appendingPathComponent(name)
+            guard fm.fileExists(atPath: path) else {
+                throw AssemblyError.missingArtifact("--artifacts: \(name) not found in \(dir)")
+            }
+            let size = (try? fm.attributesOfItem(atPath: path)[.size] as? Int) ?? 0
+            guard size > 0, fm.isExecutableFile(atPath: path) else {
+                throw AssemblyError.missingArtifact("--artifacts: \(path) is empty or not executable")
+            }
+            return path
+        }
+        return (try binary("podman"), try binary("gvproxy"), try binary("vfkit"))
+    }
+
+    /// The app executable for `pack --runtime-binary`, e.g. a containerfy built elsewhere in CI.
+    /// It must exist and be an executable Mach-O file, thin or universal.
+    static func runtimeBinary(at path: String) throws -> String {
+        let fm = FileManager.default
+        guard fm.fileExists(atPath: path) else {
+            throw AssemblyError.missingArtifact("--runtime-binary: \(path) not found")
+        }
+        guard fm.isExecutableFile(atPath: path), machOArchitectures(path) != nil else {
+            throw AssemblyError.missingArtifact("--runtime-binary: \(path) is not an executable Mach-O binary")
+        }
+        return path
+    }
+
+    /// CPU types from <mach/machine.h>, by the names `lipo -archs` prints.
+    private static let cpuTypeNames: [UInt32: String] = [
+        0x0100_000C: "arm64", 0x0100_0007: "x86_64", 0x0200_000C: "arm64_32", 0x0000_000C: "arm", 0x0000_0007: "i386",
+    ]
+
+    /// The architectures a Mach-O file is built for — one for a thin binary, every slice of a
+    /// universal one — or nil if it isn't Mach-O. Unknown CPU types read as `cpu-<n>`.
+    static func machOArchitectures(_ path: String) -> [String]? {
+        guard let handle = FileHandle(forReadingAtPath: path) else { return nil }
+        defer { try? handle.close() }
+        let bytes = [UInt8](handle.readData(ofLength: 4096))
+        func word(_ offset: Int, bigEndian: Bool) -> UInt32? {
+            guard offset + 4 <= bytes.count else { return nil }
+            let slice = Array(bytes[offset..<offset + 4])
+            return (bigEndian ? slice : Array(slice.reversed())).reduce(UInt32(0)) { $0 << 8 | UInt32($1) }
+        }
+        func name(_ cpuType: UInt32) -> String { cpuTypeNames[cpuType] ?? "cpu-\(cpuType)" }
+
+        switch word(0, bigEndian: true) {
+        case 0xFEED_FACE, 0xFEED_FACF:
+            return word(4, bigEndian: true).map { [name($0)] }
+        case 0xCEFA_EDFE, 0xCFFA_EDFE:
+            return word(4, bigEndian: false).map { [name($0)] }
+        case 0xCAFE_BABE, 0xCAFE_BABF:
+            // A fat header, then a fat_arch (20 bytes) or fat_arch_64 (32 bytes) per slice, all big-endian.
+            // Java class files share the magic; their version number reads as an implausible slice count.
+            guard let count = word(4, bigEndian: true), (1...32).contains(count) else { return nil }
+            let stride = word(0, bigEndian: true) == 0xCAFE_BABF ? 32 : 20
+            let types = (0..<Int(count)).compactMap { word(8 + $0 * stride, bigEndian: true) }
+            return types.count == Int(count) ? types.map(name) : nil
+        default:
+            return nil
+        }
+    }
+
+    /// The architecture bundles are built for. The podman, gvproxy and vfkit that pack bundles
+    /// are this Mac's, so the app only runs on Macs like it.
+    static var targetArchitecture: String {
+        #if arch(arm64)
+        return "arm64"
+        #else
+        return "x86_64"
+        #endif
+    }
+
+    /// Fails unless the runtime binary at `path` includes `architecture` — macOS reports an app
+    /// whose executable can't run on the Mac as damaged. Files that aren't Mach-O aren't checked.
+    static func checkRuntimeArchitecture(_ path: String, architecture: String = BundleAssembler.targetArchitecture) throws {
+        guard let architectures = machOArchitectures(path), !architectures.contains(architecture) else { return }
+        throw AssemblyError.wrongArchitecture(path: path, found: architectures, expected: architecture)
+    }
+
+    /// Writes stand-in podman, gvproxy and vfkit executables into `dir` for `--placeholder-artifacts`.
+    /// Each is a tiny script that says what it is and exits 1, so a bundle built from them is
+    /// structurally complete (and signable) but can never start a VM by accident.
+    static func writePlaceholderBinaries(in dir: String) throws -> (podman: String, gvproxy: String, vfkit: String) {
+        let fm = FileManager.default
+        try fm.createDirectory(atPath: dir, withIntermediateDirectories: true)
+        func placeholder(_ name: String) throws -> String {
+            let path = (dir as NSString).appendingPathComponent(name)
+            let script = """
+            #!/bin/sh
+            # CONTAINERFY PLACEHOLDER — not a real \(name) binary
+            echo "\(name): placeholder from 'containerfy pack --placeholder-artifacts'; this bundle cannot run" >&2
+            exit 1
+
+            """
+            try script.write(toFile: path, atomically: true, encoding: .utf8)
+            try fm.setAttributes([.posixPermissions: 0o755], ofItemAtPath: path)
+            return path
+        }
+        return (try placeholder("podman"), try placeholder("gvproxy"), try placeholder("vfkit"))
+    }
+
+    /// Assembles a .app bundle. The same inputs produce byte-identical files with identical
+    /// modification times (see `normalizeTimestamps`), so bundles can be rebuilt and compared.
     static func assemble(
         config: ComposeConfig,
         podmanPath: String,
@@ -54,9 +189,14 @@ enum BundleAssembler {
         vfkitPath: String,
         outputPath: String,
         binaryPath: String? = nil,
+        architecture: String = BundleAssembler.targetArchitecture,
+        caCertificates: [CACertificates.Certificate] = [],
+        tempDir: String = NSTemporaryDirectory(),
         shell: ShellExecutor = SystemShellExecutor()
     ) throws {
         let fm = FileManager.default
+        let binarySrc = binaryPath ?? CommandLine.arguments[0]
+        try checkRuntimeArchitecture(binarySrc, architecture: architecture)
 
         let appDir = outputPath.hasSuffix(".app") ? outputPath : outputPath + ".app"
         let contentsDir = (appDir as NSString).appendingPathComponent("Contents")
@@ -68,61 +208,459 @@ enum BundleAssembler {
             try fm.removeItem(atPath: appDir)
         }
 
-        // Create directory structure
+        // Create directory structure; a bundle cut short by an interrupt is removed
         for dir in [macosDir, resourcesDir] {
             try fm.createDirectory(atPath: dir, withIntermediateDirectories: true)
         }
+        InterruptCleanup.shared.track(appDir)
+        defer { InterruptCleanup.shared.untrack(appDir) }
+
+        let layout = plannedLayout(config: config, hasCACertificates: !caCertificates.isEmpty)
 
-        // Copy compose file
+        // Copy compose file, recording its digest so `containerfy verify` can detect edits
+        var composeSHA256: String?
         if let composePath = config.composePath {
-            let dst = (resourcesDir as NSString).appendingPathComponent("docker-compose.yml")
-            try fm.copyItem(atPath: composePath, toPath: dst)
+            let dst = (resourcesDir as NSString).appendingPathComponent(layout.compose)
+            if let rendered = config.renderedCompose {
+                try rendered.write(toFile: dst, atomically: true, encoding: .utf8)
+            } else {
+                try fm.copyItem(atPath: composePath, toPath: dst)
+            }
+            composeSHA256 = try Checksum.sha256(ofFile: dst)
+
+            // Resolved config for the app, so it never has to re-parse the compose file
+            try RuntimeConfig(config: config).write(toResourcesPath: resourcesDir)
         }
 
-        // Copy env files
+        // Copy env files — without a BOM or CRLF endings, and owner-only, since they often hold
+        // credentials and the source is usually world-readable.
         for envFile in config.envFiles {
             let fileName = (envFile as NSString).lastPathComponent
             let dst = (resourcesDir as NSString).appendingPathComponent(fileName)
-            try fm.copyItem(atPath: envFile, toPath: dst)
+            guard let data = fm.contents(atPath: envFile) else {
+                throw AssemblyError.missingArtifact(envFile)
+            }
+            guard fm.createFile(atPath: dst, contents: EnvFile.normalize(data)) else {
+                throw AssemblyError.writeFailed("could not write \(dst)")
+            }
+            try fm.setAttributes([.posixPermissions: 0o600], ofItemAtPath: dst)
+        }
+
+        // Fingerprint of the inputs that define what the app runs: the bundled compose file
+        // plus env files. Two bundles with the same value were packed from identical config.
+        var configSHA256: String?
+        if composeSHA256 != nil {
+            configSHA256 = try Checksum.sha256(ofFiles: [layout.compose] + layout.envFiles, in: resourcesDir)
+        }
+
+        // Secrets and configs go where the bundled compose file expects them; secrets are
+        // readable by the owner only
+        for file in config.bundledFiles {
+            let dst = (resourcesDir as NSString).appendingPathComponent(file.bundlePath)
+            let dir = (dst as NSString).deletingLastPathComponent
+            try fm.createDirectory(atPath: dir, withIntermediateDirectories: true)
+            try fm.copyItem(atPath: file.source, toPath: dst)
+            if file.kind == .secret {
+                try fm.setAttributes([.posixPermissions: 0o600], ofItemAtPath: dst)
+                try fm.setAttributes([.posixPermissions: 0o700], ofItemAtPath: dir)
+            }
+        }
+
+        // Write app-level labels for inventory tooling
+        if let labels = layout.labels {
+            let encoder = JSONEncoder()
+            encoder.outputFormatting = [.prettyPrinted, .sortedKeys]
+            let data = try encoder.encode(config.labels)
+            let dst = (resourcesDir as NSString).appendingPathComponent(labels)
+            guard fm.createFile(atPath: dst, contents: data) else {
+                throw AssemblyError.writeFailed("could not write \(dst)")
+            }
+        }
+
+        // License agreement; signAndPackage also places it next to the app in the .dmg
+        if let license = config.license, let fileName = layout.license {
+            try fm.copyItem(atPath: license, toPath: (resourcesDir as NSString).appendingPathComponent(fileName))
+        }
+
+        // App icon, referenced from Info.plist
+        if let icon = config.icon, let fileName = layout.icon {
+            try installIcon(from: icon, to: (resourcesDir as NSString).appendingPathComponent(fileName), tempDir: tempDir, shell: shell)
+        }
+
+        // Bundle private CA certificates; the app installs them into the VM trust store on start
+        if let dir = layout.caCertificates {
+            let certDir = (resourcesDir as NSString).appendingPathComponent(dir)
+            try fm.createDirectory(atPath: certDir, withIntermediateDirectories: true)
+            for cert in caCertificates {
+                let dst = (certDir as NSString).appendingPathComponent(cert.fileName)
+                try cert.pem.write(toFile: dst, atomically: true, encoding: .utf8)
+            }
+        }
+
+        // Seed directories for named volumes; the app imports each into its volume on first start
+        if let dir = layout.volumeSeeds {
+            let seedsDir = (resourcesDir as NSString).appendingPathComponent(dir)
+            try fm.createDirectory(atPath: seedsDir, withIntermediateDirectories: true)
+            for seed in config.volumeSeeds {
+                try fm.copyItem(atPath: seed.source, toPath: (seedsDir as NSString).appendingPathComponent(seed.volume))
+            }
         }
 
+        // What the app will create outside the bundle, for `containerfy uninstall`
+        try InstalledPaths.make(config: config).write(toResourcesPath: resourcesDir)
+
+        try layout.write(toResourcesPath: resourcesDir)
+
+        // Digest every resource last, so the manifest covers layout.json too
+        try BundleManifest.generate(resourcesPath: resourcesDir).write(toResourcesPath: resourcesDir)
+
         // Generate Info.plist
-        let plist = generateInfoPlist(config: config)
+        let plist = generateInfoPlist(config: config, composeSHA256: composeSHA256, configSHA256: configSHA256, iconFile: layout.icon)
         let plistPath = (contentsDir as NSString).appendingPathComponent("Info.plist")
         try plist.write(toFile: plistPath, atomically: true, encoding: .utf8)
 
-        // Copy Containerfy binary
+        // Copy the Containerfy, podman, vfkit and gvproxy binaries — the bulk of the bundle — concurrently
         let binaryDst = (macosDir as NSString).appendingPathComponent("Containerfy")
-        let binarySrc = binaryPath ?? CommandLine.arguments[0]
+        let podmanDst = (macosDir as NSString).appendingPathComponent("podman")
+        let vfkitDst = (macosDir as NSString).appendingPathComponent("vfkit")
+        let gvproxyDst = (macosDir as NSString).appendingPathComponent("gvproxy")
+        var executables = [(podmanPath, podmanDst), (vfkitPath, vfkitDst), (gvproxyPath, gvproxyDst)]
         if fm.fileExists(atPath: binarySrc) {
-            try fm.copyItem(atPath: binarySrc, toPath: binaryDst)
-            try fm.setAttributes([.posixPermissions: 0o755], ofItemAtPath: binaryDst)
+            executables.insert((binarySrc, binaryDst), at: 0)
         } else {
-            print("  Warning: Containerfy binary not found at \(binarySrc)")
+            warn("Containerfy binary not found at \(binarySrc)")
         }
+        try copyExecutables(executables)
 
-        // Copy podman binary
-        let podmanDst = (macosDir as NSString).appendingPathComponent("podman")
-        try fm.copyItem(atPath: podmanPath, toPath: podmanDst)
-        try fm.setAttributes([.posixPermissions: 0o755], ofItemAtPath: podmanDst)
+        // Sign one at a time; vfkit needs VZ entitlements
         try adHocSignBinary(path: podmanDst, shell: shell)
-
-        // Copy vfkit binary (needs VZ entitlements)
-        let vfkitDst = (macosDir as NSString).appendingPathComponent("vfkit")
-        try fm.copyItem(atPath: vfkitPath, toPath: vfkitDst)
-        try fm.setAttributes([.posixPermissions: 0o755], ofItemAtPath: vfkitDst)
-        try signVFKit(path: vfkitDst, shell: shell)
-
-        // Copy gvproxy binary
-        let gvproxyDst = (macosDir as NSString).appendingPathComponent("gvproxy")
-        try fm.copyItem(atPath: gvproxyPath, toPath: gvproxyDst)
-        try fm.setAttributes([.posixPermissions: 0o755], ofItemAtPath: gvproxyDst)
+        try signVFKit(path: vfkitDst, tempDir: tempDir, shell: shell)
         try adHocSignBinary(path: gvproxyDst, shell: shell)
 
         // Ad-hoc sign the whole bundle
         try adHocSign(appPath: appDir, shell: shell)
 
-        print("  -> \(appDir)")
+        // Last, so signing's writes are covered too; the signature doesn't include timestamps
+        try normalizeTimestamps(under: appDir, to: sourceDate())
+    }
+
+    /// Copies each source to its destination and marks it executable, all at once. Every copy runs
+    /// to completion; if any fail, the error of the first one in `files` order is thrown, so the
+    /// reported failure doesn't depend on timing.
+    static func copyExecutables(
+        _ files: [(source: String, destination: String)],
+        copy: (String, String) throws -> Void = { try FileManager.default.copyItem(atPath: $0, toPath: $1) }
+    ) throws {
+        var failures = [Error?](repeating: nil, count: files.count)
+        let lock = NSLock()
+        DispatchQueue.concurrentPerform(iterations: files.count) { index in
+            let file = files[index]
+            do {
+                try copy(file.source, file.destination)
+                // A short copy (full disk, flaky network volume) would otherwise only show when the app fails to start
+                let expected = try FileManager.default.attributesOfItem(atPath: file.source)[.size] as? UInt64
+                let copied = try FileManager.default.attributesOfItem(atPath: file.destination)[.size] as? UInt64
+                guard copied == expected else {
+                    throw AssemblyError.writeFailed("\(file.destination) is \(copied ?? 0) bytes after copying, expected \(expected ?? 0)")
+                }
+                try FileManager.default.setAttributes([.posixPermissions: 0o755], ofItemAtPath: file.destination)
+            } catch {
+                lock.lock()
+                failures[index] = error
+                lock.unlock()
+            }
+        }
+        if let failure = failures.lazy.compactMap({ $0 }).first {
+            throw failure
+        }
+    }
+
+    // MARK: - Self-Test
+
+    /// Info.plist keys macOS needs to launch the app.
+    static let requiredPlistKeys = [
+        "CFBundleIdentifier", "CFBundleName", "CFBundleExecutable", "CFBundleVersion",
+        "CFBundleShortVersionString", "CFBundlePackageType",
+    ]
+
+    /// Checks a freshly assembled bundle is complete before it is signed or shipped: Info.plist
+    /// parses and has the launch keys, every binary is in MacOS/ and executable, every resource
+    /// layout.json names exists, and Resources still matches manifest.json and the compose digest.
+    static func verifyBundle(appPath: String) throws {
+        let fm = FileManager.default
+        let contentsDir = (appPath as NSString).appendingPathComponent("Contents")
+        let plistPath = (contentsDir as NSString).appendingPathComponent("Info.plist")
+        guard let data = fm.contents(atPath: plistPath),
+              let plist = try? PropertyListSerialization.propertyList(from: data, format: nil) as? [String: Any] else {
+            throw AssemblyError.verificationFailed("Contents/Info.plist is missing or not a property list")
+        }
+        for key in requiredPlistKeys where (plist[key] as? String)?.isEmpty ?? true {
+            throw AssemblyError.verificationFailed("Contents/Info.plist has no \(key)")
+        }
+
+        let executable = plist["CFBundleExecutable"] as? String ?? "Containerfy"
+        for name in [executable, "podman", "vfkit", "gvproxy"] {
+            let path = (contentsDir as NSString).appendingPathComponent("MacOS/\(name)")
+            let size = (try? fm.attributesOfItem(atPath: path)[.size] as? UInt64) ?? 0
+            guard size > 0, fm.isExecutableFile(atPath: path) else {
+                throw AssemblyError.verificationFailed("Contents/MacOS/\(name) is missing, empty or not executable")
+            }
+        }
+
+        let resourcesDir = (contentsDir as NSString).appendingPathComponent("Resources")
+        guard fm.fileExists(atPath: (resourcesDir as NSString).appendingPathComponent(BundleLayout.fileName)) else {
+            throw AssemblyError.verificationFailed("Contents/Resources has no \(BundleLayout.fileName)")
+        }
+        do {
+            let layout = try BundleLayout.load(resourcesPath: resourcesDir)
+            let roles = [
+                layout.compose, layout.runtime, layout.labels, layout.caCertificates, layout.license, layout.icon,
+                layout.volumeSeeds, layout.installedPaths, layout.manifest,
+            ]
+            for name in roles.compactMap({ $0 }) + layout.envFiles
+            where !fm.fileExists(atPath: (resourcesDir as NSString).appendingPathComponent(name)) {
+                throw AssemblyError.verificationFailed("Contents/Resources/\(name) is listed in \(BundleLayout.fileName) but missing")
+            }
+            try VerifyCommand.verifyComposeDigest(appPath: appPath)
+            guard try VerifyCommand.verifyManifest(appPath: appPath) != nil else {
+                throw AssemblyError.verificationFailed("Contents/Resources has no \(BundleManifest.fileName)")
+            }
+        } catch let error as AssemblyError {
+            throw error
+        } catch {
+            throw AssemblyError.verificationFailed(error.localizedDescription)
+        }
+    }
+
+    /// Name of the bundled x-containerfy.license file in Resources/.
+    static let licenseFileName = "LICENSE.txt"
+
+    /// Name of the bundled app icon in Resources/.
+    static let iconFileName = "AppIcon.icns"
+
+    /// Directory in Resources/ holding each x-containerfy.volumes seed, one subdirectory per volume.
+    static let volumeSeedsDirectory = "volume-seeds"
+
+    /// The layout `assemble` writes for `config`, so `pack --dry-run` can describe a bundle
+    /// without building it.
+    static func plannedLayout(config: ComposeConfig, hasCACertificates: Bool) -> BundleLayout {
+        BundleLayout(
+            schemaVersion: BundleLayout.currentSchemaVersion,
+            compose: BundleLayout.composeFileName,
+            runtime: config.composePath != nil ? RuntimeConfig.fileName : nil,
+            envFiles: config.envFiles.map { ($0 as NSString).lastPathComponent },
+            labels: config.labels.isEmpty ? nil : "labels.json",
+            caCertificates: hasCACertificates ? CACertificates.bundleDirectory : nil,
+            license: config.license != nil ? licenseFileName : nil,
+            icon: config.icon != nil ? iconFileName : nil,
+            volumeSeeds: config.volumeSeeds.isEmpty ? nil : volumeSeedsDirectory,
+            installedPaths: InstalledPaths.fileName,
+            manifest: BundleManifest.fileName
+        )
+    }
+
+    /// Top-level entries `assemble` writes to Resources/ for `config`; directories end in "/".
+    static func plannedResources(config: ComposeConfig, hasCACertificates: Bool) -> [String] {
+        let layout = plannedLayout(config: config, hasCACertificates: hasCACertificates)
+        var names = [layout.compose]
+        if let runtime = layout.runtime { names.append(runtime) }
+        names += [BundleLayout.fileName, layout.installedPaths, layout.manifest].compactMap { $0 }
+        names += layout.envFiles
+        for file in config.bundledFiles {
+            let dir = file.bundlePath.split(separator: "/").first.map { String($0) + "/" } ?? file.bundlePath
+            if !names.contains(dir) { names.append(dir) }
+        }
+        names += [layout.labels, layout.license, layout.icon].compactMap { $0 }
+        names += [layout.caCertificates, layout.volumeSeeds].compactMap { $0 }.map { $0 + "/" }
+        return names
+    }
+
+    // MARK: - Icon
+
+    /// Smallest icon pack accepts; macOS draws the largest slot (512pt @2x) from 1024 pixels.
+    static let minimumIconPixels = 512
+    static let recommendedIconPixels = 1024
+
+    /// Pixel size of each .icns element type that holds a square image.
+    private static let icnsPixelSizes: [String: Int] = [
+        "ic10": 1024, "ic09": 512, "ic14": 512, "ic08": 256, "ic13": 256, "ic07": 128, "it32": 128,
+        "ic12": 64, "icp6": 64, "ih32": 48, "ic11": 32, "icp5": 32, "il32": 32, "ic05": 32,
+        "icp4": 16, "is32": 16, "ic04": 16,
+    ]
+
+    /// Width and height of a PNG (from its IHDR chunk) or of the largest image in an .icns,
+    /// or nil if the file is neither.
+    static func iconPixelSize(atPath path: String) -> (width: Int, height: Int)? {
+        guard let data = FileManager.default.contents(atPath: path) else { return nil }
+        let bytes = [UInt8](data)
+        func uint32(at offset: Int) -> Int {
+            bytes[offset..<offset + 4].reduce(0) { $0 << 8 | Int($1) }
+        }
+
+        let pngSignature: [UInt8] = [0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A]
+        if bytes.count >= 24, bytes.starts(with: pngSignature), String(decoding: bytes[12..<16], as: UTF8.self) == "IHDR" {
+            return (uint32(at: 16), uint32(at: 20))
+        }
+
+        guard bytes.count >= 8, String(decoding: bytes[0..<4], as: UTF8.self) == "icns" else { return nil }
+        var largest = 0
+        var offset = 8
+        while offset + 8 <= bytes.count {
+            largest = max(largest, icnsPixelSizes[String(decoding: bytes[offset..<offset + 4], as: UTF8.self)] ?? 0)
+            let length = uint32(at: offset + 4)
+            guard length >= 8 else { break }
+            offset += length
+        }
+        return largest > 0 ? (largest, largest) : nil
+    }
+
+    /// Copies an .icns icon to `destination`, or builds one from a PNG: `sips` renders each
+    /// size of an .iconset, staged in `tempDir`, and `iconutil` packs it. The PNG should be at
+    /// least 1024x1024.
+    static func installIcon(
+        from source: String, to destination: String, tempDir: String = NSTemporaryDirectory(), shell: ShellExecutor = SystemShellExecutor()
+    ) throws {
+        let fm = FileManager.default
+        if (source as NSString).pathExtension.lowercased() == "icns" {
+            try fm.copyItem(atPath: source, toPath: destination)
+            return
+        }
+
+        let iconset = (tempDir as NSString).appendingPathComponent("containerfy-icon-\(ProcessInfo.processInfo.globallyUniqueString).iconset")
+        try fm.createDirectory(atPath: iconset, withIntermediateDirectories: true)
+        InterruptCleanup.shared.track(iconset)
+        defer {
+            InterruptCleanup.shared.untrack(iconset)
+            try? fm.removeItem(atPath: iconset)
+        }
+
+        for size in [16, 32, 128, 256, 512] {
+            for scale in [1, 2] {
+                let pixels = "\(size * scale)"
+                let name = scale == 1 ? "icon_\(size)x\(size).png" : "icon_\(size)x\(size)@2x.png"
+                let result = try shell.run(
+                    executable: "/usr/bin/sips",
+                    arguments: ["-s", "format", "png", "-z", pixels, pixels, source, "--out", (iconset as NSString).appendingPathComponent(name)]
+                )
+                guard result.exitCode == 0 else {
+                    throw AssemblyError.writeFailed("could not convert icon \(source): \(result.stderr)")
+                }
+            }
+        }
+
+        let result = try shell.run(executable: "/usr/bin/iconutil", arguments: ["-c", "icns", iconset, "-o", destination])
+        guard result.exitCode == 0 else {
+            throw AssemblyError.writeFailed("iconutil could not build \(destination): \(result.stderr)")
+        }
+    }
+
+    // MARK: - Reproducibility
+
+    /// The modification time given to every bundled file: `SOURCE_DATE_EPOCH` if set (the
+    /// reproducible-builds.org convention), otherwise the Unix epoch.
+    static func sourceDate(environment: [String: String] = ProcessInfo.processInfo.environment) -> Date {
+        let seconds = environment["SOURCE_DATE_EPOCH"].flatMap(TimeInterval.init) ?? 0
+        return Date(timeIntervalSince1970: seconds)
+    }
+
+    /// Sets the modification time of `path` and everything under it to `date`, so two builds
+    /// of the same inputs differ in neither content nor metadata. Symlinks are left alone.
+    static func normalizeTimestamps(under path: String, to date: Date) throws {
+        let fm = FileManager.default
+        let entries = (fm.enumerator(atPath: path)?.compactMap { $0 as? String } ?? [])
+            .map { (path as NSString).appendingPathComponent($0) }
+        for entry in entries + [path] {
+            guard try fm.attributesOfItem(atPath: entry)[.type] as? FileAttributeType != .typeSymbolicLink else { continue }
+            try fm.setAttributes([.modificationDate: date], ofItemAtPath: entry)
+        }
+    }
+
+    // MARK: - Size Budget
+
+    /// Throws `overBudget` if the file or directory at `path` is larger than `maxMB`.
+    static func checkSizeBudget(path: String, maxMB: Int) throws {
+        let files = fileSizes(under: path)
+        let total = files.reduce(UInt64(0)) { $0 + $1.bytes }
+        guard total > UInt64(maxMB) * 1024 * 1024 else { return }
+        let largest = Array(files.sorted { $0.bytes > $1.bytes }.prefix(5))
+        throw AssemblyError.overBudget(path: path, bytes: total, budgetMB: maxMB, largest: largest)
+    }
+
+    /// Sizes of the regular files under `path`, relative to it. A plain file yields itself.
+    static func fileSizes(under path: String) -> [(path: String, bytes: UInt64)] {
+        let fm = FileManager.default
+        var isDir: ObjCBool = false
+        guard fm.fileExists(atPath: path, isDirectory: &isDir) else { return [] }
+
+        if !isDir.boolValue {
+            let size = (try? fm.attributesOfItem(atPath: path)[.size] as? NSNumber)?.uint64Value ?? 0
+            return [((path as NSString).lastPathComponent, size)]
+        }
+
+        var result: [(path: String, bytes: UInt64)] = []
+        guard let enumerator = fm.enumerator(atPath: path) else { return [] }
+        for case let rel as String in enumerator {
+            let full = (path as NSString).appendingPathComponent(rel)
+            guard let attrs = try? fm.attributesOfItem(atPath: full),
+                  attrs[.type] as? FileAttributeType == .typeRegular,
+                  let size = attrs[.size] as? NSNumber else { continue }
+            result.append((rel, size.uint64Value))
+        }
+        return result
+    }
+
+    // MARK: - Free Space
+
+    /// Kept free on top of the estimate: PNG icons grow when converted to .icns, and Info.plist,
+    /// manifests and signatures are written too.
+    static let freeSpaceHeadroomBytes: UInt64 = 64 * 1024 * 1024
+
+    /// Rough size of the .app: the binaries plus every file copied into Resources.
+    static func estimatedAppBytes(config: ComposeConfig, binaries: [String]) -> UInt64 {
+        let inputs = binaries + [config.composePath, config.icon, config.license].compactMap { $0 }
+            + config.envFiles + config.bundledFiles.map(\.source) + config.volumeSeeds.map(\.source)
+        return inputs.flatMap { fileSizes(under: $0) }.reduce(0) { $0 + $1.bytes }
+    }
+
+    /// Space `pack` needs, by location. The .app, and a .dmg no larger than it, are written next to
+    /// the output; a .dmg is first staged as a copy of the .app in the temporary directory.
+    static func spaceNeeded(appBytes: UInt64, outputDir: String, tempDir: String, dmg: Bool) -> [(path: String, bytes: UInt64)] {
+        var needed = [(path: outputDir, bytes: (dmg ? 2 : 1) * appBytes + freeSpaceHeadroomBytes)]
+        if dmg {
+            needed.append((path: tempDir, bytes: appBytes + freeSpaceHeadroomBytes))
+        }
+        return needed
+    }
+
+    /// Throws `insufficientSpace` for the first location without room. Locations whose free space
+    /// can't be read are skipped rather than failing the build.
+    static func checkFreeSpace(_ needed: [(path: String, bytes: UInt64)], available: (String) -> Int64? = BundleAssembler.freeBytes(at:)) throws {
+        for (path, bytes) in needed {
+            guard let free = available(path), free >= 0 else { continue }
+            if UInt64(free) < bytes {
+                throw AssemblyError.insufficientSpace(path: path, neededBytes: bytes, freeBytes: UInt64(free))
+            }
+        }
+    }
+
+    /// Space available for new files on the volume holding `path`, or its nearest existing
+    /// parent, since the output directory may not exist yet.
+    static func freeBytes(at path: String) -> Int64? {
+        var existing = (path as NSString).isAbsolutePath ? path : FileManager.default.currentDirectoryPath + "/" + path
+        while !FileManager.default.fileExists(atPath: existing), existing != "/" {
+            existing = (existing as NSString).deletingLastPathComponent
+        }
+        let values = try? URL(fileURLWithPath: existing).resourceValues(forKeys: [.volumeAvailableCapacityForImportantUsageKey])
+        return values?.volumeAvailableCapacityForImportantUsage
+    }
+
+    /// Non-fatal assembly problems go to stderr, so `pack --json` output stays parseable.
+    private static func warn(_ message: String) {
+        FileHandle.standardError.write("  Warning: \(message)\n".data(using: .utf8)!)
+    }
+
+    private static func formatMB(_ bytes: UInt64) -> String {
+        String(format: "%.1f", Double(bytes) / 1024 / 1024)
     }
 
     // MARK: - Ad-hoc Signing
@@ -133,7 +671,7 @@ enum BundleAssembler {
             arguments: ["--force", "--sign", "-", appPath]
         )
         if result.exitCode != 0 {
-            print("  Warning: Ad-hoc signing failed: \(result.stderr)")
+            warn("Ad-hoc signing failed: \(result.stderr)")
         }
     }
 
@@ -143,30 +681,15 @@ enum BundleAssembler {
             arguments: ["--force", "--sign", "-", path]
         )
         if result.exitCode != 0 {
-            print("  Warning: Ad-hoc signing of \(path) failed: \(result.stderr)")
+            warn("Ad-hoc signing of \(path) failed: \(result.stderr)")
         }
     }
 
     // MARK: - vfkit Signing
 
-    static func signVFKit(path: String, shell: ShellExecutor = SystemShellExecutor()) throws {
-        let entitlementsPlist = """
-        <?xml version="1.0" encoding="UTF-8"?>
-        <!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" \
-        "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
-        <plist version="1.0">
-        <dict>
-            <key>com.apple.security.virtualization</key>
-            <true/>
-            <key>com.apple.security.network.server</key>
-            <true/>
-            <key>com.apple.security.network.client</key>
-            <true/>
-        </dict>
-        </plist>
-        """
-
-        let tmpEntitlements = NSTemporaryDirectory() + "vfkit-entitlements-\(ProcessInfo.processInfo.globallyUniqueString).plist"
+    static func signVFKit(path: String, tempDir: String = NSTemporaryDirectory(), shell: ShellExecutor = SystemShellExecutor()) throws {
+        let entitlementsPlist = generateEntitlementsPlist()
+        let tmpEntitlements = (tempDir as NSString).appendingPathComponent("vfkit-entitlements-\(ProcessInfo.processInfo.globallyUniqueString).plist")
         try entitlementsPlist.write(toFile: tmpEntitlements, atomically: true, encoding: .utf8)
         defer { try? FileManager.default.removeItem(atPath: tmpEntitlements) }
 
@@ -175,20 +698,102 @@ enum BundleAssembler {
             arguments: ["--force", "--sign", "-", "--entitlements", tmpEntitlements, path]
         )
         if result.exitCode != 0 {
-            print("  Warning: vfkit signing failed: \(result.stderr)")
+            warn("vfkit signing failed: \(result.stderr)")
         }
     }
 
+    // MARK: - Entitlements
+
+    /// Hardened-runtime entitlements for packed apps. `codesign --deep` applies them to every
+    /// nested binary too, so they cover what vfkit needs to boot the VM.
+    static func generateEntitlementsPlist() -> String {
+        """
+        <?xml version="1.0" encoding="UTF-8"?>
+        <!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+        <plist version="1.0">
+        <!--
+        	Generated by containerfy pack. Replace with pack --entitlements <path>.
+        	com.apple.security.virtualization  vfkit runs the VM with Virtualization.framework
+        	com.apple.security.hypervisor      hypervisor access for the VM
+        	com.apple.security.network.server  gvproxy listens on the forwarded host ports
+        	com.apple.security.network.client  podman talks to the VM over its socket
+        	No JIT or unsigned-executable-memory entitlements: the bundled binaries don't need them.
+        -->
+        <dict>
+        	<key>com.apple.security.virtualization</key>
+        	<true/>
+        	<key>com.apple.security.hypervisor</key>
+        	<true/>
+        	<key>com.apple.security.network.server</key>
+        	<true/>
+        	<key>com.apple.security.network.client</key>
+        	<true/>
+        </dict>
+        </plist>
+        """
+    }
+
     // MARK: - Info.plist Generation
 
-    private static func generateInfoPlist(config: ComposeConfig) -> String {
+    /// LSMinimumSystemVersion of packed apps (Virtualization.framework features the VM relies on).
+    static let minimumSystemVersion = "14.0"
+
+    /// Info.plist key holding the SHA-256 of `Resources/docker-compose.yml` at pack time.
+    static let composeDigestKey = "ContainerfyComposeSHA256"
+
+    /// Info.plist key holding the SHA-256 over the bundled compose file and env files at pack time.
+    static let configDigestKey = "ContainerfyConfigSHA256"
+
+    /// Info.plist key holding the version of containerfy that packed the bundle.
+    static let builderVersionKey = "ContainerfyBuilderVersion"
+
+    /// CFBundleIdentifier. parseBuild has already validated (and if needed converted) the identifier.
+    static func bundleIdentifier(config: ComposeConfig) -> String {
+        config.identifier ?? "com.containerfy.\(config.name ?? "Containerfy")"
+    }
+
+    static func generateInfoPlist(config: ComposeConfig, composeSHA256: String?, configSHA256: String? = nil, iconFile: String?) -> String {
         let name = config.name ?? "Containerfy"
         let version = config.version ?? "1.0.0"
         let displayName = config.displayName ?? titleCase(name)
 
-        var bundleID = config.identifier ?? "com.containerfy.\(name)"
-        if !bundleID.contains(".") {
-            bundleID = bundleID.replacingOccurrences(of: "/", with: ".")
+        let bundleID = bundleIdentifier(config: config)
+
+        var digestEntry = ""
+        if let composeSHA256 {
+            digestEntry = "\n\t<key>\(composeDigestKey)</key>\n\t<string>\(composeSHA256)</string>"
+        }
+        if let configSHA256 {
+            digestEntry += "\n\t<key>\(configDigestKey)</key>\n\t<string>\(configSHA256)</string>"
+        }
+
+        // Without LSUIElement the app gets a Dock icon and shows in the app switcher
+        let backgroundEntry = config.runsInBackground ? "\n\t<key>LSUIElement</key>\n\t<true/>" : ""
+
+        var categoryEntry = ""
+        if let category = config.category {
+            categoryEntry = "\n\t<key>LSApplicationCategoryType</key>\n\t<string>\(category)</string>"
+        }
+
+        // x-containerfy.plist entries; parseBuild has already dropped keys written here
+        let extraEntries = config.infoPlistExtras.sorted { $0.key < $1.key }
+            .map { "\n\t<key>\(PlistValue.escape($0.key))</key>\n" + $0.value.xml(indent: "\t") }
+            .joined()
+
+        var updateEntry = ""
+        if let feed = config.updateFeed {
+            updateEntry = "\n\t<key>SUFeedURL</key>\n\t<string>\(PlistValue.escape(feed.feedURL))</string>"
+                + "\n\t<key>SUPublicEDKey</key>\n\t<string>\(PlistValue.escape(feed.publicEDKey))</string>"
+        }
+
+        // Finder's Get Info shows this, so it points at the bundled license when there is one
+        let copyright = config.license == nil
+            ? "Built with Containerfy"
+            : "Licensed under the terms in Contents/Resources/\(licenseFileName)"
+
+        var iconEntry = ""
+        if let iconFile {
+            iconEntry = "\n\t<key>CFBundleIconFile</key>\n\t<string>\((iconFile as NSString).deletingPathExtension)</string>"
         }
 
         return """
@@ -205,19 +810,19 @@ enum BundleAssembler {
         \t<key>CFBundleExecutable</key>
         \t<string>Containerfy</string>
         \t<key>CFBundleVersion</key>
-        \t<string>\(version)</string>
+        \t<string>\(config.buildNumber ?? version)</string>
         \t<key>CFBundleShortVersionString</key>
         \t<string>\(version)</string>
         \t<key>CFBundlePackageType</key>
         \t<string>APPL</string>
         \t<key>CFBundleInfoDictionaryVersion</key>
-        \t<string>6.0</string>
-        \t<key>LSUIElement</key>
-        \t<true/>
+        \t<string>6.0</string>\(backgroundEntry)
         \t<key>LSMinimumSystemVersion</key>
-        \t<string>14.0</string>
+        \t<string>\(config.minimumMacOS ?? minimumSystemVersion)</string>\(categoryEntry)
         \t<key>NSHumanReadableCopyright</key>
-        \t<string>Built with Containerfy</string>
+        \t<string>\(copyright)</string>
+        \t<key>\(builderVersionKey)</key>
+        \t<string>\(ContainerfyVersion.current)</string>\(iconEntry)\(updateEntry)\(digestEntry)\(extraEntries)
         </dict>
         </plist>
         """
@@ -0,0 +1,92 @@
+import Foundation
+
+/// `Resources/layout.json`, written by `pack`: where each kind of bundled resource lives,
+/// relative to `Contents/Resources`. The runtime and `verify` read file locations from here
+/// instead of hardcoding names, so the on-disk layout can change without breaking the contract.
+struct BundleLayout: Codable, Equatable, Sendable {
+
+    enum LayoutError: LocalizedError {
+        case unreadable(String)
+        case unsupportedSchema(Int)
+
+        var errorDescription: String? {
+            switch self {
+            case .unreadable(let path):
+                return "\(path) is not a valid bundle layout manifest"
+            case .unsupportedSchema(let version):
+                return "bundle layout schema \(version) is newer than this containerfy supports (\(BundleLayout.currentSchemaVersion)) — upgrade containerfy"
+            }
+        }
+    }
+
+    /// Bump when a role is renamed or its meaning changes. Adding an optional role doesn't need a bump.
+    static let currentSchemaVersion = 1
+    static let fileName = "layout.json"
+    /// Name of the bundled compose file; every layout so far uses it.
+    static let composeFileName = "docker-compose.yml"
+
+    var schemaVersion: Int
+    var compose: String
+    /// Pre-parsed runtime contract (see RuntimeConfig); nil for bundles that predate it.
+    var runtime: String?
+    var envFiles: [String]
+    var labels: String?
+    var caCertificates: String?
+    var license: String?
+    var icon: String?
+    /// Directory holding one seed directory per seeded named volume; nil when there are none.
+    var volumeSeeds: String?
+    /// What the app creates outside the bundle (see InstalledPaths); nil for bundles that predate it.
+    var installedPaths: String?
+    /// Per-file digests of Resources (see BundleManifest); nil for bundles that predate it.
+    var manifest: String?
+
+    enum CodingKeys: String, CodingKey {
+        case schemaVersion = "schema_version"
+        case compose
+        case runtime
+        case envFiles = "env_files"
+        case labels
+        case caCertificates = "ca_certificates"
+        case license
+        case icon
+        case volumeSeeds = "volume_seeds"
+        case installedPaths = "installed_paths"
+        case manifest
+    }
+
+    /// Layout of bundles packed before layout.json existed.
+    static let legacy = BundleLayout(
+        schemaVersion: currentSchemaVersion,
+        compose: composeFileName,
+        runtime: nil,
+        envFiles: [],
+        labels: nil,
+        caCertificates: CACertificates.bundleDirectory,
+        license: nil,
+        icon: nil,
+        volumeSeeds: nil,
+        installedPaths: nil,
+        manifest: nil
+    )
+
+    /// Reads `layout.json` from a Resources directory. A missing manifest means a legacy bundle.
+    static func load(resourcesPath: String) throws -> BundleLayout {
+        let path = (resourcesPath as NSString).appendingPathComponent(fileName)
+        guard let data = FileManager.default.contents(atPath: path) else { return .legacy }
+        guard let layout = try? JSONDecoder().decode(BundleLayout.self, from: data) else {
+            throw LayoutError.unreadable(path)
+        }
+        guard layout.schemaVersion <= currentSchemaVersion else {
+            throw LayoutError.unsupportedSchema(layout.schemaVersion)
+        }
+        return layout
+    }
+
+    func write(toResourcesPath resourcesPath: String) throws {
+        let encoder = JSONEncoder()
+        encoder.outputFormatting = [.prettyPrinted, .sortedKeys]
+        let path = (resourcesPath as NSString).appendingPathComponent(Self.fileName)
+        try encoder.encode(self).write(to: URL(fileURLWithPath: path))
+    }
+}
@@ -0,0 +1,102 @@
+import Foundation
+
+/// `Resources/manifest.json`, written last by `pack`: the SHA-256 and size of every file under
+/// `Contents/Resources`, sorted by path, so the same inputs always produce the same manifest.
+/// `verify` re-hashes the files to detect tampering with any bundled resource, not just the
+/// compose file. Binaries in `Contents/MacOS` are left out — signing rewrites them after
+/// assembly, and their code signature already covers them.
+struct BundleManifest: Codable, Equatable, Sendable {
+
+    enum ManifestError: LocalizedError {
+        case unreadable(String)
+        case unsupportedSchema(Int)
+        case missingFile(String)
+        case modifiedFile(path: String, expected: String, actual: String)
+        case unexpectedFile(String)
+
+        var errorDescription: String? {
+            switch self {
+            case .unreadable(let path):
+                return "\(path) is not a valid bundle manifest"
+            case .unsupportedSchema(let version):
+                return "bundle manifest schema \(version) is newer than this containerfy supports (\(BundleManifest.currentSchemaVersion)) — upgrade containerfy"
+            case .missingFile(let path):
+                return "\(path) is listed in \(BundleManifest.fileName) but missing from the bundle"
+            case .modifiedFile(let path, let expected, let actual):
+                return "\(path) does not match the pack-time digest (expected \(expected), found \(actual)) — the bundle was modified or corrupted"
+            case .unexpectedFile(let path):
+                return "\(path) is not listed in \(BundleManifest.fileName) — it was added after pack"
+            }
+        }
+    }
+
+    static let currentSchemaVersion = 1
+    static let fileName = "manifest.json"
+
+    struct Entry: Codable, Equatable, Sendable {
+        /// Relative to `Contents/Resources`.
+        var path: String
+        var sha256: String
+        var size: UInt64
+    }
+
+    var schemaVersion: Int
+    var files: [Entry]
+
+    enum CodingKeys: String, CodingKey {
+        case schemaVersion = "schema_version"
+        case files
+    }
+
+    /// Hashes every regular file under `resourcesPath` except the manifest itself.
+    static func generate(resourcesPath: String) throws -> BundleManifest {
+        let files = try BundleAssembler.fileSizes(under: resourcesPath)
+            .filter { $0.path != fileName }
+            .sorted { $0.path < $1.path }
+            .map { file in
+                Entry(
+                    path: file.path,
+                    sha256: try Checksum.sha256(ofFile: (resourcesPath as NSString).appendingPathComponent(file.path)),
+                    size: file.bytes
+                )
+            }
+        return BundleManifest(schemaVersion: currentSchemaVersion, files: files)
+    }
+
+    static func load(path: String) throws -> BundleManifest {
+        guard let data = FileManager.default.contents(atPath: path),
+              let manifest = try? JSONDecoder().decode(BundleManifest.self, from: data) else {
+            throw ManifestError.unreadable(path)
+        }
+        guard manifest.schemaVersion <= currentSchemaVersion else {
+            throw ManifestError.unsupportedSchema(manifest.schemaVersion)
+        }
+        return manifest
+    }
+
+    func write(toResourcesPath resourcesPath: String) throws {
+        let encoder = JSONEncoder()
+        encoder.outputFormatting = [.prettyPrinted, .sortedKeys]
+        let path = (resourcesPath as NSString).appendingPathComponent(Self.fileName)
+        try encoder.encode(self).write(to: URL(fileURLWithPath: path))
+    }
+
+    /// Re-hashes the files under `resourcesPath` and throws on the first one that is missing,
+    /// modified, or not listed.
+    func verify(resourcesPath: String) throws {
+        let fm = FileManager.default
+        for entry in files {
+            let full = (resourcesPath as NSString).appendingPathComponent(entry.path)
+            guard fm.fileExists(atPath: full) else { throw ManifestError.missingFile(entry.path) }
+            let actual = try Checksum.sha256(ofFile: full)
+            guard actual.caseInsensitiveCompare(entry.sha256) == .orderedSame else {
+                throw ManifestError.modifiedFile(path: entry.path, expected: entry.sha256, actual: actual)
+            }
+        }
+        let listed = Set(files.map(\.path))
+        let onDisk = BundleAssembler.fileSizes(under: resourcesPath).map(\.path).filter { $0 != Self.fileName }
+        if let extra = onDisk.sorted().first(where: { !listed.contains($0) }) {
+            throw ManifestError.unexpectedFile(extra)
+        }
+    }
+}
@@ -0,0 +1,83 @@
+import CryptoKit
+import Foundation
+import Security
+
+/// Private CA certificates passed with `pack --ca-cert`, bundled into the .app and
+/// installed into the VM's trust store each time the machine starts.
+enum CACertificates {
+
+    struct Certificate: Sendable {
+        /// File the certificate was read from.
+        let source: String
+        let der: Data
+
+        /// SHA-256 over the DER encoding, as colon-separated uppercase hex (the form `openssl x509 -fingerprint` prints).
+        var fingerprint: String {
+            SHA256.hash(data: der).map { String(format: "%02X", $0) }.joined(separator: ":")
+        }
+
+        /// Bundle file name, derived from the fingerprint so repeated certs collapse to one file.
+        var fileName: String {
+            let hex = SHA256.hash(data: der).map { String(format: "%02x", $0) }.joined()
+            return "\(hex.prefix(16)).pem"
+        }
+
+        var pem: String {
+            let body = der.base64EncodedString(options: [.lineLength64Characters, .endLineWithLineFeed])
+            return "-----BEGIN CERTIFICATE-----\n\(body)\n-----END CERTIFICATE-----\n"
+        }
+    }
+
+    enum CertificateError: LocalizedError {
+        case unreadable(String)
+        case noCertificates(String)
+        case invalid(String, Int)
+
+        var errorDescription: String? {
+            switch self {
+            case .unreadable(let path): return "CA certificate \(path) could not be read"
+            case .noCertificates(let path): return "CA certificate \(path) contains no PEM certificate blocks"
+            case .invalid(let path, let index): return "CA certificate \(path): block \(index) is not a valid X.509 certificate"
+            }
+        }
+    }
+
+    /// Resources subdirectory holding the bundled certificates.
+    static let bundleDirectory = "ca-certificates"
+
+    /// Trust anchor directory inside the Fedora CoreOS VM.
+    static let vmAnchorDirectory = "/etc/pki/ca-trust/source/anchors"
+
+    /// Reads every `BEGIN CERTIFICATE` block in a PEM file and checks each parses as X.509.
+    static func load(path: String) throws -> [Certificate] {
+        guard let data = FileManager.default.contents(atPath: path),
+              let text = String(data: data, encoding: .utf8) else {
+            throw CertificateError.unreadable(path)
+        }
+
+        let begin = "-----BEGIN CERTIFICATE-----"
+        let end = "-----END CERTIFICATE-----"
+        var certificates: [Certificate] = []
+        var remainder = text[...]
+        while let start = remainder.range(of: begin), let stop = remainder.range(of: end, range: start.upperBound..<remainder.endIndex) {
+            let body = remainder[start.upperBound..<stop.lowerBound]
+            guard let der = Data(base64Encoded: String(body), options: .ignoreUnknownCharacters),
+                  SecCertificateCreateWithData(nil, der as CFData) != nil else {
+                throw CertificateError.invalid(path, certificates.count + 1)
+            }
+            certificates.append(Certificate(source: path, der: der))
+            remainder = remainder[stop.upperBound...]
+        }
+
+        guard !certificates.isEmpty else { throw CertificateError.noCertificates(path) }
+        return certificates
+    }
+
+    /// Shell command run over `podman machine ssh` to install one PEM as a trust anchor.
+    /// The PEM travels base64-encoded inside the command, so nothing has to be piped to ssh.
+    static func installCommand(pem: String, fileName: String) -> String {
+        let encoded = Data(pem.utf8).base64EncodedString()
+        let target = "\(vmAnchorDirectory)/containerfy-\(fileName)"
+        return "echo \(encoded) | base64 -d | sudo tee \(target) > /dev/null && sudo update-ca-trust"
+    }
+}
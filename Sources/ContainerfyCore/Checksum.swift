@@ -0,0 +1,86 @@
+import CryptoKit
+import Foundation
+
+/// SHA-256 checksums for distributable artifacts, written as `<artifact>.sha256` sidecars
+/// in the `<hash>  <filename>` format understood by `shasum -a 256 -c`.
+enum Checksum {
+
+    /// Hex SHA-256 of a file, or of a directory's sorted contents (for `.app` bundles).
+    static func sha256(atPath path: String) throws -> String {
+        var isDir: ObjCBool = false
+        guard FileManager.default.fileExists(atPath: path, isDirectory: &isDir) else {
+            throw CocoaError(.fileNoSuchFile, userInfo: [NSFilePathErrorKey: path])
+        }
+        return isDir.boolValue ? try sha256(ofDirectory: path) : try sha256(ofFile: path)
+    }
+
+    /// Writes `<path>.sha256` next to the artifact and returns the sidecar path.
+    @discardableResult
+    static func writeSidecar(for path: String) throws -> String {
+        let hash = try sha256(atPath: path)
+        let fileName = (path as NSString).lastPathComponent
+        let sidecar = path + ".sha256"
+        try "\(hash)  \(fileName)\n".write(toFile: sidecar, atomically: true, encoding: .utf8)
+        return sidecar
+    }
+
+    // MARK: - Hashing
+
+    /// Streams the file through SHA-256 so large DMGs aren't loaded into memory.
+    static func sha256(ofFile path: String) throws -> String {
+        guard let handle = FileHandle(forReadingAtPath: path) else {
+            throw CocoaError(.fileReadNoPermission, userInfo: [NSFilePathErrorKey: path])
+        }
+        defer { try? handle.close() }
+
+        var hasher = SHA256()
+        while let chunk = try handle.read(upToCount: 1 << 20), !chunk.isEmpty {
+            hasher.update(data: chunk)
+        }
+        return hex(hasher.finalize())
+    }
+
+    /// Hashes every entry under `dir` in sorted path order, so the result only depends on
+    /// relative paths, file contents, and symlink targets — not on timestamps or traversal order.
+    static func sha256(ofDirectory dir: String) throws -> String {
+        let fm = FileManager.default
+        guard let enumerator = fm.enumerator(atPath: dir) else {
+            throw CocoaError(.fileReadUnknown, userInfo: [NSFilePathErrorKey: dir])
+        }
+        let entries = enumerator.compactMap { $0 as? String }.sorted()
+
+        var hasher = SHA256()
+        for rel in entries {
+            let full = (dir as NSString).appendingPathComponent(rel)
+            let attrs = try fm.attributesOfItem(atPath: full)
+            let line: String
+            switch attrs[.type] as? FileAttributeType {
+            case .typeRegular?:
+                line = "f \(rel) \(try sha256(ofFile: full))"
+            case .typeSymbolicLink?:
+                line = "l \(rel) \(try fm.destinationOfSymbolicLink(atPath: full))"
+            case .typeDirectory?:
+                line = "d \(rel)"
+            default:
+                continue
+            }
+            hasher.update(data: Data((line + "\n").utf8))
+        }
+        return hex(hasher.finalize())
+    }
+
+    /// Hashes the named files under `dir` in the given order as `<name> <sha256>` lines, so the
+    /// result changes when any file's name or contents change but not with timestamps.
+    static func sha256(ofFiles names: [String], in dir: String) throws -> String {
+        var hasher = SHA256()
+        for name in names {
+            let line = "\(name) \(try sha256(ofFile: (dir as NSString).appendingPathComponent(name)))"
+            hasher.update(data: Data((line + "\n").utf8))
+        }
+        return hex(hasher.finalize())
+    }
+
+    private static func hex(_ digest: SHA256.Digest) -> String {
+        digest.map { String(format: "%02x", $0) }.joined()
+    }
+}
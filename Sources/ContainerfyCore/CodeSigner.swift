@@ -6,9 +6,12 @@ import Foundation
 struct CodeSigner {
 
     let shell: ShellExecutor
+    /// Where entitlements and .dmg staging go (`pack --tmpdir`).
+    let tempDir: String
 
-    init(shell: ShellExecutor = SystemShellExecutor()) {
+    init(shell: ShellExecutor = SystemShellExecutor(), tempDir: String = NSTemporaryDirectory()) {
         self.shell = shell
+        self.tempDir = tempDir
     }
 
     enum SigningError: LocalizedError {
@@ -21,47 +24,54 @@ struct CodeSigner {
         }
     }
 
+    /// How `notarytool` authenticates.
+    enum NotaryCredentials: Equatable, Sendable {
+        /// A profile saved with `xcrun notarytool store-credentials`.
+        case keychainProfile(String)
+        /// An Apple ID, its team, and an app-specific password.
+        case appleID(String, teamID: String, password: String)
+
+        var notarytoolArguments: [String] {
+            switch self {
+            case .keychainProfile(let profile):
+                return ["--keychain-profile", profile]
+            case .appleID(let appleID, let teamID, let password):
+                return ["--apple-id", appleID, "--team-id", teamID, "--password", password]
+            }
+        }
+    }
+
+    /// The parts of `notarytool submit --output-format json` that pack uses.
+    struct NotarySubmission: Decodable, Equatable {
+        let id: String?
+        let status: String?
+        let message: String?
+    }
+
     /// Full signing + packaging pipeline. Returns path to the notarized DMG.
+    /// `identity` (hash or certificate name) skips the interactive prompt; `requireStaple`
+    /// makes a stapling failure fatal instead of a warning. `entitlements` is passed to `signApp`.
     func signAndPackage(
         appPath: String,
         appName: String,
         outputDir: String,
-        keychainProfile: String,
+        notary: NotaryCredentials,
+        volumeName: String? = nil,
+        identity preferredIdentity: String? = nil,
+        entitlements: String? = nil,
+        requireStaple: Bool = false,
         onProgress: (String) -> Void
     ) throws -> String {
         // 1. Resolve signing identity
         onProgress("Resolving signing identity...")
-        let identity = try resolveIdentity()
+        let identity = try resolveIdentity(preferred: preferredIdentity)
 
-        // 2. Sign .app
-        onProgress("Signing \(appName).app...")
-        let entitlements = "Resources/Entitlements.plist"
-        var codesignArgs = ["--force", "--sign", identity, "--options", "runtime", "--timestamp", "--deep"]
-        if FileManager.default.fileExists(atPath: entitlements) {
-            codesignArgs += ["--entitlements", entitlements]
-        }
-        codesignArgs.append(appPath)
-        let signResult = try shell.run(executable: "/usr/bin/codesign", arguments: codesignArgs)
-        guard signResult.exitCode == 0 else { throw SigningError.failed("codesign failed: \(signResult.stderr)") }
-
-        // 3. Verify
-        onProgress("Verifying signature...")
-        let verifyResult = try shell.run(executable: "/usr/bin/codesign", arguments: ["--verify", "--deep", "--strict", appPath])
-        guard verifyResult.exitCode == 0 else { throw SigningError.failed("Verification failed: \(verifyResult.stderr)") }
+        // 2-3. Sign and verify .app
+        try signApp(appPath: appPath, identity: identity, entitlements: entitlements, onProgress: onProgress)
 
         // 4. Create DMG
         onProgress("Creating DMG...")
-        let stagingDir = NSTemporaryDirectory() + "containerfy-dmg-\(ProcessInfo.processInfo.globallyUniqueString)"
-        let fm = FileManager.default
-        try fm.createDirectory(atPath: stagingDir, withIntermediateDirectories: true)
-        defer { try? fm.removeItem(atPath: stagingDir) }
-        try fm.copyItem(atPath: appPath, toPath: (stagingDir as NSString).appendingPathComponent((appPath as NSString).lastPathComponent))
-        try fm.createSymbolicLink(atPath: (stagingDir as NSString).appendingPathComponent("Applications"), withDestinationPath: "/Applications")
-
-        let dmgPath = (outputDir as NSString).appendingPathComponent("\(appName).dmg")
-        if fm.fileExists(atPath: dmgPath) { try fm.removeItem(atPath: dmgPath) }
-        let dmgResult = try shell.run(executable: "/usr/bin/hdiutil", arguments: ["create", "-volname", appName, "-srcfolder", stagingDir, "-ov", "-format", "UDZO", dmgPath])
-        guard dmgResult.exitCode == 0 else { throw SigningError.failed("DMG creation failed: \(dmgResult.stderr)") }
+        let dmgPath = try createDMG(appPath: appPath, appName: appName, volumeName: volumeName ?? appName, outputDir: outputDir)
 
         // 5. Sign DMG
         onProgress("Signing DMG...")
@@ -70,28 +80,129 @@ struct CodeSigner {
 
         // 6. Notarize
         onProgress("Submitting for notarization (this may take several minutes)...")
-        let notarizeResult = try shell.run(executable: "/usr/bin/xcrun", arguments: [
-            "notarytool", "submit", dmgPath, "--keychain-profile", keychainProfile, "--wait",
-        ])
-        guard notarizeResult.exitCode == 0 else {
-            throw SigningError.failed("""
-                Notarization failed: \(notarizeResult.stderr.isEmpty ? notarizeResult.stdout : notarizeResult.stderr)
-                Set up credentials: xcrun notarytool store-credentials \(keychainProfile)
-                """)
+        let notarizeResult = try shell.run(
+            executable: "/usr/bin/xcrun",
+            arguments: ["notarytool", "submit", dmgPath] + notary.notarytoolArguments + ["--wait", "--output-format", "json"]
+        )
+        let submission = Self.parseNotarySubmission(notarizeResult.stdout)
+        guard notarizeResult.exitCode == 0, submission?.status == "Accepted" else {
+            throw SigningError.failed(notarizationFailure(notarizeResult, submission: submission, notary: notary))
         }
 
         // 7. Staple (non-fatal)
         onProgress("Stapling notarization ticket...")
         let stapleResult = try shell.run(executable: "/usr/bin/xcrun", arguments: ["stapler", "staple", dmgPath])
         if stapleResult.exitCode != 0 {
+            if requireStaple {
+                throw SigningError.failed("Stapling failed: \(stapleResult.stderr)")
+            }
             printWarning("Stapling failed (Gatekeeper will verify online): \(stapleResult.stderr)")
         }
 
         return dmgPath
     }
 
-    /// Parse `security find-identity` output. Auto-pick if one, prompt if multiple.
-    func resolveIdentity() throws -> String {
+    /// Signs the .app with Hardened Runtime and verifies it with `codesign --verify --deep --strict`.
+    /// `identity` must already be resolved (see `resolveIdentity`). Used on its own by
+    /// `pack --sign`, which stops short of the .dmg and notarization. `entitlements` is a plist
+    /// path (`pack --entitlements`); nil signs with `BundleAssembler.generateEntitlementsPlist()`.
+    func signApp(appPath: String, identity: String, entitlements: String? = nil, onProgress: (String) -> Void) throws {
+        let appName = ((appPath as NSString).lastPathComponent as NSString).deletingPathExtension
+        onProgress("Signing \(appName).app...")
+        var entitlementsPath = entitlements ?? ""
+        if entitlements == nil {
+            entitlementsPath = (tempDir as NSString).appendingPathComponent("containerfy-entitlements-\(ProcessInfo.processInfo.globallyUniqueString).plist")
+            try BundleAssembler.generateEntitlementsPlist().write(toFile: entitlementsPath, atomically: true, encoding: .utf8)
+            InterruptCleanup.shared.track(entitlementsPath)
+        }
+        defer {
+            if entitlements == nil {
+                InterruptCleanup.shared.untrack(entitlementsPath)
+                try? FileManager.default.removeItem(atPath: entitlementsPath)
+            }
+        }
+        let codesignArgs = [
+            "--force", "--sign", identity, "--options", "runtime", "--timestamp", "--deep",
+            "--entitlements", entitlementsPath, appPath,
+        ]
+        let signResult = try shell.run(executable: "/usr/bin/codesign", arguments: codesignArgs)
+        guard signResult.exitCode == 0 else { throw SigningError.failed("codesign failed: \(signResult.stderr)") }
+
+        onProgress("Verifying signature...")
+        let verifyResult = try shell.run(executable: "/usr/bin/codesign", arguments: ["--verify", "--deep", "--strict", appPath])
+        guard verifyResult.exitCode == 0 else { throw SigningError.failed("Verification failed: \(verifyResult.stderr)") }
+    }
+
+    /// Builds a compressed (UDZO) `<outputDir>/<appName>.dmg` holding the .app, an /Applications
+    /// symlink to drag it onto, and License.txt when the bundle has one. Used by the signed
+    /// pipeline and on its own by `pack --dmg`.
+    func createDMG(appPath: String, appName: String, volumeName: String, outputDir: String) throws -> String {
+        let stagingDir = (tempDir as NSString).appendingPathComponent("containerfy-dmg-\(ProcessInfo.processInfo.globallyUniqueString)")
+        let fm = FileManager.default
+        try fm.createDirectory(atPath: stagingDir, withIntermediateDirectories: true)
+        InterruptCleanup.shared.track(stagingDir)
+        defer {
+            InterruptCleanup.shared.untrack(stagingDir)
+            try? fm.removeItem(atPath: stagingDir)
+        }
+        try fm.copyItem(atPath: appPath, toPath: (stagingDir as NSString).appendingPathComponent((appPath as NSString).lastPathComponent))
+        try fm.createSymbolicLink(atPath: (stagingDir as NSString).appendingPathComponent("Applications"), withDestinationPath: "/Applications")
+        let bundledLicense = ((appPath as NSString).appendingPathComponent("Contents/Resources") as NSString)
+            .appendingPathComponent(BundleAssembler.licenseFileName)
+        if fm.fileExists(atPath: bundledLicense) {
+            try fm.copyItem(atPath: bundledLicense, toPath: (stagingDir as NSString).appendingPathComponent("License.txt"))
+        }
+
+        let dmgPath = (outputDir as NSString).appendingPathComponent("\(appName).dmg")
+        if fm.fileExists(atPath: dmgPath) { try fm.removeItem(atPath: dmgPath) }
+        // A .dmg cut short by an interrupt is unusable
+        InterruptCleanup.shared.track(dmgPath)
+        defer { InterruptCleanup.shared.untrack(dmgPath) }
+        let dmgResult: ProcessResult
+        do {
+            dmgResult = try shell.run(
+                executable: "/usr/bin/hdiutil",
+                arguments: ["create", "-volname", volumeName, "-srcfolder", stagingDir, "-ov", "-format", "UDZO", dmgPath]
+            )
+        } catch {
+            throw SigningError.failed("hdiutil could not be run (\(error.localizedDescription)) — .dmg images can only be built on macOS")
+        }
+        guard dmgResult.exitCode == 0 else { throw SigningError.failed("DMG creation failed: \(dmgResult.stderr)") }
+        return dmgPath
+    }
+
+    static func parseNotarySubmission(_ output: String) -> NotarySubmission? {
+        guard let data = output.data(using: .utf8) else { return nil }
+        return try? JSONDecoder().decode(NotarySubmission.self, from: data)
+    }
+
+    /// Explains a rejected or failed submission. When Apple assigned a submission ID, the
+    /// developer log (which lists each rejected binary and why) is fetched and included.
+    private func notarizationFailure(_ result: ProcessResult, submission: NotarySubmission?, notary: NotaryCredentials) -> String {
+        var lines: [String]
+        if let status = submission?.status {
+            lines = ["Notarization failed: status \(status)" + (submission?.message.map { " — \($0)" } ?? "")]
+        } else {
+            lines = ["Notarization failed: \(result.stderr.isEmpty ? result.stdout : result.stderr)"]
+        }
+        if let id = submission?.id {
+            let logArguments = ["notarytool", "log", id] + notary.notarytoolArguments
+            if let log = try? shell.run(executable: "/usr/bin/xcrun", arguments: logArguments), log.exitCode == 0, !log.stdout.isEmpty {
+                lines.append("Notarization log for submission \(id):")
+                lines.append(log.stdout)
+            } else {
+                lines.append("Fetch the log with: xcrun notarytool log \(id) <credentials>")
+            }
+        }
+        if case .keychainProfile(let profile) = notary, submission?.id == nil {
+            lines.append("Set up credentials: xcrun notarytool store-credentials \(profile)")
+        }
+        return lines.joined(separator: "\n")
+    }
+
+    /// Parse `security find-identity` output. Use `preferred` (hash or name) if given,
+    /// otherwise auto-pick if one, prompt if multiple.
+    func resolveIdentity(preferred: String? = nil) throws -> String {
         let result = try shell.run(executable: "/usr/bin/security", arguments: ["find-identity", "-v", "-p", "codesigning"])
         guard result.exitCode == 0 else { throw SigningError.failed("security find-identity failed: \(result.stderr)") }
 
@@ -109,6 +220,13 @@ struct CodeSigner {
         guard !identities.isEmpty else {
             throw SigningError.failed("No signing identities found. Install a Developer ID certificate from developer.apple.com")
         }
+        if let preferred {
+            guard let match = identities.first(where: { $0.hash.caseInsensitiveCompare(preferred) == .orderedSame || $0.name == preferred }) else {
+                let available = identities.map { "  \($0.hash) \"\($0.name)\"" }.joined(separator: "\n")
+                throw SigningError.failed("Signing identity \"\(preferred)\" not found. Available:\n\(available)")
+            }
+            return match.hash
+        }
         if identities.count == 1 { return identities[0].hash }
 
         // Multiple — prompt
@@ -126,6 +244,95 @@ struct CodeSigner {
         }
     }
 
+    /// Keychain service `notarytool store-credentials` saves profiles under, one item per profile.
+    static let notaryKeychainService = "com.apple.gke.notary.tool"
+
+    /// Whether `xcrun notarytool store-credentials <profile>` has saved this profile to the keychain.
+    func notaryProfileExists(_ profile: String) throws -> Bool {
+        let result = try shell.run(executable: "/usr/bin/security", arguments: [
+            "find-generic-password", "-s", Self.notaryKeychainService, "-a", "\(Self.notaryKeychainService).saved-creds.\(profile)",
+        ])
+        return result.exitCode == 0
+    }
+
+    /// Where `xcrun` finds `tool` (`notarytool`, `stapler`) in the active developer directory, or nil
+    /// when the Xcode command line tools don't provide it.
+    func xcrunTool(_ tool: String) throws -> String? {
+        let result = try shell.run(executable: "/usr/bin/xcrun", arguments: ["--find", tool])
+        let path = result.stdout.trimmingCharacters(in: .whitespacesAndNewlines)
+        return result.exitCode == 0 && !path.isEmpty ? path : nil
+    }
+
+    /// Result of `spctl --assess`: whether Gatekeeper would launch the app, and why.
+    struct GatekeeperVerdict: Equatable {
+        let accepted: Bool
+        /// spctl's `source=` line (e.g. "Notarized Developer ID", "no usable signature"),
+        /// or its last output line when there is none.
+        let reason: String
+    }
+
+    /// Asks Gatekeeper whether it would allow `appPath` to run, as on a clean machine.
+    func assessGatekeeper(appPath: String) throws -> GatekeeperVerdict {
+        let result = try shell.run(executable: "/usr/sbin/spctl", arguments: ["--assess", "--type", "exec", "--verbose", appPath])
+        // spctl writes its verdict to stderr
+        let lines = (result.stderr + "\n" + result.stdout)
+            .split(separator: "\n")
+            .map { $0.trimmingCharacters(in: .whitespaces) }
+            .filter { !$0.isEmpty }
+        let reason = lines.first { $0.hasPrefix("source=") }.map { String($0.dropFirst("source=".count)) }
+            ?? lines.last
+            ?? "exit code \(result.exitCode)"
+        return GatekeeperVerdict(accepted: result.exitCode == 0, reason: reason)
+    }
+
+    /// What `codesign -dv` reports about a bundle's signature.
+    struct SignatureInfo: Equatable, Encodable {
+        let signed: Bool
+        let adHoc: Bool
+        /// Leaf certificate, e.g. "Developer ID Application: Example Corp (TEAM123456)".
+        let authority: String?
+        let teamID: String?
+
+        enum CodingKeys: String, CodingKey {
+            case signed
+            case adHoc = "ad_hoc"
+            case authority
+            case teamID = "team_id"
+        }
+
+        var summary: String {
+            guard signed else { return "unsigned" }
+            if adHoc { return "ad-hoc signed" }
+            return authority.map { "signed by \($0)" } ?? "signed"
+        }
+    }
+
+    func signatureInfo(appPath: String) throws -> SignatureInfo {
+        let result = try shell.run(executable: "/usr/bin/codesign", arguments: ["-dv", "--verbose=2", appPath])
+        return Self.parseSignatureInfo(result)
+    }
+
+    /// Parses `codesign -dv --verbose=2`, which writes `Key=value` lines to stderr.
+    static func parseSignatureInfo(_ result: ProcessResult) -> SignatureInfo {
+        guard result.exitCode == 0 else {
+            return SignatureInfo(signed: false, adHoc: false, authority: nil, teamID: nil)
+        }
+        var fields: [String: String] = [:]
+        for line in (result.stderr + "\n" + result.stdout).split(separator: "\n") {
+            guard let eq = line.firstIndex(of: "=") else { continue }
+            let key = String(line[..<eq])
+            // Authority repeats up the chain; the first one is the signing certificate
+            if fields[key] == nil { fields[key] = String(line[line.index(after: eq)...]) }
+        }
+        let teamID = fields["TeamIdentifier"].flatMap { $0 == "not set" ? nil : $0 }
+        return SignatureInfo(
+            signed: true,
+            adHoc: fields["Signature"] == "adhoc",
+            authority: fields["Authority"],
+            teamID: teamID
+        )
+    }
+
     private func printWarning(_ message: String) {
         FileHandle.standardError.write(Data("Warning: \(message)\n".utf8))
     }
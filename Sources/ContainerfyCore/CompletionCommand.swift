@@ -0,0 +1,224 @@
+import Foundation
+
+/// CLI `completion` command — prints a shell completion script for the subcommands and their flags.
+///
+/// Usage: containerfy completion <bash|zsh|fish>
+public struct CompletionCommand {
+
+    enum Shell: String, CaseIterable {
+        case bash
+        case zsh
+        case fish
+    }
+
+    struct Command {
+        var name: String
+        var summary: String
+        var flags: [String]
+        /// Positional arguments are .app bundles rather than plain files.
+        var takesApp = false
+    }
+
+    /// Every subcommand and flag. Add new flags here too, or they won't be completed.
+    static let commands: [Command] = [
+        Command(name: "pack", summary: "Build a distributable .app bundle from a docker-compose.yml", flags: [
+            "--compose", "--allow-http", "--compose-format", "--env-file-search-up", "--allow-env", "--output", "--ca-cert", "--identifier", "--signed", "--notarize-profile",
+            "--dmg", "--volume-name", "--tmpdir", "--archive", "--apple-id", "--team-id", "--app-password", "--sign",
+            "--sign-identity", "--entitlements", "--release-dmg", "--print-config", "--dry-run", "--signing-check", "--quiet", "--verbose", "--log-file",
+            "--json", "--all", "--keep-going", "--emit-appcast", "--confine-paths", "--confine-root", "--override-image",
+            "--profile", "--require-signed", "--placeholder-artifacts", "--artifacts", "--runtime-binary", "--require-binary", "--assess", "--require-gatekeeper-pass",
+            "--no-verify", "--max-bundle-mb", "--checksum", "--build-manifest", "--strict", "--lint", "--require-pinned", "--allow-privileged",
+            "--max-disk-mb", "--max-env-file-kb", "--help",
+        ]),
+        Command(name: "validate", summary: "Check a docker-compose.yml and print the resolved config", flags: [
+            "--compose", "--compose-format", "--env-file-search-up", "--allow-env", "--profile", "--identifier", "--override-image",
+            "--json", "--strict", "--require-pinned", "--allow-privileged", "--check-env", "--lint", "--help",
+        ]),
+        Command(name: "lint", summary: "Report best-practice findings for a docker-compose.yml", flags: [
+            "--compose", "--compose-format", "--env-file-search-up", "--allow-env", "--profile", "--identifier", "--override-image",
+            "--disable-rule", "--strict", "--list-rules", "--help",
+        ]),
+        Command(name: "verify", summary: "Check a packed .app against its pack-time digests", flags: ["--help"], takesApp: true),
+        Command(name: "inspect", summary: "Show what a packed .app contains and how it is signed", flags: ["--json", "--help"], takesApp: true),
+        Command(name: "uninstall", summary: "Remove the VM and support files of a packed .app", flags: ["--dry-run", "--help"], takesApp: true),
+        Command(name: "doctor", summary: "Check this Mac has what pack needs", flags: ["--sign", "--notarize-profile", "--help"]),
+        Command(name: "completion", summary: "Print a shell completion script", flags: Shell.allCases.map(\.rawValue)),
+        Command(name: "version", summary: "Print the containerfy version", flags: []),
+    ]
+
+    public init() {}
+
+    /// Runs the completion command. Returns an exit code (0 = script printed).
+    public func run(arguments: [String]) -> Int32 {
+        if arguments.first == "--help" || arguments.first == "-h" {
+            Self.printUsage()
+            return 0
+        }
+        guard arguments.count == 1, let shell = Shell(rawValue: arguments[0]) else {
+            Self.printError("completion takes one shell: bash, zsh or fish")
+            Self.printUsage()
+            return 1
+        }
+        print(Self.script(for: shell), terminator: "")
+        return 0
+    }
+
+    static func script(for shell: Shell) -> String {
+        switch shell {
+        case .bash: return bashScript()
+        case .zsh: return zshScript()
+        case .fish: return fishScript()
+        }
+    }
+
+    // MARK: - Scripts
+
+    private static func bashScript() -> String {
+        var cases = ""
+        for command in commands where command.name != "version" {
+            guard command.name != "completion" else {
+                cases += """
+                        completion)
+                            COMPREPLY=($(compgen -W "\(command.flags.joined(separator: " "))" -- "$cur"))
+                            ;;
+
+                """
+                continue
+            }
+            let files = command.takesApp ? "compgen -d -- \"$cur\"" : "compgen -f -- \"$cur\""
+            cases += """
+                    \(command.name))
+                        if [[ "$cur" == -* ]]; then
+                            COMPREPLY=($(compgen -W "\(command.flags.joined(separator: " "))" -- "$cur"))
+                        else
+                            COMPREPLY=($(\(files)))
+                        fi
+                        ;;
+
+            """
+        }
+        return """
+        # bash completion for containerfy
+        #
+        # Install for the current shell:
+        #   source <(containerfy completion bash)
+        # or permanently (with the bash-completion package):
+        #   containerfy completion bash > "$(brew --prefix)/etc/bash_completion.d/containerfy"
+
+        _containerfy() {
+            local cur="${COMP_WORDS[COMP_CWORD]}"
+            if [[ $COMP_CWORD -eq 1 ]]; then
+                COMPREPLY=($(compgen -W "\(commands.map(\.name).joined(separator: " ")) --help" -- "$cur"))
+                return
+            fi
+            local cmd="${COMP_WORDS[1]}"
+            case "$cmd" in
+        \(cases)    esac
+        }
+        complete -o filenames -F _containerfy containerfy
+
+        """
+    }
+
+    private static func zshScript() -> String {
+        var cases = ""
+        for command in commands where command.name != "version" {
+            let words = command.flags.joined(separator: " ")
+            guard command.name != "completion" else {
+                cases += """
+                        completion)
+                            compadd -- \(words)
+                            ;;
+
+                """
+                continue
+            }
+            let files = command.takesApp ? "_files -/" : "_files"
+            cases += """
+                    \(command.name))
+                        if [[ $PREFIX == -* ]]; then
+                            compadd -- \(words)
+                        else
+                            \(files)
+                        fi
+                        ;;
+
+            """
+        }
+        let described = commands.map { "'\($0.name):\($0.summary.replacingOccurrences(of: "'", with: "'\\''"))'" }
+        return """
+        #compdef containerfy
+        # zsh completion for containerfy
+        #
+        # Install: write this file as _containerfy somewhere on $fpath, then restart zsh:
+        #   containerfy completion zsh > "${fpath[1]}/_containerfy"
+        # or for the current shell only:
+        #   source <(containerfy completion zsh)
+
+        _containerfy() {
+            if (( CURRENT == 2 )); then
+                local -a commands
+                commands=(
+                    \(described.joined(separator: "\n            "))
+                )
+                _describe 'command' commands
+                return
+            fi
+            case $words[2] in
+        \(cases)    esac
+        }
+
+        if [[ $zsh_eval_context[-1] == loadautofunc ]]; then
+            _containerfy "$@"
+        else
+            compdef _containerfy containerfy
+        fi
+
+        """
+    }
+
+    private static func fishScript() -> String {
+        var lines = [
+            "# fish completion for containerfy",
+            "#",
+            "# Install:",
+            "#   containerfy completion fish > ~/.config/fish/completions/containerfy.fish",
+            "",
+            "complete -c containerfy -f",
+        ]
+        for command in commands {
+            let summary = command.summary.replacingOccurrences(of: "'", with: "\\'")
+            lines.append("complete -c containerfy -n __fish_use_subcommand -a \(command.name) -d '\(summary)'")
+        }
+        for command in commands {
+            let condition = "'__fish_seen_subcommand_from \(command.name)'"
+            if command.name == "completion" {
+                lines.append("complete -c containerfy -n \(condition) -a '\(command.flags.joined(separator: " "))'")
+                continue
+            }
+            for flag in command.flags {
+                lines.append("complete -c containerfy -n \(condition) -l \(flag.dropFirst(2))")
+            }
+            if command.name != "version" {
+                lines.append("complete -c containerfy -n \(condition) -F")
+            }
+        }
+        return lines.joined(separator: "\n") + "\n"
+    }
+
+    // MARK: - Output
+
+    private static func printError(_ message: String) {
+        let stderr = FileHandle.standardError
+        stderr.write("Error: \(message)\n".data(using: .utf8)!)
+    }
+
+    private static func printUsage() {
+        print("""
+        Usage: containerfy completion <bash|zsh|fish>
+
+        Print a completion script for containerfy's commands and flags. The script's
+        comments explain how to install it for that shell.
+        """)
+    }
+}
@@ -2,26 +2,250 @@ import Foundation
 import Yams
 
 /// Port mapping extracted from a compose service's `ports:` list.
-struct PortMapping: Sendable {
+struct PortMapping: Sendable, Codable, Equatable {
     let hostPort: UInt16
     let containerPort: UInt16
+    /// `tcp` or `udp`.
+    let `protocol`: String
+
+    init(hostPort: UInt16, containerPort: UInt16, protocol: String = "tcp") {
+        self.hostPort = hostPort
+        self.containerPort = containerPort
+        self.protocol = `protocol`
+    }
+
+    /// `host:container`, with `/udp` appended for UDP ports.
+    var notation: String {
+        let base = "\(hostPort):\(containerPort)"
+        return `protocol` == "tcp" ? base : "\(base)/\(`protocol`)"
+    }
 }
 
 /// A compose service with exposed ports (generates "Open" menu items).
-struct ServiceInfo: Sendable {
+struct ServiceInfo: Sendable, Codable {
     let name: String
     let displayLabel: String
     let ports: [PortMapping]
 
-    /// URL for the "Open" menu item: http://127.0.0.1:<first host port>
+    /// URL for the "Open" menu item: http://127.0.0.1:<first TCP host port>
     var openURL: URL? {
-        guard let first = ports.first else { return nil }
+        guard let first = ports.first(where: { $0.protocol == "tcp" }) else { return nil }
         return URL(string: "http://127.0.0.1:\(first.hostPort)")
     }
 }
 
+/// A `devices:` entry — a device node exposed from the VM into a container.
+struct DeviceMapping: Sendable, Equatable, Codable {
+    let hostPath: String
+    let containerPath: String
+    let permissions: String
+}
+
+/// An x-containerfy healthcheck — what the app polls to decide services are ready.
+enum Healthcheck: Sendable, Equatable, Codable {
+    /// An HTTP GET; `url`'s host is normalized to 127.0.0.1 and `path` to start with "/".
+    case http(url: String, path: String)
+    /// A TCP connect to 127.0.0.1:`port`, for services without an HTTP endpoint (databases, caches).
+    case tcp(port: UInt16)
+}
+
+/// A file-based top-level `secrets:` or `configs:` entry, copied into the bundle. The bundled compose file
+/// is rewritten to point at the copy, so the source path doesn't matter at runtime.
+struct BundledFile: Sendable, Equatable, Codable {
+    enum Kind: String, Sendable, Codable {
+        case secret
+        case config
+
+        /// Top-level compose key, and the directory under Resources the files are copied to.
+        var key: String { rawValue + "s" }
+    }
+
+    let kind: Kind
+    let name: String
+    /// Absolute path of the source file.
+    let source: String
+    /// Relative to `Contents/Resources` (and to the bundled compose file).
+    let bundlePath: String
+}
+
+/// `x-containerfy.volumes.<name>.seed`: a directory whose contents fill a named volume the
+/// first time the app starts. A volume that already exists is never reseeded.
+struct VolumeSeed: Sendable, Equatable, Codable {
+    /// Key under the top-level `volumes:`; the copy is bundled as `volume-seeds/<volume>`.
+    let volume: String
+    /// The volume's name in podman: its `name:`, or `<project>_<volume>` as compose names it.
+    let podmanName: String
+    /// Absolute path of the source directory; empty in the runtime config.
+    let source: String
+}
+
+/// `x-containerfy.update`: where Sparkle looks for new releases, and the key it checks them with.
+struct UpdateFeed: Sendable, Equatable, Codable {
+    /// `SUFeedURL`: the appcast, served over HTTPS.
+    let feedURL: String
+    /// `SUPublicEDKey`: the base64 EdDSA (ed25519) public key updates must be signed with.
+    let publicEDKey: String
+}
+
+/// One `environment:` entry of a service, after `${VAR}` interpolation. Encoded with its real
+/// value, so a config round-trips through JSON; `--print-config` and `validate` show
+/// `displayValue` instead.
+struct EnvironmentVariable: Sendable, Equatable, Codable {
+    static let mask = "********"
+
+    /// Names that look like credentials.
+    private static let secretNamePattern = try! NSRegularExpression(
+        pattern: #"(PASSWORD|PASSWD|SECRET|TOKEN|API_?KEY|PRIVATE_?KEY|CREDENTIALS?)"#,
+        options: .caseInsensitive
+    )
+
+    let name: String
+    /// nil for a bare `KEY`, which compose takes from the environment it runs in.
+    let value: String?
+
+    var looksLikeSecret: Bool {
+        Self.secretNamePattern.firstMatch(in: name, range: NSRange(name.startIndex..., in: name)) != nil
+    }
+
+    /// `value`, or `mask` for credential-like names.
+    var displayValue: String? {
+        value.map { looksLikeSecret && !$0.isEmpty ? Self.mask : $0 }
+    }
+}
+
+/// A value from `x-containerfy.plist`, limited to the types Info.plist can hold.
+enum PlistValue: Sendable, Equatable, Codable {
+    case string(String)
+    case integer(Int)
+    case real(Double)
+    case bool(Bool)
+    case array([PlistValue])
+    case dict([String: PlistValue])
+
+    /// Converts a parsed YAML/JSON value; nil for null, dates and anything else plist can't hold.
+    init?(_ raw: Any) {
+        switch raw {
+        case let value as String: self = .string(value)
+        case let value as Bool: self = .bool(value)
+        case let value as Int: self = .integer(value)
+        case let value as Double: self = .real(value)
+        case let list as [Any]:
+            var items: [PlistValue] = []
+            for item in list {
+                guard let value = PlistValue(item) else { return nil }
+                items.append(value)
+            }
+            self = .array(items)
+        case let map as [String: Any]:
+            var entries: [String: PlistValue] = [:]
+            for (key, item) in map {
+                guard let value = PlistValue(item) else { return nil }
+                entries[key] = value
+            }
+            self = .dict(entries)
+        default:
+            return nil
+        }
+    }
+
+    /// The value as plist XML starting at `indent`, one more tab per nesting level; dict keys are sorted.
+    func xml(indent: String) -> String {
+        switch self {
+        case .string(let value):
+            return "\(indent)<string>\(Self.escape(value))</string>"
+        case .integer(let value):
+            return "\(indent)<integer>\(value)</integer>"
+        case .real(let value):
+            return "\(indent)<real>\(value)</real>"
+        case .bool(let value):
+            return "\(indent)<\(value)/>"
+        case .array(let items):
+            guard !items.isEmpty else { return "\(indent)<array/>" }
+            return (["\(indent)<array>"] + items.map { $0.xml(indent: indent + "\t") } + ["\(indent)</array>"])
+                .joined(separator: "\n")
+        case .dict(let entries):
+            guard !entries.isEmpty else { return "\(indent)<dict/>" }
+            var lines = ["\(indent)<dict>"]
+            for (key, value) in entries.sorted(by: { $0.key < $1.key }) {
+                lines.append("\(indent)\t<key>\(Self.escape(key))</key>")
+                lines.append(value.xml(indent: indent + "\t"))
+            }
+            lines.append("\(indent)</dict>")
+            return lines.joined(separator: "\n")
+        }
+    }
+
+    static func escape(_ text: String) -> String {
+        text.replacingOccurrences(of: "&", with: "&amp;")
+            .replacingOccurrences(of: "<", with: "&lt;")
+            .replacingOccurrences(of: ">", with: "&gt;")
+    }
+
+    /// Reads the JSON form written by `encode(to:)`. A real with no fractional part is written
+    /// as a JSON integer, so it reads back as `.integer`.
+    init(from decoder: Decoder) throws {
+        let container = try decoder.singleValueContainer()
+        if let value = try? container.decode(Bool.self) {
+            self = .bool(value)
+        } else if let value = try? container.decode(Int.self) {
+            self = .integer(value)
+        } else if let value = try? container.decode(Double.self) {
+            self = .real(value)
+        } else if let value = try? container.decode(String.self) {
+            self = .string(value)
+        } else if let items = try? container.decode([PlistValue].self) {
+            self = .array(items)
+        } else if let entries = try? container.decode([String: PlistValue].self) {
+            self = .dict(entries)
+        } else {
+            throw DecodingError.dataCorruptedError(in: container, debugDescription: "not a string, number, boolean, list or map")
+        }
+    }
+
+    func encode(to encoder: Encoder) throws {
+        var container = encoder.singleValueContainer()
+        switch self {
+        case .string(let value): try container.encode(value)
+        case .integer(let value): try container.encode(value)
+        case .real(let value): try container.encode(value)
+        case .bool(let value): try container.encode(value)
+        case .array(let items): try container.encode(items)
+        case .dict(let entries): try container.encode(entries)
+        }
+    }
+}
+
+/// Build-time settings of a single compose service (populated by parseBuild).
+/// The compose file is passed through unchanged, so these are validated copies, not overrides.
+struct ServiceSpec: Sendable, Codable {
+    let name: String
+    let image: String?
+    /// `platform:` (`linux/arm64` or `linux/amd64`), which podman pulls and runs this image for.
+    let platform: String?
+    /// `container_name`, unique across services; nil lets compose name the container.
+    let containerName: String?
+    let capAdd: [String]
+    let capDrop: [String]
+    let devices: [DeviceMapping]
+    let memSwappiness: Int?
+    let oomKillDisable: Bool?
+    let restart: String?
+    /// Services named in `depends_on` (list or map form), sorted.
+    let dependsOn: [String]
+    /// True when a healthcheck is defined and not disabled.
+    let hasHealthcheck: Bool
+    let healthcheckTimeout: String?
+    /// `environment:` in list (`KEY=value`) or map form, sorted by name.
+    var environment: [EnvironmentVariable]
+    /// Names of `environment:` variables given a literal value in the compose file.
+    let inlineEnvironmentKeys: [String]
+}
+
 /// Parsed subset of docker-compose.yml that Containerfy needs at runtime.
-struct ComposeConfig: Sendable {
+///
+/// Tools that generate configs can round-trip one through `jsonData()` and `init(json:)`, and
+/// check an edited or hand-built one with `validate()` before assembling it.
+struct ComposeConfig: Sendable, Codable {
     let portMappings: [PortMapping]
     let displayName: String?
     let services: [ServiceInfo]
@@ -29,33 +253,143 @@ struct ComposeConfig: Sendable {
     // Build-time fields (populated by parseBuild, nil at runtime)
     let name: String?
     let version: String?
+    /// x-containerfy.build_number, written as CFBundleVersion; nil uses `version`.
+    let buildNumber: String?
     let identifier: String?
+    /// Absolute path of x-containerfy.icon (.icns or .png), bundled as Resources/AppIcon.icns.
     let icon: String?
+    /// Absolute path of x-containerfy.license, bundled as Resources/LICENSE.txt.
+    let license: String?
+    /// x-containerfy.ui.background: menu-bar only (LSUIElement), with no Dock icon. Default true.
+    let runsInBackground: Bool
+    /// x-containerfy.min_macos, for LSMinimumSystemVersion; nil uses BundleAssembler.minimumSystemVersion.
+    let minimumMacOS: String?
+    /// x-containerfy.category, written as LSApplicationCategoryType.
+    let category: String?
+    /// x-containerfy.plist: extra Info.plist entries, without keys containerfy writes itself.
+    let infoPlistExtras: [String: PlistValue]
+    /// x-containerfy.update, written as SUFeedURL and SUPublicEDKey; nil leaves both keys out.
+    let updateFeed: UpdateFeed?
     let cpuMin: Int?
     let cpuRecommended: Int?
     let memoryMBMin: Int?
     let memoryMBRecommended: Int?
     let diskMB: Int?
+    /// x-containerfy.volumes.<name>.max_mb, keyed by named volume.
+    let volumeLimitsMB: [String: Int]
+    /// x-containerfy.volumes.<name>.seed, sorted by volume.
+    let volumeSeeds: [VolumeSeed]
     let images: [String]
     let envFiles: [String]
+    /// File-based secrets, then configs, each sorted by name.
+    let bundledFiles: [BundledFile]
     let composePath: String?
     let composeDir: String?
+    let labels: [String: String]
+    var serviceSpecs: [ServiceSpec]
+    /// Service names with every service after the ones it depends on; ties in name order.
+    let startupOrder: [String]
+    /// x-containerfy.healthcheck, or every entry of x-containerfy.healthchecks; the app is ready
+    /// once all of them pass.
+    let healthchecks: [Healthcheck]
+    /// Compose file to bundle when pack changed it (`${VAR}` interpolation, `--override-image`,
+    /// merged `--compose` files);
+    /// nil means the file at `composePath` is bundled byte-for-byte.
+    var renderedCompose: String?
+    /// Non-fatal findings from parseBuild, shown by `pack`.
+    let warnings: [String]
+
+    /// URL of the first HTTP healthcheck; nil when there is none.
+    var healthcheckURL: String? {
+        for case .http(let url, _) in healthchecks { return url }
+        return nil
+    }
+
+    /// Path of the first HTTP healthcheck ("/" when the URL has none).
+    var healthcheckPath: String? {
+        for case .http(_, let path) in healthchecks { return path }
+        return nil
+    }
+
+    /// The service a healthcheck reaches: the one publishing its port over TCP. A host port
+    /// belongs to at most one service (parseBuild and `validate` reject duplicates), so this is
+    /// unambiguous; nil when no service publishes the port.
+    func targetService(of healthcheck: Healthcheck) -> String? {
+        let port: Int
+        switch healthcheck {
+        case .http(let url, _):
+            guard let urlPort = URLComponents(string: url)?.port else { return nil }
+            port = urlPort
+        case .tcp(let tcpPort):
+            port = Int(tcpPort)
+        }
+        return services.first { info in
+            info.ports.contains { $0.protocol == "tcp" && Int($0.hostPort) == port }
+        }?.name
+    }
 
     /// No compose file found — run with no port forwarding.
     static let empty = ComposeConfig(
         portMappings: [], displayName: nil, services: [],
-        name: nil, version: nil, identifier: nil, icon: nil,
+        name: nil, version: nil, buildNumber: nil, identifier: nil, icon: nil, license: nil, runsInBackground: true, minimumMacOS: nil, category: nil, infoPlistExtras: [:], updateFeed: nil,
         cpuMin: nil, cpuRecommended: nil, memoryMBMin: nil, memoryMBRecommended: nil, diskMB: nil,
-        images: [], envFiles: [], composePath: nil, composeDir: nil
+        volumeLimitsMB: [:], volumeSeeds: [], images: [], envFiles: [], bundledFiles: [], composePath: nil, composeDir: nil, labels: [:], serviceSpecs: [],
+        startupOrder: [], healthchecks: [], renderedCompose: nil, warnings: []
     )
 }
 
+// In an extension, so ComposeConfig keeps its memberwise initializer.
+extension ComposeConfig {
+    /// The config as JSON, secrets included; `pack --print-config --json` prints it `masked()`.
+    func jsonData() throws -> Data {
+        let encoder = JSONEncoder()
+        encoder.outputFormatting = [.prettyPrinted, .sortedKeys, .withoutEscapingSlashes]
+        return try encoder.encode(self)
+    }
+
+    /// Reads a config written by `jsonData()`.
+    init(json: Data) throws {
+        self = try JSONDecoder().decode(ComposeConfig.self, from: json)
+    }
+
+    /// The config for printing: credential-like `environment:` values are replaced by
+    /// `EnvironmentVariable.mask`, in `serviceSpecs` and wherever they appear in `renderedCompose`.
+    func masked() -> ComposeConfig {
+        let secrets = Set(serviceSpecs.flatMap(\.environment).compactMap { $0.looksLikeSecret ? $0.value : nil }.filter { !$0.isEmpty })
+        var masked = self
+        for index in masked.serviceSpecs.indices {
+            masked.serviceSpecs[index].environment = masked.serviceSpecs[index].environment.map {
+                EnvironmentVariable(name: $0.name, value: $0.displayValue)
+            }
+        }
+        // Longest first, so a secret that contains another is masked whole
+        masked.renderedCompose = renderedCompose.map { rendered in
+            secrets.sorted { $0.count > $1.count }.reduce(rendered) { $0.replacingOccurrences(of: $1, with: EnvironmentVariable.mask) }
+        }
+        return masked
+    }
+
+    /// Checks the config against the rules parseBuild applies; see `ComposeConfigParser.validate`.
+    func validate(maxDiskMB: Int = ComposeConfigParser.BuildOptions().maxDiskMB) throws {
+        try ComposeConfigParser.validate(self, maxDiskMB: maxDiskMB)
+    }
+}
+
 enum ComposeConfigParser {
 
     // MARK: - Runtime loading (GUI mode)
 
-    /// Loads and parses the compose file, checking bundle first then Application Support.
+    /// Loads the app's config: the bundle's runtime.json if pack wrote one, otherwise the
+    /// compose file, checking bundle first then Application Support.
     static func load() -> ComposeConfig {
+        if let runtimeURL = Paths.runtimeConfigURL {
+            do {
+                return try RuntimeConfig.load(path: runtimeURL.path).composeConfig
+            } catch {
+                print("[Compose] \(error.localizedDescription) — falling back to the compose file")
+            }
+        }
+
         let url: URL
 
         if let bundleURL = Paths.composeFileURL,
@@ -95,7 +429,7 @@ enum ComposeConfigParser {
         if portMappings.isEmpty {
             print("[Compose] No port mappings found in compose file")
         } else {
-            print("[Compose] Found \(portMappings.count) port mapping(s): \(portMappings.map { "\($0.hostPort):\($0.containerPort)" }.joined(separator: ", "))")
+            print("[Compose] Found \(portMappings.count) port mapping(s): \(portMappings.map(\.notation).joined(separator: ", "))")
         }
 
         if !services.isEmpty {
@@ -106,9 +440,10 @@ enum ComposeConfigParser {
             portMappings: portMappings,
             displayName: displayName,
             services: services,
-            name: name, version: nil, identifier: nil, icon: nil,
+            name: name, version: nil, buildNumber: nil, identifier: nil, icon: nil, license: nil, runsInBackground: true, minimumMacOS: nil, category: nil, infoPlistExtras: [:], updateFeed: nil,
             cpuMin: cpuMin, cpuRecommended: nil, memoryMBMin: memoryMBMin, memoryMBRecommended: nil, diskMB: diskMB,
-            images: [], envFiles: [], composePath: nil, composeDir: nil
+            volumeLimitsMB: [:], volumeSeeds: [], images: [], envFiles: [], bundledFiles: [], composePath: nil, composeDir: nil, labels: [:], serviceSpecs: [],
+            startupOrder: [], healthchecks: [], renderedCompose: nil, warnings: []
         )
     }
 
@@ -116,227 +451,1531 @@ enum ComposeConfigParser {
 
     private static let nameRegex = try! NSRegularExpression(pattern: #"^[a-zA-Z][a-zA-Z0-9-]{0,63}$"#)
     private static let semverRegex = try! NSRegularExpression(pattern: #"^\d+\.\d+\.\d+"#)
+    /// CFBundleVersion: one to three period-separated integers.
+    private static let buildNumberRegex = try! NSRegularExpression(pattern: #"^\d+(\.\d+){0,2}$"#)
+    /// RFC 1123 DNS label — services reach each other by name on the compose network inside the VM.
+    private static let serviceNameRegex = try! NSRegularExpression(pattern: #"^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$"#)
+    /// Service names that would shadow a name the VM already resolves, or containerfy's own.
+    static let reservedServiceNames: [String: String] = [
+        "localhost": "it would shadow the container's own loopback address",
+        "host-gateway": "podman uses it to mean the VM host in extra_hosts",
+        "containerfy": "it is reserved for containerfy's own resources in the VM",
+    ]
+    /// CFBundleIdentifier: reverse-DNS, at least two dot-separated components of [A-Za-z0-9-].
+    private static let bundleIdentifierRegex = try! NSRegularExpression(pattern: #"^[A-Za-z0-9-]+(\.[A-Za-z0-9-]+)+$"#)
+    /// Image reference: [registry[:port]/]path[:tag][@sha256:digest], path components lowercase.
+    private static let imageReferenceRegex = try! NSRegularExpression(
+        pattern: #"^([A-Za-z0-9.-]+(:[0-9]+)?/)?[a-z0-9]+([._-]+[a-z0-9]+)*(/[a-z0-9]+([._-]+[a-z0-9]+)*)*(:[A-Za-z0-9_][A-Za-z0-9_.-]{0,127})?(@sha256:[a-f0-9]{64})?$"#
+    )
+    private static let labelKeyRegex = try! NSRegularExpression(pattern: #"^[a-zA-Z0-9]([a-zA-Z0-9._-]{0,126}[a-zA-Z0-9])?$"#)
+
+    /// Knobs for parseBuild that come from `pack` flags rather than the compose file.
+    enum ComposeFormat: String, Sendable {
+        case yaml
+        case json
+    }
+
+    struct BuildOptions: Sendable {
+        /// `--compose-format`; nil picks JSON for `.json` files and YAML otherwise.
+        var composeFormat: ComposeFormat?
+        /// Turn warnings that would likely break the app at runtime into errors.
+        var strict = false
+        /// `--require-pinned`: images without a version tag or digest are errors instead of warnings.
+        var requirePinned = false
+        /// Env files larger than this are almost certainly the wrong file.
+        var maxEnvFileKB = 256
+        /// Upper bound for x-containerfy.vm.disk_mb; catches typos like 200000.
+        var maxDiskMB = 131072
+        /// `--identifier`: replaces x-containerfy.identifier (white-labeled builds).
+        var identifier: String?
+        /// `--override-image`: service name -> image reference, applied before images are extracted.
+        var imageOverrides: [String: String] = [:]
+        /// `--confine-paths`: referenced files (env_file, license, icon) must resolve inside
+        /// `confineRoot`, or the compose file's directory when that is nil.
+        var confinePaths = false
+        var confineRoot: String?
+        /// Variables for `${VAR}` interpolation; nil uses the process environment, limited to
+        /// `allowedEnvironment`. Either way, a `.env` next to the compose file fills in anything not set.
+        var environment: [String: String]?
+        /// `--allow-env`: process environment variables `${VAR}` may read. Everything else in the
+        /// packing shell is ignored, so its secrets can't end up in the bundled compose file.
+        var allowedEnvironment: Set<String> = []
+        /// `--env-file-search-up`: with no `.env` next to the compose file, use the nearest one in
+        /// up to this many parent directories. Ignored for a `--compose` URL.
+        var envFileSearchUp = 0
+        /// Further `--compose` files, merged over the first in order (like `docker compose -f a -f b`).
+        /// Relative paths in every file resolve against the first file's directory.
+        var overrideComposePaths: [String] = []
+        /// `--profile`: services with `profiles:` are packed only if they list one of these.
+        var profiles: [String] = []
+        /// `--allow-privileged`: accept `privileged: true` and `privilegedCapabilities` in `cap_add`, with a warning.
+        var allowPrivileged = false
+        /// `--compose <url>`: the URL the compose file was downloaded from. Nothing next to it was
+        /// fetched, so env_file, secret and config files, the icon and the license are rejected.
+        var remoteSource: String?
+    }
+
+    /// File names searched when `--compose` points at a directory, in Docker Compose's precedence order.
+    static let composeFileNames = ["compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"]
 
     /// Full build-time parse — validates x-containerfy, rejects unsupported keywords, extracts images/env_files.
-    static func parseBuild(composePath: String) throws -> ComposeConfig {
-        let absPath = (composePath as NSString).standardizingPath
-        let fullPath: String
-        if absPath.hasPrefix("/") {
-            fullPath = absPath
-        } else {
-            fullPath = FileManager.default.currentDirectoryPath + "/" + composePath
+    /// `composePath` may be a compose file or a directory containing one.
+    static func parseBuild(composePath: String, options: BuildOptions = BuildOptions()) throws -> ComposeConfig {
+        let source = try loadSource(composePath: composePath, options: options)
+        let fullPath = source.fullPath
+        let composeDir = (fullPath as NSString).deletingLastPathComponent
+        let confinementRoot = options.confinePaths ? (options.confineRoot ?? composeDir) : nil
+        var root = source.root
+        let extended = source.extended
+
+        // ${VAR} interpolation — resolved now, since end users' machines have neither the
+        // packing shell's environment nor the project's .env
+        let environment = source.environment
+        let rawRoot = root
+        let interpolation = try ComposeInterpolation.interpolate(rawRoot, environment: environment)
+        var bundleRoot: [String: Any]?
+        if interpolation.substituted, let interpolated = interpolation.value as? [String: Any] {
+            root = interpolated
+            bundleRoot = try ComposeInterpolation.interpolate(rawRoot, environment: environment, escapeDollars: true).value as? [String: Any]
+        }
+        if !options.overrideComposePaths.isEmpty || extended, bundleRoot == nil {
+            bundleRoot = rawRoot
         }
 
-        let composeDir = (fullPath as NSString).deletingLastPathComponent
+        // Image overrides also rewrite the compose file that gets bundled
+        if !options.imageOverrides.isEmpty {
+            root = try applyImageOverrides(options.imageOverrides, to: root)
+            bundleRoot = try applyImageOverrides(options.imageOverrides, to: bundleRoot ?? rawRoot)
+        }
 
-        guard let data = FileManager.default.contents(atPath: fullPath) else {
-            throw ComposeError.fileNotFound(fullPath)
+        // Profiles are resolved now; the bundled compose file keeps only the selected services
+        if usesProfiles(root) {
+            root = try applyProfiles(options.profiles, to: root)
+            bundleRoot = try applyProfiles(options.profiles, to: bundleRoot ?? rawRoot)
         }
-        guard let contents = String(data: data, encoding: .utf8) else {
-            throw ComposeError.invalidFormat
+
+        // env_file globs are expanded now; podman compose on the end user's Mac reads each path literally
+        if let expanded = try expandEnvFileGlobs(in: root, composeDir: composeDir) {
+            root = expanded
+            bundleRoot = try expandEnvFileGlobs(in: bundleRoot ?? rawRoot, composeDir: composeDir) ?? bundleRoot
         }
-        guard let root = try Yams.load(yaml: contents) as? [String: Any] else {
-            throw ComposeError.invalidFormat
+
+        // x-containerfy.env is merged into every service's environment:, in the bundled compose file too
+        if let raw = (root["x-containerfy"] as? [String: Any])?["env"] {
+            _ = try parseGlobalEnvironment(raw)
+            root = mergeGlobalEnvironment(into: root, composeDir: composeDir)
+            bundleRoot = mergeGlobalEnvironment(into: bundleRoot ?? rawRoot, composeDir: composeDir)
+        }
+
+        // File-based secrets and configs are copied into the bundle, and the bundled compose file points at the copies
+        let bundledFiles = try parseBundledFiles(root, kind: .secret, composeDir: composeDir, confineTo: confinementRoot)
+            + parseBundledFiles(root, kind: .config, composeDir: composeDir, confineTo: confinementRoot)
+        if !bundledFiles.isEmpty {
+            bundleRoot = rewriteBundledFileSources(bundledFiles, in: bundleRoot ?? rawRoot)
         }
+        let renderedCompose = try bundleRoot.map { try Yams.dump(object: $0, sortKeys: true) }
 
         // Parse x-containerfy block (required for build)
         guard let xContainerfy = root["x-containerfy"] as? [String: Any] else {
             throw ComposeError.missingField("x-containerfy")
         }
 
-        // name (required)
-        guard let name = xContainerfy["name"] as? String, !name.isEmpty else {
-            throw ComposeError.missingField("x-containerfy.name")
+        // Independent checks record their error and carry on, so one run reports every problem
+        var errors: [ComposeError] = []
+        var warnings: [String] = []
+        func collect<T>(_ step: () throws -> T) throws -> T? {
+            do {
+                return try step()
+            } catch let error as ComposeError {
+                errors.append(error)
+                return nil
+            }
         }
-        let nameRange = NSRange(name.startIndex..., in: name)
-        guard nameRegex.firstMatch(in: name, range: nameRange) != nil else {
-            throw ComposeError.invalidValue("x-containerfy.name", name, "must match ^[a-zA-Z][a-zA-Z0-9-]{0,63}$")
+
+        // Top-level version (optional; the Compose Spec omits it)
+        _ = try collect { try checkComposeFileVersion(root["version"], strict: options.strict, warnings: &warnings) }
+
+        // name (required)
+        let name = try collect { () throws -> String in
+            guard let name = xContainerfy["name"] as? String, !name.isEmpty else {
+                throw ComposeError.missingField("x-containerfy.name")
+            }
+            let nameRange = NSRange(name.startIndex..., in: name)
+            guard nameRegex.firstMatch(in: name, range: nameRange) != nil else {
+                throw ComposeError.invalidValue("x-containerfy.name", name, "must match ^[a-zA-Z][a-zA-Z0-9-]{0,63}$")
+            }
+            return name
         }
 
         // version (required)
-        guard let version = xContainerfy["version"] as? String, !version.isEmpty else {
-            throw ComposeError.missingField("x-containerfy.version")
+        let version = try collect { () throws -> String in
+            guard let version = xContainerfy["version"] as? String, !version.isEmpty else {
+                throw ComposeError.missingField("x-containerfy.version")
+            }
+            let versionRange = NSRange(version.startIndex..., in: version)
+            guard semverRegex.firstMatch(in: version, range: versionRange) != nil else {
+                throw ComposeError.invalidValue("x-containerfy.version", version, "not valid semver")
+            }
+            return version
         }
-        let versionRange = NSRange(version.startIndex..., in: version)
-        guard semverRegex.firstMatch(in: version, range: versionRange) != nil else {
-            throw ComposeError.invalidValue("x-containerfy.version", version, "not valid semver")
+
+        // build_number (optional) — CFBundleVersion, which macOS and updaters compare; defaults to version
+        var buildNumber: String?
+        if let raw = xContainerfy["build_number"] {
+            buildNumber = try collect { try parseBuildNumber(raw) }
+        }
+
+        // min_containerfy_version (optional) — refuse files written for a newer containerfy
+        if let minVersion = xContainerfy["min_containerfy_version"] {
+            _ = try collect {
+                guard let minVersion = minVersion as? String,
+                      semverRegex.firstMatch(in: minVersion, range: NSRange(minVersion.startIndex..., in: minVersion)) != nil else {
+                    throw ComposeError.invalidValue("x-containerfy.min_containerfy_version", "\(minVersion)", "not valid semver")
+                }
+                try checkMinimumVersion(minVersion, current: ContainerfyVersion.current)
+            }
         }
 
-        // identifier (required)
-        guard let identifier = xContainerfy["identifier"] as? String, !identifier.isEmpty else {
-            throw ComposeError.missingField("x-containerfy.identifier")
+        // identifier (required unless overridden with --identifier)
+        let identifier = try collect { () throws -> String in
+            if let override = options.identifier {
+                guard isValidBundleIdentifier(override) else {
+                    throw ComposeError.invalidValue("--identifier", override, "must be a reverse-DNS bundle ID like com.example.app (letters, digits, '-' and '.')")
+                }
+                return override
+            }
+            guard let fromCompose = xContainerfy["identifier"] as? String, !fromCompose.isEmpty else {
+                throw ComposeError.missingField("x-containerfy.identifier")
+            }
+            let converted = bundleIdentifier(fromRepositoryURL: fromCompose)
+            guard isValidBundleIdentifier(converted) else {
+                let reason = converted == fromCompose
+                    ? "must be a reverse-DNS bundle ID like com.example.app (letters, digits, '-' and '.') or a repository URL like github.com/owner/repo"
+                    : "converts to \"\(converted)\", which is not a valid bundle ID (letters, digits, '-' and '.') — set a reverse-DNS identifier instead"
+                throw ComposeError.invalidValue("x-containerfy.identifier", fromCompose, reason)
+            }
+            return converted
         }
 
         // display_name (optional)
         let displayName = (xContainerfy["display_name"] as? String) ?? (xContainerfy["name"] as? String)
 
-        // icon (optional)
-        let icon = xContainerfy["icon"] as? String
+        // icon (optional) — becomes the app's Finder/Dock icon
+        var icon: String?
+        if let raw = xContainerfy["icon"] {
+            icon = try collect { () throws -> String in
+                guard let relative = raw as? String, !relative.isEmpty else {
+                    throw ComposeError.invalidValue("x-containerfy.icon", "\(raw)", "must be a file path relative to the compose file")
+                }
+                let ext = (relative as NSString).pathExtension.lowercased()
+                guard ext == "icns" || ext == "png" else {
+                    throw ComposeError.invalidValue("x-containerfy.icon", relative, "must be an .icns or .png file")
+                }
+                let resolved = relative.hasPrefix("/") ? relative : (composeDir as NSString).appendingPathComponent(relative)
+                var isDir: ObjCBool = false
+                guard FileManager.default.fileExists(atPath: resolved, isDirectory: &isDir), !isDir.boolValue else {
+                    throw ComposeError.invalidValue("x-containerfy.icon", relative, "no such file: \(resolved)")
+                }
+                if let root = confinementRoot {
+                    try checkConfined(resolved, original: relative, root: root, field: "x-containerfy.icon")
+                }
+                // Smaller or non-square icons are scaled up or squashed into a blurry Dock icon
+                guard let size = BundleAssembler.iconPixelSize(atPath: resolved) else {
+                    throw ComposeError.invalidValue("x-containerfy.icon", relative, "is not a valid PNG or ICNS image")
+                }
+                guard size.width == size.height else {
+                    throw ComposeError.invalidValue("x-containerfy.icon", relative, "is \(size.width)x\(size.height) — the icon must be square, ideally 1024x1024")
+                }
+                guard size.width >= BundleAssembler.minimumIconPixels else {
+                    throw ComposeError.invalidValue(
+                        "x-containerfy.icon", relative,
+                        "is \(size.width)x\(size.height) — the icon must be at least \(BundleAssembler.minimumIconPixels)x\(BundleAssembler.minimumIconPixels), ideally 1024x1024"
+                    )
+                }
+                if size.width < BundleAssembler.recommendedIconPixels {
+                    warnings.append("x-containerfy.icon is \(size.width)x\(size.height) — macOS uses 1024x1024 for the largest icon size, so it will look soft on Retina displays")
+                }
+                return resolved
+            }
+        }
+
+        // license (optional) — EULA shipped in the bundle and the .dmg
+        var license: String?
+        if let raw = xContainerfy["license"] {
+            license = try collect { () throws -> String in
+                guard let relative = raw as? String, !relative.isEmpty else {
+                    throw ComposeError.invalidValue("x-containerfy.license", "\(raw)", "must be a file path relative to the compose file")
+                }
+                let resolved = relative.hasPrefix("/") ? relative : (composeDir as NSString).appendingPathComponent(relative)
+                var isDir: ObjCBool = false
+                guard FileManager.default.fileExists(atPath: resolved, isDirectory: &isDir), !isDir.boolValue else {
+                    throw ComposeError.invalidValue("x-containerfy.license", relative, "no such file: \(resolved)")
+                }
+                if let root = confinementRoot {
+                    try checkConfined(resolved, original: relative, root: root, field: "x-containerfy.license")
+                }
+                return resolved
+            }
+        }
+
+        // ui (optional) — how the app presents itself
+        var runsInBackground = true
+        if let rawUI = xContainerfy["ui"] {
+            runsInBackground = try collect { () throws -> Bool in
+                guard let ui = rawUI as? [String: Any] else {
+                    throw ComposeError.invalidValue("x-containerfy.ui", "\(rawUI)", "must be a map")
+                }
+                guard let raw = ui["background"] else { return true }
+                guard let value = raw as? Bool else {
+                    throw ComposeError.invalidValue("x-containerfy.ui.background", "\(raw)", "must be true or false")
+                }
+                return value
+            } ?? true
+        }
+
+        // min_macos (optional) — LSMinimumSystemVersion; the runtime itself needs macOS 14
+        var minimumMacOS: String?
+        if let raw = xContainerfy["min_macos"] {
+            minimumMacOS = try collect { () throws -> String in
+                // YAML reads 14.5 as a number; keep what was written
+                let value = raw is String ? raw as! String : "\(raw)"
+                let parts = value.split(separator: ".", omittingEmptySubsequences: false)
+                guard (1...3).contains(parts.count), parts.allSatisfy({ !$0.isEmpty && $0.allSatisfy(\.isNumber) }),
+                      let major = Int(parts[0]) else {
+                    throw ComposeError.invalidValue("x-containerfy.min_macos", value, "must be a macOS version such as \"14.0\" or \"15.2\"")
+                }
+                let minimumMajor = Int(BundleAssembler.minimumSystemVersion.split(separator: ".")[0])!
+                guard major >= minimumMajor, major < 100 else {
+                    throw ComposeError.invalidValue(
+                        "x-containerfy.min_macos", value,
+                        "must be \(BundleAssembler.minimumSystemVersion) or later — containerfy apps need macOS \(minimumMajor)"
+                    )
+                }
+                return value
+            }
+        }
+
+        // category (optional) — how Finder and Launchpad classify the app
+        var category: String?
+        if let raw = xContainerfy["category"] {
+            category = try collect { () throws -> String in
+                guard let value = raw as? String, appCategories.contains(value) else {
+                    throw ComposeError.invalidValue(
+                        "x-containerfy.category", "\(raw)",
+                        "must be an Apple app category such as public.app-category.developer-tools or public.app-category.productivity"
+                    )
+                }
+                return value
+            }
+        }
+
+        // plist (optional) — extra Info.plist entries such as NSAppTransportSecurity or URL schemes
+        let infoPlistExtras = try collect { try parseInfoPlistExtras(xContainerfy["plist"], warnings: &warnings) } ?? [:]
+
+        // update (optional) — Sparkle feed and signing key, written into Info.plist
+        let updateFeed = try collect { try parseUpdateFeed(xContainerfy["update"]) } ?? nil
+
+        // labels (optional) — app-level inventory metadata
+        let labels = try collect { try parseLabels(xContainerfy["labels"]) } ?? [:]
 
         // vm (required)
-        guard let vm = xContainerfy["vm"] as? [String: Any] else {
-            throw ComposeError.missingField("x-containerfy.vm")
+        let vmConfig = try collect {
+            guard let vm = xContainerfy["vm"] as? [String: Any] else {
+                throw ComposeError.missingField("x-containerfy.vm")
+            }
+            return try parseVMConfig(vm, maxDiskMB: options.maxDiskMB)
         }
-        let (cpuMin, cpuRecommended, memoryMBMin, memoryMBRecommended, diskMB) = try parseVMConfig(vm)
 
         // Parse services with full validation
-        guard let svcs = root["services"] as? [String: Any] else {
-            throw ComposeError.missingField("services")
-        }
+        let errorsBeforeServices = errors.count
+        let svcs = try collect { () throws -> [String: Any] in
+            guard let svcs = root["services"] as? [String: Any] else {
+                throw ComposeError.missingField("services")
+            }
+            return svcs
+        } ?? [:]
 
         var allMappings: [PortMapping] = []
         var serviceInfos: [ServiceInfo] = []
         var images: [String] = []
         var seenImages = Set<String>()
-        var hostPorts: [Int] = []
+        // Keyed by "port/protocol": TCP and UDP on the same host port don't collide
+        var hostPortOwners: [String: String] = [:]
+        var tcpHostPorts = Set<Int>()
         var envFiles: [String] = []
+        var serviceSpecs: [ServiceSpec] = []
 
-        for (svcName, svcRaw) in svcs {
+        // Sorted so problems are reported in a stable order; each service reports its first one
+        for (svcName, svcRaw) in svcs.sorted(by: { $0.key < $1.key }) {
             guard let svc = svcRaw as? [String: Any] else { continue }
 
-            // Hard-reject validation
-            if svc["build"] != nil {
-                throw ComposeError.rejected(svcName, "build:", "use pre-built images only")
-            }
-            if svc["extends"] != nil {
-                throw ComposeError.rejected(svcName, "extends:", "not supported")
-            }
-            if svc["profiles"] != nil {
-                throw ComposeError.rejected(svcName, "profiles:", "not supported in v1")
-            }
-            if let nm = svc["network_mode"] as? String, nm == "host" {
-                throw ComposeError.rejected(svcName, "network_mode: host", "breaks port forwarding")
-            }
+            _ = try collect {
+                try checkServiceName(svcName)
+
+                // Hard-reject validation
+                if svc["build"] != nil {
+                    throw ComposeError.rejected(svcName, "build:", "use pre-built images only")
+                }
+                if let nm = svc["network_mode"] as? String, nm == "host" {
+                    throw ComposeError.rejected(svcName, "network_mode: host", "breaks port forwarding")
+                }
+                if (svc["privileged"] as? Bool) == true {
+                    guard options.allowPrivileged else {
+                        throw ComposeError.rejected(
+                            svcName, "privileged: true",
+                            "it gives the container full control of the VM every other service runs in (pass --allow-privileged to pack it anyway)"
+                        )
+                    }
+                    warnings.append("service \"\(svcName)\" runs privileged (--allow-privileged) — it has full control of the VM")
+                }
+
+                // Check volumes for bind mounts
+                if let vols = svc["volumes"] as? [Any] {
+                    for v in vols {
+                        if let volStr = v as? String, isBindMount(volStr) {
+                            throw ComposeError.rejected(svcName, "bind mount volume \"\(volStr)\"", "only named volumes are supported")
+                        }
+                        if let volMap = v as? [String: Any], (volMap["type"] as? String) == "bind" {
+                            throw ComposeError.rejected(svcName, "bind mount volume", "only named volumes are supported")
+                        }
+                    }
+                }
 
-            // Check volumes for bind mounts
-            if let vols = svc["volumes"] as? [Any] {
-                for v in vols {
-                    if let volStr = v as? String, isBindMount(volStr) {
-                        throw ComposeError.rejected(svcName, "bind mount volume \"\(volStr)\"", "only named volumes are supported")
+                // Extract image
+                if let image = svc["image"] as? String, !image.isEmpty {
+                    if !isPinnedImage(image) {
+                        if options.requirePinned {
+                            throw ComposeError.invalidValue(
+                                "services.\(svcName).image", image,
+                                "must have a version tag or @sha256: digest (--require-pinned)"
+                            )
+                        }
+                        warnings.append(unpinnedImageWarning(service: svcName, image: image))
                     }
-                    if let volMap = v as? [String: Any], (volMap["type"] as? String) == "bind" {
-                        throw ComposeError.rejected(svcName, "bind mount volume", "only named volumes are supported")
+                    if !seenImages.contains(image) {
+                        seenImages.insert(image)
+                        images.append(image)
                     }
                 }
-            }
 
-            // Extract image
-            if let image = svc["image"] as? String, !image.isEmpty {
-                if !seenImages.contains(image) {
-                    seenImages.insert(image)
-                    images.append(image)
+                // Extract ports
+                var svcMappings: [PortMapping] = []
+                if let ports = svc["ports"] as? [Any] {
+                    for port in ports {
+                        for mapping in try validatedPortEntries(port, field: "services.\(svcName).ports") {
+                            if mapping.hostPort < 1024 {
+                                if options.strict {
+                                    throw ComposeError.invalidValue("services.\(svcName).ports", "\(port)", "host port \(mapping.hostPort) is privileged (below 1024)")
+                                }
+                                warnings.append("service \"\(svcName)\" publishes privileged host port \(mapping.hostPort) — the VM's port forwarding may not be able to bind it")
+                            }
+                            let portKey = "\(mapping.hostPort)/\(mapping.protocol)"
+                            if let owner = hostPortOwners[portKey] {
+                                let reason = owner == svcName
+                                    ? "host port \(portKey) is published twice by service \"\(svcName)\""
+                                    : "host port \(portKey) is published by both \"\(min(owner, svcName))\" and \"\(max(owner, svcName))\""
+                                throw ComposeError.validationFailed(reason)
+                            }
+                            hostPortOwners[portKey] = svcName
+                            if mapping.protocol == "tcp" {
+                                tcpHostPorts.insert(Int(mapping.hostPort))
+                            }
+                            svcMappings.append(mapping)
+                        }
+                    }
                 }
-            }
 
-            // Extract ports
-            var svcMappings: [PortMapping] = []
-            if let ports = svc["ports"] as? [Any] {
-                for port in ports {
-                    if let mapping = parsePortEntry(port) {
-                        svcMappings.append(mapping)
-                        hostPorts.append(Int(mapping.hostPort))
+                if !svcMappings.isEmpty {
+                    allMappings.append(contentsOf: svcMappings)
+                    serviceInfos.append(ServiceInfo(
+                        name: svcName,
+                        displayLabel: titleCase(svcName),
+                        ports: svcMappings
+                    ))
+                }
+
+                // Extract env_file references
+                let svcEnvFiles = try extractEnvFiles(
+                    svc, serviceName: svcName, composeDir: composeDir, maxKB: options.maxEnvFileKB, confineTo: confinementRoot
+                )
+                envFiles.append(contentsOf: svcEnvFiles)
+
+                try checkBundledFileReferences(svc, kind: .secret, root: root, serviceName: svcName)
+                try checkBundledFileReferences(svc, kind: .config, root: root, serviceName: svcName)
+
+                // Linux capabilities
+                let capAdd = try parseCapabilities(svc["cap_add"], field: "services.\(svcName).cap_add")
+                let capDrop = try parseCapabilities(svc["cap_drop"], field: "services.\(svcName).cap_drop")
+                if let cap = capAdd.first(where: privilegedCapabilities.contains) {
+                    guard options.allowPrivileged else {
+                        throw ComposeError.rejected(
+                            svcName, "cap_add: \(cap)",
+                            "it lets the container take over the VM every other service runs in (pass --allow-privileged to pack it anyway)"
+                        )
                     }
+                    warnings.append("service \"\(svcName)\" adds capability \(cap) (--allow-privileged) — it can take over the VM")
                 }
-            }
 
-            if !svcMappings.isEmpty {
-                allMappings.append(contentsOf: svcMappings)
-                serviceInfos.append(ServiceInfo(
+                // Device passthrough (resolved inside the VM, not on the Mac)
+                let devices = try parseDevices(svc["devices"], serviceName: svcName)
+
+                // Memory tuning
+                var memSwappiness: Int?
+                if let raw = svc["mem_swappiness"] {
+                    guard let value = raw as? Int else {
+                        throw ComposeError.invalidValue("services.\(svcName).mem_swappiness", "\(raw)", "must be an integer 0-100")
+                    }
+                    guard (0...100).contains(value) else {
+                        throw ComposeError.outOfRange("services.\(svcName).mem_swappiness", "\(raw)", "must be an integer 0-100")
+                    }
+                    memSwappiness = value
+                }
+                var oomKillDisable: Bool?
+                if let raw = svc["oom_kill_disable"] {
+                    guard let value = raw as? Bool else {
+                        throw ComposeError.invalidValue("services.\(svcName).oom_kill_disable", "\(raw)", "must be true or false")
+                    }
+                    oomKillDisable = value
+                    if value {
+                        warnings.append("service \"\(svcName)\" sets oom_kill_disable — if it runs away it can exhaust the VM's memory and hang every service")
+                    }
+                }
+
+                let environment = try parseEnvironment(svc["environment"], serviceName: svcName)
+
+                // Healthcheck (kept for lint; podman compose validates the contents)
+                let healthcheck = svc["healthcheck"] as? [String: Any]
+                let healthcheckDisabled = (healthcheck?["disable"] as? Bool) == true
+                    || (healthcheck?["test"] as? [String])?.first == "NONE"
+
+                serviceSpecs.append(ServiceSpec(
                     name: svcName,
-                    displayLabel: titleCase(svcName),
-                    ports: svcMappings
+                    image: svc["image"] as? String,
+                    platform: try parsePlatform(svc["platform"], serviceName: svcName),
+                    containerName: try parseContainerName(svc["container_name"], serviceName: svcName),
+                    capAdd: capAdd,
+                    capDrop: capDrop,
+                    devices: devices,
+                    memSwappiness: memSwappiness,
+                    oomKillDisable: oomKillDisable,
+                    restart: try parseRestart(svc["restart"], serviceName: svcName, warnings: &warnings),
+                    dependsOn: try parseDependsOn(svc["depends_on"], serviceName: svcName),
+                    hasHealthcheck: healthcheck != nil && !healthcheckDisabled,
+                    healthcheckTimeout: healthcheck?["timeout"].map { "\($0)" },
+                    environment: environment,
+                    inlineEnvironmentKeys: inlineEnvironmentKeys(environment)
                 ))
             }
-
-            // Extract env_file references
-            let svcEnvFiles = try extractEnvFiles(svc, serviceName: svcName, composeDir: composeDir)
-            envFiles.append(contentsOf: svcEnvFiles)
         }
 
         serviceInfos.sort { $0.name < $1.name }
+        serviceSpecs.sort { $0.name < $1.name }
+
+        // Env files are copied flat into Resources: a file shared by services is bundled once,
+        // and two different files can't share a name
+        var seenEnvFiles = Set<String>()
+        envFiles = envFiles.filter { seenEnvFiles.insert(($0 as NSString).standardizingPath).inserted }
+        _ = try collect { try checkEnvFileNamesUnique(envFiles) }
+
+        // The checks below look across services; with a service already rejected they would
+        // only report follow-on problems
+        let servicesValid = errors.count == errorsBeforeServices
+
+        // depends_on must name existing services and be acyclic, or startup deadlocks in the VM
+        var startupOrder: [String] = []
+        if servicesValid {
+            startupOrder = try collect { try resolveStartupOrder(serviceSpecs) } ?? []
+            _ = try collect { try checkContainerNamesUnique(serviceSpecs) }
+        }
+
+        // The VM runs one architecture natively; a service pinned to the other one is emulated
+        let pinned = serviceSpecs.compactMap { spec in spec.platform.map { (spec.name, $0) } }
+        if Set(pinned.map { architecture(ofPlatform: $0.1) }).count > 1 {
+            warnings.append(
+                "services mix CPU architectures (" + pinned.map { "\($0.0): \($0.1)" }.joined(separator: ", ")
+                    + ") — the ones that don't match the Mac's CPU run under emulation in the VM and are noticeably slower"
+            )
+        }
+
+        // Must have at least one exposed port, and no more than the forwarder handles
+        if servicesValid, hostPortOwners.isEmpty {
+            errors.append(.validationFailed("no services with ports: found — at least one exposed port is required"))
+        }
+        _ = try collect { try checkPublishedPortCount(hostPortOwners.count) }
+
+        // Named-volume size limits and seeds (optional) — the VM disk is fixed, so unbounded volumes can fill it
+        var volumeLimitsMB: [String: Int] = [:]
+        var volumeSeeds: [VolumeSeed] = []
+        if let vmConfig {
+            (volumeLimitsMB, volumeSeeds) = try collect {
+                try parseVolumes(
+                    xContainerfy["volumes"], root: root, diskMB: vmConfig.diskMB, composeDir: composeDir,
+                    confineTo: confinementRoot, warnings: &warnings
+                )
+            } ?? (limitsMB: [:], seeds: [])
+        }
 
-        // Must have at least one exposed port
-        if hostPorts.isEmpty {
-            throw ComposeError.validationFailed("no services with ports: found — at least one exposed port is required")
+        // healthcheck / healthchecks (optional) — polled by the app to decide when services are ready
+        var healthchecks: [Healthcheck] = []
+        if servicesValid {
+            healthchecks = try collect { () throws -> [Healthcheck] in
+                switch (xContainerfy["healthcheck"], xContainerfy["healthchecks"]) {
+                case (let single?, nil):
+                    return [try parseHealthcheck(
+                        single, field: "x-containerfy.healthcheck", hostPorts: tcpHostPorts,
+                        strict: options.strict, warnings: &warnings
+                    )]
+                case (nil, let rawList?):
+                    guard let list = rawList as? [Any], !list.isEmpty else {
+                        throw ComposeError.invalidValue("x-containerfy.healthchecks", "\(rawList)", "must be a non-empty list of healthchecks")
+                    }
+                    return try list.enumerated().map { index, entry in
+                        try parseHealthcheck(
+                            entry, field: "x-containerfy.healthchecks[\(index)]", hostPorts: tcpHostPorts,
+                            strict: options.strict, warnings: &warnings
+                        )
+                    }
+                case (.some, .some):
+                    throw ComposeError.invalidValue("x-containerfy", "healthcheck and healthchecks", "use healthchecks: for several, not both")
+                case (nil, nil):
+                    return []
+                }
+            } ?? []
         }
 
+        guard errors.isEmpty, let name, let version, let identifier, let vmConfig else {
+            throw errors.count == 1 ? errors[0] : ComposeError.multiple(errors)
+        }
         return ComposeConfig(
             portMappings: allMappings,
             displayName: displayName,
             services: serviceInfos,
             name: name,
             version: version,
+            buildNumber: buildNumber,
             identifier: identifier,
             icon: icon,
-            cpuMin: cpuMin,
-            cpuRecommended: cpuRecommended,
-            memoryMBMin: memoryMBMin,
-            memoryMBRecommended: memoryMBRecommended,
-            diskMB: diskMB,
+            license: license,
+            runsInBackground: runsInBackground,
+            minimumMacOS: minimumMacOS,
+            category: category,
+            infoPlistExtras: infoPlistExtras,
+            updateFeed: updateFeed,
+            cpuMin: vmConfig.cpuMin,
+            cpuRecommended: vmConfig.cpuRec,
+            memoryMBMin: vmConfig.memMin,
+            memoryMBRecommended: vmConfig.memRec,
+            diskMB: vmConfig.diskMB,
+            volumeLimitsMB: volumeLimitsMB,
+            volumeSeeds: volumeSeeds,
             images: images,
             envFiles: envFiles,
+            bundledFiles: bundledFiles,
             composePath: fullPath,
-            composeDir: composeDir
+            composeDir: composeDir,
+            labels: labels,
+            serviceSpecs: serviceSpecs,
+            startupOrder: startupOrder,
+            healthchecks: healthchecks,
+            renderedCompose: renderedCompose,
+            warnings: warnings
         )
     }
 
-    // MARK: - VM Config
+    /// Every `${VAR}` reference in the compose file, checked against the environment pack would
+    /// interpolate with, for `validate --check-env`. Nothing else is validated.
+    static func environmentReferences(
+        composePath: String, options: BuildOptions = BuildOptions()
+    ) throws -> [ComposeInterpolation.Reference] {
+        let source = try loadSource(composePath: composePath, options: options)
+        return try ComposeInterpolation.references(in: source.root, environment: source.environment)
+    }
 
-    private static func parseVMConfig(_ vm: [String: Any]) throws -> (cpuMin: Int, cpuRec: Int, memMin: Int, memRec: Int, diskMB: Int) {
-        guard let cpu = vm["cpu"] as? [String: Any] else {
-            throw ComposeError.missingField("x-containerfy.vm.cpu")
-        }
-        let cpuMin = toInt(cpu["min"])
-        if cpuMin < 1 || cpuMin > 16 {
-            throw ComposeError.invalidValue("x-containerfy.vm.cpu.min", "\(cpuMin)", "must be 1-16")
+    /// The compose file `composePath` names (a file, or a directory holding one) with `--compose`
+    /// overrides merged and `extends:` resolved, and the environment to interpolate it with: the
+    /// packing shell's `--allow-env` variables, over the project's `.env`.
+    private static func loadSource(
+        composePath: String, options: BuildOptions
+    ) throws -> (fullPath: String, root: [String: Any], extended: Bool, environment: [String: String]) {
+        let absPath = (composePath as NSString).standardizingPath
+        var fullPath: String
+        if absPath.hasPrefix("/") {
+            fullPath = absPath
+        } else {
+            fullPath = FileManager.default.currentDirectoryPath + "/" + composePath
         }
-        var cpuRec = toInt(cpu["recommended"])
-        if cpuRec == 0 { cpuRec = cpuMin }
-        if cpuRec < cpuMin {
-            throw ComposeError.invalidValue("x-containerfy.vm.cpu.recommended", "\(cpuRec)", "must be >= min (\(cpuMin))")
+
+        var isDirectory: ObjCBool = false
+        if FileManager.default.fileExists(atPath: fullPath, isDirectory: &isDirectory), isDirectory.boolValue {
+            fullPath = try discoverComposeFile(inDirectory: fullPath)
         }
 
-        guard let mem = vm["memory_mb"] as? [String: Any] else {
-            throw ComposeError.missingField("x-containerfy.vm.memory_mb")
+        var root = try loadRoot(atPath: fullPath, format: options.composeFormat)
+        for overridePath in options.overrideComposePaths {
+            let absOverride = (overridePath as NSString).isAbsolutePath
+                ? overridePath
+                : FileManager.default.currentDirectoryPath + "/" + overridePath
+            let overlay = try loadRoot(atPath: (absOverride as NSString).standardizingPath, format: options.composeFormat)
+            root = ComposeMerge.merge(root, overlay)
         }
-        let memMin = toInt(mem["min"])
-        if memMin < 512 || memMin > 32768 {
-            throw ComposeError.invalidValue("x-containerfy.vm.memory_mb.min", "\(memMin)", "must be 512-32768")
+        if let source = options.remoteSource {
+            try rejectLocalFileReferences(in: root, source: source)
         }
-        var memRec = toInt(mem["recommended"])
-        if memRec == 0 { memRec = memMin }
-        if memRec < memMin {
-            throw ComposeError.invalidValue("x-containerfy.vm.memory_mb.recommended", "\(memRec)", "must be >= min (\(memMin))")
+        // extends: is resolved here, since the files it points at are not bundled
+        let extended = ComposeMerge.usesExtends(root)
+        if extended {
+            root = try ComposeMerge.resolveExtends(root, path: fullPath) { try loadRoot(atPath: $0, format: options.composeFormat) }
         }
 
-        let diskMB = toInt(vm["disk_mb"])
-        if diskMB < 1024 {
-            throw ComposeError.invalidValue("x-containerfy.vm.disk_mb", "\(diskMB)", "must be >= 1024")
-        }
+        let composeDir = (fullPath as NSString).deletingLastPathComponent
+        let searchUp = options.remoteSource == nil ? options.envFileSearchUp : 0
+        let dotEnv = dotEnvPath(composeDir: composeDir, searchUp: searchUp).map(ComposeInterpolation.loadDotEnv(atPath:)) ?? [:]
+        let shell = options.environment ?? ProcessInfo.processInfo.environment.filter { options.allowedEnvironment.contains($0.key) }
+        let environment = dotEnv.merging(shell) { _, shell in shell }
+        return (fullPath, root, extended, environment)
+    }
 
-        return (cpuMin, cpuRec, memMin, memRec, diskMB)
+    /// The `.env` to interpolate with: the one next to the compose file, or else the nearest one
+    /// in up to `searchUp` parent directories (a monorepo's shared `.env`).
+    static func dotEnvPath(composeDir: String, searchUp: Int) -> String? {
+        var dir = composeDir
+        for _ in 0...max(0, searchUp) {
+            let candidate = (dir as NSString).appendingPathComponent(".env")
+            if FileManager.default.fileExists(atPath: candidate) { return candidate }
+            let parent = (dir as NSString).deletingLastPathComponent
+            guard !parent.isEmpty, parent != dir else { break }
+            dir = parent
+        }
+        return nil
     }
 
-    // MARK: - Env Files
+    /// The name of the `*alias` Yams reported at `mark` (1-based line and column).
+    private static func aliasName(in yaml: String, at mark: Mark) -> String? {
+        let lines = yaml.components(separatedBy: "\n")
+        guard mark.line >= 1, mark.line <= lines.count else { return nil }
+        let rest = lines[mark.line - 1].dropFirst(max(0, mark.column - 1))
+        guard rest.first == "*" else { return nil }
+        let name = rest.dropFirst().prefix { !$0.isWhitespace && !",[]{}".contains($0) }
+        return name.isEmpty ? nil : String(name)
+    }
 
-    private static func extractEnvFiles(_ svc: [String: Any], serviceName: String, composeDir: String) throws -> [String] {
-        guard let ef = svc["env_file"] else { return [] }
+    /// Reads one compose file as a map, as JSON for `.json` files (or `format == .json`) and YAML otherwise.
+    private static func loadRoot(atPath fullPath: String, format: ComposeFormat?) throws -> [String: Any] {
+        guard let data = FileManager.default.contents(atPath: fullPath) else {
+            throw ComposeError.fileNotFound(fullPath)
+        }
+        guard let contents = String(data: data, encoding: .utf8) else {
+            throw ComposeError.invalidFormat
+        }
+        switch format ?? (fullPath.lowercased().hasSuffix(".json") ? .json : .yaml) {
+        case .yaml:
+            let fileName = (fullPath as NSString).lastPathComponent
+            let node: Node?
+            do {
+                node = try Yams.compose(yaml: contents)
+            } catch YamlError.composer(_, let problem, let mark, _) where problem == "found undefined alias" {
+                let name = aliasName(in: contents, at: mark) ?? "name"
+                throw ComposeError.validationFailed("\(fileName) line \(mark.line): alias *\(name) has no matching anchor (&\(name)) before it")
+            }
+            if let node {
+                try checkMergeKeys(node, path: "")
+            }
+            guard let yamlRoot = try Yams.load(yaml: contents) as? [String: Any] else {
+                throw ComposeError.invalidFormat
+            }
+            return yamlRoot
+        case .json:
+            return try loadJSONRoot(data, path: fullPath)
+        }
+    }
 
-        var paths: [String] = []
-        if let s = ef as? String {
-            paths = [s]
-        } else if let arr = ef as? [Any] {
-            for item in arr {
-                if let s = item as? String {
-                    paths.append(s)
-                } else if let m = item as? [String: Any], let p = m["path"] as? String {
-                    paths.append(p)
+    /// Yams expands `<<: *anchor` and `<<: [*a, *b]`, but silently drops a merge of anything other
+    /// than a map, which would leave a service without keys its author expects it to inherit.
+    private static func checkMergeKeys(_ node: Node, path: String) throws {
+        if let mapping = node.mapping {
+            for (key, value) in mapping {
+                let keyPath = path.isEmpty ? (key.string ?? "?") : "\(path).\(key.string ?? "?")"
+                if key.string == "<<" {
+                    let sources = value.sequence.map(Array.init) ?? [value]
+                    if value.mapping == nil, sources.contains(where: { $0.mapping == nil }) {
+                        throw ComposeError.invalidValue(
+                            keyPath,
+                            value.string ?? "<<",
+                            "a merge key must reference a map (<<: *anchor) or a list of maps (<<: [*a, *b])"
+                        )
+                    }
                 }
+                try checkMergeKeys(value, path: keyPath)
+            }
+        } else if let sequence = node.sequence {
+            for (index, item) in sequence.enumerated() {
+                try checkMergeKeys(item, path: "\(path)[\(index)]")
             }
         }
+    }
 
-        var result: [String] = []
-        let fm = FileManager.default
+    /// Parses a JSON compose file, reporting the parser's line/column on syntax errors.
+    private static func loadJSONRoot(_ data: Data, path: String) throws -> [String: Any] {
+        let object: Any
+        do {
+            object = try JSONSerialization.jsonObject(with: data)
+        } catch {
+            let detail = (error as NSError).userInfo[NSDebugDescriptionErrorKey] as? String ?? error.localizedDescription
+            throw ComposeError.validationFailed("\((path as NSString).lastPathComponent) is not valid JSON: \(detail)")
+        }
+        guard let root = object as? [String: Any] else {
+            throw ComposeError.validationFailed("\((path as NSString).lastPathComponent) must contain a JSON object at the top level")
+        }
+        return root
+    }
+
+    /// Turns a repository URL into a bundle ID: `https://github.com/acme/app` (scheme and `.git`
+    /// optional) becomes `com.github.acme.app`, and a bare `acme/app` becomes `acme.app`.
+    /// Anything without a `/` is returned unchanged.
+    static func bundleIdentifier(fromRepositoryURL value: String) -> String {
+        var path = value
+        for scheme in ["https://", "http://"] where path.hasPrefix(scheme) {
+            path = String(path.dropFirst(scheme.count))
+        }
+        if path.hasSuffix(".git") { path = String(path.dropLast(4)) }
+        var components = path.split(separator: "/").map(String.init)
+        guard path.contains("/"), let host = components.first else { return value }
+        if host.contains(".") {
+            components[0] = host.split(separator: ".").reversed().joined(separator: ".")
+        }
+        return components.joined(separator: ".")
+    }
+
+    static func isValidBundleIdentifier(_ identifier: String) -> Bool {
+        bundleIdentifierRegex.firstMatch(in: identifier, range: NSRange(identifier.startIndex..., in: identifier)) != nil
+    }
+
+    // MARK: - Compose File Discovery
+
+    /// Finds the compose file in `dir` using Docker Compose's precedence order.
+    /// The `.yaml` and `.yml` spellings of the same name existing side by side is ambiguous and rejected.
+    static func discoverComposeFile(inDirectory dir: String) throws -> String {
+        let fm = FileManager.default
+        let found = composeFileNames.filter { fm.fileExists(atPath: (dir as NSString).appendingPathComponent($0)) }
+
+        guard let first = found.first else {
+            throw ComposeError.validationFailed("no compose file found in \(dir) — expected one of: \(composeFileNames.joined(separator: ", "))")
+        }
+
+        let stem = (first as NSString).deletingPathExtension
+        let sameStem = found.filter { ($0 as NSString).deletingPathExtension == stem }
+        if sameStem.count > 1 {
+            throw ComposeError.validationFailed("ambiguous compose files in \(dir): \(sameStem.joined(separator: " and ")) — pass --compose with an explicit file")
+        }
+
+        return (dir as NSString).appendingPathComponent(first)
+    }
+
+    // MARK: - Minimum Version
+
+    /// Parses x-containerfy.build_number: a non-negative integer, or a string of one to three
+    /// period-separated integers. Anything else can't be ordered by macOS or an updater.
+    private static func parseBuildNumber(_ raw: Any) throws -> String {
+        let field = "x-containerfy.build_number"
+        let value: String
+        if let string = raw as? String {
+            value = string
+        } else if !(raw is Bool), let int = raw as? Int {
+            value = String(int)
+        } else if raw is Double {
+            throw ComposeError.invalidValue(field, "\(raw)", "quote dotted build numbers (\"1.10\") so YAML keeps them as text")
+        } else {
+            value = "\(raw)"
+        }
+        guard buildNumberRegex.firstMatch(in: value, range: NSRange(value.startIndex..., in: value)) != nil else {
+            throw ComposeError.invalidValue(field, value, "must be an integer or dotted integers like 42 or 1.2.42")
+        }
+        return value
+    }
+
+    /// Throws when the compose file requires a newer containerfy than `current`.
+    /// Development builds skip the check since they don't carry a release version.
+    static func checkMinimumVersion(_ required: String, current: String) throws {
+        if current.hasSuffix("-dev") { return }
+        if ContainerfyVersion.compare(current, required) == .orderedAscending {
+            throw ComposeError.validationFailed(
+                "this compose file requires containerfy \(required) or newer (running \(current)) — upgrade containerfy to pack it"
+            )
+        }
+    }
+
+    /// Service names must be DNS labels, and not one of `reservedServiceNames`.
+    private static func checkServiceName(_ svcName: String) throws {
+        let svcNameRange = NSRange(svcName.startIndex..., in: svcName)
+        guard serviceNameRegex.firstMatch(in: svcName, range: svcNameRange) != nil else {
+            throw ComposeError.invalidValue(
+                "services.\(svcName)", svcName,
+                "service names must be DNS labels: 1-63 chars of lowercase a-z, 0-9 and '-', not starting or ending with '-'"
+            )
+        }
+        if let reason = reservedServiceNames[svcName] {
+            throw ComposeError.invalidValue("services.\(svcName)", svcName, "\"\(svcName)\" is a reserved service name: \(reason)")
+        }
+    }
+
+    // MARK: - In-Memory Validation
+
+    /// Applies parseBuild's rules to a config that was built or edited in memory rather than
+    /// parsed: x-containerfy fields, VM sizing, service and container names, host ports,
+    /// depends_on and healthcheck ports. Every problem is reported at once. Checks that need the
+    /// compose file itself — hard-rejected keywords, bind mounts, referenced files — are not repeated.
+    static func validate(_ config: ComposeConfig, maxDiskMB: Int = BuildOptions().maxDiskMB) throws {
+        var errors: [ComposeError] = []
+        func collect(_ step: () throws -> Void) throws {
+            do {
+                try step()
+            } catch let error as ComposeError {
+                errors.append(error)
+            }
+        }
+
+        try collect {
+            guard let name = config.name, !name.isEmpty else { throw ComposeError.missingField("x-containerfy.name") }
+            guard nameRegex.firstMatch(in: name, range: NSRange(name.startIndex..., in: name)) != nil else {
+                throw ComposeError.invalidValue("x-containerfy.name", name, "must match ^[a-zA-Z][a-zA-Z0-9-]{0,63}$")
+            }
+        }
+        try collect {
+            guard let version = config.version, !version.isEmpty else { throw ComposeError.missingField("x-containerfy.version") }
+            guard semverRegex.firstMatch(in: version, range: NSRange(version.startIndex..., in: version)) != nil else {
+                throw ComposeError.invalidValue("x-containerfy.version", version, "not valid semver")
+            }
+        }
+        try collect {
+            if let buildNumber = config.buildNumber { _ = try parseBuildNumber(buildNumber) }
+        }
+        try collect {
+            if let feed = config.updateFeed {
+                _ = try parseUpdateFeed(["feed_url": feed.feedURL, "public_ed_key": feed.publicEDKey])
+            }
+        }
+        try collect {
+            guard let identifier = config.identifier, !identifier.isEmpty else { throw ComposeError.missingField("x-containerfy.identifier") }
+            guard isValidBundleIdentifier(identifier) else {
+                throw ComposeError.invalidValue("x-containerfy.identifier", identifier, "must be a reverse-DNS bundle ID like com.example.app (letters, digits, '-' and '.')")
+            }
+        }
+        try collect {
+            _ = try parseVMConfig([
+                "cpu": ["min": config.cpuMin ?? 0, "recommended": config.cpuRecommended ?? 0],
+                "memory_mb": ["min": config.memoryMBMin ?? 0, "recommended": config.memoryMBRecommended ?? 0],
+                "disk_mb": config.diskMB ?? 0,
+            ], maxDiskMB: maxDiskMB)
+        }
+
+        for spec in config.serviceSpecs {
+            try collect { try checkServiceName(spec.name) }
+        }
+        var hostPortOwners: [String: String] = [:]
+        for service in config.services {
+            for mapping in service.ports {
+                let portKey = "\(mapping.hostPort)/\(mapping.protocol)"
+                try collect {
+                    if let owner = hostPortOwners[portKey], owner != service.name {
+                        throw ComposeError.validationFailed("host port \(portKey) is published by both \"\(owner)\" and \"\(service.name)\"")
+                    }
+                    hostPortOwners[portKey] = service.name
+                }
+            }
+        }
+        try collect { try checkPublishedPortCount(hostPortOwners.count) }
+        try collect { try checkContainerNamesUnique(config.serviceSpecs) }
+        try collect { _ = try resolveStartupOrder(config.serviceSpecs) }
+
+        let tcpHostPorts = Set(config.portMappings.filter { $0.protocol == "tcp" }.map { Int($0.hostPort) })
+        for (index, healthcheck) in config.healthchecks.enumerated() {
+            let field = "x-containerfy.healthchecks[\(index)]"
+            try collect {
+                switch healthcheck {
+                case .http(let url, _):
+                    _ = try parseHealthcheckURL(url, field: "\(field).url", hostPorts: tcpHostPorts)
+                case .tcp(let port):
+                    guard tcpHostPorts.contains(Int(port)) else {
+                        throw ComposeError.invalidValue("\(field).tcp.port", "\(port)", "port must match a TCP host port in some service's ports:")
+                    }
+                }
+            }
+        }
+
+        guard errors.isEmpty else {
+            throw errors.count == 1 ? errors[0] : ComposeError.multiple(errors)
+        }
+    }
+
+    // MARK: - VM Config
+
+    private static func parseVMConfig(_ vm: [String: Any], maxDiskMB: Int) throws -> (cpuMin: Int, cpuRec: Int, memMin: Int, memRec: Int, diskMB: Int) {
+        guard let cpu = vm["cpu"] as? [String: Any] else {
+            throw ComposeError.missingField("x-containerfy.vm.cpu")
+        }
+        let cpuMin = toInt(cpu["min"])
+        if cpuMin < 1 || cpuMin > 16 {
+            throw ComposeError.outOfRange("x-containerfy.vm.cpu.min", "\(cpuMin)", "must be 1-16")
+        }
+        var cpuRec = toInt(cpu["recommended"])
+        if cpuRec == 0 { cpuRec = cpuMin }
+        if cpuRec < cpuMin {
+            throw ComposeError.outOfRange("x-containerfy.vm.cpu.recommended", "\(cpuRec)", "must be >= min (\(cpuMin))")
+        }
+
+        guard let mem = vm["memory_mb"] as? [String: Any] else {
+            throw ComposeError.missingField("x-containerfy.vm.memory_mb")
+        }
+        let memMin = toInt(mem["min"])
+        if memMin < 512 || memMin > 32768 {
+            throw ComposeError.outOfRange("x-containerfy.vm.memory_mb.min", "\(memMin)", "must be 512-32768")
+        }
+        var memRec = toInt(mem["recommended"])
+        if memRec == 0 { memRec = memMin }
+        if memRec < memMin {
+            throw ComposeError.outOfRange("x-containerfy.vm.memory_mb.recommended", "\(memRec)", "must be >= min (\(memMin))")
+        }
+
+        let diskMB = toInt(vm["disk_mb"])
+        if diskMB < 1024 {
+            throw ComposeError.outOfRange("x-containerfy.vm.disk_mb", "\(diskMB)", "must be >= 1024")
+        }
+        if diskMB > maxDiskMB {
+            throw ComposeError.outOfRange("x-containerfy.vm.disk_mb", "\(diskMB)", "must be <= \(maxDiskMB) (raise with --max-disk-mb)")
+        }
+
+        return (cpuMin, cpuRec, memMin, memRec, diskMB)
+    }
+
+    // MARK: - restart
+
+    private static let restartPolicies: Set<String> = ["no", "always", "on-failure", "unless-stopped"]
+
+    /// Docker's container name pattern, which podman follows.
+    private static let containerNameRegex = try! NSRegularExpression(pattern: #"^[a-zA-Z0-9][a-zA-Z0-9_.-]+$"#)
+
+    /// Prefix of names containerfy gives its own resources in the VM (the podman machine is `containerfy-<app>`).
+    static let reservedContainerNamePrefix = "containerfy-"
+
+    /// Validates `container_name:` — a valid container name outside containerfy's own namespace.
+    private static func parseContainerName(_ raw: Any?, serviceName: String) throws -> String? {
+        guard let raw else { return nil }
+        let field = "services.\(serviceName).container_name"
+        guard let name = raw as? String,
+              containerNameRegex.firstMatch(in: name, range: NSRange(name.startIndex..., in: name)) != nil else {
+            throw ComposeError.invalidValue(field, "\(raw)", "must be 2+ chars of a-z, A-Z, 0-9, '_', '.' and '-', starting with a letter or digit")
+        }
+        guard !name.lowercased().hasPrefix(reservedContainerNamePrefix) else {
+            throw ComposeError.invalidValue(field, name, "names starting with \"\(reservedContainerNamePrefix)\" are reserved for containerfy")
+        }
+        return name
+    }
+
+    /// Two services with the same `container_name` can't both start: the second `compose up` fails.
+    static func checkContainerNamesUnique(_ specs: [ServiceSpec]) throws {
+        var owners: [String: [String]] = [:]
+        for spec in specs {
+            if let name = spec.containerName { owners[name, default: []].append(spec.name) }
+        }
+        let duplicates = owners.filter { $0.value.count > 1 }.sorted { $0.key < $1.key }
+        guard duplicates.isEmpty else {
+            let details = duplicates.map { "\"\($0.key)\" (services \($0.value.sorted().joined(separator: ", ")))" }
+            throw ComposeError.validationFailed("container_name must be unique across services: \(details.joined(separator: "; ")) — rename or remove container_name")
+        }
+    }
+
+    /// Compose file format versions read the same way under the Compose Spec, which podman compose follows.
+    private static let composeFileVersionRegex = try! NSRegularExpression(pattern: #"^[23](\.[0-9]+)?$"#)
+
+    /// Checks the obsolete top-level `version:`. Files without one are Compose Spec files; 2.x and
+    /// 3.x files are read the same way. Anything else was written for a format containerfy doesn't
+    /// know, so its keys may not mean what the author expected.
+    private static func checkComposeFileVersion(_ raw: Any?, strict: Bool, warnings: inout [String]) throws {
+        guard let raw else { return }
+        let version = "\(raw)"
+        guard composeFileVersionRegex.firstMatch(in: version, range: NSRange(version.startIndex..., in: version)) == nil else { return }
+        let reason = "is not a compose file version containerfy supports (2.x, 3.x, or no version: for the Compose Spec) — the file is read with Compose Spec rules"
+        if strict {
+            throw ComposeError.invalidValue("version", version, reason)
+        }
+        warnings.append("top-level version \"\(version)\" \(reason)")
+    }
+
+    /// Validates `restart:` against the policies podman supports, including `on-failure:<max-retries>`.
+    /// `no` is allowed but warned about: a packaged app has nobody around to restart a crashed service.
+    private static func parseRestart(_ raw: Any?, serviceName: String, warnings: inout [String]) throws -> String? {
+        guard let raw else { return nil }
+        let field = "services.\(serviceName).restart"
+        // Unquoted `no` is a YAML 1.1 boolean
+        let policy = (raw as? Bool) == false ? "no" : "\(raw)"
+        let parts = policy.split(separator: ":", maxSplits: 1).map(String.init)
+        guard let base = parts.first, restartPolicies.contains(base) else {
+            throw ComposeError.invalidValue(field, policy, "must be one of no, always, on-failure, unless-stopped")
+        }
+        if parts.count == 2 {
+            guard base == "on-failure", let retries = Int(parts[1]), retries > 0 else {
+                throw ComposeError.invalidValue(field, policy, "only on-failure takes a retry count, as on-failure:<n> with n > 0")
+            }
+        }
+        if base == "no" {
+            warnings.append("service \"\(serviceName)\" sets restart: \"no\" — if it crashes it stays down until the app is restarted")
+        }
+        return policy
+    }
+
+    // MARK: - platform
+
+    /// Linux platforms a podman machine VM can run: its native architecture, and the other one
+    /// under emulation (Rosetta on Apple silicon).
+    private static let supportedPlatforms: Set<String> = ["linux/arm64", "linux/arm64/v8", "linux/amd64"]
+
+    private static func parsePlatform(_ raw: Any?, serviceName: String) throws -> String? {
+        guard let raw else { return nil }
+        let platform = "\(raw)"
+        guard supportedPlatforms.contains(platform.lowercased()) else {
+            throw ComposeError.invalidValue(
+                "services.\(serviceName).platform", platform,
+                "must be linux/arm64 or linux/amd64 — the app's VM runs Linux on those architectures only"
+            )
+        }
+        return platform
+    }
+
+    /// `arm64` for `linux/arm64/v8`, `amd64` for `linux/amd64`.
+    private static func architecture(ofPlatform platform: String) -> String {
+        let parts = platform.lowercased().split(separator: "/")
+        return parts.count > 1 ? String(parts[1]) : platform.lowercased()
+    }
+
+    // MARK: - depends_on
+
+    private static let dependencyConditions: Set<String> = ["service_started", "service_healthy", "service_completed_successfully"]
+
+    /// Reads `depends_on` in the list form (`[db]`) or the map form (`db: { condition: ... }`).
+    private static func parseDependsOn(_ raw: Any?, serviceName: String) throws -> [String] {
+        guard let raw else { return [] }
+        let field = "services.\(serviceName).depends_on"
+        if let list = raw as? [Any] {
+            return try list.map { entry in
+                guard let name = entry as? String else {
+                    throw ComposeError.invalidValue(field, "\(entry)", "list entries must be service names")
+                }
+                return name
+            }.sorted()
+        }
+        guard let map = raw as? [String: Any] else {
+            throw ComposeError.invalidValue(field, "\(raw)", "must be a list of service names or a map of service names to { condition: ... }")
+        }
+        for (name, value) in map {
+            guard let options = value as? [String: Any] else { continue }
+            if let condition = options["condition"], !dependencyConditions.contains("\(condition)") {
+                throw ComposeError.invalidValue(
+                    "\(field).\(name).condition", "\(condition)",
+                    "must be one of \(dependencyConditions.sorted().joined(separator: ", "))"
+                )
+            }
+        }
+        return map.keys.sorted()
+    }
+
+    /// Orders services so each starts after its dependencies (depth-first, in name order).
+    /// Throws for a dependency on an unknown service or a cycle, naming the cycle.
+    static func resolveStartupOrder(_ specs: [ServiceSpec]) throws -> [String] {
+        let dependencies = Dictionary(specs.map { ($0.name, $0.dependsOn) }, uniquingKeysWith: { first, _ in first })
+        for spec in specs {
+            for dependency in spec.dependsOn where dependencies[dependency] == nil {
+                throw ComposeError.invalidValue("services.\(spec.name).depends_on", dependency, "no service named \"\(dependency)\"")
+            }
+        }
+
+        var order: [String] = []
+        var finished = Set<String>()
+        var path: [String] = []
+        func visit(_ name: String) throws {
+            if finished.contains(name) { return }
+            if let start = path.firstIndex(of: name) {
+                let cycle = path[start...] + [name]
+                throw ComposeError.validationFailed(
+                    "depends_on cycle: \(cycle.joined(separator: " -> ")) — these services would wait for each other forever"
+                )
+            }
+            path.append(name)
+            for dependency in dependencies[name] ?? [] {
+                try visit(dependency)
+            }
+            path.removeLast()
+            finished.insert(name)
+            order.append(name)
+        }
+        for name in dependencies.keys.sorted() {
+            try visit(name)
+        }
+        return order
+    }
+
+    // MARK: - Volume Limits
+
+    /// Room on the VM disk that volume limits may not claim: the VM's own system and the
+    /// images, which are pulled at runtime so their size isn't known at pack time.
+    static let volumeReserveMB = 1024
+
+    /// Compose project the app runs under when the file has no top-level `name:` — compose names
+    /// it after the directory holding the bundled file, `Contents/Resources`.
+    static let composeProjectName = "resources"
+
+    /// Parses x-containerfy.volumes. Each key must be a top-level named volume with a `max_mb`
+    /// limit, a `seed` directory, or both. Limits — and the size of seeds without one — must fit in
+    /// disk_mb minus `volumeReserveMB`, and a seed must fit its own limit. Named volumes without a
+    /// limit get a warning.
+    private static func parseVolumes(
+        _ raw: Any?, root: [String: Any], diskMB: Int, composeDir: String, confineTo confinementRoot: String?,
+        warnings: inout [String]
+    ) throws -> (limitsMB: [String: Int], seeds: [VolumeSeed]) {
+        let topLevel = root["volumes"] as? [String: Any] ?? [:]
+        let namedVolumes = Set(topLevel.keys)
+        var limits: [String: Int] = [:]
+        var seeds: [VolumeSeed] = []
+        var seedMB: [String: Int] = [:]
+        if let raw {
+            guard let dict = raw as? [String: Any] else {
+                throw ComposeError.invalidValue("x-containerfy.volumes", "\(raw)", "must be a map of volume names to { max_mb: <n>, seed: <dir> }")
+            }
+            for (name, value) in dict.sorted(by: { $0.key < $1.key }) {
+                let field = "x-containerfy.volumes.\(name)"
+                guard namedVolumes.contains(name) else {
+                    throw ComposeError.invalidValue(field, name, "no top-level volumes entry named \"\(name)\"")
+                }
+                guard let entry = value as? [String: Any], entry["max_mb"] != nil || entry["seed"] != nil else {
+                    throw ComposeError.missingField("\(field).max_mb")
+                }
+                if entry["max_mb"] != nil {
+                    let maxMB = toInt(entry["max_mb"])
+                    guard maxMB > 0 else {
+                        throw ComposeError.invalidValue("\(field).max_mb", "\(entry["max_mb"] ?? "")", "must be a positive number of MB")
+                    }
+                    limits[name] = maxMB
+                }
+                if let rawSeed = entry["seed"] {
+                    guard let path = rawSeed as? String, !path.isEmpty else {
+                        throw ComposeError.invalidValue("\(field).seed", "\(rawSeed)", "must be a directory path, relative to the compose file")
+                    }
+                    let resolved = (path as NSString).isAbsolutePath ? path : (composeDir as NSString).appendingPathComponent(path)
+                    var isDir: ObjCBool = false
+                    guard FileManager.default.fileExists(atPath: resolved, isDirectory: &isDir) else {
+                        throw ComposeError.invalidValue("\(field).seed", path, "no such directory: \(resolved)")
+                    }
+                    guard isDir.boolValue else {
+                        throw ComposeError.invalidValue("\(field).seed", path, "must be a directory")
+                    }
+                    if let confinementRoot {
+                        try checkConfined(resolved, original: path, root: confinementRoot, field: "\(field).seed")
+                    }
+                    let bytes = BundleAssembler.fileSizes(under: resolved).reduce(UInt64(0)) { $0 + $1.bytes }
+                    let mb = Int((bytes + 1024 * 1024 - 1) / (1024 * 1024))
+                    if let maxMB = limits[name], mb > maxMB {
+                        throw ComposeError.invalidValue("\(field).seed", path, "holds \(mb) MB, more than the volume's max_mb of \(maxMB)")
+                    }
+                    let declaredName = (topLevel[name] as? [String: Any])?["name"] as? String
+                    let project = root["name"] as? String ?? composeProjectName
+                    seeds.append(VolumeSeed(
+                        volume: name,
+                        podmanName: declaredName ?? "\(project)_\(name)",
+                        source: (resolved as NSString).standardizingPath
+                    ))
+                    seedMB[name] = mb
+                }
+            }
+        }
+
+        let total = limits.values.reduce(0, +) + seedMB.filter { limits[$0.key] == nil }.values.reduce(0, +)
+        let budget = diskMB - volumeReserveMB
+        if total > budget {
+            throw ComposeError.validationFailed(
+                "named volume limits and seeds add up to \(total) MB, more than the \(budget) MB available (x-containerfy.vm.disk_mb \(diskMB) minus \(volumeReserveMB) MB for the VM and images) — lower max_mb, shrink the seeds, or raise disk_mb"
+            )
+        }
+        for name in namedVolumes.subtracting(limits.keys).sorted() {
+            warnings.append("named volume \"\(name)\" has no x-containerfy.volumes.\(name).max_mb — it can grow until the VM disk is full")
+        }
+        return (limits, seeds)
+    }
+
+    // MARK: - Category
+
+    /// Apple's LSApplicationCategoryType values.
+    static let appCategories: Set<String> = Set([
+        "business", "developer-tools", "education", "entertainment", "finance", "games", "graphics-design",
+        "healthcare-fitness", "lifestyle", "medical", "music", "news", "photography", "productivity", "reference",
+        "social-networking", "sports", "travel", "utilities", "video", "weather",
+        "action-games", "adventure-games", "arcade-games", "board-games", "card-games", "casino-games", "dice-games",
+        "educational-games", "family-games", "kids-games", "music-games", "puzzle-games", "racing-games",
+        "role-playing-games", "simulation-games", "sports-games", "strategy-games", "trivia-games", "word-games",
+    ].map { "public.app-category.\($0)" })
+
+    // MARK: - Update Feed
+
+    /// Parses x-containerfy.update. Both keys are required: Sparkle only installs updates signed
+    /// with the public key, and only fetches the feed over HTTPS.
+    private static func parseUpdateFeed(_ raw: Any?) throws -> UpdateFeed? {
+        guard let raw else { return nil }
+        guard let map = raw as? [String: Any] else {
+            throw ComposeError.invalidValue("x-containerfy.update", "\(raw)", "must be a map with feed_url and public_ed_key")
+        }
+        guard let rawURL = map["feed_url"] else { throw ComposeError.missingField("x-containerfy.update.feed_url") }
+        guard let feedURL = rawURL as? String,
+              let components = URLComponents(string: feedURL),
+              components.scheme?.lowercased() == "https", !(components.host ?? "").isEmpty else {
+            throw ComposeError.invalidValue("x-containerfy.update.feed_url", "\(rawURL)", "must be an https:// URL")
+        }
+        guard let rawKey = map["public_ed_key"] else { throw ComposeError.missingField("x-containerfy.update.public_ed_key") }
+        guard let key = rawKey as? String, let data = Data(base64Encoded: key), data.count == 32 else {
+            throw ComposeError.invalidValue(
+                "x-containerfy.update.public_ed_key", "\(rawKey)",
+                "must be a base64 EdDSA public key (32 bytes), as printed by Sparkle's generate_keys"
+            )
+        }
+        return UpdateFeed(feedURL: feedURL, publicEDKey: key)
+    }
+
+    // MARK: - Info.plist Extras
+
+    /// Info.plist keys containerfy writes itself, with the x-containerfy field that sets each (if any).
+    static let builtInPlistKeys: [String: String?] = [
+        "CFBundleIdentifier": "identifier", "CFBundleName": "name", "CFBundleDisplayName": "display_name",
+        "CFBundleVersion": "build_number", "CFBundleShortVersionString": "version", "CFBundleIconFile": "icon",
+        "LSUIElement": "ui.background", "LSMinimumSystemVersion": "min_macos", "LSApplicationCategoryType": "category",
+        "CFBundleExecutable": nil, "CFBundlePackageType": nil, "CFBundleInfoDictionaryVersion": nil,
+        "NSHumanReadableCopyright": nil, BundleAssembler.builderVersionKey: nil,
+        BundleAssembler.composeDigestKey: nil, BundleAssembler.configDigestKey: nil,
+        "SUFeedURL": "update.feed_url", "SUPublicEDKey": "update.public_ed_key",
+    ]
+
+    /// Parses `x-containerfy.plist`. Keys containerfy writes itself keep containerfy's value and are
+    /// dropped with a warning naming the x-containerfy field to use instead.
+    private static func parseInfoPlistExtras(_ raw: Any?, warnings: inout [String]) throws -> [String: PlistValue] {
+        guard let raw else { return [:] }
+        guard let map = raw as? [String: Any] else {
+            throw ComposeError.invalidValue("x-containerfy.plist", "\(raw)", "must be a map of Info.plist keys to values")
+        }
+
+        var extras: [String: PlistValue] = [:]
+        for (key, item) in map.sorted(by: { $0.key < $1.key }) {
+            guard !key.isEmpty else {
+                throw ComposeError.invalidValue("x-containerfy.plist", key, "keys must not be empty")
+            }
+            guard let value = PlistValue(item) else {
+                throw ComposeError.invalidValue(
+                    "x-containerfy.plist.\(key)", "\(item)",
+                    "must be a string, number, boolean, list or map (null and dates are not supported)"
+                )
+            }
+            if let field = builtInPlistKeys[key] {
+                let hint = field.map { " — set x-containerfy.\($0) instead" } ?? ""
+                warnings.append("x-containerfy.plist.\(key) is ignored because containerfy sets \(key) itself\(hint)")
+                continue
+            }
+            extras[key] = value
+        }
+        return extras
+    }
+
+    // MARK: - Labels
+
+    private static func parseLabels(_ raw: Any?) throws -> [String: String] {
+        guard let raw else { return [:] }
+        guard let dict = raw as? [String: Any] else {
+            throw ComposeError.invalidValue("x-containerfy.labels", "\(raw)", "must be a map of string keys to string values")
+        }
+
+        var labels: [String: String] = [:]
+        for (key, value) in dict {
+            let keyRange = NSRange(key.startIndex..., in: key)
+            guard labelKeyRegex.firstMatch(in: key, range: keyRange) != nil else {
+                throw ComposeError.invalidValue("x-containerfy.labels", key, "keys must be 1-128 chars of [a-zA-Z0-9._-], starting and ending alphanumeric")
+            }
+            guard let str = value as? String else {
+                throw ComposeError.invalidValue("x-containerfy.labels.\(key)", "\(value)", "must be a string (quote numbers and booleans)")
+            }
+            labels[key] = str
+        }
+        return labels
+    }
+
+    // MARK: - Global Environment
+
+    private static let environmentNameRegex = try! NSRegularExpression(pattern: "^[A-Za-z_][A-Za-z0-9_]*$")
+
+    /// `x-containerfy.env`: variables every service gets unless it sets them itself.
+    private static func parseGlobalEnvironment(_ raw: Any) throws -> [String: String] {
+        guard let dict = raw as? [String: Any] else {
+            throw ComposeError.invalidValue("x-containerfy.env", "\(raw)", "must be a map of variable names to values")
+        }
+        var variables: [String: String] = [:]
+        for (key, value) in dict {
+            guard environmentNameRegex.firstMatch(in: key, range: NSRange(key.startIndex..., in: key)) != nil else {
+                throw ComposeError.invalidValue("x-containerfy.env", key, "variable names must be letters, digits and _, not starting with a digit")
+            }
+            if value is NSNull || value is [Any] || value is [String: Any] {
+                throw ComposeError.invalidValue("x-containerfy.env.\(key)", "\(value)", "must be a string, number or boolean")
+            }
+            variables[key] = "\(value)"
+        }
+        return variables
+    }
+
+    /// Adds `x-containerfy.env` (read from `root` itself, so the bundled copy keeps its escaped
+    /// `$$`) to each service's `environment:`, skipping variables the service already sets in
+    /// `environment:` or one of its env files. List-form environments get `KEY=value` entries.
+    private static func mergeGlobalEnvironment(into root: [String: Any], composeDir: String) -> [String: Any] {
+        guard let raw = (root["x-containerfy"] as? [String: Any])?["env"],
+              let globals = try? parseGlobalEnvironment(raw), !globals.isEmpty,
+              var services = root["services"] as? [String: Any] else { return root }
+
+        for (name, value) in services {
+            guard var svc = value as? [String: Any] else { continue }
+            var own = Set<String>()
+            let envFiles: [Any] = (svc["env_file"] as? [Any]) ?? svc["env_file"].map { [$0] } ?? []
+            for entry in envFiles {
+                guard let path = (entry as? String) ?? ((entry as? [String: Any])?["path"] as? String) else { continue }
+                let abs = (path as NSString).isAbsolutePath ? path : (composeDir as NSString).appendingPathComponent(path)
+                own.formUnion(ComposeInterpolation.loadDotEnv(atPath: abs).keys)
+            }
+
+            if let list = svc["environment"] as? [Any] {
+                for item in list {
+                    guard let entry = item as? String else { continue }
+                    own.insert(String(entry.prefix { $0 != "=" }))
+                }
+                svc["environment"] = list + globals.keys.sorted().filter { !own.contains($0) }.map { "\($0)=\(globals[$0]!)" }
+            } else if svc["environment"] == nil || svc["environment"] is [String: Any] {
+                var map = svc["environment"] as? [String: Any] ?? [:]
+                own.formUnion(map.keys)
+                for (key, value) in globals where !own.contains(key) {
+                    map[key] = value
+                }
+                svc["environment"] = map
+            }
+            services[name] = svc
+        }
+        var result = root
+        result["services"] = services
+        return result
+    }
+
+    // MARK: - Capabilities
+
+    /// Linux capability names accepted by `cap_add` / `cap_drop`, without the `CAP_` prefix.
+    static let knownCapabilities: Set<String> = [
+        "ALL",
+        "AUDIT_CONTROL", "AUDIT_READ", "AUDIT_WRITE", "BLOCK_SUSPEND", "BPF", "CHECKPOINT_RESTORE",
+        "CHOWN", "DAC_OVERRIDE", "DAC_READ_SEARCH", "FOWNER", "FSETID", "IPC_LOCK", "IPC_OWNER",
+        "KILL", "LEASE", "LINUX_IMMUTABLE", "MAC_ADMIN", "MAC_OVERRIDE", "MKNOD", "NET_ADMIN",
+        "NET_BIND_SERVICE", "NET_BROADCAST", "NET_RAW", "PERFMON", "SETFCAP", "SETGID", "SETPCAP",
+        "SETUID", "SYS_ADMIN", "SYS_BOOT", "SYS_CHROOT", "SYS_MODULE", "SYS_NICE", "SYS_PACCT",
+        "SYS_PTRACE", "SYS_RAWIO", "SYS_RESOURCE", "SYS_TIME", "SYS_TTY_CONFIG", "SYSLOG", "WAKE_ALARM",
+    ]
+
+    /// Capabilities that amount to control of the VM kernel; `cap_add` rejects them without `--allow-privileged`.
+    static let privilegedCapabilities: Set<String> = ["ALL", "SYS_ADMIN", "SYS_MODULE", "SYS_RAWIO", "SYS_BOOT", "SYS_TIME", "MAC_ADMIN", "BPF"]
+
+    /// Parses a `cap_add` / `cap_drop` list, normalizing to uppercase without the `CAP_` prefix.
+    private static func parseCapabilities(_ raw: Any?, field: String) throws -> [String] {
+        guard let raw else { return [] }
+        guard let list = raw as? [Any] else {
+            throw ComposeError.invalidValue(field, "\(raw)", "must be a list of capability names")
+        }
+
+        var caps: [String] = []
+        for item in list {
+            guard let str = item as? String else {
+                throw ComposeError.invalidValue(field, "\(item)", "must be a capability name")
+            }
+            var cap = str.uppercased()
+            if cap.hasPrefix("CAP_") { cap = String(cap.dropFirst(4)) }
+            guard knownCapabilities.contains(cap) else {
+                throw ComposeError.invalidValue(field, str, "not a known Linux capability")
+            }
+            caps.append(cap)
+        }
+        return caps
+    }
+
+    // MARK: - Devices
+
+    /// Device nodes that exist inside the Fedora CoreOS VM. Host hardware (USB, GPU, audio,
+    /// serial) is never forwarded into the VM, so anything else would fail at `compose up`.
+    static let vmSupportedDevices: Set<String> = [
+        "/dev/net/tun", "/dev/fuse",
+        "/dev/null", "/dev/zero", "/dev/full", "/dev/random", "/dev/urandom", "/dev/tty",
+    ]
+
+    /// Parses a service's `devices:` list (short `host[:container[:perms]]` or long `source`/`target`/`permissions` form).
+    private static func parseDevices(_ raw: Any?, serviceName: String) throws -> [DeviceMapping] {
+        guard let raw else { return [] }
+        let field = "services.\(serviceName).devices"
+        guard let list = raw as? [Any] else {
+            throw ComposeError.invalidValue(field, "\(raw)", "must be a list of device mappings")
+        }
+
+        var devices: [DeviceMapping] = []
+        for item in list {
+            let mapping: DeviceMapping
+            if let str = item as? String {
+                let parts = str.split(separator: ":", omittingEmptySubsequences: false).map(String.init)
+                guard parts.count <= 3, !parts[0].isEmpty else {
+                    throw ComposeError.invalidValue(field, str, "expected host[:container[:permissions]]")
+                }
+                mapping = DeviceMapping(
+                    hostPath: parts[0],
+                    containerPath: parts.count > 1 ? parts[1] : parts[0],
+                    permissions: parts.count > 2 ? parts[2] : "rwm"
+                )
+            } else if let map = item as? [String: Any], let source = map["source"] as? String {
+                let target = (map["target"] as? String) ?? source
+                mapping = DeviceMapping(hostPath: source, containerPath: target, permissions: (map["permissions"] as? String) ?? "rwm")
+            } else {
+                throw ComposeError.invalidValue(field, "\(item)", "expected host[:container[:permissions]] or a map with source")
+            }
+
+            guard mapping.containerPath.hasPrefix("/") else {
+                throw ComposeError.invalidValue(field, mapping.containerPath, "container path must be absolute")
+            }
+            guard !mapping.permissions.isEmpty, mapping.permissions.allSatisfy({ "rwm".contains($0) }) else {
+                throw ComposeError.invalidValue(field, mapping.permissions, "permissions must be a combination of r, w, m")
+            }
+            guard vmSupportedDevices.contains(mapping.hostPath) else {
+                throw ComposeError.rejected(
+                    serviceName, "device \"\(mapping.hostPath)\"",
+                    "host devices are not available inside the VM (supported: \(vmSupportedDevices.sorted().joined(separator: ", ")))"
+                )
+            }
+            devices.append(mapping)
+        }
+        return devices
+    }
+
+    // MARK: - Env Files
+
+    private static func extractEnvFiles(
+        _ svc: [String: Any], serviceName: String, composeDir: String, maxKB: Int, confineTo root: String? = nil
+    ) throws -> [String] {
+        guard let ef = svc["env_file"] else { return [] }
+
+        var paths: [String] = []
+        if let s = ef as? String {
+            paths = [s]
+        } else if let arr = ef as? [Any] {
+            for item in arr {
+                if let s = item as? String {
+                    paths.append(s)
+                } else if let m = item as? [String: Any], let p = m["path"] as? String {
+                    paths.append(p)
+                }
+            }
+        }
+
+        var result: [String] = []
+        let fm = FileManager.default
         for p in paths {
             let abs: String
             if (p as NSString).isAbsolutePath {
@@ -347,12 +1986,234 @@ enum ComposeConfigParser {
             guard fm.fileExists(atPath: abs) else {
                 throw ComposeError.validationFailed("service \"\(serviceName)\" references env_file \"\(p)\" which does not exist")
             }
+            if let root {
+                try checkConfined(abs, original: p, root: root, field: "services.\(serviceName).env_file")
+            }
+            let size = (try? fm.attributesOfItem(atPath: abs)[.size] as? NSNumber)?.intValue ?? 0
+            if size > maxKB * 1024 {
+                throw ComposeError.validationFailed(
+                    "service \"\(serviceName)\" references env_file \"\(p)\" which is \(size / 1024) KB (limit \(maxKB) KB) — check it points at the right file, or raise --max-env-file-kb"
+                )
+            }
+            let contents = EnvFile.normalize(fm.contents(atPath: abs) ?? Data())
+            if let problem = EnvFile.firstProblem(in: contents) {
+                throw ComposeError.validationFailed(
+                    "service \"\(serviceName)\" env_file \"\(p)\" line \(problem.line): \(problem.reason) — expected KEY=VALUE, a # comment, or a blank line"
+                )
+            }
             result.append(abs)
         }
 
         return result
     }
 
+    /// Characters that make an `env_file` entry a glob pattern rather than a literal path.
+    private static let globCharacters = CharacterSet(charactersIn: "*?[")
+
+    /// Replaces every `env_file` entry whose file name is a glob (`./config/*.env`) with the files
+    /// it matches, sorted, written relative to the same directory as the pattern. Returns nil when
+    /// no service uses a glob, so the compose file is bundled untouched.
+    private static func expandEnvFileGlobs(in root: [String: Any], composeDir: String) throws -> [String: Any]? {
+        guard var services = root["services"] as? [String: Any] else { return nil }
+        var expandedAny = false
+        for (svcName, value) in services {
+            guard var svc = value as? [String: Any], let ef = svc["env_file"] else { continue }
+            let entries: [Any] = (ef as? [Any]) ?? [ef]
+            var expanded: [Any] = []
+            var globbed = false
+            for entry in entries {
+                let dict = entry as? [String: Any]
+                guard let pattern = (entry as? String) ?? (dict?["path"] as? String),
+                      pattern.rangeOfCharacter(from: globCharacters) != nil else {
+                    expanded.append(entry)
+                    continue
+                }
+                globbed = true
+                for path in try matchEnvFileGlob(pattern, serviceName: svcName, composeDir: composeDir) {
+                    if var dict {
+                        dict["path"] = path
+                        expanded.append(dict)
+                    } else {
+                        expanded.append(path)
+                    }
+                }
+            }
+            if globbed {
+                svc["env_file"] = expanded
+                services[svcName] = svc
+                expandedAny = true
+            }
+        }
+        guard expandedAny else { return nil }
+        var result = root
+        result["services"] = services
+        return result
+    }
+
+    /// Files matching `pattern`, with wildcards allowed in the file name only. Hidden files match
+    /// only if the pattern itself starts with `.`, as in a shell.
+    private static func matchEnvFileGlob(_ pattern: String, serviceName: String, composeDir: String) throws -> [String] {
+        let field = "services.\(serviceName).env_file"
+        let dir = (pattern as NSString).deletingLastPathComponent
+        let namePattern = (pattern as NSString).lastPathComponent
+        guard dir.rangeOfCharacter(from: globCharacters) == nil else {
+            throw ComposeError.invalidValue(field, pattern, "wildcards are only supported in the file name, not in directories")
+        }
+        let absDir = (dir as NSString).isAbsolutePath ? dir : (composeDir as NSString).appendingPathComponent(dir)
+        let fm = FileManager.default
+        let names = ((try? fm.contentsOfDirectory(atPath: absDir)) ?? []).filter { name in
+            var isDir: ObjCBool = false
+            let abs = (absDir as NSString).appendingPathComponent(name)
+            return fnmatch(namePattern, name, FNM_PERIOD) == 0 && fm.fileExists(atPath: abs, isDirectory: &isDir) && !isDir.boolValue
+        }
+        guard !names.isEmpty else {
+            throw ComposeError.validationFailed("service \"\(serviceName)\" references env_file pattern \"\(pattern)\" which matches no files")
+        }
+        return names.sorted().map { dir.isEmpty ? $0 : (dir as NSString).appendingPathComponent($0) }
+    }
+
+    /// Env files land side by side in Resources, so two with the same file name would overwrite each other.
+    private static func checkEnvFileNamesUnique(_ envFiles: [String]) throws {
+        var byName: [String: [String]] = [:]
+        for path in envFiles {
+            byName[(path as NSString).lastPathComponent, default: []].append(path)
+        }
+        if let (name, paths) = byName.filter({ $0.value.count > 1 }).min(by: { $0.key < $1.key }) {
+            throw ComposeError.validationFailed(
+                "env files \(paths.joined(separator: " and ")) are both named \"\(name)\" and would collide in the bundle — rename one"
+            )
+        }
+    }
+
+    // MARK: - Secrets and Configs
+
+    /// Reads the top-level `secrets:` or `configs:` block. Only `file:` sources can be bundled:
+    /// external entries need a swarm or secret store, and `environment:` would be read on the end
+    /// user's Mac. Inline `content:` configs stay in the compose file as they are.
+    private static func parseBundledFiles(
+        _ root: [String: Any], kind: BundledFile.Kind, composeDir: String, confineTo confinementRoot: String?
+    ) throws -> [BundledFile] {
+        guard let raw = root[kind.key] else { return [] }
+        guard let entries = raw as? [String: Any] else {
+            throw ComposeError.invalidValue(kind.key, "\(raw)", "must be a map of \(kind.rawValue) names to definitions")
+        }
+
+        var files: [BundledFile] = []
+        for (name, rawEntry) in entries.sorted(by: { $0.key < $1.key }) {
+            let field = "\(kind.key).\(name)"
+            guard labelKeyRegex.firstMatch(in: name, range: NSRange(name.startIndex..., in: name)) != nil else {
+                throw ComposeError.invalidValue(field, name, "\(kind.rawValue) names may only contain letters, digits, '.', '_' and '-'")
+            }
+            guard let entry = rawEntry as? [String: Any] else {
+                throw ComposeError.invalidValue(field, "\(rawEntry)", "must be a map with file:")
+            }
+            if entry["external"] != nil {
+                throw ComposeError.invalidValue(field, "external", "external \(kind.key) are not supported — the packed app has no swarm or secret store; use file:")
+            }
+            if entry["environment"] != nil {
+                throw ComposeError.invalidValue(field, "environment", "\(kind.key) from environment variables are not supported — the variable would be read on the end user's Mac; use file:")
+            }
+            if kind == .config, entry["content"] is String {
+                continue
+            }
+            guard let path = entry["file"] as? String, !path.isEmpty else {
+                throw ComposeError.missingField("\(field).file")
+            }
+            let resolved = (path as NSString).isAbsolutePath ? path : (composeDir as NSString).appendingPathComponent(path)
+            var isDir: ObjCBool = false
+            guard FileManager.default.fileExists(atPath: resolved, isDirectory: &isDir), !isDir.boolValue else {
+                throw ComposeError.validationFailed("\(kind.rawValue) \"\(name)\" references file \"\(path)\" which does not exist")
+            }
+            if let confinementRoot {
+                try checkConfined(resolved, original: path, root: confinementRoot, field: "\(field).file")
+            }
+            files.append(BundledFile(kind: kind, name: name, source: resolved, bundlePath: "\(kind.key)/\(name)"))
+        }
+        return files
+    }
+
+    /// Every `services.<name>.secrets` or `.configs` entry (short `name` or long `{source: name}` form) must
+    /// name a top-level entry.
+    private static func checkBundledFileReferences(
+        _ svc: [String: Any], kind: BundledFile.Kind, root: [String: Any], serviceName: String
+    ) throws {
+        guard let raw = svc[kind.key] else { return }
+        let field = "services.\(serviceName).\(kind.key)"
+        guard let references = raw as? [Any] else {
+            throw ComposeError.invalidValue(field, "\(raw)", "must be a list")
+        }
+        let declared = Set((root[kind.key] as? [String: Any])?.keys.map { $0 } ?? [])
+        for reference in references {
+            let name: String
+            if let short = reference as? String {
+                name = short
+            } else if let long = reference as? [String: Any], let source = long["source"] as? String {
+                name = source
+            } else {
+                throw ComposeError.invalidValue(field, "\(reference)", "entries must be a \(kind.rawValue) name or a map with source:")
+            }
+            guard declared.contains(name) else {
+                throw ComposeError.invalidValue(field, name, "no top-level \(kind.key) entry named \"\(name)\"")
+            }
+        }
+    }
+
+    /// Points each bundled file's `file:` at its copy in the bundle.
+    private static func rewriteBundledFileSources(_ files: [BundledFile], in root: [String: Any]) -> [String: Any] {
+        var result = root
+        for file in files {
+            var entries = result[file.kind.key] as? [String: Any] ?? [:]
+            var entry = entries[file.name] as? [String: Any] ?? [:]
+            entry["file"] = "./" + file.bundlePath
+            entries[file.name] = entry
+            result[file.kind.key] = entries
+        }
+        return result
+    }
+
+    /// For a compose file fetched from `source`: every reference to a file next to it is an error,
+    /// since only the compose file itself was downloaded.
+    private static func rejectLocalFileReferences(in root: [String: Any], source: String) throws {
+        var errors: [ComposeError] = []
+        func reject(_ field: String, _ value: Any) {
+            errors.append(.invalidValue(field, "\(value)", "local files can't be referenced from a compose file fetched from \(source) — clone the repository and pack it from disk"))
+        }
+
+        let x = root["x-containerfy"] as? [String: Any] ?? [:]
+        for key in ["icon", "license"] {
+            if let value = x[key] { reject("x-containerfy.\(key)", value) }
+        }
+        for kind in [BundledFile.Kind.secret, .config] {
+            let entries = root[kind.key] as? [String: Any] ?? [:]
+            for name in entries.keys.sorted() {
+                if let file = (entries[name] as? [String: Any])?["file"] { reject("\(kind.key).\(name).file", file) }
+            }
+        }
+        let services = root["services"] as? [String: Any] ?? [:]
+        for name in services.keys.sorted() {
+            guard let svc = services[name] as? [String: Any] else { continue }
+            if let envFile = svc["env_file"] { reject("services.\(name).env_file", envFile) }
+            if let file = (svc["extends"] as? [String: Any])?["file"] { reject("services.\(name).extends.file", file) }
+        }
+        let volumes = x["volumes"] as? [String: Any] ?? [:]
+        for name in volumes.keys.sorted() {
+            if let seed = (volumes[name] as? [String: Any])?["seed"] { reject("x-containerfy.volumes.\(name).seed", seed) }
+        }
+
+        if errors.count == 1 { throw errors[0] }
+        if !errors.isEmpty { throw ComposeError.multiple(errors) }
+    }
+
+    /// Throws unless `path`, with `..` and symlinks resolved, is `root` or lies beneath it.
+    private static func checkConfined(_ path: String, original: String, root: String, field: String) throws {
+        let absRoot = (root as NSString).isAbsolutePath ? root : FileManager.default.currentDirectoryPath + "/" + root
+        let resolvedRoot = ((absRoot as NSString).standardizingPath as NSString).resolvingSymlinksInPath
+        let resolved = ((path as NSString).standardizingPath as NSString).resolvingSymlinksInPath
+        guard resolved == resolvedRoot || resolved.hasPrefix(resolvedRoot.hasSuffix("/") ? resolvedRoot : resolvedRoot + "/") else {
+            throw ComposeError.invalidValue(field, original, "resolves to \(resolved), outside \(resolvedRoot) (--confine-paths)")
+        }
+    }
+
     // MARK: - Bind Mount Detection
 
     private static func isBindMount(_ vol: String) -> Bool {
@@ -376,9 +2237,7 @@ enum ComposeConfigParser {
 
             var svcMappings: [PortMapping] = []
             for port in ports {
-                if let mapping = parsePortEntry(port) {
-                    svcMappings.append(mapping)
-                }
+                svcMappings.append(contentsOf: parsePortEntries(port))
             }
 
             if !svcMappings.isEmpty {
@@ -405,49 +2264,135 @@ enum ComposeConfigParser {
             .joined(separator: " ")
     }
 
-    /// Parses a single port entry. Supports:
+    /// Runtime variant of `validatedPortEntries` — malformed entries are skipped.
+    private static func parsePortEntries(_ entry: Any) -> [PortMapping] {
+        (try? validatedPortEntries(entry, field: "ports")) ?? []
+    }
+
+    /// Largest number of ports a single ranged entry may publish.
+    static let maxPortRangeSpan = 1024
+
+    /// Most distinct host ports (per protocol) all services together may publish. Each one is a
+    /// separate forward in the app's port forwarder, which stops being reliable beyond this.
+    static let maxPublishedPorts = 1024
+
+    private static func checkPublishedPortCount(_ count: Int) throws {
+        guard count <= maxPublishedPorts else {
+            throw ComposeError.validationFailed(
+                "services publish \(count) host ports, more than the limit of \(maxPublishedPorts) the app can forward — publish fewer or narrower port ranges"
+            )
+        }
+    }
+
+    /// Parses a single port entry into one mapping per published port. Supports:
     /// - `"8000:8000"` (string, host:container)
     /// - `"8000"` (string, same host and container)
+    /// - `"8000-8005:9000-9005"`, `"8000-8005"` (string ranges of equal length)
     /// - `8000` (integer, same host and container)
-    /// - `{ published: 8000, target: 8000 }` (long-form)
-    private static func parsePortEntry(_ entry: Any) -> PortMapping? {
+    /// - `{ published: 8000, target: 8000, protocol: udp }` (long-form)
+    /// The protocol defaults to tcp.
+    private static func validatedPortEntries(_ entry: Any, field: String) throws -> [PortMapping] {
         if let str = entry as? String {
-            return parsePortString(str)
+            return try validatedPortString(str, field: field)
         }
-        if let num = entry as? Int, let port = UInt16(exactly: num) {
-            return PortMapping(hostPort: port, containerPort: port)
+        if let num = entry as? Int {
+            let port = try portNumber("\(num)", entry: "\(num)", field: field)
+            return [PortMapping(hostPort: port, containerPort: port)]
         }
         if let dict = entry as? [String: Any] {
-            guard let published = dict["published"], let target = dict["target"] else { return nil }
-            guard let hostPort = asUInt16(published), let containerPort = asUInt16(target) else { return nil }
-            return PortMapping(hostPort: hostPort, containerPort: containerPort)
+            guard let published = dict["published"], let target = dict["target"] else {
+                throw ComposeError.invalidValue(field, "\(dict)", "long-form ports need both published and target")
+            }
+            let hostPort = try portNumber("\(published)", entry: "\(dict)", field: field)
+            let containerPort = try portNumber("\(target)", entry: "\(dict)", field: field)
+            let proto = try portProtocol(dict["protocol"].map { "\($0)" }, entry: "\(dict)", field: field)
+            return [PortMapping(hostPort: hostPort, containerPort: containerPort, protocol: proto)]
         }
-        return nil
+        throw ComposeError.invalidValue(field, "\(entry)", "expected a port string, number, or published/target map")
     }
 
-    /// Parses `"8000:8000"`, `"127.0.0.1:8000:8000"`, `"8000:8000/tcp"`, `"8000"`.
-    private static func parsePortString(_ str: String) -> PortMapping? {
-        // Strip protocol suffix (e.g. "/tcp", "/udp")
-        let base = str.split(separator: "/").first.map(String.init) ?? str
+    /// Parses `"8000:8000"`, `"127.0.0.1:8000:8000"`, `"8000:8000/udp"`, `"8000"`, and the same
+    /// forms with `start-end` ranges on both sides.
+    private static func validatedPortString(_ str: String, field: String) throws -> [PortMapping] {
+        // Split off the protocol suffix (e.g. "/tcp", "/udp")
+        let slashParts = str.split(separator: "/", maxSplits: 1).map(String.init)
+        let base = slashParts.first ?? str
+        let proto = try portProtocol(slashParts.count > 1 ? slashParts[1] : nil, entry: str, field: field)
 
         let parts = base.split(separator: ":").map(String.init)
 
+        let hostRange: ClosedRange<UInt16>
+        let containerRange: ClosedRange<UInt16>
         switch parts.count {
         case 1:
             // "8000" — same host and container
-            guard let port = UInt16(parts[0]) else { return nil }
-            return PortMapping(hostPort: port, containerPort: port)
+            hostRange = try portRange(parts[0], entry: str, field: field)
+            containerRange = hostRange
         case 2:
             // "8000:8000"
-            guard let hostPort = UInt16(parts[0]), let containerPort = UInt16(parts[1]) else { return nil }
-            return PortMapping(hostPort: hostPort, containerPort: containerPort)
+            hostRange = try portRange(parts[0], entry: str, field: field)
+            containerRange = try portRange(parts[1], entry: str, field: field)
         case 3:
             // "127.0.0.1:8000:8000" — IP:host:container
-            guard let hostPort = UInt16(parts[1]), let containerPort = UInt16(parts[2]) else { return nil }
-            return PortMapping(hostPort: hostPort, containerPort: containerPort)
+            hostRange = try portRange(parts[1], entry: str, field: field)
+            containerRange = try portRange(parts[2], entry: str, field: field)
         default:
-            return nil
+            throw ComposeError.invalidValue(field, str, "expected [ip:]host:container or a single port")
+        }
+
+        guard hostRange.count == containerRange.count else {
+            throw ComposeError.invalidValue(
+                field, str,
+                "host range has \(hostRange.count) port(s) but container range has \(containerRange.count)"
+            )
         }
+        return zip(hostRange, containerRange).map { PortMapping(hostPort: $0, containerPort: $1, protocol: proto) }
+    }
+
+    /// Normalizes a port protocol; nil means tcp. Only tcp and udp are forwarded by the VM.
+    private static func portProtocol(_ raw: String?, entry: String, field: String) throws -> String {
+        guard let raw else { return "tcp" }
+        let proto = raw.lowercased()
+        guard proto == "tcp" || proto == "udp" else {
+            throw ComposeError.invalidValue(field, entry, "protocol must be tcp or udp")
+        }
+        return proto
+    }
+
+    /// `"8000"` or `"8000-8010"`. A range must be ascending and span at most `maxPortRangeSpan` ports.
+    private static func portRange(_ raw: String, entry: String, field: String) throws -> ClosedRange<UInt16> {
+        let bounds = raw.split(separator: "-", omittingEmptySubsequences: false).map(String.init)
+        switch bounds.count {
+        case 1:
+            let port = try portNumber(raw, entry: entry, field: field)
+            return port...port
+        case 2:
+            let start = try portNumber(bounds[0], entry: entry, field: field)
+            let end = try portNumber(bounds[1], entry: entry, field: field)
+            guard start <= end else {
+                throw ComposeError.invalidValue(field, entry, "port range \(raw) must be ascending")
+            }
+            guard Int(end) - Int(start) + 1 <= maxPortRangeSpan else {
+                throw ComposeError.invalidValue(
+                    field, entry,
+                    "port range \(raw) publishes \(Int(end) - Int(start) + 1) ports (limit \(maxPortRangeSpan))"
+                )
+            }
+            return start...end
+        default:
+            throw ComposeError.invalidValue(field, entry, "\"\(raw)\" is not a port or port range")
+        }
+    }
+
+    /// A single port number in 1-65535.
+    private static func portNumber(_ raw: String, entry: String, field: String) throws -> UInt16 {
+        guard let n = Int(raw) else {
+            throw ComposeError.invalidValue(field, entry, "\"\(raw)\" is not a port number")
+        }
+        guard (1...65535).contains(n) else {
+            throw ComposeError.outOfRange(field, entry, "port \(n) is out of range (1-65535)")
+        }
+        return UInt16(n)
     }
 
     private static func parseDisplayName(from root: [String: Any]) -> String? {
@@ -455,10 +2400,178 @@ enum ComposeConfigParser {
         return (xContainerfy["display_name"] as? String) ?? (xContainerfy["name"] as? String)
     }
 
-    private static func asUInt16(_ value: Any) -> UInt16? {
-        if let i = value as? Int { return UInt16(exactly: i) }
-        if let s = value as? String { return UInt16(s) }
-        return nil
+    /// Replaces `services.<name>.image` for each override. Every named service must exist
+    /// and every reference must be a well-formed image reference.
+    private static func applyImageOverrides(_ overrides: [String: String], to root: [String: Any]) throws -> [String: Any] {
+        guard var services = root["services"] as? [String: Any] else {
+            throw ComposeError.missingField("services")
+        }
+        for (service, image) in overrides.sorted(by: { $0.key < $1.key }) {
+            guard var svc = services[service] as? [String: Any] else {
+                let known = services.keys.sorted().joined(separator: ", ")
+                throw ComposeError.invalidValue("--override-image", "\(service)=\(image)", "no service named \"\(service)\" (services: \(known))")
+            }
+            guard isValidImageReference(image) else {
+                throw ComposeError.invalidValue("--override-image", "\(service)=\(image)", "not a valid image reference")
+            }
+            svc["image"] = image
+            services[service] = svc
+        }
+        var result = root
+        result["services"] = services
+        return result
+    }
+
+    private static func usesProfiles(_ root: [String: Any]) -> Bool {
+        (root["services"] as? [String: Any])?.values.contains { ($0 as? [String: Any])?["profiles"] != nil } ?? false
+    }
+
+    /// Drops services whose `profiles:` name none of `active`, and strips `profiles:` from the
+    /// rest, matching `docker compose --profile`: services without profiles always start.
+    private static func applyProfiles(_ active: [String], to root: [String: Any]) throws -> [String: Any] {
+        guard var services = root["services"] as? [String: Any] else {
+            throw ComposeError.missingField("services")
+        }
+        for (name, raw) in services {
+            guard var svc = raw as? [String: Any], let rawProfiles = svc["profiles"] else { continue }
+            guard let profiles = rawProfiles as? [Any], profiles.allSatisfy({ $0 is String }) else {
+                throw ComposeError.invalidValue("services.\(name).profiles", "\(rawProfiles)", "must be a list of profile names")
+            }
+            if profiles.contains(where: { active.contains($0 as! String) }) {
+                svc.removeValue(forKey: "profiles")
+                services[name] = svc
+            } else {
+                services.removeValue(forKey: name)
+            }
+        }
+        var result = root
+        result["services"] = services
+        return result
+    }
+
+    /// An image is pinned when it has a digest, or a tag other than `latest`.
+    static func isPinnedImage(_ image: String) -> Bool {
+        if image.contains("@sha256:") { return true }
+        // The tag follows the last ':' after the last '/', so registry ports don't count.
+        let lastComponent = image.split(separator: "/").last.map(String.init) ?? image
+        guard let colon = lastComponent.lastIndex(of: ":") else { return false }
+        return lastComponent[lastComponent.index(after: colon)...] != "latest"
+    }
+
+    /// Shared with ComposeLinter's unpinned-image rule so lint reports it once.
+    static func unpinnedImageWarning(service: String, image: String) -> String {
+        "service \"\(service)\" uses unpinned image \(image) — users may get a different image than you tested"
+    }
+
+    static func isValidImageReference(_ image: String) -> Bool {
+        imageReferenceRegex.firstMatch(in: image, range: NSRange(image.startIndex..., in: image)) != nil
+    }
+
+    /// Parses a healthcheck map: exactly one of `url:` (HTTP) or `tcp:` (`{host, port}`; host
+    /// defaults to 127.0.0.1). Either way the port must be published over TCP by some service.
+    private static func parseHealthcheck(
+        _ raw: Any, field: String, hostPorts: Set<Int>, strict: Bool, warnings: inout [String]
+    ) throws -> Healthcheck {
+        guard let map = raw as? [String: Any] else {
+            throw ComposeError.invalidValue(field, "\(raw)", "must be a map with url: or tcp:")
+        }
+        switch (map["url"], map["tcp"]) {
+        case (let rawURL?, nil):
+            let (url, path) = try parseHealthcheckURL(rawURL, field: "\(field).url", hostPorts: hostPorts)
+            if path == "/" {
+                let reason = "has no path — many apps return 404 on /, so the app would never become ready; use an explicit endpoint like /health"
+                if strict {
+                    throw ComposeError.invalidValue("\(field).url", url, reason)
+                }
+                warnings.append("\(field).url \(url) \(reason)")
+            }
+            return .http(url: url, path: path)
+        case (nil, let rawTCP?):
+            return .tcp(port: try parseHealthcheckTCP(rawTCP, field: "\(field).tcp", hostPorts: hostPorts))
+        case (.some, .some):
+            throw ComposeError.invalidValue(field, "url and tcp", "set either url: or tcp:, not both")
+        case (nil, nil):
+            throw ComposeError.missingField("\(field).url or \(field).tcp")
+        }
+    }
+
+    /// Validates a `tcp: {host, port}` healthcheck target and returns its port.
+    private static func parseHealthcheckTCP(_ raw: Any, field: String, hostPorts: Set<Int>) throws -> UInt16 {
+        guard let map = raw as? [String: Any], let rawPort = map["port"] else {
+            throw ComposeError.invalidValue(field, "\(raw)", "must be a map with port: (and optionally host:)")
+        }
+        let host = map["host"].map { "\($0)" } ?? "127.0.0.1"
+        guard loopbackHosts.contains(host.lowercased()) else {
+            throw ComposeError.invalidValue("\(field).host", host, "host must be loopback: 127.0.0.1, localhost or [::1]")
+        }
+        let port = try portNumber("\(rawPort)", entry: "\(rawPort)", field: "\(field).port")
+        guard hostPorts.contains(Int(port)) else {
+            throw ComposeError.invalidValue("\(field).port", "\(port)", "port must match a TCP host port in some service's ports:")
+        }
+        return port
+    }
+
+    /// Host spellings accepted for loopback in healthcheck URLs; all are stored as 127.0.0.1.
+    static let loopbackHosts: Set<String> = ["127.0.0.1", "localhost", "::1", "[::1]"]
+
+    /// Validates a healthcheck url: an http URL on a loopback host whose port is published
+    /// over TCP by some service. Returns the URL with its host normalized to 127.0.0.1, and its path,
+    /// with an empty path normalized to "/".
+    private static func parseHealthcheckURL(_ raw: Any, field: String, hostPorts: Set<Int>) throws -> (url: String, path: String) {
+        guard let url = raw as? String, var components = URLComponents(string: url),
+              components.scheme == "http", let host = components.host else {
+            throw ComposeError.invalidValue(field, "\(raw)", "must be an http:// URL")
+        }
+        guard loopbackHosts.contains(host.lowercased()) else {
+            throw ComposeError.invalidValue(field, url, "host must be loopback: 127.0.0.1, localhost or [::1]")
+        }
+        guard let port = components.port, hostPorts.contains(port) else {
+            throw ComposeError.invalidValue(field, url, "port must match a TCP host port in some service's ports:")
+        }
+        components.host = "127.0.0.1"
+        let path = components.path.isEmpty ? "/" : components.path
+        return (components.string ?? url, path)
+    }
+
+    /// Reads `environment:` in map or `KEY=value` list form. A bare `KEY` (or `KEY:` with no
+    /// value) is kept with a nil value; compose takes it from the environment it runs in.
+    private static func parseEnvironment(_ raw: Any?, serviceName: String) throws -> [EnvironmentVariable] {
+        guard let raw else { return [] }
+        let field = "services.\(serviceName).environment"
+        var variables: [EnvironmentVariable] = []
+        if let map = raw as? [String: Any] {
+            for (key, value) in map {
+                if value is [Any] || value is [String: Any] {
+                    throw ComposeError.invalidValue("\(field).\(key)", "\(value)", "must be a string, number or boolean")
+                }
+                variables.append(EnvironmentVariable(name: key, value: value is NSNull ? nil : "\(value)"))
+            }
+        } else if let list = raw as? [Any] {
+            for item in list {
+                guard let entry = item as? String, !entry.isEmpty, !entry.hasPrefix("=") else {
+                    throw ComposeError.invalidValue(field, "\(item)", "list entries must be KEY=value or KEY")
+                }
+                guard let eq = entry.firstIndex(of: "=") else {
+                    variables.append(EnvironmentVariable(name: entry, value: nil))
+                    continue
+                }
+                variables.append(EnvironmentVariable(name: String(entry[..<eq]), value: String(entry[entry.index(after: eq)...])))
+            }
+        } else {
+            throw ComposeError.invalidValue(field, "\(raw)", "must be a map or a list of KEY=value entries")
+        }
+        return variables.sorted { $0.name < $1.name }
+    }
+
+    /// Variables that carry a literal value. Bare `KEY` entries and escaped `$${...}` references
+    /// are resolved when the app runs, so they're skipped.
+    private static func inlineEnvironmentKeys(_ environment: [EnvironmentVariable]) -> [String] {
+        environment
+            .filter { variable in
+                guard let value = variable.value, !value.isEmpty else { return false }
+                return !(value.hasPrefix("${") && value.hasSuffix("}"))
+            }
+            .map(\.name)
     }
 
     private static func toInt(_ value: Any?) -> Int {
@@ -474,8 +2587,58 @@ enum ComposeConfigParser {
         case fileNotFound(String)
         case missingField(String)
         case invalidValue(String, String, String)
+        /// A number outside its allowed range: field, value, reason. Reads like `invalidValue`.
+        case outOfRange(String, String, String)
         case rejected(String, String, String)
         case validationFailed(String)
+        /// Several problems found in one pass, in the order they were checked.
+        case multiple([ComposeError])
+
+        /// Machine-readable kind of problem, stable across releases so tooling can branch on it.
+        enum Code: String, Sendable, Encodable {
+            case invalidFormat = "INVALID_FORMAT"
+            case fileNotFound = "FILE_NOT_FOUND"
+            case missingField = "MISSING_FIELD"
+            case invalidValue = "INVALID_VALUE"
+            case range = "RANGE"
+            case unsupported = "UNSUPPORTED"
+            case invalid = "INVALID"
+            case multiple = "MULTIPLE"
+        }
+
+        var code: Code {
+            switch self {
+            case .invalidFormat: return .invalidFormat
+            case .fileNotFound: return .fileNotFound
+            case .missingField: return .missingField
+            case .invalidValue: return .invalidValue
+            case .outOfRange: return .range
+            case .rejected: return .unsupported
+            case .validationFailed: return .invalid
+            case .multiple: return .multiple
+            }
+        }
+
+        /// Dotted path of the offending key (`x-containerfy.vm.cpu.min`, `services.web`), when
+        /// the problem is tied to one.
+        var field: String? {
+            switch self {
+            case .missingField(let field), .invalidValue(let field, _, _), .outOfRange(let field, _, _):
+                return field
+            case .rejected(let service, _, _):
+                return "services.\(service)"
+            case .invalidFormat, .fileNotFound, .validationFailed, .multiple:
+                return nil
+            }
+        }
+
+        /// The individual problems, with `multiple` flattened.
+        var problems: [ComposeError] {
+            if case .multiple(let errors) = self {
+                return errors.flatMap(\.problems)
+            }
+            return [self]
+        }
 
         var errorDescription: String? {
             switch self {
@@ -485,13 +2648,34 @@ enum ComposeConfigParser {
                 return "compose file not found: \(path)"
             case .missingField(let field):
                 return "\(field) is required"
-            case .invalidValue(let field, let value, let reason):
+            case .invalidValue(let field, let value, let reason), .outOfRange(let field, let value, let reason):
                 return "\(field) \"\(value)\" is invalid: \(reason)"
             case .rejected(let service, let keyword, let reason):
                 return "service \"\(service)\" uses \(keyword) which is not supported — \(reason)"
             case .validationFailed(let msg):
                 return msg
+            case .multiple(let errors):
+                return "\(errors.count) problems:\n" + errors.map { "  - \($0.errorDescription ?? "\($0)")" }.joined(separator: "\n")
+            }
+        }
+    }
+
+    /// One validation problem as `validate --json` reports it.
+    struct ValidationProblem: Sendable, Equatable, Encodable {
+        var code: ComposeError.Code
+        var field: String?
+        var message: String
+    }
+
+    /// `error` as a list of classified problems. YAML syntax errors count as `INVALID_FORMAT`;
+    /// any other error that isn't a `ComposeError` is reported as `INVALID`.
+    static func validationProblems(in error: Error) -> [ValidationProblem] {
+        if let composeError = error as? ComposeError {
+            return composeError.problems.map {
+                ValidationProblem(code: $0.code, field: $0.field, message: $0.errorDescription ?? "\($0)")
             }
         }
+        let code: ComposeError.Code = error is YamlError ? .invalidFormat : .invalid
+        return [ValidationProblem(code: code, field: nil, message: error.localizedDescription)]
     }
 }
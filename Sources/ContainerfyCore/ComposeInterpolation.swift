@@ -0,0 +1,264 @@
+import Foundation
+
+/// Docker Compose-style `${VAR}` interpolation over a parsed compose file.
+///
+/// Values are resolved at pack time against the project's `.env` plus the packing shell's
+/// `--allow-env` variables, because the packed app runs on machines that have neither. Like
+/// Compose, only values are interpolated — keys and comments are left alone.
+enum ComposeInterpolation {
+
+    /// Supported forms: `$VAR`, `${VAR}`, `${VAR:-default}`, `${VAR-default}`, `${VAR:?error}`,
+    /// `${VAR?error}`, `${VAR:+alt}`, `${VAR+alt}`, and `$$` for a literal `$`. Defaults,
+    /// alternatives and errors may themselves hold references, as in `${A:-${B}}`.
+    /// Unlike Compose, a plain `${VAR}` that is unset is an error: it would otherwise bake
+    /// an empty string into the bundle.
+    static func interpolate(
+        _ value: Any,
+        environment: [String: String],
+        field: String = "",
+        escapeDollars: Bool = false
+    ) throws -> (value: Any, substituted: Bool) {
+        if let str = value as? String {
+            return try interpolate(string: str, environment: environment, field: field, escapeDollars: escapeDollars)
+        }
+        if let map = value as? [String: Any] {
+            var result: [String: Any] = [:]
+            var substituted = false
+            for (key, child) in map {
+                let (newChild, changed) = try interpolate(
+                    child, environment: environment, field: field.isEmpty ? key : "\(field).\(key)", escapeDollars: escapeDollars
+                )
+                result[key] = newChild
+                substituted = substituted || changed
+            }
+            return (result, substituted)
+        }
+        if let list = value as? [Any] {
+            var substituted = false
+            let result = try list.enumerated().map { index, child -> Any in
+                let (newChild, changed) = try interpolate(child, environment: environment, field: "\(field)[\(index)]", escapeDollars: escapeDollars)
+                substituted = substituted || changed
+                return newChild
+            }
+            return (result, substituted)
+        }
+        return (value, false)
+    }
+
+    /// Interpolates one string. With `escapeDollars`, the output is meant to be read by Compose
+    /// again, so `$$` stays escaped and substituted values have their `$` doubled.
+    static func interpolate(
+        string: String,
+        environment: [String: String],
+        field: String,
+        escapeDollars: Bool = false
+    ) throws -> (value: String, substituted: Bool) {
+        try substitute(string, field: field, escapeDollars: escapeDollars) { body in
+            try resolve(body, environment: environment, field: field)
+        }
+    }
+
+    /// One variable reference in a compose file, as `validate --check-env` reports it.
+    struct Reference: Equatable, Sendable, Encodable {
+        enum Status: String, Sendable, Encodable {
+            /// The variable has a value that is used.
+            case set
+            /// Optional and unset (or empty, for `:-`), so its default or alternative is used.
+            case defaulted
+            /// Required and unset (or empty, for `:?`): pack would fail.
+            case missing
+        }
+
+        let name: String
+        /// Where it appears, e.g. `services.web.environment.LOG_LEVEL`.
+        let field: String
+        /// false for `${VAR:-x}`, `${VAR-x}`, `${VAR:+x}` and `${VAR+x}`, which always resolve.
+        let required: Bool
+        let status: Status
+    }
+
+    /// Every variable reference in `value`, in document order with map keys sorted, checked
+    /// against `environment` without substituting anything.
+    static func references(in value: Any, environment: [String: String], field: String = "") throws -> [Reference] {
+        if let str = value as? String {
+            var found: [Reference] = []
+            _ = try substitute(str, field: field, escapeDollars: false) { body in
+                let (name, op, argument) = try parse(body, field: field)
+                let value = environment[name]
+                let present = op?.hasPrefix(":") == true ? !(value ?? "").isEmpty : value != nil
+                let required = op == nil || op == ":?" || op == "?"
+                let status: Reference.Status = present ? .set : required ? .missing : .defaulted
+                found.append(Reference(name: name, field: field, required: required, status: status))
+                found += try references(in: argument, environment: environment, field: field)
+                return ""
+            }
+            return found
+        }
+        if let map = value as? [String: Any] {
+            return try map.keys.sorted().flatMap { key in
+                try references(in: map[key]!, environment: environment, field: field.isEmpty ? key : "\(field).\(key)")
+            }
+        }
+        if let list = value as? [Any] {
+            return try list.enumerated().flatMap { index, child in
+                try references(in: child, environment: environment, field: "\(field)[\(index)]")
+            }
+        }
+        return []
+    }
+
+    /// Walks `string`, replacing each `${...}` or `$NAME` with what `resolving` returns for its body.
+    private static func substitute(
+        _ string: String,
+        field: String,
+        escapeDollars: Bool,
+        resolving: (String) throws -> String
+    ) throws -> (value: String, substituted: Bool) {
+        guard string.contains("$") else { return (string, false) }
+
+        func escaped(_ s: String) -> String {
+            escapeDollars ? s.replacingOccurrences(of: "$", with: "$$") : s
+        }
+
+        var output = ""
+        var substituted = false
+        var i = string.startIndex
+        while i < string.endIndex {
+            let c = string[i]
+            guard c == "$" else {
+                output.append(c)
+                i = string.index(after: i)
+                continue
+            }
+            let next = string.index(after: i)
+            guard next < string.endIndex else {
+                output.append("$")
+                break
+            }
+
+            if string[next] == "$" {
+                output += escapeDollars ? "$$" : "$"
+                i = string.index(after: next)
+            } else if string[next] == "{" {
+                let bodyStart = string.index(after: next)
+                guard let close = closingBrace(in: string, from: bodyStart) else {
+                    throw ComposeConfigParser.ComposeError.invalidValue(field, string, "unterminated ${ — use $$ for a literal $")
+                }
+                output += escaped(try resolving(String(string[bodyStart..<close])))
+                substituted = true
+                i = string.index(after: close)
+            } else if string[next] == "_" || string[next].isLetter {
+                var end = next
+                while end < string.endIndex, string[end] == "_" || string[end].isLetter || string[end].isNumber {
+                    end = string.index(after: end)
+                }
+                output += escaped(try resolving(String(string[next..<end])))
+                substituted = true
+                i = end
+            } else {
+                output.append("$")
+                i = next
+            }
+        }
+        return (output, substituted)
+    }
+
+    /// The `}` that closes a `${` whose body starts at `start`, skipping nested `${...}` and `$$`.
+    private static func closingBrace(in string: String, from start: String.Index) -> String.Index? {
+        var depth = 1
+        var i = start
+        while i < string.endIndex {
+            if string[i] == "}" {
+                depth -= 1
+                if depth == 0 { return i }
+            } else if string[i] == "$" {
+                let next = string.index(after: i)
+                if next < string.endIndex, string[next] == "{" || string[next] == "$" {
+                    if string[next] == "{" { depth += 1 }
+                    i = next
+                }
+            }
+            i = string.index(after: i)
+        }
+        return nil
+    }
+
+    private static let nameRegex = try! NSRegularExpression(pattern: "^[A-Za-z_][A-Za-z0-9_]*$")
+
+    /// Splits the body of `${...}` (or a bare `$NAME`) into the variable name, the operator, and its argument.
+    private static func parse(_ body: String, field: String) throws -> (name: String, op: String?, argument: String) {
+        let operators = [":-", ":?", ":+", "-", "?", "+"]
+        var name = body
+        var op: String?
+        var argument = ""
+        if let range = body.firstIndex(where: { ":-?+".contains($0) }) {
+            name = String(body[..<range])
+            let rest = body[range...]
+            guard let matched = operators.first(where: { rest.hasPrefix($0) }) else {
+                throw ComposeConfigParser.ComposeError.invalidValue(field, "${\(body)}", "unsupported interpolation syntax")
+            }
+            op = matched
+            argument = String(rest.dropFirst(matched.count))
+        }
+        guard !name.isEmpty else {
+            throw ComposeConfigParser.ComposeError.invalidValue(field, "${\(body)}", "missing variable name")
+        }
+        guard nameRegex.firstMatch(in: name, range: NSRange(name.startIndex..., in: name)) != nil else {
+            throw ComposeConfigParser.ComposeError.invalidValue(
+                field, "${\(body)}", "invalid variable name \"\(name)\" — nesting is only supported after :-, -, :?, ?, :+ or +"
+            )
+        }
+        return (name, op, argument)
+    }
+
+    /// Resolves the body of `${...}` (or a bare `$NAME`). The argument after the operator is
+    /// interpolated only if it is used.
+    private static func resolve(_ body: String, environment: [String: String], field: String) throws -> String {
+        let (name, op, rawArgument) = try parse(body, field: field)
+        func argument() throws -> String {
+            try interpolate(string: rawArgument, environment: environment, field: field).value
+        }
+
+        let value = environment[name]
+        let isSetNonEmpty = !(value ?? "").isEmpty
+        switch op {
+        case ":-": return try isSetNonEmpty ? value! : argument()
+        case "-": return try value ?? argument()
+        case ":+": return try isSetNonEmpty ? argument() : ""
+        case "+": return try value != nil ? argument() : ""
+        case ":?", "?":
+            let present = op == ":?" ? isSetNonEmpty : value != nil
+            if present { return value! }
+            let message = try argument()
+            let reason = message.isEmpty ? "is required" : message
+            throw ComposeConfigParser.ComposeError.validationFailed("variable \(name) \(reason) (used in \(field))")
+        default:
+            guard let value else {
+                throw ComposeConfigParser.ComposeError.validationFailed(
+                    "variable \(name) is not set (used in \(field)) — add it to .env next to the compose file, export it and pass --allow-env \(name), or use ${\(name):-default}"
+                )
+            }
+            return value
+        }
+    }
+
+    /// Reads a Compose `.env` file: `KEY=value` lines, `#` comments, optional `export ` prefix,
+    /// and values optionally wrapped in single or double quotes.
+    static func loadDotEnv(atPath path: String) -> [String: String] {
+        guard let text = try? String(contentsOfFile: path, encoding: .utf8) else { return [:] }
+        var result: [String: String] = [:]
+        for rawLine in text.split(whereSeparator: \.isNewline) {
+            var line = rawLine.trimmingCharacters(in: .whitespaces)
+            guard !line.isEmpty, !line.hasPrefix("#") else { continue }
+            if line.hasPrefix("export ") { line = String(line.dropFirst("export ".count)) }
+            guard let eq = line.firstIndex(of: "=") else { continue }
+            let key = line[..<eq].trimmingCharacters(in: .whitespaces)
+            var value = line[line.index(after: eq)...].trimmingCharacters(in: .whitespaces)
+            if value.count >= 2, let first = value.first, first == "\"" || first == "'", value.last == first {
+                value = String(value.dropFirst().dropLast())
+            }
+            result[key] = value
+        }
+        return result
+    }
+}
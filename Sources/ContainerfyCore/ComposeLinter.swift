@@ -0,0 +1,132 @@
+import Foundation
+
+/// Advisory best-practice checks over a parsed compose file, run by `containerfy lint` and by
+/// `validate --lint` / `pack --lint`. New checks go in `rules`.
+/// Unlike parseBuild errors they only block a pack under `--strict`, and then only warnings —
+/// each finding names the rule that produced it so it can be silenced with `--disable-rule`.
+enum ComposeLinter {
+
+    enum Severity: String, Sendable {
+        case info
+        case warning
+    }
+
+    struct Finding: Sendable, Equatable {
+        let rule: String
+        let severity: Severity
+        let message: String
+
+        /// `<severity>: [<rule>] <message>`, as every command prints it.
+        var line: String { "\(severity.rawValue): [\(rule)] \(message)" }
+    }
+
+    struct Rule: Sendable {
+        let id: String
+        let severity: Severity
+        let summary: String
+        let check: @Sendable (ComposeConfig) -> [String]
+    }
+
+    /// Rule ID for warnings parseBuild itself raised (privileged ports, oom_kill_disable, ...).
+    static let parserRuleID = "parser-warning"
+
+    /// VM sizing above these is rarely intended for an app shipped to end users' Macs.
+    static let largeCPUCount = 8
+    static let largeMemoryMB = 16384
+    static let largeDiskMB = 102_400
+
+    /// Room on the VM disk, after the VM itself and volume limits, below which images and
+    /// container data are likely to run out of space.
+    static let tightDiskHeadroomMB = 2048
+
+    static let rules: [Rule] = [
+        Rule(id: "unpinned-image", severity: .warning, summary: "image has no tag, uses :latest, or is not pinned by digest") { config in
+            config.serviceSpecs.compactMap { spec in
+                guard let image = spec.image, !isPinned(image) else { return nil }
+                return ComposeConfigParser.unpinnedImageWarning(service: spec.name, image: image)
+            }
+        },
+        Rule(id: "healthcheck-timeout", severity: .warning, summary: "healthcheck has no timeout") { config in
+            config.serviceSpecs.compactMap { spec in
+                guard spec.hasHealthcheck, spec.healthcheckTimeout == nil else { return nil }
+                return "service \"\(spec.name)\" has a healthcheck without timeout: — a hung check blocks for the 30s default"
+            }
+        },
+        Rule(id: "no-restart-policy", severity: .info, summary: "service has no restart policy") { config in
+            config.serviceSpecs.compactMap { spec in
+                guard spec.restart == nil || spec.restart == "no" else { return nil }
+                return "service \"\(spec.name)\" has no restart policy — it stays down after a crash until the app is restarted"
+            }
+        },
+        Rule(id: "large-vm", severity: .warning, summary: "VM sizing is unusually large for an end-user Mac") { config in
+            var messages: [String] = []
+            if let cpus = config.cpuRecommended, cpus > largeCPUCount {
+                messages.append("x-containerfy.vm.cpu.recommended is \(cpus) — more than \(largeCPUCount) CPUs")
+            }
+            if let mem = config.memoryMBRecommended, mem > largeMemoryMB {
+                messages.append("x-containerfy.vm.memory_mb.recommended is \(mem) — more than \(largeMemoryMB) MB")
+            }
+            if let disk = config.diskMB, disk > largeDiskMB {
+                messages.append("x-containerfy.vm.disk_mb is \(disk) — more than \(largeDiskMB) MB")
+            }
+            return messages
+        },
+        Rule(id: "missing-display-name", severity: .info, summary: "x-containerfy.display_name is not set") { config in
+            guard let name = config.name, config.displayName == nil || config.displayName == name else { return [] }
+            return ["x-containerfy.display_name is not set — Finder and the menu bar show \"\(name)\""]
+        },
+        Rule(id: "missing-icon", severity: .info, summary: "x-containerfy.icon is not set") { config in
+            config.icon == nil ? ["x-containerfy.icon is not set — the app gets the generic application icon"] : []
+        },
+        Rule(id: "tight-disk", severity: .warning, summary: "VM disk leaves little room for images and container data") { config in
+            guard let disk = config.diskMB else { return [] }
+            let free = disk - ComposeConfigParser.volumeReserveMB - config.volumeLimitsMB.values.reduce(0, +)
+            guard free < tightDiskHeadroomMB else { return [] }
+            return ["x-containerfy.vm.disk_mb \(disk) leaves \(max(free, 0)) MB for images and container data after the VM and volume limits — less than \(tightDiskHeadroomMB) MB"]
+        },
+        Rule(id: "no-vm-headroom", severity: .info, summary: "recommended CPU or memory is no higher than the minimum") { config in
+            var messages: [String] = []
+            if let min = config.cpuMin, (config.cpuRecommended ?? min) <= min {
+                messages.append("x-containerfy.vm.cpu.recommended is not above min (\(min)) — the app can't use more CPUs on Macs that have them")
+            }
+            if let min = config.memoryMBMin, (config.memoryMBRecommended ?? min) <= min {
+                messages.append("x-containerfy.vm.memory_mb.recommended is not above min (\(min) MB) — the app can't use more memory on Macs that have it")
+            }
+            return messages
+        },
+        Rule(id: "plaintext-secret", severity: .warning, summary: "credential-like environment variable has an inline value") { config in
+            config.serviceSpecs.flatMap { spec in
+                spec.inlineEnvironmentKeys
+                    .filter { EnvironmentVariable(name: $0, value: nil).looksLikeSecret }
+                    .map { "service \"\(spec.name)\" sets \($0) inline — anyone with the .app can read it, and an env_file is bundled in plaintext too, so keep real credentials out of the bundle" }
+            }
+        },
+    ]
+
+    static var ruleIDs: [String] { [parserRuleID] + rules.map(\.id) }
+
+    /// The findings `pack --strict` and `validate --lint --strict` fail on: warnings, not info.
+    static func strictFailures(_ findings: [Finding]) -> [Finding] {
+        findings.filter { $0.severity == .warning }
+    }
+
+    /// Runs every rule not in `disabled`, parser warnings first. A parser warning that a rule
+    /// also reports (e.g. unpinned images) belongs to that rule, so disabling it silences both.
+    static func lint(_ config: ComposeConfig, disabled: Set<String> = []) -> [Finding] {
+        var findings: [Finding] = []
+        if !disabled.contains(parserRuleID) {
+            let ruleMessages = Set(rules.flatMap { $0.check(config) })
+            findings += config.warnings
+                .filter { !ruleMessages.contains($0) }
+                .map { Finding(rule: parserRuleID, severity: .warning, message: $0) }
+        }
+        for rule in rules where !disabled.contains(rule.id) {
+            findings += rule.check(config).map { Finding(rule: rule.id, severity: rule.severity, message: $0) }
+        }
+        return findings
+    }
+
+    static func isPinned(_ image: String) -> Bool {
+        ComposeConfigParser.isPinnedImage(image)
+    }
+}
@@ -0,0 +1,133 @@
+import Foundation
+
+/// Merges compose files the way `docker compose -f base.yml -f override.yml` does,
+/// so a base file plus per-environment overrides packs into one compose file.
+enum ComposeMerge {
+
+    /// Keys whose list value replaces the base value instead of extending it.
+    private static let replacedListKeys: Set<String> = ["command", "entrypoint", "test"]
+
+    /// Keys that may be written as a `KEY=value` list or a map; both forms merge by key.
+    private static let keyedListKeys: Set<String> = ["environment", "labels", "extra_hosts", "sysctls"]
+
+    /// Returns `base` with `overlay` merged on top. Maps merge recursively, scalars in the
+    /// overlay win, and lists are concatenated without duplicates (except `command`,
+    /// `entrypoint` and healthcheck `test`, which are replaced).
+    static func merge(_ base: [String: Any], _ overlay: [String: Any]) -> [String: Any] {
+        var result = base
+        for (key, overlayValue) in overlay {
+            guard let baseValue = base[key] else {
+                result[key] = overlayValue
+                continue
+            }
+            result[key] = merge(key: key, baseValue, overlayValue)
+        }
+        return result
+    }
+
+    private static func merge(key: String, _ base: Any, _ overlay: Any) -> Any {
+        if keyedListKeys.contains(key), let baseMap = keyedMap(base), let overlayMap = keyedMap(overlay) {
+            return baseMap.merging(overlayMap) { _, new in new }
+        }
+        if let baseMap = base as? [String: Any], let overlayMap = overlay as? [String: Any] {
+            return merge(baseMap, overlayMap)
+        }
+        if !replacedListKeys.contains(key), let baseList = base as? [Any], let overlayList = overlay as? [Any] {
+            var merged = baseList
+            for item in overlayList where !merged.contains(where: { isEqual($0, item) }) {
+                merged.append(item)
+            }
+            return merged
+        }
+        return overlay
+    }
+
+    static func usesExtends(_ root: [String: Any]) -> Bool {
+        (root["services"] as? [String: Any])?.values.contains { ($0 as? [String: Any])?["extends"] != nil } ?? false
+    }
+
+    /// Replaces every service's `extends:` with the merge of the service it extends and its own
+    /// keys, following chains across files. `extends` is `name` or `{service: name, file: path}`,
+    /// with `file` relative to the file that declares it; `load` reads another compose file.
+    static func resolveExtends(
+        _ root: [String: Any], path: String, load: (String) throws -> [String: Any]
+    ) throws -> [String: Any] {
+        guard var services = root["services"] as? [String: Any] else { return root }
+
+        var files: [String: [String: Any]] = [path: root]
+        func label(_ service: String, in file: String) -> String {
+            file == path ? service : "\((file as NSString).lastPathComponent):\(service)"
+        }
+        func resolve(_ name: String, in file: String, chain: [String]) throws -> [String: Any] {
+            let key = label(name, in: file)
+            if chain.contains(key) {
+                throw ComposeConfigParser.ComposeError.validationFailed(
+                    "extends cycle: \((chain + [key]).joined(separator: " -> "))"
+                )
+            }
+            guard let svc = (files[file]?["services"] as? [String: Any])?[name] as? [String: Any] else {
+                let referrer = chain.last.map { "service \"\($0)\" extends " } ?? ""
+                throw ComposeConfigParser.ComposeError.validationFailed(
+                    "\(referrer)service \"\(name)\", which is not defined in \((file as NSString).lastPathComponent)"
+                )
+            }
+            guard let rawExtends = svc["extends"] else { return svc }
+
+            let baseName: String
+            var baseFile = file
+            if let short = rawExtends as? String {
+                baseName = short
+            } else if let long = rawExtends as? [String: Any], let service = long["service"] as? String {
+                baseName = service
+                if let relative = long["file"] as? String {
+                    let dir = (file as NSString).deletingLastPathComponent
+                    baseFile = (((relative as NSString).isAbsolutePath ? relative : (dir as NSString).appendingPathComponent(relative)) as NSString).standardizingPath
+                    if files[baseFile] == nil {
+                        guard FileManager.default.fileExists(atPath: baseFile) else {
+                            throw ComposeConfigParser.ComposeError.validationFailed(
+                                "service \"\(key)\" extends \"\(service)\" from \(relative), which does not exist"
+                            )
+                        }
+                        files[baseFile] = try load(baseFile)
+                    }
+                }
+            } else {
+                throw ComposeConfigParser.ComposeError.invalidValue(
+                    "services.\(name).extends", "\(rawExtends)", "must be a service name or a map with service: (and optionally file:)"
+                )
+            }
+
+            let base = try resolve(baseName, in: baseFile, chain: chain + [key])
+            var own = svc
+            own.removeValue(forKey: "extends")
+            return merge(base, own)
+        }
+
+        for name in services.keys.sorted() {
+            services[name] = try resolve(name, in: path, chain: [])
+        }
+        var result = root
+        result["services"] = services
+        return result
+    }
+
+    /// `["A=1", "B"]` or `{A: 1, B: null}` as a map; nil for any other shape.
+    private static func keyedMap(_ value: Any) -> [String: Any]? {
+        if let map = value as? [String: Any] { return map }
+        guard let list = value as? [Any] else { return nil }
+        var result: [String: Any] = [:]
+        for item in list {
+            guard let entry = item as? String else { return nil }
+            if let eq = entry.firstIndex(of: "=") {
+                result[String(entry[..<eq])] = String(entry[entry.index(after: eq)...])
+            } else {
+                result[entry] = NSNull()
+            }
+        }
+        return result
+    }
+
+    private static func isEqual(_ a: Any, _ b: Any) -> Bool {
+        (a as? NSObject)?.isEqual(b as? NSObject) ?? false
+    }
+}
@@ -0,0 +1,216 @@
+import Foundation
+
+/// CLI `doctor` command — checks that this Mac can run `pack` before a build starts: the bundled
+/// podman binaries, free space for the bundle, and the Apple tools signing and .dmg creation use.
+/// `pack --signing-check` runs just the signing checks.
+///
+/// Usage: containerfy doctor [--sign <identity>] [--notarize-profile <name>]
+public struct DoctorCommand {
+
+    struct Check: Equatable {
+        enum Status: String {
+            case pass = "ok"
+            case warn = "warn"
+            case fail = "FAIL"
+        }
+
+        var name: String
+        var status: Status
+        var detail: String
+    }
+
+    /// Free space `pack` needs in the temporary directory: the .app, plus a .dmg of about the same size.
+    static let requiredFreeMB: Int64 = 2048
+
+    let signer: CodeSigner
+    let isExecutable: (String) -> Bool
+    let freeBytes: (String) -> Int64?
+    let locateBinaries: () throws -> (podman: String, gvproxy: String, vfkit: String)
+
+    public init() {
+        self.init(signer: CodeSigner())
+    }
+
+    init(signer: CodeSigner) {
+        self.init(
+            signer: signer,
+            isExecutable: { FileManager.default.isExecutableFile(atPath: $0) },
+            freeBytes: BundleAssembler.freeBytes(at:),
+            locateBinaries: BundleAssembler.findPodmanBinaries
+        )
+    }
+
+    init(
+        signer: CodeSigner,
+        isExecutable: @escaping (String) -> Bool,
+        freeBytes: @escaping (String) -> Int64?,
+        locateBinaries: @escaping () throws -> (podman: String, gvproxy: String, vfkit: String)
+    ) {
+        self.signer = signer
+        self.isExecutable = isExecutable
+        self.freeBytes = freeBytes
+        self.locateBinaries = locateBinaries
+    }
+
+    /// Runs the doctor command. Returns an exit code (0 = no hard requirement failed).
+    public func run(arguments: [String]) -> Int32 {
+        var identity: String?
+        var notarizeProfile: String?
+
+        var i = 0
+        while i < arguments.count {
+            switch arguments[i] {
+            case "--sign":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--sign requires an identity argument")
+                    return 1
+                }
+                identity = arguments[i]
+            case "--notarize-profile":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--notarize-profile requires a profile name")
+                    return 1
+                }
+                notarizeProfile = arguments[i]
+            case "--help", "-h":
+                Self.printUsage()
+                return 0
+            default:
+                Self.printError("Unknown flag: \(arguments[i])")
+                Self.printUsage()
+                return 1
+            }
+            i += 1
+        }
+
+        let results = checks(identity: identity, notary: notarizeProfile.map { .keychainProfile($0) })
+        print(Self.table(results))
+        return results.contains { $0.status == .fail } ? 1 : 0
+    }
+
+    /// Runs every check. Signing and notarization tools are hard requirements only when asked for.
+    func checks(identity: String?, notary: CodeSigner.NotaryCredentials?, tempDir: String = NSTemporaryDirectory()) -> [Check] {
+        var results: [Check] = []
+
+        do {
+            let binaries = try locateBinaries()
+            results.append(Check(name: "podman binaries", status: .pass, detail: (binaries.podman as NSString).deletingLastPathComponent))
+        } catch {
+            results.append(Check(name: "podman binaries", status: .fail, detail: error.localizedDescription))
+        }
+
+        if let free = freeBytes(tempDir) {
+            let freeMB = free / 1024 / 1024
+            results.append(Check(
+                name: "free disk",
+                status: freeMB >= Self.requiredFreeMB ? .pass : .fail,
+                detail: "\(freeMB) MB free in \(tempDir) (need \(Self.requiredFreeMB) MB)"
+            ))
+        } else {
+            results.append(Check(name: "free disk", status: .warn, detail: "could not read free space for \(tempDir)"))
+        }
+
+        results += signingChecks(identity: identity, notary: notary)
+        results.append(tool("hdiutil", "/usr/bin/hdiutil", requiredBecause: nil, usedFor: ".dmg creation"))
+        results.append(tool("sips", "/usr/bin/sips", requiredBecause: nil, usedFor: ".png icons"))
+        results.append(tool("iconutil", "/usr/bin/iconutil", requiredBecause: nil, usedFor: ".png icons"))
+        return results
+    }
+
+    /// The tools, certificate and notary credentials a signed build needs. Hard requirements only
+    /// when `identity` or `notary` is given; notarytool and stapler are only looked up for notarization.
+    func signingChecks(identity: String?, notary: CodeSigner.NotaryCredentials?) -> [Check] {
+        var results: [Check] = []
+        results.append(tool("codesign", "/usr/bin/codesign", requiredBecause: identity.map { _ in "--sign" }, usedFor: "signing"))
+        if let identity {
+            do {
+                _ = try signer.resolveIdentity(preferred: identity)
+                results.append(Check(name: "signing identity", status: .pass, detail: identity))
+            } catch {
+                results.append(Check(name: "signing identity", status: .fail, detail: error.localizedDescription))
+            }
+        }
+        let xcrun = tool("xcrun", "/usr/bin/xcrun", requiredBecause: notary.map { _ in "--notarize-profile" }, usedFor: "notarization")
+        results.append(xcrun)
+        guard let notary else { return results }
+
+        // Without xcrun there is nothing to ask; its row already failed
+        if xcrun.status == .pass {
+            for name in ["notarytool", "stapler"] {
+                do {
+                    if let path = try signer.xcrunTool(name) {
+                        results.append(Check(name: name, status: .pass, detail: path))
+                    } else {
+                        results.append(Check(name: name, status: .fail, detail: "xcrun --find \(name) failed — install the Xcode command line tools"))
+                    }
+                } catch {
+                    results.append(Check(name: name, status: .fail, detail: error.localizedDescription))
+                }
+            }
+        }
+        if case .keychainProfile(let profile) = notary {
+            do {
+                if try signer.notaryProfileExists(profile) {
+                    results.append(Check(name: "notary profile", status: .pass, detail: profile))
+                } else {
+                    results.append(Check(
+                        name: "notary profile",
+                        status: .fail,
+                        detail: "\"\(profile)\" is not in the keychain — save it with: xcrun notarytool store-credentials \(profile)"
+                    ))
+                }
+            } catch {
+                results.append(Check(name: "notary profile", status: .fail, detail: error.localizedDescription))
+            }
+        }
+        return results
+    }
+
+    private func tool(_ name: String, _ path: String, requiredBecause flag: String?, usedFor purpose: String) -> Check {
+        if isExecutable(path) {
+            return Check(name: name, status: .pass, detail: path)
+        }
+        if let flag {
+            return Check(name: name, status: .fail, detail: "\(path) not found — needed for \(flag)")
+        }
+        return Check(name: name, status: .warn, detail: "\(path) not found — needed for \(purpose)")
+    }
+
+    // MARK: - Output
+
+    static func table(_ checks: [Check]) -> String {
+        let width = max(checks.map(\.name.count).max() ?? 0, "Check".count) + 2
+        var lines = ["Check".padding(toLength: width, withPad: " ", startingAt: 0) + "Status  Detail"]
+        for check in checks {
+            lines.append(
+                check.name.padding(toLength: width, withPad: " ", startingAt: 0)
+                    + check.status.rawValue.padding(toLength: 8, withPad: " ", startingAt: 0)
+                    + check.detail
+            )
+        }
+        return lines.joined(separator: "\n")
+    }
+
+    private static func printError(_ message: String) {
+        let stderr = FileHandle.standardError
+        stderr.write("Error: \(message)\n".data(using: .utf8)!)
+    }
+
+    private static func printUsage() {
+        print("""
+        Usage: containerfy doctor [flags]
+
+        Check that this Mac is ready to run pack: podman, gvproxy and vfkit are
+        installed next to containerfy, the temporary directory has room for the
+        bundle, and the Apple tools for signing, notarization, .dmg creation and
+        icon conversion exist. Exits non-zero if a hard requirement fails.
+
+        Flags:
+          --sign <identity>          Also require codesign and this signing certificate (name or SHA-1 hash)
+          --notarize-profile <name>  Also require xcrun, notarytool, stapler and this saved notarytool profile
+          --help                     Show this help
+        """)
+    }
+}
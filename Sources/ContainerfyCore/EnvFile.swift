@@ -0,0 +1,63 @@
+import Foundation
+
+/// `env_file` contents. podman compose reads these line by line on the end user's Mac, so a
+/// Windows editor's BOM or CRLF endings end up inside variable names and values. `pack` checks
+/// each file here and bundles the normalized bytes.
+enum EnvFile {
+
+    struct Problem: Equatable {
+        /// 1-based.
+        var line: Int
+        /// Names the variable at most, never its value.
+        var reason: String
+    }
+
+    /// Variable names podman compose accepts.
+    private static let keyRegex = try! NSRegularExpression(pattern: "^[A-Za-z_][A-Za-z0-9_.-]*$")
+
+    /// The file with any UTF-8 BOM removed and CRLF or lone CR line endings turned into LF.
+    static func normalize(_ data: Data) -> Data {
+        var bytes = [UInt8](data)
+        if bytes.starts(with: [0xEF, 0xBB, 0xBF]) {
+            bytes.removeFirst(3)
+        }
+        var result = [UInt8]()
+        result.reserveCapacity(bytes.count)
+        var i = 0
+        while i < bytes.count {
+            if bytes[i] == 0x0D {
+                result.append(0x0A)
+                if i + 1 < bytes.count, bytes[i + 1] == 0x0A { i += 1 }
+            } else {
+                result.append(bytes[i])
+            }
+            i += 1
+        }
+        return Data(result)
+    }
+
+    /// The first line that is not blank, a `#` comment, or `KEY=VALUE` (optionally prefixed by
+    /// `export`), or nil if the whole file is well-formed. Expects normalized data.
+    static func firstProblem(in data: Data) -> Problem? {
+        guard let text = String(data: data, encoding: .utf8) else {
+            return Problem(line: 1, reason: "is not UTF-8 text")
+        }
+        for (index, rawLine) in text.components(separatedBy: "\n").enumerated() {
+            var line = rawLine.trimmingCharacters(in: .whitespaces)
+            guard !line.isEmpty, !line.hasPrefix("#") else { continue }
+            if line.hasPrefix("export ") {
+                line = line.dropFirst("export ".count).trimmingCharacters(in: .whitespaces)
+            }
+            guard let eq = line.firstIndex(of: "=") else {
+                // Only the name is reported: the rest of the line is likely a value, and values are often secrets
+                let name = line.prefix { ($0.isASCII && ($0.isLetter || $0.isNumber)) || "_.-".contains($0) }
+                return Problem(line: index + 1, reason: name.isEmpty ? "has no \"=\"" : "\"\(name)\" has no \"=\"")
+            }
+            let key = String(line[..<eq])
+            guard keyRegex.firstMatch(in: key, range: NSRange(key.startIndex..., in: key)) != nil else {
+                return Problem(line: index + 1, reason: "\"\(key)\" is not a valid variable name")
+            }
+        }
+        return nil
+    }
+}
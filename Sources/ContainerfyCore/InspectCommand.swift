@@ -0,0 +1,216 @@
+import Foundation
+
+/// CLI `inspect` command — summarizes what a packed .app contains: identity, images, ports,
+/// bundled files and signing status. Read-only; use `verify` to check integrity.
+///
+/// Usage: containerfy inspect <path-to-app> [--json]
+public struct InspectCommand {
+
+    enum InspectError: LocalizedError {
+        case notABundle(String)
+
+        var errorDescription: String? {
+            switch self {
+            case .notABundle(let path):
+                return "\(path) is not a .app bundle (no Contents/Info.plist)"
+            }
+        }
+    }
+
+    struct Report: Encodable {
+        struct Service: Encodable {
+            var name: String
+            var image: String?
+            var ports: [String]
+        }
+
+        struct File: Encodable {
+            var path: String
+            var size: UInt64
+        }
+
+        var path: String
+        var name: String?
+        var displayName: String?
+        var identifier: String?
+        var version: String?
+        var composeSHA256: String?
+        /// Digest of the compose file plus env files; nil for bundles that predate the key.
+        var configSHA256: String?
+        /// containerfy version that packed the bundle; nil for bundles that predate the key.
+        var builderVersion: String?
+        var services: [Service]
+        var images: [String]
+        /// Files under Contents/Resources, sorted by path.
+        var files: [File]
+        var totalBytes: UInt64
+        var signature: CodeSigner.SignatureInfo
+
+        enum CodingKeys: String, CodingKey {
+            case path
+            case name
+            case displayName = "display_name"
+            case identifier
+            case version
+            case composeSHA256 = "compose_sha256"
+            case configSHA256 = "config_sha256"
+            case builderVersion = "builder_version"
+            case services
+            case images
+            case files
+            case totalBytes = "total_bytes"
+            case signature
+        }
+    }
+
+    let signer: CodeSigner
+
+    public init() {
+        self.signer = CodeSigner()
+    }
+
+    init(signer: CodeSigner) {
+        self.signer = signer
+    }
+
+    /// Runs the inspect command. Returns an exit code (0 = bundle read).
+    public func run(arguments: [String]) -> Int32 {
+        var appPath: String?
+        var json = false
+        for argument in arguments {
+            switch argument {
+            case "--json":
+                json = true
+            case "--help", "-h":
+                Self.printUsage()
+                return 0
+            default:
+                guard appPath == nil, !argument.hasPrefix("-") else {
+                    Self.printError(argument.hasPrefix("-") ? "Unknown flag: \(argument)" : "inspect takes exactly one .app path")
+                    Self.printUsage()
+                    return 1
+                }
+                appPath = argument
+            }
+        }
+        guard let appPath else {
+            Self.printError("inspect takes exactly one .app path")
+            Self.printUsage()
+            return 1
+        }
+
+        do {
+            let report = try inspect(appPath: appPath)
+            print(json ? try Self.reportJSON(report) : Self.reportText(report))
+            return 0
+        } catch {
+            Self.printError(error.localizedDescription)
+            return 1
+        }
+    }
+
+    func inspect(appPath: String) throws -> Report {
+        let contentsDir = (appPath as NSString).appendingPathComponent("Contents")
+        let plistPath = (contentsDir as NSString).appendingPathComponent("Info.plist")
+        guard let data = FileManager.default.contents(atPath: plistPath),
+              let plist = try? PropertyListSerialization.propertyList(from: data, format: nil) as? [String: Any] else {
+            throw InspectError.notABundle(appPath)
+        }
+
+        let resourcesDir = (contentsDir as NSString).appendingPathComponent("Resources")
+        let layout = try BundleLayout.load(resourcesPath: resourcesDir)
+
+        // Services come from runtime.json; bundles that predate it report none
+        var services: [Report.Service] = []
+        if let runtime = layout.runtime {
+            let config = try RuntimeConfig.load(path: (resourcesDir as NSString).appendingPathComponent(runtime))
+            services = config.services.map { service in
+                Report.Service(
+                    name: service.name,
+                    image: service.image,
+                    ports: service.ports.map { PortMapping(hostPort: $0.host, containerPort: $0.container, protocol: $0.protocol ?? "tcp").notation }
+                )
+            }
+        }
+
+        let files = BundleAssembler.fileSizes(under: resourcesDir)
+            .sorted { $0.path < $1.path }
+            .map { Report.File(path: $0.path, size: $0.bytes) }
+
+        return Report(
+            path: appPath,
+            name: plist["CFBundleName"] as? String,
+            displayName: plist["CFBundleDisplayName"] as? String,
+            identifier: plist["CFBundleIdentifier"] as? String,
+            version: plist["CFBundleShortVersionString"] as? String,
+            composeSHA256: plist[BundleAssembler.composeDigestKey] as? String,
+            configSHA256: plist[BundleAssembler.configDigestKey] as? String,
+            builderVersion: plist[BundleAssembler.builderVersionKey] as? String,
+            services: services,
+            images: Array(Set(services.compactMap(\.image))).sorted(),
+            files: files,
+            totalBytes: BundleAssembler.fileSizes(under: appPath).reduce(0) { $0 + $1.bytes },
+            signature: try signer.signatureInfo(appPath: appPath)
+        )
+    }
+
+    // MARK: - Output
+
+    static func reportJSON(_ report: Report) throws -> String {
+        let encoder = JSONEncoder()
+        encoder.outputFormatting = [.prettyPrinted, .sortedKeys, .withoutEscapingSlashes]
+        return String(decoding: try encoder.encode(report), as: UTF8.self)
+    }
+
+    static func reportText(_ report: Report) -> String {
+        var lines = [
+            "Bundle:     \(report.path)",
+            "Name:       \(report.name ?? "-")" + (report.displayName.map { " (\($0))" } ?? ""),
+            "Identifier: \(report.identifier ?? "-")",
+            "Version:    \(report.version ?? "-")",
+            "Signature:  \(report.signature.summary)" + (report.signature.teamID.map { ", team \($0)" } ?? ""),
+            "Size:       \(formatSize(report.totalBytes))",
+            "Packed by:  containerfy \(report.builderVersion ?? "(unknown)")",
+        ]
+        if let digest = report.composeSHA256 {
+            lines.append("Compose:    sha256 \(digest)")
+        }
+        if let digest = report.configSHA256 {
+            lines.append("Config:     sha256 \(digest)")
+        }
+        lines.append("Services:")
+        if report.services.isEmpty { lines.append("  (none recorded)") }
+        for service in report.services {
+            let ports = service.ports.isEmpty ? "" : "  ports \(service.ports.joined(separator: ", "))"
+            lines.append("  \(service.name)  \(service.image ?? "-")\(ports)")
+        }
+        lines.append("Resources:")
+        for file in report.files {
+            lines.append("  \(formatSize(file.size).padding(toLength: 10, withPad: " ", startingAt: 0)) \(file.path)")
+        }
+        return lines.joined(separator: "\n")
+    }
+
+    private static func formatSize(_ bytes: UInt64) -> String {
+        bytes < 1024 * 1024 ? "\(bytes) B" : String(format: "%.1f MB", Double(bytes) / 1024 / 1024)
+    }
+
+    private static func printError(_ message: String) {
+        let stderr = FileHandle.standardError
+        stderr.write("Error: \(message)\n".data(using: .utf8)!)
+    }
+
+    private static func printUsage() {
+        print("""
+        Usage: containerfy inspect <path-to-app> [--json]
+
+        Print what a packed .app contains: name, identifier, version, config
+        digest, services with their images and ports, bundled resources with
+        sizes, and signing status (codesign -dv).
+
+        Flags:
+          --json                     Print the summary as JSON
+          --help                     Show this help
+        """)
+    }
+}
@@ -0,0 +1,122 @@
+import Foundation
+
+/// `Resources/installed-paths.json`, written by `pack`: what the app creates on the user's Mac
+/// outside its bundle, so `containerfy uninstall` can clean up without guessing. Files live in
+/// the app's own Application Support directory, named after its bundle identifier. The podman
+/// machine (VM disk included) is removed through podman, never by deleting podman's files.
+struct InstalledPaths: Codable, Equatable, Sendable {
+
+    enum InstalledPathsError: LocalizedError {
+        case unreadable(String)
+        case unsupportedSchema(Int)
+        case outsideSupportDirectory(String)
+        case unexpectedMachine(String)
+
+        var errorDescription: String? {
+            switch self {
+            case .unreadable(let path):
+                return "\(path) is not a valid installed-paths manifest"
+            case .unsupportedSchema(let version):
+                return "installed-paths schema \(version) is newer than this containerfy supports (\(InstalledPaths.currentSchemaVersion)) — upgrade containerfy"
+            case .outsideSupportDirectory(let path):
+                return "\(path) is not inside the app's own Application Support directory — refusing to remove it"
+            case .unexpectedMachine(let name):
+                return "\"\(name)\" is not a podman machine containerfy creates (containerfy-<name>) — refusing to remove it"
+            }
+        }
+    }
+
+    static let currentSchemaVersion = 1
+    static let fileName = "installed-paths.json"
+    static let stateFileName = "state.json"
+    private static let supportRoot = "~/Library/Application Support/"
+
+    var schemaVersion: Int
+    /// `~/Library/Application Support/<identifier>`, with `~` standing for the user's home directory.
+    var supportDirectory: String
+    /// Files the runtime writes in `supportDirectory`, relative to it. The fallback compose file
+    /// (`Paths.composeFileFallbackURL`) is not listed: the app only reads it, and only a
+    /// developer puts it there.
+    var files: [String]
+    /// The podman machine the app creates and runs its services in; always `machineName(appName:)`.
+    var podmanMachine: String
+
+    enum CodingKeys: String, CodingKey {
+        case schemaVersion = "schema_version"
+        case supportDirectory = "support_directory"
+        case files
+        case podmanMachine = "podman_machine"
+    }
+
+    /// `containerfy-<name>`, the podman machine an app named `name` runs.
+    static func machineName(appName: String?) -> String {
+        machinePrefix + (appName ?? "app")
+    }
+
+    private static let machinePrefix = "containerfy-"
+    /// What follows `machinePrefix` in a name this containerfy would generate.
+    private static let machineSuffixRegex = try! NSRegularExpression(pattern: "^[A-Za-z0-9][A-Za-z0-9_.-]*$")
+
+    /// The archive a volume seed is staged in while podman imports it; deleted once imported.
+    static func seedArchiveName(volume: String) -> String {
+        "seed-\(volume).tar"
+    }
+
+    static func make(config: ComposeConfig) -> InstalledPaths {
+        InstalledPaths(
+            schemaVersion: currentSchemaVersion,
+            supportDirectory: supportRoot + BundleAssembler.bundleIdentifier(config: config),
+            files: [stateFileName] + config.volumeSeeds.map { seedArchiveName(volume: $0.volume) },
+            podmanMachine: machineName(appName: config.name)
+        )
+    }
+
+    static func load(path: String) throws -> InstalledPaths {
+        guard let data = FileManager.default.contents(atPath: path),
+              let installed = try? JSONDecoder().decode(InstalledPaths.self, from: data) else {
+            throw InstalledPathsError.unreadable(path)
+        }
+        guard installed.schemaVersion <= currentSchemaVersion else {
+            throw InstalledPathsError.unsupportedSchema(installed.schemaVersion)
+        }
+        // Uninstall passes the name to `podman machine rm -f`, so an edited manifest must not name another machine
+        let suffix = String(installed.podmanMachine.dropFirst(machinePrefix.count))
+        guard installed.podmanMachine.hasPrefix(machinePrefix),
+              machineSuffixRegex.firstMatch(in: suffix, range: NSRange(suffix.startIndex..., in: suffix)) != nil else {
+            throw InstalledPathsError.unexpectedMachine(installed.podmanMachine)
+        }
+        return installed
+    }
+
+    func write(toResourcesPath resourcesPath: String) throws {
+        let encoder = JSONEncoder()
+        encoder.outputFormatting = [.prettyPrinted, .sortedKeys]
+        let path = (resourcesPath as NSString).appendingPathComponent(Self.fileName)
+        try encoder.encode(self).write(to: URL(fileURLWithPath: path))
+    }
+
+    /// The listed files and then the support directory itself, as absolute paths under `home`.
+    /// The directory must be a single entry in `~/Library/Application Support` and every file a
+    /// single entry in it, so an edited manifest can't point uninstall anywhere else.
+    func removablePaths(home: String) throws -> [String] {
+        func isSingleComponent(_ name: Substring) -> Bool {
+            !name.isEmpty && name != "." && name != ".." && !name.contains("/")
+        }
+        guard supportDirectory.hasPrefix(Self.supportRoot),
+              isSingleComponent(supportDirectory.dropFirst(Self.supportRoot.count)) else {
+            throw InstalledPathsError.outsideSupportDirectory(supportDirectory)
+        }
+        let directory = (home as NSString).appendingPathComponent(String(supportDirectory.dropFirst(2)))
+        // A symlinked directory would take the file removals somewhere else
+        if (try? FileManager.default.attributesOfItem(atPath: directory)[.type] as? FileAttributeType) == .typeSymbolicLink {
+            throw InstalledPathsError.outsideSupportDirectory(directory)
+        }
+        let paths = try files.map { file -> String in
+            guard isSingleComponent(Substring(file)) else {
+                throw InstalledPathsError.outsideSupportDirectory((supportDirectory as NSString).appendingPathComponent(file))
+            }
+            return (directory as NSString).appendingPathComponent(file)
+        }
+        return paths + [directory]
+    }
+}
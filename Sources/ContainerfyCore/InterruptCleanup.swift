@@ -0,0 +1,94 @@
+import Foundation
+
+/// Temp paths and child processes to tear down if `pack` is interrupted.
+///
+/// `defer` blocks don't run when the process dies from SIGINT or SIGTERM, so anything that
+/// would be left behind — a .dmg staging directory, an .iconset, a half-assembled .app — is
+/// tracked here while it exists. `installSignalHandlers()` makes Ctrl-C terminate in-flight
+/// commands, remove what is tracked, and exit with the conventional 128 + signal status.
+public final class InterruptCleanup: @unchecked Sendable {
+
+    public static let shared = InterruptCleanup()
+
+    private let lock = NSLock()
+    private var paths: Set<String> = []
+    private var processes: [ObjectIdentifier: Process] = [:]
+    private var logs: [ObjectIdentifier: BuildLog] = [:]
+    private var sources: [DispatchSourceSignal] = []
+
+    init() {}
+
+    func track(_ path: String) {
+        lock.lock(); defer { lock.unlock() }
+        paths.insert(path)
+    }
+
+    func untrack(_ path: String) {
+        lock.lock(); defer { lock.unlock() }
+        paths.remove(path)
+    }
+
+    func track(_ process: Process) {
+        lock.lock(); defer { lock.unlock() }
+        processes[ObjectIdentifier(process)] = process
+    }
+
+    func untrack(_ process: Process) {
+        lock.lock(); defer { lock.unlock() }
+        processes.removeValue(forKey: ObjectIdentifier(process))
+    }
+
+    func track(_ log: BuildLog) {
+        lock.lock(); defer { lock.unlock() }
+        logs[ObjectIdentifier(log)] = log
+    }
+
+    func untrack(_ log: BuildLog) {
+        lock.lock(); defer { lock.unlock() }
+        logs.removeValue(forKey: ObjectIdentifier(log))
+    }
+
+    /// Terminates tracked processes, removes tracked paths and closes tracked build logs.
+    /// Returns the removed paths.
+    @discardableResult
+    func cleanUp() -> [String] {
+        lock.lock()
+        let running = Array(processes.values)
+        let pending = paths.sorted()
+        let openLogs = Array(logs.values)
+        processes.removeAll()
+        paths.removeAll()
+        logs.removeAll()
+        lock.unlock()
+
+        for process in running where process.isRunning {
+            process.terminate()
+            process.waitUntilExit()
+        }
+        for path in pending {
+            try? FileManager.default.removeItem(atPath: path)
+        }
+        for log in openLogs {
+            log.close(status: "interrupted")
+        }
+        return pending
+    }
+
+    /// Handles SIGINT and SIGTERM by cleaning up and exiting. Call once, from the CLI entry point.
+    public func installSignalHandlers() {
+        lock.lock(); defer { lock.unlock() }
+        guard sources.isEmpty else { return }
+        for signo in [SIGINT, SIGTERM] {
+            // Ignore the default action so the dispatch source sees the signal instead
+            signal(signo, SIG_IGN)
+            let source = DispatchSource.makeSignalSource(signal: signo, queue: .global())
+            source.setEventHandler { [weak self] in
+                self?.cleanUp()
+                FileHandle.standardError.write("\nInterrupted — cleaned up temporary files\n".data(using: .utf8)!)
+                exit(128 + signo)
+            }
+            source.resume()
+            sources.append(source)
+        }
+    }
+}
@@ -0,0 +1,156 @@
+import Foundation
+
+/// CLI `lint` command — parses a compose file like `pack` does, then reports advisory
+/// best-practice findings from `ComposeLinter`.
+///
+/// Usage: containerfy lint [--compose <path>] [--disable-rule <id>]... [--strict]
+public struct LintCommand {
+
+    public init() {}
+
+    /// Runs the lint command. Returns an exit code: 0 unless parsing fails, or `--strict`
+    /// is given and at least one warning remains after `--disable-rule`.
+    public func run(arguments: [String]) -> Int32 {
+        var composePath = "./docker-compose.yml"
+        var buildOptions = ComposeConfigParser.BuildOptions()
+        var disabled = Set<String>()
+        var strict = false
+
+        var i = 0
+        while i < arguments.count {
+            switch arguments[i] {
+            case "--compose":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--compose requires a path argument")
+                    return 1
+                }
+                composePath = arguments[i]
+            case "--compose-format":
+                i += 1
+                guard i < arguments.count, let format = ComposeConfigParser.ComposeFormat(rawValue: arguments[i]) else {
+                    Self.printError("--compose-format must be yaml or json")
+                    return 1
+                }
+                buildOptions.composeFormat = format
+            case "--env-file-search-up":
+                i += 1
+                guard i < arguments.count, let levels = Int(arguments[i]), levels >= 0 else {
+                    Self.printError("--env-file-search-up requires a non-negative integer")
+                    return 1
+                }
+                buildOptions.envFileSearchUp = levels
+            case "--allow-env":
+                i += 1
+                guard i < arguments.count, !arguments[i].isEmpty, !arguments[i].contains("=") else {
+                    Self.printError("--allow-env requires a variable name")
+                    return 1
+                }
+                buildOptions.allowedEnvironment.insert(arguments[i])
+            case "--profile":
+                i += 1
+                guard i < arguments.count, !arguments[i].isEmpty, !arguments[i].hasPrefix("-") else {
+                    Self.printError("--profile requires a profile name")
+                    return 1
+                }
+                buildOptions.profiles.append(arguments[i])
+            case "--identifier":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--identifier requires a bundle ID")
+                    return 1
+                }
+                buildOptions.identifier = arguments[i]
+            case "--override-image":
+                i += 1
+                guard i < arguments.count, let eq = arguments[i].firstIndex(of: "="),
+                      eq != arguments[i].startIndex, eq != arguments[i].index(before: arguments[i].endIndex) else {
+                    Self.printError("--override-image requires <service>=<image>")
+                    return 1
+                }
+                let service = String(arguments[i][..<eq])
+                guard buildOptions.imageOverrides[service] == nil else {
+                    Self.printError("--override-image given twice for service \"\(service)\"")
+                    return 1
+                }
+                buildOptions.imageOverrides[service] = String(arguments[i][arguments[i].index(after: eq)...])
+            case "--disable-rule":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--disable-rule requires a rule ID")
+                    return 1
+                }
+                guard ComposeLinter.ruleIDs.contains(arguments[i]) else {
+                    Self.printError("unknown rule \"\(arguments[i])\" — run 'containerfy lint --list-rules'")
+                    return 1
+                }
+                disabled.insert(arguments[i])
+            case "--strict":
+                strict = true
+            case "--list-rules":
+                Self.printRules()
+                return 0
+            case "--help", "-h":
+                Self.printUsage()
+                return 0
+            default:
+                Self.printError("Unknown flag: \(arguments[i])")
+                Self.printUsage()
+                return 1
+            }
+            i += 1
+        }
+
+        let config: ComposeConfig
+        do {
+            config = try ComposeConfigParser.parseBuild(composePath: composePath, options: buildOptions)
+        } catch {
+            Self.printError(error.localizedDescription)
+            return 1
+        }
+
+        let findings = ComposeLinter.lint(config, disabled: disabled)
+        for finding in findings {
+            print(finding.line)
+        }
+        print(findings.isEmpty ? "No findings" : "\(findings.count) finding(s)")
+
+        return strict && !ComposeLinter.strictFailures(findings).isEmpty ? 1 : 0
+    }
+
+    // MARK: - Output Helpers
+
+    private static func printError(_ message: String) {
+        let stderr = FileHandle.standardError
+        stderr.write("Error: \(message)\n".data(using: .utf8)!)
+    }
+
+    private static func printRules() {
+        print("\(ComposeLinter.parserRuleID) (warning): non-fatal findings from compose validation")
+        for rule in ComposeLinter.rules {
+            print("\(rule.id) (\(rule.severity.rawValue)): \(rule.summary)")
+        }
+    }
+
+    private static func printUsage() {
+        print("""
+        Usage: containerfy lint [flags]
+
+        Report best-practice findings for a docker-compose.yml. Findings are advisory;
+        the exit code is non-zero only if the file fails validation, or under --strict.
+
+        Flags:
+          --compose <path>           Path to docker-compose.yml, or a directory containing one (default: ./docker-compose.yml)
+          --compose-format <fmt>     Parse the compose file as yaml or json (default: from the file extension)
+          --env-file-search-up <n>   Use the nearest .env in up to n parent directories for ${VAR}
+          --allow-env <name>         Let ${name} read the shell environment (repeatable)
+          --profile <name>           Also include services in this compose profile (repeatable)
+          --identifier <bundle-id>   Override x-containerfy.identifier
+          --override-image <svc>=<image>  Replace a service's image (repeatable)
+          --disable-rule <id>        Silence a rule (repeatable)
+          --strict                   Exit non-zero if any warning remains; info findings never fail
+          --list-rules               List rule IDs and exit
+          --help                     Show this help
+        """)
+    }
+}
@@ -3,25 +3,164 @@ import Foundation
 /// CLI `pack` command — validates compose, locates podman binaries, assembles .app bundle,
 /// and optionally signs + notarizes.
 ///
-/// Usage: containerfy pack [--compose <path>] [--output <path>] [--signed <keychain-profile>]
+/// Usage: containerfy pack [flags] — the flags are listed in `printUsage` and docs/cli-reference.md.
 public struct PackCommand {
 
     let signer: CodeSigner
+    let onEvent: (PackEvent) -> Void
 
-    public init() {
+    /// `onEvent` receives phase progress; the default prints the CLI's step output.
+    public init(onEvent: @escaping (PackEvent) -> Void = PackEvent.print) {
         self.signer = CodeSigner()
+        self.onEvent = onEvent
     }
 
-    init(signer: CodeSigner) {
+    init(signer: CodeSigner, onEvent: @escaping (PackEvent) -> Void = PackEvent.print) {
         self.signer = signer
+        self.onEvent = onEvent
     }
 
-    /// Runs the pack command. Returns an exit code (0 = success).
-    public func run(arguments: [String]) -> Int32 {
-        // Parse flags
+    /// How much `pack` prints. `--json` replaces all of it with JSON lines.
+    enum LogLevel {
+        /// Only errors (on stderr) and the final artifact path.
+        case quiet
+        /// Step headers, progress and the build summary.
+        case normal
+        /// Also every external command (codesign, hdiutil, notarytool, ...) and its output, on stderr.
+        case verbose
+    }
+
+    /// Flags shared by every app in a run.
+    private struct Options {
         var composePath = "./docker-compose.yml"
         var outputPath: String?
-        var signedProfile: String?
+        /// With `--all`, each app is written to `<outputDir>/<name>.app`.
+        var outputDir: String?
+        /// Set by `--signed`/`--notarize-profile` or the Apple ID flags; enables the .dmg and notarization.
+        var notary: CodeSigner.NotaryCredentials?
+        var maxBundleMB: Int?
+        var writeChecksum = false
+        /// `--build-manifest`: write `<name>.build-manifest.json` next to the final artifact.
+        var writeBuildManifest = false
+        var buildOptions = ComposeConfigParser.BuildOptions()
+        var signIdentity: String?
+        /// `--entitlements`: used instead of the generated entitlements when signing.
+        var entitlementsPath: String?
+        var releaseDMG = false
+        var printConfig = false
+        /// `--dry-run`: parse, print what a build would do, and stop.
+        var dryRun = false
+        /// `--signing-check`: check the signing identity, notary profile and tools, and stop.
+        var signingCheck = false
+        /// `--lint`: run ComposeLinter's rules and print the findings at the end of the build.
+        var lint = false
+        var json = false
+        var allDir: String?
+        var keepGoing = false
+        var requireSigned = false
+        var appcastPath: String?
+        var caCertPaths: [String] = []
+        var placeholderArtifacts = false
+        /// `--artifacts`: directory with prebuilt podman, gvproxy and vfkit to bundle.
+        var artifactsDir: String?
+        /// `--runtime-binary`: the app executable to bundle instead of this containerfy binary.
+        var runtimeBinary: String?
+        /// `--require-binary`: fail, rather than warn, when the app executable isn't found.
+        var requireBinary = false
+        var assess = false
+        var requireGatekeeperPass = false
+        /// `--dmg`: wrap the .app in a .dmg even without notarization.
+        var dmg = false
+        /// `--archive`: package the .app as a single .tar.gz or .zip instead.
+        var archive: BundleArchive.Format?
+        var volumeName: String?
+        /// `--tmpdir`: where scratch files and .dmg staging go.
+        var tempDir = NSTemporaryDirectory()
+        var logLevel = LogLevel.normal
+        /// Cleared by `--no-verify`: skip the self-test of the assembled bundle.
+        var verifyBundle = true
+        /// `--allow-http`: accept an `http://` `--compose` URL.
+        var allowHTTP = false
+        /// `--log-file`: where events, output, errors and external commands are also written.
+        var logPath: String?
+        /// The open `logPath`, for the rest of the run.
+        var log: BuildLog?
+        /// Whether `--compose` was given, which `--all` rejects.
+        var composeGiven = false
+        /// Cleared by the library entry points, which print nothing to stdout.
+        var printsOutput = true
+        /// Whether a missing `runtimeBinary` means this process's executable. Cleared by the
+        /// library entry points, where that is the embedding program rather than containerfy.
+        var bundlesOwnExecutable = true
+
+        init() {}
+
+        /// The library form: the flags `options` stands for, checked the way `parse` checks them.
+        init(_ options: PackOptions) throws {
+            composePath = options.composePath
+            composeGiven = true
+            outputPath = options.outputPath
+            signIdentity = options.signIdentity
+            notary = options.notarizeProfile.map { .keychainProfile($0) }
+            dmg = options.dmg
+            if let archive = options.archive {
+                guard let format = BundleArchive.Format(rawValue: archive) else {
+                    throw PackError.invalidOptions("--archive requires a format: tar.gz or zip")
+                }
+                self.archive = format
+            }
+            writeChecksum = options.checksum
+            writeBuildManifest = options.buildManifest
+            buildOptions.profiles = options.profiles
+            buildOptions.identifier = options.identifier
+            guard options.envFileSearchUp >= 0 else {
+                throw PackError.invalidOptions("--env-file-search-up requires a non-negative integer")
+            }
+            buildOptions.envFileSearchUp = options.envFileSearchUp
+            buildOptions.allowedEnvironment = Set(options.allowedEnvironment)
+            buildOptions.strict = options.strict
+            lint = options.lint
+            buildOptions.requirePinned = options.requirePinned
+            buildOptions.allowPrivileged = options.allowPrivileged
+            placeholderArtifacts = options.placeholderArtifacts
+            artifactsDir = options.artifactsDir
+            runtimeBinary = options.runtimeBinary
+            requireBinary = options.requireBinary
+            if let tmpDir = options.tmpDir {
+                var isDir: ObjCBool = false
+                guard FileManager.default.fileExists(atPath: tmpDir, isDirectory: &isDir), isDir.boolValue else {
+                    throw PackError.invalidOptions("--tmpdir requires an existing directory")
+                }
+                tempDir = tmpDir
+            }
+            logPath = options.logFile
+            printsOutput = false
+            bundlesOwnExecutable = false
+        }
+    }
+
+    /// Runs the pack command. Returns an exit code (0 = success).
+    public func run(arguments: [String]) -> Int32 {
+        var options = Options()
+        if let code = Self.parse(arguments, into: &options) { return code }
+        guard let logPath = options.logPath else { return run(options) }
+
+        // --log-file covers everything after the flags are parsed, failures included
+        do {
+            options.log = try Self.openLog(logPath, arguments: arguments)
+        } catch {
+            Self.printError(error.localizedDescription)
+            return 1
+        }
+        let code = run(options)
+        Self.closeLog(options.log, status: code == 0 ? "succeeded" : "failed (exit \(code))")
+        return code
+    }
+
+    /// Reads the flags into `options`. Returns the exit code to stop with, after printing
+    /// usage or an error, or nil to go on.
+    private static func parse(_ arguments: [String], into options: inout Options) -> Int32? {
+        var appleIDFlags: [String: String] = [:]
 
         var i = 0
         while i < arguments.count {
@@ -32,21 +171,256 @@ public struct PackCommand {
                     Self.printError("--compose requires a path argument")
                     return 1
                 }
-                composePath = arguments[i]
+                if options.composeGiven {
+                    options.buildOptions.overrideComposePaths.append(arguments[i])
+                } else {
+                    options.composePath = arguments[i]
+                }
+                options.composeGiven = true
             case "--output":
                 i += 1
                 guard i < arguments.count else {
                     Self.printError("--output requires a path argument")
                     return 1
                 }
-                outputPath = arguments[i]
+                options.outputPath = arguments[i]
             case "--signed":
                 i += 1
                 guard i < arguments.count else {
                     Self.printError("--signed requires a keychain profile name")
                     return 1
                 }
-                signedProfile = arguments[i]
+                options.notary = .keychainProfile(arguments[i])
+            case "--notarize-profile":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--notarize-profile requires a keychain profile name")
+                    return 1
+                }
+                options.notary = .keychainProfile(arguments[i])
+            case "--apple-id", "--team-id", "--app-password":
+                let flag = arguments[i]
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("\(flag) requires a value")
+                    return 1
+                }
+                appleIDFlags[flag] = arguments[i]
+            case "--sign-identity", "--sign":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("\(arguments[i - 1]) requires a certificate name or SHA-1 hash")
+                    return 1
+                }
+                options.signIdentity = arguments[i]
+            case "--release-dmg":
+                options.releaseDMG = true
+            case "--print-config":
+                options.printConfig = true
+            case "--dry-run":
+                options.dryRun = true
+            case "--signing-check":
+                options.signingCheck = true
+            case "--json":
+                options.json = true
+            case "--max-bundle-mb":
+                i += 1
+                guard i < arguments.count, let mb = Int(arguments[i]), mb > 0 else {
+                    Self.printError("--max-bundle-mb requires a positive integer")
+                    return 1
+                }
+                options.maxBundleMB = mb
+            case "--checksum":
+                options.writeChecksum = true
+            case "--build-manifest":
+                options.writeBuildManifest = true
+            case "--strict":
+                options.buildOptions.strict = true
+            case "--lint":
+                options.lint = true
+            case "--require-pinned":
+                options.buildOptions.requirePinned = true
+            case "--allow-privileged":
+                options.buildOptions.allowPrivileged = true
+            case "--max-env-file-kb":
+                i += 1
+                guard i < arguments.count, let kb = Int(arguments[i]), kb > 0 else {
+                    Self.printError("--max-env-file-kb requires a positive integer")
+                    return 1
+                }
+                options.buildOptions.maxEnvFileKB = kb
+            case "--all":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--all requires a directory argument")
+                    return 1
+                }
+                options.allDir = arguments[i]
+            case "--keep-going":
+                options.keepGoing = true
+            case "--emit-appcast":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--emit-appcast requires a path argument")
+                    return 1
+                }
+                options.appcastPath = arguments[i]
+            case "--compose-format":
+                i += 1
+                guard i < arguments.count, let format = ComposeConfigParser.ComposeFormat(rawValue: arguments[i]) else {
+                    Self.printError("--compose-format must be yaml or json")
+                    return 1
+                }
+                options.buildOptions.composeFormat = format
+            case "--env-file-search-up":
+                i += 1
+                guard i < arguments.count, let levels = Int(arguments[i]), levels >= 0 else {
+                    Self.printError("--env-file-search-up requires a non-negative integer")
+                    return 1
+                }
+                options.buildOptions.envFileSearchUp = levels
+            case "--allow-env":
+                i += 1
+                guard i < arguments.count, !arguments[i].isEmpty, !arguments[i].contains("=") else {
+                    Self.printError("--allow-env requires a variable name")
+                    return 1
+                }
+                options.buildOptions.allowedEnvironment.insert(arguments[i])
+            case "--max-disk-mb":
+                i += 1
+                guard i < arguments.count, let mb = Int(arguments[i]), mb >= 1024 else {
+                    Self.printError("--max-disk-mb requires an integer >= 1024")
+                    return 1
+                }
+                options.buildOptions.maxDiskMB = mb
+            case "--ca-cert":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--ca-cert requires a PEM file path")
+                    return 1
+                }
+                options.caCertPaths.append(arguments[i])
+            case "--identifier":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--identifier requires a bundle ID")
+                    return 1
+                }
+                options.buildOptions.identifier = arguments[i]
+            case "--confine-paths":
+                options.buildOptions.confinePaths = true
+            case "--confine-root":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--confine-root requires a directory argument")
+                    return 1
+                }
+                options.buildOptions.confinePaths = true
+                options.buildOptions.confineRoot = arguments[i]
+            case "--override-image":
+                i += 1
+                guard i < arguments.count, let eq = arguments[i].firstIndex(of: "="),
+                      eq != arguments[i].startIndex, eq != arguments[i].index(before: arguments[i].endIndex) else {
+                    Self.printError("--override-image requires <service>=<image>")
+                    return 1
+                }
+                let service = String(arguments[i][..<eq])
+                guard options.buildOptions.imageOverrides[service] == nil else {
+                    Self.printError("--override-image given twice for service \"\(service)\"")
+                    return 1
+                }
+                options.buildOptions.imageOverrides[service] = String(arguments[i][arguments[i].index(after: eq)...])
+            case "--entitlements":
+                i += 1
+                guard i < arguments.count, !arguments[i].isEmpty else {
+                    Self.printError("--entitlements requires a plist path")
+                    return 1
+                }
+                guard let data = FileManager.default.contents(atPath: arguments[i]),
+                      (try? PropertyListSerialization.propertyList(from: data, format: nil)) is [String: Any] else {
+                    Self.printError("--entitlements: \(arguments[i]) is not a readable property list with a top-level dictionary")
+                    return 1
+                }
+                options.entitlementsPath = arguments[i]
+            case "--profile":
+                i += 1
+                guard i < arguments.count, !arguments[i].isEmpty, !arguments[i].hasPrefix("-") else {
+                    Self.printError("--profile requires a profile name")
+                    return 1
+                }
+                options.buildOptions.profiles.append(arguments[i])
+            case "--require-signed":
+                options.requireSigned = true
+            case "--placeholder-artifacts":
+                options.placeholderArtifacts = true
+            case "--artifacts":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--artifacts requires a directory")
+                    return 1
+                }
+                options.artifactsDir = arguments[i]
+            case "--runtime-binary":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--runtime-binary requires a path")
+                    return 1
+                }
+                options.runtimeBinary = arguments[i]
+            case "--require-binary":
+                options.requireBinary = true
+            case "--dmg":
+                options.dmg = true
+            case "--archive":
+                i += 1
+                guard i < arguments.count, let format = BundleArchive.Format(rawValue: arguments[i]) else {
+                    Self.printError("--archive requires a format: tar.gz or zip")
+                    return 1
+                }
+                options.archive = format
+            case "--tmpdir":
+                i += 1
+                var isDir: ObjCBool = false
+                guard i < arguments.count, FileManager.default.fileExists(atPath: arguments[i], isDirectory: &isDir), isDir.boolValue else {
+                    Self.printError("--tmpdir requires an existing directory")
+                    return 1
+                }
+                options.tempDir = arguments[i]
+            case "--volume-name":
+                i += 1
+                guard i < arguments.count, !arguments[i].isEmpty else {
+                    Self.printError("--volume-name requires a name")
+                    return 1
+                }
+                options.volumeName = arguments[i]
+            case "--log-file":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--log-file requires a path argument")
+                    return 1
+                }
+                options.logPath = arguments[i]
+            case "--quiet", "-q":
+                guard options.logLevel != .verbose else {
+                    Self.printError("--quiet and --verbose cannot be combined")
+                    return 1
+                }
+                options.logLevel = .quiet
+            case "--verbose", "-v":
+                guard options.logLevel != .quiet else {
+                    Self.printError("--quiet and --verbose cannot be combined")
+                    return 1
+                }
+                options.logLevel = .verbose
+            case "--no-verify":
+                options.verifyBundle = false
+            case "--allow-http":
+                options.allowHTTP = true
+            case "--assess":
+                options.assess = true
+            case "--require-gatekeeper-pass":
+                options.assess = true
+                options.requireGatekeeperPass = true
             case "--help", "-h":
                 Self.printUsage()
                 return 0
@@ -58,92 +432,919 @@ public struct PackCommand {
             i += 1
         }
 
+        if !appleIDFlags.isEmpty {
+            guard options.notary == nil else {
+                Self.printError("--apple-id/--team-id/--app-password cannot be combined with --signed or --notarize-profile")
+                return 1
+            }
+            guard let appleID = appleIDFlags["--apple-id"], let teamID = appleIDFlags["--team-id"],
+                  let password = appleIDFlags["--app-password"] else {
+                Self.printError("notarizing with an Apple ID needs all of --apple-id, --team-id and --app-password")
+                return 1
+            }
+            options.notary = .appleID(appleID, teamID: teamID, password: password)
+        }
+        return nil
+    }
+
+    /// Everything after parsing: the modes that stop early, `--all`, or a single build.
+    private func run(_ options: Options) -> Int32 {
+        var options = options
+
+        // Check the signing setup and stop: nothing is parsed, downloaded or built
+        if options.signingCheck {
+            guard options.signIdentity != nil || options.notary != nil else {
+                Self.printError("--signing-check needs --sign <identity>, --notarize-profile <name>, or --apple-id, --team-id and --app-password", log: options.log)
+                return 1
+            }
+            let results = DoctorCommand(signer: signer).signingChecks(identity: options.signIdentity, notary: options.notary)
+            print(DoctorCommand.table(results))
+            return results.contains { $0.status == .fail } ? 1 : 0
+        }
+
+        do {
+            try Self.validate(&options)
+        } catch {
+            Self.printError(error.localizedDescription, log: options.log)
+            return 1
+        }
+        if let allDir = options.allDir {
+            return packAll(in: allDir, options: options)
+        }
+        return packAndReport(options)
+    }
+
+    /// Rejects flag combinations a build can't honor, before anything is downloaded or parsed.
+    /// `--release-dmg` also turns on the checksum.
+    private static func validate(_ options: inout Options) throws {
+        if options.releaseDMG {
+            guard options.signIdentity != nil, options.notary != nil else {
+                throw PackError.invalidOptions("--release-dmg requires --sign-identity and --notarize-profile (or --apple-id, --team-id and --app-password)")
+            }
+            options.writeChecksum = true
+        }
+        if options.requireSigned, options.notary == nil, options.signIdentity == nil {
+            throw PackError.invalidOptions("--require-signed: this build would be unsigned — pass --sign <identity>, --signed <keychain-profile> or --release-dmg")
+        }
+
+        if options.entitlementsPath != nil, options.notary == nil, options.signIdentity == nil {
+            throw PackError.invalidOptions("--entitlements only applies to signed builds — pass --sign <identity>, --signed <keychain-profile> or --release-dmg")
+        }
+
+        if options.appcastPath != nil, options.notary == nil {
+            throw PackError.invalidOptions("--emit-appcast needs a .dmg — pass --signed <keychain-profile> or --release-dmg")
+        }
+
+        if options.archive != nil, options.dmg || options.notary != nil {
+            throw PackError.invalidOptions("--archive cannot be combined with --dmg or notarization — archive the .app, then build the .dmg from it")
+        }
+
+        if options.artifactsDir != nil, options.placeholderArtifacts {
+            throw PackError.invalidOptions("--artifacts and --placeholder-artifacts cannot be combined")
+        }
+
+        if options.allDir != nil {
+            if options.json {
+                throw PackError.invalidOptions("--json is not supported with --all")
+            }
+            if options.outputPath?.contains("{") == true {
+                throw PackError.invalidOptions("--output placeholders are not supported with --all, where --output names the directory")
+            }
+            if options.composeGiven {
+                throw PackError.invalidOptions("--all and --compose cannot be combined")
+            }
+        } else if options.keepGoing {
+            throw PackError.invalidOptions("--keep-going is only supported with --all")
+        }
+
+        if RemoteCompose.isURL(options.composePath) {
+            if options.buildOptions.overrideComposePaths.contains(where: RemoteCompose.isURL) {
+                throw PackError.invalidOptions("only the first --compose may be a URL")
+            }
+        } else if options.allowHTTP {
+            throw PackError.invalidOptions("--allow-http only applies when --compose is a URL")
+        }
+    }
+
+    /// Runs the pipeline for one app and prints what it produced. Returns an exit code.
+    private func packAndReport(_ options: Options) -> Int32 {
+        do {
+            switch try pack(options) {
+            case .config(let text), .plan(let text):
+                print(text)
+            case .built(let result):
+                if options.json {
+                    result.printJSON()
+                } else if options.logLevel == .quiet {
+                    print(result.path)
+                }
+            }
+            return 0
+        } catch {
+            if case PackError.lintFailed(let findings) = error {
+                for finding in findings { Self.printError(finding, log: options.log) }
+            }
+            Self.printError(error.localizedDescription, log: options.log)
+            return 1
+        }
+    }
+
+    /// What one run of the pipeline produced.
+    private enum Outcome {
+        /// `--print-config`: the resolved config, as text or JSON.
+        case config(String)
+        /// `--dry-run`: what a build would do.
+        case plan(String)
+        case built(PackResult)
+    }
+
+    /// The pipeline for a single compose file, shared by the CLI and the library entry points.
+    /// A failed step emits a `.failed` event and throws a `PackError` for the caller to report.
+    private func pack(_ options: Options) throws -> Outcome {
+        var options = options
+
+        // A compose file served over HTTPS is downloaded to a scratch directory and packed from there
+        var remoteDir: String?
+        defer {
+            if let remoteDir {
+                InterruptCleanup.shared.untrack(remoteDir)
+                try? FileManager.default.removeItem(atPath: remoteDir)
+            }
+        }
+        if RemoteCompose.isURL(options.composePath) {
+            let dir = (options.tempDir as NSString).appendingPathComponent("containerfy-remote-\(ProcessInfo.processInfo.globallyUniqueString)")
+            remoteDir = dir
+            InterruptCleanup.shared.track(dir)
+            do {
+                try FileManager.default.createDirectory(atPath: dir, withIntermediateDirectories: true)
+                options.buildOptions.remoteSource = options.composePath
+                options.composePath = try RemoteCompose.download(options.composePath, into: dir, allowHTTP: options.allowHTTP)
+            } catch {
+                throw PackError.invalidCompose(error.localizedDescription)
+            }
+        }
+
+        func parseCompose() throws -> ComposeConfig {
+            do {
+                return try ComposeConfigParser.parseBuild(composePath: options.composePath, options: options.buildOptions)
+            } catch {
+                throw PackError.invalidCompose("Compose validation failed: \(error.localizedDescription)")
+            }
+        }
+
+        // Debug dump: parse, return the resolved config, and stop before building
+        if options.printConfig {
+            let config = try parseCompose()
+            do {
+                return .config(options.json ? try Self.configJSON(config) : Self.configText(config))
+            } catch {
+                throw PackError.invalidCompose("Compose validation failed: \(error.localizedDescription)")
+            }
+        }
+
+        // Plan only: parse and size the build, but touch nothing on disk and run no tools
+        if options.dryRun {
+            let config = try parseCompose()
+            let binaries = options.placeholderArtifacts ? nil : try? Self.locateBinaries(options)
+            do {
+                return .plan(try Self.dryRunPlan(config, options: options, binaries: binaries))
+            } catch {
+                throw PackError.invalidOptions(error.localizedDescription)
+            }
+        }
+
+        let signs = options.notary != nil || options.signIdentity != nil
+        // The notarized pipeline always builds a .dmg; otherwise --dmg adds its own step
+        let standaloneDMG = options.dmg && options.notary == nil
+        // --archive is the alternative to --dmg, so it takes the same step
+        let dmgStep = signs ? 5 : 4
+        let totalSteps = 3 + (signs ? 1 : 0) + (standaloneDMG || options.archive != nil ? 1 : 0) + (options.assess ? 1 : 0)
+        // --json: newline-delimited events and a final result on stdout, nothing else
+        let handler: (PackEvent) -> Void
+        if options.json {
+            handler = PackEvent.printJSON
+        } else {
+            handler = options.logLevel == .quiet ? { _ in } : onEvent
+        }
+        // External commands are echoed with --verbose and always recorded in --log-file
+        let shell: ShellExecutor = options.logLevel == .verbose || options.log != nil
+            ? EchoingShellExecutor(base: self.signer.shell, console: options.logLevel == .verbose, log: options.log)
+            : self.signer.shell
+        let signer = CodeSigner(shell: shell, tempDir: options.tempDir)
+        func emit(_ phase: PackEvent.Phase, _ step: Int, _ status: PackEvent.Status, _ message: String) {
+            options.log?.write("[\(step)/\(totalSteps)] \(phase.rawValue) \(status.rawValue): \(message)")
+            handler(PackEvent(phase: phase, step: step, totalSteps: totalSteps, status: status, message: message))
+        }
+        func say(_ line: String) {
+            options.log?.write(line)
+            if !options.json, options.logLevel != .quiet, options.printsOutput { print(line) }
+        }
+        func checksum(_ artifact: String) throws {
+            guard options.writeChecksum else { return }
+            do {
+                say("    Checksum: \(try Checksum.writeSidecar(for: artifact))")
+            } catch {
+                throw PackError.packagingFailed("Checksum failed: \(error.localizedDescription)")
+            }
+        }
+
+        // Final step with --assess: ask Gatekeeper about the finished .app. A rejection is
+        // only fatal under --require-gatekeeper-pass.
+        func assessGatekeeper(_ appPath: String) throws {
+            guard options.assess else { return }
+            emit(.assess, totalSteps, .started, "Assessing with Gatekeeper (spctl)...")
+            let verdict: CodeSigner.GatekeeperVerdict
+            do {
+                verdict = try signer.assessGatekeeper(appPath: appPath)
+            } catch {
+                emit(.assess, totalSteps, .failed, error.localizedDescription)
+                let message = "Gatekeeper assessment failed: \(error.localizedDescription)"
+                if options.requireGatekeeperPass { throw PackError.gatekeeperRejected(message) }
+                Self.printError(message, log: options.log)
+                return
+            }
+            if verdict.accepted {
+                emit(.assess, totalSteps, .completed, "Gatekeeper: accepted (\(verdict.reason))")
+                say("    Gatekeeper: accepted (\(verdict.reason))")
+                return
+            }
+            emit(.assess, totalSteps, .failed, "Gatekeeper: rejected (\(verdict.reason))")
+            say("    Gatekeeper: rejected (\(verdict.reason))")
+            if options.requireGatekeeperPass {
+                throw PackError.gatekeeperRejected("--require-gatekeeper-pass: Gatekeeper would block this app on end-user machines (\(verdict.reason))")
+            }
+        }
+
+        // `--sign` alone: check the identity exists before spending time on the build
+        var signOnlyIdentity: String?
+        if options.notary == nil, let preferred = options.signIdentity {
+            do {
+                signOnlyIdentity = try signer.resolveIdentity(preferred: preferred)
+            } catch {
+                throw PackError.signingFailed("Signing failed: \(error.localizedDescription)")
+            }
+        }
+
         // Step 1: Parse and validate compose file
-        Self.printStep(1, "Parsing \(composePath)...")
+        emit(.parse, 1, .started, "Parsing \(options.composePath)...")
         let config: ComposeConfig
         do {
-            config = try ComposeConfigParser.parseBuild(composePath: composePath)
+            config = try parseCompose()
         } catch {
-            Self.printError("Compose validation failed: \(error.localizedDescription)")
-            return 1
+            emit(.parse, 1, .failed, error.localizedDescription)
+            throw error
         }
 
         let name = config.name ?? "Containerfy"
         let version = config.version ?? "1.0.0"
         let identifier = config.identifier ?? "unknown"
 
-        print("    App: \(name) v\(version) (\(identifier))")
-        print("    Images: \(config.images.count), Ports: \(config.portMappings.map { String($0.hostPort) }.joined(separator: ", "))")
+        emit(.parse, 1, .progress, "App: \(name) v\(version) (\(identifier))")
+        emit(.parse, 1, .progress, "Images: \(config.images.count), Ports: \(config.portMappings.map { $0.protocol == "tcp" ? String($0.hostPort) : "\($0.hostPort)/\($0.protocol)" }.joined(separator: ", "))")
+        for warning in config.warnings {
+            emit(.parse, 1, .progress, "Warning: \(warning)")
+        }
+        // --lint: findings are printed once the build is done, unless --strict stops it here
+        let lintFindings = options.lint ? ComposeLinter.lint(config) : []
+        let strictFailures = options.buildOptions.strict ? ComposeLinter.strictFailures(lintFindings) : []
+        if !strictFailures.isEmpty {
+            let error = PackError.lintFailed(strictFailures.map(\.line))
+            emit(.parse, 1, .failed, error.localizedDescription)
+            throw error
+        }
+        var caCertificates: [CACertificates.Certificate] = []
+        do {
+            for path in options.caCertPaths {
+                caCertificates += try CACertificates.load(path: path)
+            }
+        } catch {
+            emit(.parse, 1, .failed, error.localizedDescription)
+            throw PackError.invalidOptions(error.localizedDescription)
+        }
+        for cert in caCertificates {
+            emit(.parse, 1, .progress, "CA: \(cert.fingerprint) (\(cert.source))")
+        }
+        emit(.parse, 1, .completed, "Parsed \(options.composePath)")
 
-        // Step 2: Locate podman binaries (must be alongside the containerfy binary)
-        Self.printStep(2, "Locating podman binaries...")
+        // Step 2: Locate podman binaries (alongside the containerfy binary, or in --artifacts)
+        emit(.locateBinaries, 2, .started, "Locating podman binaries...")
         let podmanPath: String
         let gvproxyPath: String
         let vfkitPath: String
+        let runtimePath: String
+        var placeholderDir: String?
+        defer {
+            if let placeholderDir {
+                InterruptCleanup.shared.untrack(placeholderDir)
+                try? FileManager.default.removeItem(atPath: placeholderDir)
+            }
+        }
         do {
-            (podmanPath, gvproxyPath, vfkitPath) = try BundleAssembler.findPodmanBinaries()
-            print("    podman:  \(podmanPath)")
-            print("    gvproxy: \(gvproxyPath)")
-            print("    vfkit:   \(vfkitPath)")
+            if options.placeholderArtifacts {
+                let dir = (options.tempDir as NSString).appendingPathComponent("containerfy-placeholders-\(ProcessInfo.processInfo.globallyUniqueString)")
+                placeholderDir = dir
+                InterruptCleanup.shared.track(dir)
+                (podmanPath, gvproxyPath, vfkitPath) = try BundleAssembler.writePlaceholderBinaries(in: dir)
+                emit(.locateBinaries, 2, .progress, "Using placeholder binaries — the bundle will not run")
+            } else {
+                (podmanPath, gvproxyPath, vfkitPath) = try Self.locateBinaries(options)
+            }
+            runtimePath = try Self.locateRuntimeBinary(options)
+            emit(.locateBinaries, 2, .progress, "runtime: \(runtimePath)")
+            emit(.locateBinaries, 2, .progress, "podman:  \(podmanPath)")
+            emit(.locateBinaries, 2, .progress, "gvproxy: \(gvproxyPath)")
+            emit(.locateBinaries, 2, .progress, "vfkit:   \(vfkitPath)")
+            emit(.locateBinaries, 2, .completed, "Found podman binaries")
         } catch {
-            Self.printError("\(error.localizedDescription)")
-            return 1
+            emit(.locateBinaries, 2, .failed, error.localizedDescription)
+            throw PackError.missingBinaries(error.localizedDescription)
         }
 
         // Step 3: Assemble .app bundle
-        let output = outputPath ?? "./\(name)"
-        Self.printStep(3, "Assembling .app bundle...")
+        emit(.assemble, 3, .started, "Assembling .app bundle...")
+        let output: String
+        do {
+            output = try Self.outputPath(for: config, options: options)
+        } catch {
+            emit(.assemble, 3, .failed, error.localizedDescription)
+            throw PackError.invalidOptions(error.localizedDescription)
+        }
+        do {
+            // Fail now rather than halfway through a copy or hdiutil
+            let appBytes = BundleAssembler.estimatedAppBytes(
+                config: config, binaries: [podmanPath, gvproxyPath, vfkitPath, runtimePath]
+            )
+            let outputDir = (output as NSString).deletingLastPathComponent
+            try BundleAssembler.checkFreeSpace(BundleAssembler.spaceNeeded(
+                appBytes: appBytes, outputDir: outputDir.isEmpty ? "." : outputDir,
+                tempDir: options.tempDir, dmg: options.dmg || options.notary != nil
+            ))
+        } catch {
+            emit(.assemble, 3, .failed, error.localizedDescription)
+            throw PackError.assemblyFailed(error.localizedDescription)
+        }
         do {
             try BundleAssembler.assemble(
                 config: config,
                 podmanPath: podmanPath,
                 gvproxyPath: gvproxyPath,
                 vfkitPath: vfkitPath,
-                outputPath: output
+                outputPath: output,
+                binaryPath: runtimePath,
+                caCertificates: caCertificates,
+                tempDir: options.tempDir,
+                shell: signer.shell
             )
         } catch {
-            Self.printError("Bundle assembly failed: \(error.localizedDescription)")
-            return 1
+            emit(.assemble, 3, .failed, error.localizedDescription)
+            throw PackError.assemblyFailed("Bundle assembly failed: \(error.localizedDescription)")
         }
 
         let appPath = output.hasSuffix(".app") ? output : output + ".app"
-        print("")
 
-        if let profile = signedProfile {
-            Self.printStep(4, "Signing and packaging...")
+        do {
+            if let maxMB = options.maxBundleMB {
+                try BundleAssembler.checkSizeBudget(path: appPath, maxMB: maxMB)
+            }
+            if options.verifyBundle {
+                try BundleAssembler.verifyBundle(appPath: appPath)
+            }
+        } catch {
+            emit(.assemble, 3, .failed, error.localizedDescription)
+            throw PackError.assemblyFailed(error.localizedDescription)
+        }
+        emit(.assemble, 3, .progress, "-> \(appPath)")
+        emit(.assemble, 3, .completed, appPath)
+        say("")
+
+        var manifestPath: String?
+        func result(_ artifact: String, signed: Bool, notarized: Bool) -> PackResult {
+            PackResult(
+                path: artifact, name: name, version: version, identifier: identifier,
+                images: config.images, signed: signed, notarized: notarized,
+                checksum: options.writeChecksum ? artifact + ".sha256" : nil,
+                buildManifest: manifestPath
+            )
+        }
+
+        func buildManifest(_ artifact: String, signed: Bool, notarized: Bool) throws {
+            guard options.writeBuildManifest else { return }
+            do {
+                let manifest = try BuildManifest.make(
+                    config: config, appPath: appPath, artifactPath: artifact,
+                    caCertificates: caCertificates, signed: signed, notarized: notarized
+                )
+                let path = try manifest.write(nextTo: artifact)
+                manifestPath = path
+                say("    Build manifest: \(path)")
+            } catch {
+                throw PackError.packagingFailed("Build manifest failed: \(error.localizedDescription)")
+            }
+        }
+
+        let volumeName = options.volumeName ?? config.displayName ?? name
+
+        // `--dmg` without notarization: wrap the .app for drag-to-Applications installs.
+        // Returns the .dmg path.
+        func makeStandaloneDMG() throws -> String {
+            emit(.dmg, dmgStep, .started, "Creating .dmg...")
+            let dmgPath: String
+            do {
+                let outputDir = (appPath as NSString).deletingLastPathComponent
+                dmgPath = try signer.createDMG(
+                    appPath: appPath, appName: name, volumeName: volumeName,
+                    outputDir: outputDir.isEmpty ? "." : outputDir
+                )
+                if let maxMB = options.maxBundleMB {
+                    try BundleAssembler.checkSizeBudget(path: dmgPath, maxMB: maxMB)
+                }
+            } catch {
+                emit(.dmg, dmgStep, .failed, error.localizedDescription)
+                throw PackError.packagingFailed("DMG creation failed: \(error.localizedDescription)")
+            }
+            emit(.dmg, dmgStep, .completed, dmgPath)
+            return dmgPath
+        }
+
+        // `--archive`: the whole .app tree in one file, modes and symlinks intact.
+        // Returns the archive path.
+        func makeArchive(_ format: BundleArchive.Format) throws -> String {
+            emit(.archive, dmgStep, .started, "Creating .\(format.rawValue) archive...")
+            let archivePath: String
+            do {
+                let outputDir = (appPath as NSString).deletingLastPathComponent
+                archivePath = try BundleArchive.create(
+                    appPath: appPath, appName: name, format: format,
+                    outputDir: outputDir.isEmpty ? "." : outputDir, shell: signer.shell
+                )
+            } catch {
+                emit(.archive, dmgStep, .failed, error.localizedDescription)
+                throw PackError.packagingFailed(error.localizedDescription)
+            }
+            emit(.archive, dmgStep, .completed, archivePath)
+            return archivePath
+        }
+
+        let built: PackResult
+        if let notary = options.notary {
+            emit(.sign, 4, .started, "Signing and packaging...")
+            let dmgPath: String
             do {
                 let outputDir = (appPath as NSString).deletingLastPathComponent
-                let dmgPath = try signer.signAndPackage(
+                dmgPath = try signer.signAndPackage(
                     appPath: appPath,
                     appName: name,
                     outputDir: outputDir.isEmpty ? "." : outputDir,
-                    keychainProfile: profile,
+                    notary: notary,
+                    volumeName: volumeName,
+                    identity: options.signIdentity,
+                    entitlements: options.entitlementsPath,
+                    requireStaple: options.releaseDMG,
                     onProgress: { status in
-                        print("    \(status)")
+                        emit(.sign, 4, .progress, status)
                     }
                 )
-                print("")
-                print("Build complete: \(dmgPath)")
             } catch {
-                Self.printError("Signing failed: \(error.localizedDescription)")
-                return 1
+                emit(.sign, 4, .failed, error.localizedDescription)
+                throw PackError.signingFailed("Signing failed: \(error.localizedDescription)")
+            }
+            if let maxMB = options.maxBundleMB {
+                do {
+                    try BundleAssembler.checkSizeBudget(path: dmgPath, maxMB: maxMB)
+                } catch {
+                    emit(.sign, 4, .failed, error.localizedDescription)
+                    throw PackError.packagingFailed(error.localizedDescription)
+                }
+            }
+            emit(.sign, 4, .completed, dmgPath)
+            try assessGatekeeper(appPath)
+            try checksum(dmgPath)
+            try buildManifest(dmgPath, signed: true, notarized: true)
+            if let appcastPath = options.appcastPath {
+                do {
+                    let item = try Appcast.item(
+                        title: config.displayName ?? name,
+                        version: version,
+                        build: config.buildNumber,
+                        dmgPath: dmgPath,
+                        minimumSystemVersion: config.minimumMacOS ?? BundleAssembler.minimumSystemVersion
+                    )
+                    try Appcast.write(item: item, title: config.displayName ?? name, to: appcastPath)
+                    say("    Appcast: \(appcastPath)")
+                } catch {
+                    throw PackError.packagingFailed("Appcast failed: \(error.localizedDescription)")
+                }
+            }
+            say("")
+            say("Build complete: \(dmgPath)")
+            built = result(dmgPath, signed: true, notarized: true)
+            if options.placeholderArtifacts {
+                say("Note: Built with --placeholder-artifacts — do not distribute; the app cannot start its VM.")
+            }
+        } else if let identity = signOnlyIdentity {
+            emit(.sign, 4, .started, "Signing...")
+            do {
+                try signer.signApp(appPath: appPath, identity: identity, entitlements: options.entitlementsPath, onProgress: { status in
+                    emit(.sign, 4, .progress, status)
+                })
+            } catch {
+                emit(.sign, 4, .failed, error.localizedDescription)
+                throw PackError.signingFailed("Signing failed: \(error.localizedDescription)")
+            }
+            emit(.sign, 4, .completed, "Signed and verified (codesign --verify --strict)")
+            var artifact = appPath
+            if standaloneDMG {
+                artifact = try makeStandaloneDMG()
+            } else if let format = options.archive {
+                artifact = try makeArchive(format)
             }
+            try assessGatekeeper(appPath)
+            try checksum(artifact)
+            try buildManifest(artifact, signed: true, notarized: false)
+            say("Build complete (signed, not notarized): \(artifact)")
+            built = result(artifact, signed: true, notarized: false)
+            say("Note: Gatekeeper blocks downloaded apps that are not notarized.")
+            say("      To notarize: containerfy pack --sign-identity <identity> --signed <keychain-profile>")
         } else {
-            print("Build complete (unsigned): \(appPath)")
-            print("Note: Unsigned apps will trigger a Gatekeeper warning on end-user machines.")
-            print("      To sign and notarize: containerfy pack --signed <keychain-profile>")
+            var artifact = appPath
+            if standaloneDMG {
+                artifact = try makeStandaloneDMG()
+            } else if let format = options.archive {
+                artifact = try makeArchive(format)
+            }
+            try assessGatekeeper(appPath)
+            try checksum(artifact)
+            try buildManifest(artifact, signed: false, notarized: false)
+            say("Build complete (unsigned): \(artifact)")
+            built = result(artifact, signed: false, notarized: false)
+            if options.placeholderArtifacts {
+                say("Note: Built with --placeholder-artifacts — the app cannot start its VM.")
+            }
+            say("Note: Unsigned apps will trigger a Gatekeeper warning on end-user machines.")
+            say("      To sign and notarize: containerfy pack --signed <keychain-profile>")
         }
 
-        return 0
+        if options.lint {
+            say("")
+            for finding in lintFindings { say(finding.line) }
+            say(lintFindings.isEmpty ? "No lint findings" : "\(lintFindings.count) lint finding(s)")
+        }
+        return .built(built)
     }
 
-    // MARK: - Output Helpers
+    // MARK: - Library Entry Points
+
+    /// Packs one app from typed options, for programs that embed containerfy. Progress goes only
+    /// to this command's `onEvent` (which prints unless one is passed to `init(onEvent:)`), and a
+    /// failure throws a `PackError`. `options.runtimeBinary` is required.
+    public func run(_ options: PackOptions) throws -> PackResult {
+        guard case .built(let result) = try pack(options, mode: { _ in }) else {
+            preconditionFailure("a build returns its result")
+        }
+        return result
+    }
+
+    /// `pack --dry-run` for embedders: what `run(_:)` would do with `options`, without
+    /// writing anything or running any tool.
+    public func plan(_ options: PackOptions) throws -> String {
+        guard case .plan(let plan) = try pack(options, mode: { $0.dryRun = true }) else {
+            preconditionFailure("a dry run returns its plan")
+        }
+        return plan
+    }
+
+    /// `pack --print-config` for embedders: the config `run(_:)` would build from, as text
+    /// or, with `json`, in the `--print-config --json` format.
+    public func resolvedConfig(_ options: PackOptions, json: Bool = false) throws -> String {
+        guard case .config(let config) = try pack(options, mode: { $0.printConfig = true; $0.json = json }) else {
+            preconditionFailure("--print-config returns the config")
+        }
+        return config
+    }
+
+    /// Maps `packOptions` onto the CLI's options, sets the mode, and runs the pipeline, with
+    /// `logFile` open around it.
+    private func pack(_ packOptions: PackOptions, mode: (inout Options) -> Void) throws -> Outcome {
+        var options = try Options(packOptions)
+        mode(&options)
+        try Self.validate(&options)
+        guard let logPath = options.logPath else { return try pack(options) }
+
+        options.log = try Self.openLog(logPath, arguments: packOptions.arguments)
+        do {
+            let outcome = try pack(options)
+            Self.closeLog(options.log, status: "succeeded")
+            return outcome
+        } catch {
+            options.log?.write("Error: \(error.localizedDescription)")
+            Self.closeLog(options.log, status: "failed")
+            throw error
+        }
+    }
+
+    /// Opens `--log-file` and writes the command line it covers.
+    private static func openLog(_ path: String, arguments: [String]) throws -> BuildLog {
+        let log: BuildLog
+        do {
+            log = try BuildLog(path: path)
+        } catch {
+            throw PackError.invalidOptions("--log-file: could not create \(path): \(error.localizedDescription)")
+        }
+        log.write("containerfy \(ContainerfyVersion.current): " + EchoingShellExecutor.commandLine(executable: "pack", arguments: arguments))
+        InterruptCleanup.shared.track(log)
+        return log
+    }
 
-    private static func printStep(_ step: Int, _ message: String) {
-        print("[\(step)] \(message)")
+    private static func closeLog(_ log: BuildLog?, status: String) {
+        guard let log else { return }
+        InterruptCleanup.shared.untrack(log)
+        log.close(status: status)
     }
 
-    private static func printError(_ message: String) {
+    // MARK: - Batch Builds
+
+    /// Packs every immediate subdirectory of `dir` that contains a compose file.
+    /// Stops at the first failure unless `--keep-going`, then prints a summary.
+    private func packAll(in dir: String, options: Options) -> Int32 {
+        let apps = Self.discoverApps(in: dir)
+        guard !apps.isEmpty else {
+            Self.printError("no compose files found in subdirectories of \(dir)", log: options.log)
+            return 1
+        }
+
+        var results: [(app: String, status: String)] = []
+        for (index, composePath) in apps.enumerated() {
+            let app = ((composePath as NSString).deletingLastPathComponent as NSString).lastPathComponent
+            print("==> [\(index + 1)/\(apps.count)] \(app)")
+
+            var appOptions = options
+            appOptions.composePath = composePath
+            appOptions.outputDir = options.outputPath
+            appOptions.outputPath = nil
+
+            options.log?.write("==> [\(index + 1)/\(apps.count)] \(app)")
+            let code = packAndReport(appOptions)
+            results.append((app, code == 0 ? "ok" : "FAILED"))
+            print("")
+            if code != 0, !options.keepGoing {
+                for skipped in apps.dropFirst(index + 1) {
+                    results.append((((skipped as NSString).deletingLastPathComponent as NSString).lastPathComponent, "skipped"))
+                }
+                break
+            }
+        }
+
+        let failed = results.filter { $0.status != "ok" }.count
+        var summary = ["Summary: \(results.count - failed) of \(apps.count) app(s) built"]
+        for result in results {
+            summary.append("  \(result.status.padding(toLength: 8, withPad: " ", startingAt: 0))\(result.app)")
+        }
+        options.log?.write(summary.joined(separator: "\n"))
+        print(summary.joined(separator: "\n"))
+        return failed == 0 ? 0 : 1
+    }
+
+    /// Compose files in the immediate, non-hidden subdirectories of `dir`, sorted by directory name.
+    static func discoverApps(in dir: String) -> [String] {
+        let fm = FileManager.default
+        guard let entries = try? fm.contentsOfDirectory(atPath: dir) else { return [] }
+        return entries.sorted().compactMap { entry in
+            guard !entry.hasPrefix(".") else { return nil }
+            let sub = (dir as NSString).appendingPathComponent(entry)
+            var isDir: ObjCBool = false
+            guard fm.fileExists(atPath: sub, isDirectory: &isDir), isDir.boolValue else { return nil }
+            return try? ComposeConfigParser.discoverComposeFile(inDirectory: sub)
+        }
+    }
+
+    /// The podman, gvproxy and vfkit to bundle: from `--artifacts` if given, otherwise next to containerfy.
+    private static func locateBinaries(_ options: Options) throws -> (podman: String, gvproxy: String, vfkit: String) {
+        if let dir = options.artifactsDir {
+            return try BundleAssembler.prebuiltBinaries(in: dir)
+        }
+        return try BundleAssembler.findPodmanBinaries()
+    }
+
+    /// The app executable to bundle: `--runtime-binary` if given, otherwise this containerfy binary.
+    /// With `--require-binary` a missing one is an error here instead of a warning during assembly.
+    /// The library entry points have no containerfy binary to fall back to, so they require one.
+    private static func locateRuntimeBinary(_ options: Options) throws -> String {
+        if let path = options.runtimeBinary {
+            // Checked again when the bundle is assembled; failing here skips exporting images first
+            try BundleAssembler.checkRuntimeArchitecture(BundleAssembler.runtimeBinary(at: path))
+            return path
+        }
+        guard options.bundlesOwnExecutable else {
+            throw PackError.missingBinaries("runtimeBinary is required when packing from a library — pass the containerfy executable to bundle")
+        }
+        let path = CommandLine.arguments[0]
+        if options.requireBinary, !FileManager.default.fileExists(atPath: path) {
+            throw BundleAssembler.AssemblyError.missingArtifact(
+                "Containerfy binary not found at \(path) (--require-binary) — pass --runtime-binary <path>"
+            )
+        }
+        return path
+    }
+
+    // MARK: - Output Path
+
+    enum OutputTemplateError: LocalizedError {
+        case unknownPlaceholder(String)
+        case escapesDirectory(String)
+
+        var errorDescription: String? {
+            switch self {
+            case .unknownPlaceholder(let placeholder):
+                return "--output: unknown placeholder {\(placeholder)} — use {name}, {version} or {platform}"
+            case .escapesDirectory(let path):
+                return "--output: \(path) is outside the current directory — use an absolute path to write there"
+            }
+        }
+    }
+
+    /// `{platform}`: what the bundled podman, gvproxy and vfkit run on — this Mac's architecture.
+    static var platform: String {
+        "macos-\(BundleAssembler.targetArchitecture)"
+    }
+
+    private static let placeholderRegex = try! NSRegularExpression(pattern: #"\{([^{}]*)\}"#)
+
+    /// Replaces `{name}`, `{version}` and `{platform}` in an `--output` value, e.g.
+    /// `dist/{name}-{version}` becomes `dist/MyApp-1.2.3`. A relative path with placeholders
+    /// must stay inside the current directory; paths without any are used as given.
+    static func expandOutputTemplate(_ template: String, name: String, version: String, platform: String = PackCommand.platform) throws -> String {
+        let values = ["name": name, "version": version, "platform": platform]
+        let matches = placeholderRegex.matches(in: template, range: NSRange(template.startIndex..., in: template))
+        guard !matches.isEmpty else { return template }
+
+        var expanded = template
+        for match in matches.reversed() {
+            let whole = Range(match.range, in: template)!
+            let key = String(template[Range(match.range(at: 1), in: template)!])
+            guard let value = values[key] else {
+                throw OutputTemplateError.unknownPlaceholder(key)
+            }
+            expanded.replaceSubrange(whole, with: value)
+        }
+
+        if !(expanded as NSString).isAbsolutePath {
+            var depth = 0
+            for component in expanded.split(separator: "/") {
+                switch component {
+                case ".": continue
+                case "..": depth -= 1
+                default: depth += 1
+                }
+                if depth < 0 { throw OutputTemplateError.escapesDirectory(expanded) }
+            }
+        }
+        return expanded
+    }
+
+    /// Where the .app goes, without the `.app` suffix Assemble adds: `--output` with its
+    /// placeholders expanded, or `<name>` in the current (or `--all` output) directory.
+    private static func outputPath(for config: ComposeConfig, options: Options) throws -> String {
+        let name = config.name ?? "Containerfy"
+        guard let template = options.outputPath else {
+            return "\(options.outputDir ?? ".")/\(name)"
+        }
+        return try expandOutputTemplate(template, name: name, version: config.version ?? "1.0.0")
+    }
+
+    // MARK: - Config Dump
+
+    /// `--print-config --json` output, with secrets masked.
+    static func configJSON(_ config: ComposeConfig) throws -> String {
+        String(decoding: try config.masked().jsonData(), as: UTF8.self)
+    }
+
+    /// `--dry-run` output: where the build would go, what goes in the bundle, and which steps run.
+    /// `binaries` is nil when podman was not found (or with `--placeholder-artifacts`).
+    private static func dryRunPlan(_ config: ComposeConfig, options: Options, binaries: (podman: String, gvproxy: String, vfkit: String)?) throws -> String {
+        let name = config.name ?? "Containerfy"
+        let output = try outputPath(for: config, options: options)
+        let appPath = output.hasSuffix(".app") ? output : output + ".app"
+        let binaryPaths = binaries.map { [$0.podman, $0.gvproxy, $0.vfkit, options.runtimeBinary ?? CommandLine.arguments[0]] } ?? []
+        let appBytes = BundleAssembler.estimatedAppBytes(config: config, binaries: binaryPaths)
+        let signs = options.notary != nil || options.signIdentity != nil
+
+        var lines = [
+            "Plan for \(name) v\(config.version ?? "1.0.0") (\(config.identifier ?? "unknown"))",
+            "  output:     \(appPath)",
+            "  binaries:   " + (binaries.map { ($0.podman as NSString).deletingLastPathComponent }
+                ?? (options.placeholderArtifacts ? "placeholders (the bundle will not run)" : "not found — pack would fail at step 2")),
+            "  size:       about \(appBytes / 1024 / 1024) MB" + (binaries == nil ? " without the podman binaries" : ""),
+            "  images:     pulled by podman when the app first starts",
+        ]
+        for spec in config.serviceSpecs {
+            lines.append("    \(spec.name): \(spec.image ?? "-")")
+        }
+        lines.append("  bundle:")
+        lines.append("    Contents/MacOS/Containerfy, podman, vfkit, gvproxy")
+        let resources = BundleAssembler.plannedResources(config: config, hasCACertificates: !options.caCertPaths.isEmpty)
+        lines.append("    Contents/Resources/" + resources.joined(separator: ", "))
+
+        var steps = ["parse", "locate binaries", "assemble"]
+        if let identity = options.signIdentity {
+            steps.append("sign (\(identity))")
+        } else if options.notary != nil {
+            steps.append("sign")
+        }
+        if options.notary != nil {
+            steps.append("notarize and staple .dmg")
+        } else if options.dmg {
+            steps.append(".dmg")
+        } else if let archive = options.archive {
+            steps.append(".\(archive.rawValue) archive")
+        }
+        if options.assess { steps.append("Gatekeeper assessment") }
+        if options.writeChecksum { steps.append("checksum") }
+        if options.writeBuildManifest { steps.append("build manifest") }
+        lines.append("  steps:      " + steps.joined(separator: ", "))
+        if !signs {
+            lines.append("  signing:    none (ad-hoc only)")
+        }
+        for warning in config.warnings {
+            lines.append("  warning:    \(warning)")
+        }
+        return lines.joined(separator: "\n")
+    }
+
+    static func configText(_ config: ComposeConfig) -> String {
+        func opt(_ value: Any?) -> String { value.map { "\($0)" } ?? "-" }
+
+        var lines = [
+            "compose:      \(opt(config.composePath))",
+            "name:         \(opt(config.name))",
+            "display_name: \(opt(config.displayName))",
+            "version:      \(opt(config.version))" + (config.buildNumber.map { " (build \($0))" } ?? ""),
+            "identifier:   \(opt(config.identifier))",
+            "icon:         \(opt(config.icon))",
+            "vm:           cpu \(opt(config.cpuMin))/\(opt(config.cpuRecommended)), memory \(opt(config.memoryMBMin))/\(opt(config.memoryMBRecommended)) MB, disk \(opt(config.diskMB)) MB",
+            "images:       \(config.images.joined(separator: ", "))",
+            "env_files:    \(config.envFiles.joined(separator: ", "))",
+        ]
+        if let feed = config.updateFeed {
+            lines.append("update:       \(feed.feedURL)")
+        }
+        if !config.volumeLimitsMB.isEmpty {
+            lines.append("volumes:      " + config.volumeLimitsMB.sorted { $0.key < $1.key }.map { "\($0.key) max \($0.value) MB" }.joined(separator: ", "))
+        }
+        if !config.volumeSeeds.isEmpty {
+            lines.append("seeds:        " + config.volumeSeeds.map { "\($0.volume) (\($0.source))" }.joined(separator: ", "))
+        }
+        for kind in [BundledFile.Kind.secret, .config] {
+            let files = config.bundledFiles.filter { $0.kind == kind }
+            if !files.isEmpty {
+                lines.append("\(kind.key):".padding(toLength: 14, withPad: " ", startingAt: 0) + files.map { "\($0.name) (\($0.source))" }.joined(separator: ", "))
+            }
+        }
+        for healthcheck in config.healthchecks {
+            let service = config.targetService(of: healthcheck) ?? "-"
+            switch healthcheck {
+            case .http(let url, let path):
+                lines.append("healthcheck:  \(url) (path \(path), service \(service))")
+            case .tcp(let port):
+                lines.append("healthcheck:  tcp 127.0.0.1:\(port) (service \(service))")
+            }
+        }
+        if !config.labels.isEmpty {
+            lines.append("labels:       " + config.labels.sorted { $0.key < $1.key }.map { "\($0.key)=\($0.value)" }.joined(separator: ", "))
+        }
+        if config.startupOrder.count > 1 {
+            lines.append("startup:      " + config.startupOrder.joined(separator: ", "))
+        }
+        lines.append("services:")
+        for spec in config.serviceSpecs {
+            lines.append("  \(spec.name): \(opt(spec.image))")
+            if let info = config.services.first(where: { $0.name == spec.name }) {
+                lines.append("    ports:    " + info.ports.map(\.notation).joined(separator: ", "))
+            }
+            if let platform = spec.platform { lines.append("    platform: \(platform)") }
+            if let containerName = spec.containerName { lines.append("    container_name: \(containerName)") }
+            if !spec.capAdd.isEmpty { lines.append("    cap_add:  \(spec.capAdd.joined(separator: ", "))") }
+            if !spec.capDrop.isEmpty { lines.append("    cap_drop: \(spec.capDrop.joined(separator: ", "))") }
+            if !spec.devices.isEmpty {
+                lines.append("    devices:  " + spec.devices.map { "\($0.hostPath):\($0.containerPath):\($0.permissions)" }.joined(separator: ", "))
+            }
+            if let swappiness = spec.memSwappiness { lines.append("    mem_swappiness: \(swappiness)") }
+            if let oomKillDisable = spec.oomKillDisable { lines.append("    oom_kill_disable: \(oomKillDisable)") }
+            if !spec.dependsOn.isEmpty { lines.append("    depends_on: \(spec.dependsOn.joined(separator: ", "))") }
+            if !spec.environment.isEmpty {
+                lines.append("    environment: " + spec.environment.map { $0.displayValue.map { value in "\($0.name)=\(value)" } ?? $0.name }.joined(separator: ", "))
+            }
+        }
+        for warning in config.warnings {
+            lines.append("warning: \(warning)")
+        }
+        return lines.joined(separator: "\n")
+    }
+
+    // MARK: - Output Helpers
+
+    /// Prints `Error: <message>` to stderr, and to `log` when there is a `--log-file`.
+    private static func printError(_ message: String, log: BuildLog? = nil) {
+        log?.write("Error: \(message)")
         let stderr = FileHandle.standardError
         stderr.write("Error: \(message)\n".data(using: .utf8)!)
     }
@@ -156,9 +1357,77 @@ public struct PackCommand {
         Requires podman installed (brew install podman).
 
         Flags:
-          --compose <path>           Path to docker-compose.yml (default: ./docker-compose.yml)
-          --output <path>            Output path for .app bundle (default: ./<name> from x-containerfy)
+          --compose <path>           Path to docker-compose.yml, or a directory to search (default: ./docker-compose.yml).
+                                     Repeat to merge override files over the first, in order
+                                     The first may be an https:// URL, if it references no local files
+          --allow-http               Accept an http:// --compose URL
+          --compose-format <fmt>     yaml or json (default: json for .json files, yaml otherwise)
+          --env-file-search-up <n>   Without a .env next to the compose file, use the nearest one
+                                     in up to n parent directories for ${VAR} interpolation
+          --allow-env <name>         Let ${name} read the shell environment (repeatable); other
+                                     variables come only from .env
+          --output <path>            Output path for .app bundle (default: ./<name> from x-containerfy).
+                                     May use {name}, {version} and {platform}, e.g. dist/{name}-{version}
+          --ca-cert <path>           PEM CA certificate to trust inside the VM (repeatable)
+          --identifier <bundle-id>   Override x-containerfy.identifier (e.g. for white-labeled builds)
           --signed <keychain-profile>  Sign .app, create .dmg, notarize, and staple.
+          --notarize-profile <profile>  Same as --signed
+          --dmg                      Also wrap the .app in a compressed .dmg with an Applications link
+                                     (always done with --signed)
+          --volume-name <name>       Volume name of the .dmg (default: x-containerfy display_name)
+          --tmpdir <dir>             Use <dir> for scratch files and .dmg staging instead of $TMPDIR
+          --archive <fmt>            Also package the .app as <name>.tar.gz or <name>.zip, keeping file
+                                     modes and symlinks (for moving unsigned or signed builds between machines)
+          --apple-id <id>            Notarize with an Apple ID instead of a keychain profile (like --signed);
+          --team-id <team>           needs all three of --apple-id, --team-id and --app-password
+          --app-password <password>
+          --sign <identity>          Sign and verify the .app with this Developer ID certificate (name or
+                                     SHA-1 hash), without a .dmg or notarization
+          --sign-identity <identity>  Certificate for --signed (skips the prompt); alone, same as --sign
+          --entitlements <path>      Sign with this entitlements plist instead of the generated one
+          --release-dmg              Sign, build .dmg, notarize, staple (required), and write a checksum.
+                                     Requires --sign-identity and --notarize-profile
+          --print-config             Print the resolved compose config and exit without building
+          --dry-run                  Print the plan (output path, bundle contents, size, steps) and exit
+                                     without assembling, signing or running any tools
+          --signing-check            Check the --sign identity, notary profile, codesign, notarytool and
+                                     stapler, print the results and exit without building
+          --quiet, -q                Print only errors and the path of the finished artifact
+          --log-file <path>          Also write every step, error and external command, with timestamps,
+                                     to <path> whatever the console level
+          --verbose, -v              Also print every external command and its output (to stderr)
+          --json                     Print progress and the result as newline-delimited JSON (errors stay on stderr).
+                                     With --print-config, print the config as JSON
+          --all <dir>                Pack every subdirectory of <dir> that has a compose file;
+                                     --output then names the directory the .app bundles go in
+          --keep-going               With --all, continue past failed apps
+          --emit-appcast <path>      Create or append a Sparkle appcast item for the signed .dmg
+          --confine-paths            Reject env_file/license paths that resolve outside the compose directory
+          --confine-root <dir>       Like --confine-paths, but confine to <dir>
+          --override-image <svc>=<image>  Replace a service's image in the bundled compose file (repeatable)
+          --profile <name>           Also pack services in this compose profile (repeatable)
+          --require-signed           Fail instead of producing an unsigned build (for release CI)
+          --placeholder-artifacts    Bundle stub podman/gvproxy/vfkit to test assembly, signing and
+                                     .dmg creation quickly; the result cannot run
+          --artifacts <dir>          Bundle the podman, gvproxy and vfkit in <dir> instead of the ones
+                                     next to containerfy
+          --runtime-binary <path>    Bundle this Mach-O executable as the app instead of the running containerfy
+          --require-binary           Fail if the app executable isn't found, instead of warning and
+                                     building an app that can't launch
+          --assess                   Run spctl on the finished .app and report Gatekeeper's verdict
+          --require-gatekeeper-pass  Like --assess, but fail if Gatekeeper would reject the app
+          --no-verify                Skip the self-test of the assembled bundle (Info.plist keys, binaries,
+                                     resources against manifest.json)
+          --max-bundle-mb <n>        Fail if the .app (or signed .dmg) is larger than n MB
+          --checksum                 Write <artifact>.sha256 next to the final .app or .dmg
+          --build-manifest           Write <name>.build-manifest.json (images, sizes, digests) next to it too
+          --strict                   Treat warnings (e.g. privileged host ports) as errors, and --lint findings too
+          --lint                     Run the best-practice rules of 'containerfy lint' and print the findings after
+                                     the build; with --strict, any warning fails before building
+          --require-pinned           Fail on images without a version tag or @sha256: digest (e.g. nginx, nginx:latest)
+          --allow-privileged         Accept privileged: true and cap_add: SYS_ADMIN (and similar) with a warning
+          --max-disk-mb <n>          Largest accepted x-containerfy.vm.disk_mb (default: 131072)
+          --max-env-file-kb <n>      Reject env_file references larger than n KB (default: 256)
           --help, -h                 Show this help message
         """)
     }
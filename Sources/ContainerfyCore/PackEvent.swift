@@ -0,0 +1,124 @@
+import Foundation
+
+/// Progress event emitted by `PackCommand` as it moves through the pack pipeline.
+/// Embedders pass an `onEvent` handler to follow progress without scraping stdout;
+/// the CLI uses `PackEvent.print` to produce its usual `[n] ...` output, or
+/// `PackEvent.printJSON` for `pack --json`.
+public struct PackEvent: Sendable, Encodable {
+
+    public enum Phase: String, Sendable, Encodable {
+        case parse
+        case locateBinaries = "locate-binaries"
+        case assemble
+        case sign
+        case dmg
+        case archive
+        case assess
+    }
+
+    public enum Status: String, Sendable, Encodable {
+        case started
+        case progress
+        case completed
+        case failed
+    }
+
+    public let phase: Phase
+    /// 1-based position of `phase` in this run.
+    public let step: Int
+    /// Number of phases in this run (3 unsigned, plus 1 each for signing, a standalone `--dmg`
+    /// or `--archive`, and `--assess`).
+    public let totalSteps: Int
+    public let status: Status
+    public let message: String
+
+    enum CodingKeys: String, CodingKey {
+        case type
+        case phase
+        case step
+        case totalSteps = "total_steps"
+        case status
+        case message
+    }
+
+    public init(phase: Phase, step: Int, totalSteps: Int, status: Status, message: String) {
+        self.phase = phase
+        self.step = step
+        self.totalSteps = totalSteps
+        self.status = status
+        self.message = message
+    }
+
+    /// Default CLI handler — prints phase starts as `[n] message` and progress indented.
+    /// Completion is implied by the next step; failures are reported separately on stderr.
+    public static func print(_ event: PackEvent) {
+        switch event.status {
+        case .started: Swift.print("[\(event.step)] \(event.message)")
+        case .progress: Swift.print("    \(event.message)")
+        case .completed, .failed: break
+        }
+    }
+
+    /// `pack --json` handler — one JSON object per line, every status included.
+    public static func printJSON(_ event: PackEvent) {
+        Swift.print(jsonLine(event))
+    }
+
+    public func encode(to encoder: Encoder) throws {
+        var container = encoder.container(keyedBy: CodingKeys.self)
+        try container.encode("event", forKey: .type)
+        try container.encode(phase, forKey: .phase)
+        try container.encode(step, forKey: .step)
+        try container.encode(totalSteps, forKey: .totalSteps)
+        try container.encode(status, forKey: .status)
+        try container.encode(message, forKey: .message)
+    }
+
+    /// Compact, key-sorted JSON without a trailing newline.
+    static func jsonLine<T: Encodable>(_ value: T) -> String {
+        let encoder = JSONEncoder()
+        encoder.outputFormatting = [.sortedKeys, .withoutEscapingSlashes]
+        guard let data = try? encoder.encode(value) else { return "{}" }
+        return String(decoding: data, as: UTF8.self)
+    }
+}
+
+/// Last line of `pack --json` output, written once the build succeeds, and the return value
+/// of `PackCommand.run(_:)`.
+public struct PackResult: Sendable, Encodable {
+    /// The distributable artifact: the .dmg when one was built, otherwise the .app.
+    public let path: String
+    public let name: String
+    public let version: String
+    public let identifier: String
+    public let images: [String]
+    public let signed: Bool
+    public let notarized: Bool
+    /// Path of the `.sha256` sidecar, with `--checksum`.
+    public let checksum: String?
+    /// Path of `<name>.build-manifest.json`, with `--build-manifest`.
+    public let buildManifest: String?
+
+    enum CodingKeys: String, CodingKey {
+        case type, path, name, version, identifier, images, signed, notarized, checksum
+        case buildManifest = "build_manifest"
+    }
+
+    public func encode(to encoder: Encoder) throws {
+        var container = encoder.container(keyedBy: CodingKeys.self)
+        try container.encode("result", forKey: .type)
+        try container.encode(path, forKey: .path)
+        try container.encode(name, forKey: .name)
+        try container.encode(version, forKey: .version)
+        try container.encode(identifier, forKey: .identifier)
+        try container.encode(images, forKey: .images)
+        try container.encode(signed, forKey: .signed)
+        try container.encode(notarized, forKey: .notarized)
+        try container.encodeIfPresent(checksum, forKey: .checksum)
+        try container.encodeIfPresent(buildManifest, forKey: .buildManifest)
+    }
+
+    func printJSON() {
+        print(PackEvent.jsonLine(self))
+    }
+}
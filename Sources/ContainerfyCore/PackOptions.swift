@@ -0,0 +1,115 @@
+import Foundation
+
+/// Typed options for `PackCommand.run(_:)`, the library form of `containerfy pack`. Each
+/// property matches the pack flag of the same name; see docs/cli-reference.md for details.
+///
+/// Only a subset of pack's flags is covered. The others, among them Apple ID notarization
+/// (`--apple-id`, `--team-id`, `--app-password`), `--release-dmg`, `--signed`, `--ca-cert`,
+/// `--override-image`, `--confine-paths`, `--max-disk-mb`, `--max-env-file-kb`,
+/// `--compose-format`, extra `--compose` files, `--entitlements`, `--no-verify` and
+/// `--emit-appcast`, are only available through `PackCommand.run(arguments:)`.
+public struct PackOptions: Sendable, Equatable {
+    public var composePath: String
+    /// `--output`: where the .app goes, with `{name}`, `{version}` and `{platform}` expanded;
+    /// nil uses `./<name>`.
+    public var outputPath: String?
+    /// `--sign`: Developer ID identity (name or SHA-1 hash) to sign the .app with.
+    public var signIdentity: String?
+    /// `--notarize-profile`: keychain profile for notarization; also builds a .dmg.
+    public var notarizeProfile: String?
+    /// `--dmg`: wrap the .app in a .dmg without notarizing.
+    public var dmg = false
+    /// `--archive`: `tar.gz` or `zip`.
+    public var archive: String?
+    public var checksum = false
+    public var buildManifest = false
+    /// `--profile`, once per compose profile to activate.
+    public var profiles: [String] = []
+    /// `--identifier`: replaces x-containerfy.identifier.
+    public var identifier: String?
+    /// `--env-file-search-up`: parent directories to search for a `.env` when none is next to the compose file.
+    public var envFileSearchUp = 0
+    /// `--allow-env`, once per shell variable `${VAR}` may read.
+    public var allowedEnvironment: [String] = []
+    public var strict = false
+    /// `--lint`: also run the best-practice rules; with `strict`, any warning fails the build.
+    public var lint = false
+    public var requirePinned = false
+    public var allowPrivileged = false
+    /// `--placeholder-artifacts`: bundle stub binaries; the result cannot run.
+    public var placeholderArtifacts = false
+    /// `--artifacts`: directory with prebuilt podman, gvproxy and vfkit to bundle.
+    public var artifactsDir: String?
+    /// `--runtime-binary`: the app executable to bundle instead of the running containerfy.
+    public var runtimeBinary: String?
+    /// `--require-binary`: fail instead of warning when the app executable isn't found.
+    public var requireBinary = false
+    /// `--tmpdir`: an existing directory for scratch files and .dmg staging, instead of the
+    /// system temporary directory.
+    public var tmpDir: String?
+    /// `--log-file`: also write a timestamped log of the build here.
+    public var logFile: String?
+
+    public init(composePath: String = "./docker-compose.yml") {
+        self.composePath = composePath
+    }
+
+    /// The equivalent `pack` command line.
+    var arguments: [String] {
+        var args = ["--compose", composePath]
+        if let outputPath { args += ["--output", outputPath] }
+        if let signIdentity { args += ["--sign-identity", signIdentity] }
+        if let notarizeProfile { args += ["--notarize-profile", notarizeProfile] }
+        if dmg { args.append("--dmg") }
+        if let archive { args += ["--archive", archive] }
+        if checksum { args.append("--checksum") }
+        if buildManifest { args.append("--build-manifest") }
+        for profile in profiles { args += ["--profile", profile] }
+        if let identifier { args += ["--identifier", identifier] }
+        if envFileSearchUp > 0 { args += ["--env-file-search-up", String(envFileSearchUp)] }
+        for name in allowedEnvironment { args += ["--allow-env", name] }
+        if strict { args.append("--strict") }
+        if lint { args.append("--lint") }
+        if requirePinned { args.append("--require-pinned") }
+        if allowPrivileged { args.append("--allow-privileged") }
+        if placeholderArtifacts { args.append("--placeholder-artifacts") }
+        if let artifactsDir { args += ["--artifacts", artifactsDir] }
+        if let runtimeBinary { args += ["--runtime-binary", runtimeBinary] }
+        if requireBinary { args.append("--require-binary") }
+        if let tmpDir { args += ["--tmpdir", tmpDir] }
+        if let logFile { args += ["--log-file", logFile] }
+        return args
+    }
+}
+
+/// Why `PackCommand.run(_:)`, `plan(_:)` or `resolvedConfig(_:json:)` failed. Each message
+/// is the one `containerfy pack` prints after `Error: `.
+public enum PackError: LocalizedError, Equatable {
+    /// The options can't be combined, or one of them is invalid.
+    case invalidOptions(String)
+    /// The compose file couldn't be downloaded, read or validated.
+    case invalidCompose(String)
+    /// `strict` with `lint`: the warnings that failed the build.
+    case lintFailed([String])
+    /// podman, gvproxy, vfkit or the app executable is missing or can't be bundled.
+    case missingBinaries(String)
+    /// The .app couldn't be written, or failed its size budget or self-test.
+    case assemblyFailed(String)
+    /// The signing identity couldn't be resolved, or codesign or notarization failed.
+    case signingFailed(String)
+    /// The .dmg, archive, checksum, build manifest or appcast couldn't be written.
+    case packagingFailed(String)
+    /// `--require-gatekeeper-pass`: Gatekeeper would block the app.
+    case gatekeeperRejected(String)
+
+    public var errorDescription: String? {
+        switch self {
+        case .lintFailed(let findings):
+            return "--strict: \(findings.count) lint warning(s)"
+        case .invalidOptions(let message), .invalidCompose(let message), .missingBinaries(let message),
+             .assemblyFailed(let message), .signingFailed(let message), .packagingFailed(let message),
+             .gatekeeperRejected(let message):
+            return message
+        }
+    }
+}
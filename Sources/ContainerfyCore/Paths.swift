@@ -1,21 +1,66 @@
 import Foundation
 
 enum Paths {
+    /// This app's own support directory, named after its bundle identifier so packed apps don't
+    /// share state and `containerfy uninstall` can remove one app's files (see InstalledPaths).
+    /// Unpacked development builds have no identifier and use `Containerfy`.
     static var applicationSupport: URL {
+        let base = FileManager.default.urls(for: .applicationSupportDirectory, in: .userDomainMask).first!
+        return base.appendingPathComponent(Bundle.main.bundleIdentifier ?? "Containerfy")
+    }
+
+    /// `~/Library/Application Support/Containerfy`, which every app shared before support
+    /// directories were named after the bundle identifier.
+    static var legacyApplicationSupport: URL {
         let base = FileManager.default.urls(for: .applicationSupportDirectory, in: .userDomainMask).first!
         return base.appendingPathComponent("Containerfy")
     }
 
     static var stateFileURL: URL {
-        applicationSupport.appendingPathComponent("state.json")
+        applicationSupport.appendingPathComponent(InstalledPaths.stateFileName)
+    }
+
+    /// Resource layout of the app bundle (Resources/layout.json), or the legacy layout
+    /// for bundles packed before the manifest existed.
+    static var bundleLayout: BundleLayout {
+        guard let resources = Bundle.main.resourceURL else { return .legacy }
+        do {
+            return try BundleLayout.load(resourcesPath: resources.path)
+        } catch {
+            print("[Paths] \(error.localizedDescription) — using the default layout")
+            return .legacy
+        }
     }
 
     /// Compose file from the app bundle (placed there by `containerfy pack`)
     static var composeFileURL: URL? {
-        Bundle.main.url(forResource: "docker-compose", withExtension: "yml")
+        guard let url = Bundle.main.resourceURL?.appendingPathComponent(bundleLayout.compose),
+              FileManager.default.fileExists(atPath: url.path) else { return nil }
+        return url
+    }
+
+    /// Resolved runtime config written by `containerfy pack` (nil for older bundles)
+    static var runtimeConfigURL: URL? {
+        guard let file = bundleLayout.runtime,
+              let url = Bundle.main.resourceURL?.appendingPathComponent(file),
+              FileManager.default.fileExists(atPath: url.path) else { return nil }
+        return url
     }
 
-    /// Fallback compose file in Application Support (for development/testing)
+    /// Private CA certificates bundled by `containerfy pack --ca-cert`
+    static var caCertificatesURL: URL? {
+        guard let dir = bundleLayout.caCertificates else { return nil }
+        return Bundle.main.resourceURL?.appendingPathComponent(dir)
+    }
+
+    /// Named-volume seeds bundled from x-containerfy.volumes (nil when there are none)
+    static var volumeSeedsURL: URL? {
+        guard let dir = bundleLayout.volumeSeeds else { return nil }
+        return Bundle.main.resourceURL?.appendingPathComponent(dir)
+    }
+
+    /// Fallback compose file in Application Support (for development/testing). Put there by
+    /// hand, so `containerfy uninstall` leaves it alone (see InstalledPaths.files).
     static var composeFileFallbackURL: URL {
         applicationSupport.appendingPathComponent("docker-compose.yml")
     }
@@ -39,10 +84,36 @@ enum Paths {
         return URL(fileURLWithPath: "/opt/homebrew/bin/podman")
     }
 
+    /// Creates the support directory. The first time a packed app creates it, the state file
+    /// from the shared legacy directory is moved in, so a crash in the last run is still detected.
     static func ensureDirectoryExists() throws {
+        let isNew = !FileManager.default.fileExists(atPath: applicationSupport.path)
         try FileManager.default.createDirectory(
             at: applicationSupport,
             withIntermediateDirectories: true
         )
+        if isNew, applicationSupport.standardizedFileURL != legacyApplicationSupport.standardizedFileURL {
+            migrateLegacyState(from: legacyApplicationSupport, to: applicationSupport)
+        }
+    }
+
+    /// Moves `state.json` from `legacy` into `directory`, then removes `legacy` if nothing else
+    /// is left in it. Seed archives are only kept while a volume is imported, and the fallback
+    /// compose file belongs to unpacked builds, which still use `legacy`, so neither is moved.
+    static func migrateLegacyState(from legacy: URL, to directory: URL) {
+        let fm = FileManager.default
+        let legacyState = legacy.appendingPathComponent(InstalledPaths.stateFileName)
+        let state = directory.appendingPathComponent(InstalledPaths.stateFileName)
+        guard fm.fileExists(atPath: legacyState.path), !fm.fileExists(atPath: state.path) else { return }
+        do {
+            try fm.moveItem(at: legacyState, to: state)
+            print("[Paths] Moved \(legacyState.path) to \(state.path)")
+        } catch {
+            print("[Paths] Could not move \(legacyState.path): \(error.localizedDescription)")
+            return
+        }
+        if (try? fm.contentsOfDirectory(atPath: legacy.path))?.isEmpty == true {
+            try? fm.removeItem(at: legacy)
+        }
     }
 }
@@ -9,6 +9,7 @@ final class PodmanMachine: @unchecked Sendable {
     private let cpus: Int
     private let memoryMB: Int
     private let diskGB: Int
+    private let volumeSeeds: [VolumeSeed]
     private let shell: ShellExecutor
 
     private let logLock = NSLock()
@@ -22,9 +23,8 @@ final class PodmanMachine: @unchecked Sendable {
         self.stateController = stateController
         self.shell = shell
 
-        // Derive machine name from app identifier (e.g. "com.containerfy.test-app" → "containerfy-test-app")
-        let name = composeConfig.name ?? "app"
-        self.machineName = "containerfy-\(name)"
+        // Derive machine name from the app name (e.g. "test-app" → "containerfy-test-app")
+        self.machineName = InstalledPaths.machineName(appName: composeConfig.name)
 
         // Compose file from bundle
         self.composeFileURL = Paths.composeFileURL ?? {
@@ -37,6 +37,7 @@ final class PodmanMachine: @unchecked Sendable {
         self.memoryMB = composeConfig.memoryMBRecommended ?? composeConfig.memoryMBMin ?? 2048
         // Fedora CoreOS needs ~5GB for itself; enforce minimum 10GB
         self.diskGB = max(10, (composeConfig.diskMB ?? 10240) / 1024)
+        self.volumeSeeds = composeConfig.volumeSeeds
     }
 
     // MARK: - Lifecycle
@@ -84,6 +85,20 @@ final class PodmanMachine: @unchecked Sendable {
                 appendLog("Machine started")
             }
 
+            // Trust bundled private CAs before compose pulls images
+            if let msg = try installCACertificates() {
+                appendLog(msg)
+                await MainActor.run { _ = stateController.transition(to: .error, reason: msg) }
+                return
+            }
+
+            // Fill seeded volumes before compose creates them empty
+            if let msg = try seedVolumes() {
+                appendLog(msg)
+                await MainActor.run { _ = stateController.transition(to: .error, reason: msg) }
+                return
+            }
+
             // Run compose up
             if let composeURL = composeFileURL {
                 appendLog("Running compose up...")
@@ -157,6 +172,72 @@ final class PodmanMachine: @unchecked Sendable {
 
     // MARK: - Private
 
+    /// Installs bundled CA certificates into the VM trust store. The machine may have been
+    /// recreated since the last run, so this runs on every start. Returns an error message on failure.
+    private func installCACertificates() throws -> String? {
+        guard let dir = Paths.caCertificatesURL,
+              let files = try? FileManager.default.contentsOfDirectory(atPath: dir.path) else { return nil }
+
+        for file in files.sorted() where file.hasSuffix(".pem") {
+            let pem = try String(contentsOf: dir.appendingPathComponent(file), encoding: .utf8)
+            appendLog("Installing CA certificate \(file)...")
+            let result = try runPodman([
+                "machine", "ssh", machineName,
+                CACertificates.installCommand(pem: pem, fileName: file),
+            ])
+            if result.exitCode != 0 {
+                return "installing CA certificate \(file) failed: \(result.stderr)"
+            }
+        }
+        return nil
+    }
+
+    /// Creates each seeded named volume and fills it from its bundled seed. A volume that already
+    /// exists holds the user's data, so it's left alone. Returns an error message on failure.
+    private func seedVolumes() throws -> String? {
+        guard !volumeSeeds.isEmpty, let dir = Paths.volumeSeedsURL else { return nil }
+
+        for seed in volumeSeeds {
+            if try runPodman(["volume", "exists", seed.podmanName]).exitCode == 0 { continue }
+
+            // `podman volume import` doesn't run over the remote connection, so it runs in the VM,
+            // reading an archive from Application Support — the machine mounts the home directory
+            appendLog("Seeding volume \(seed.podmanName)...")
+            try Paths.ensureDirectoryExists()
+            let archive = Paths.applicationSupport.appendingPathComponent(InstalledPaths.seedArchiveName(volume: seed.volume))
+            defer { try? FileManager.default.removeItem(at: archive) }
+            var environment = ProcessInfo.processInfo.environment
+            environment["COPYFILE_DISABLE"] = "1"  // no ._ AppleDouble entries in the archive
+            let tar = try shell.run(
+                executable: "/usr/bin/tar",
+                arguments: ["-c", "-f", archive.path, "-C", dir.appendingPathComponent(seed.volume).path, "."],
+                environment: environment
+            )
+            if tar.exitCode != 0 {
+                return "archiving the seed for volume \(seed.podmanName) failed: \(tar.stderr)"
+            }
+
+            let create = try runPodman(["volume", "create", seed.podmanName])
+            if create.exitCode != 0 {
+                return "creating volume \(seed.podmanName) failed: \(create.stderr)"
+            }
+            let imported = try runPodman([
+                "machine", "ssh", machineName,
+                "podman volume import \(shellQuoted(seed.podmanName)) \(shellQuoted(archive.path))",
+            ])
+            if imported.exitCode != 0 {
+                // An empty volume would never be seeded, so remove it and try again next start
+                _ = try? runPodman(["volume", "rm", seed.podmanName])
+                return "seeding volume \(seed.podmanName) failed: \(imported.stderr)"
+            }
+        }
+        return nil
+    }
+
+    private func shellQuoted(_ value: String) -> String {
+        "'" + value.replacingOccurrences(of: "'", with: "'\\''") + "'"
+    }
+
     /// Path to the podman binary. Checks app bundle (MacOS/) first, then system.
     private var podmanPath: String {
         if let bundled = Bundle.main.executableURL?.deletingLastPathComponent().appendingPathComponent("podman"),
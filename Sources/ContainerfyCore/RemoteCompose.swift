@@ -0,0 +1,149 @@
+import Foundation
+
+/// `pack --compose <url>`: fetches a compose file served over HTTPS so it can be packed without
+/// cloning the repository it lives in. Only the compose file itself is fetched, so
+/// `parseBuild` rejects references to files next to it (see `BuildOptions.remoteSource`).
+enum RemoteCompose {
+
+    enum FetchError: LocalizedError {
+        case insecure(String)
+        case badStatus(url: String, status: Int)
+        case tooLarge(url: String, maxBytes: Int)
+        case failed(url: String, reason: String)
+
+        var errorDescription: String? {
+            switch self {
+            case .insecure(let url):
+                return "\(url) is not HTTPS — pass --allow-http to fetch a compose file over plain HTTP"
+            case .badStatus(let url, let status):
+                return "could not fetch \(url): HTTP \(status)"
+            case .tooLarge(let url, let maxBytes):
+                return "\(url) is larger than \(maxBytes / 1024) KB — that is not a compose file"
+            case .failed(let url, let reason):
+                return "could not fetch \(url): \(reason)"
+            }
+        }
+    }
+
+    /// Compose files are a few KB; anything this large is the wrong URL.
+    static let maxBytes = 1024 * 1024
+    static let timeout: TimeInterval = 30
+
+    /// Performs the request, reading at most `maxBytes + 1` bytes of the body. Returns the status
+    /// and the URL of the final response, after redirects.
+    typealias Transport = (_ request: URLRequest, _ maxBytes: Int) throws -> (status: Int, data: Data, finalURL: URL?)
+
+    /// True for `http://` and `https://` `--compose` arguments.
+    static func isURL(_ path: String) -> Bool {
+        let lowered = path.lowercased()
+        return lowered.hasPrefix("https://") || lowered.hasPrefix("http://")
+    }
+
+    /// Downloads `urlString` into `directory`, keeping its file name (so the JSON/YAML choice and
+    /// `compose.yaml`-style names still apply), and returns the file's path.
+    static func download(
+        _ urlString: String,
+        into directory: String,
+        allowHTTP: Bool = false,
+        maxBytes: Int = RemoteCompose.maxBytes,
+        timeout: TimeInterval = RemoteCompose.timeout,
+        transport: Transport = RemoteCompose.urlSessionTransport
+    ) throws -> String {
+        guard let url = URL(string: urlString), let scheme = url.scheme?.lowercased(), url.host != nil else {
+            throw FetchError.failed(url: urlString, reason: "not a valid URL")
+        }
+        guard scheme == "https" || (scheme == "http" && allowHTTP) else {
+            throw FetchError.insecure(urlString)
+        }
+
+        var request = URLRequest(url: url, cachePolicy: .reloadIgnoringLocalCacheData, timeoutInterval: timeout)
+        request.setValue("containerfy/\(ContainerfyVersion.current)", forHTTPHeaderField: "User-Agent")
+        let response: (status: Int, data: Data, finalURL: URL?)
+        do {
+            response = try transport(request, maxBytes)
+        } catch let error as FetchError {
+            throw error
+        } catch {
+            throw FetchError.failed(url: urlString, reason: error.localizedDescription)
+        }
+        // A redirect must not quietly downgrade the connection
+        if let final = response.finalURL, final.scheme?.lowercased() != "https", !allowHTTP {
+            throw FetchError.insecure(final.absoluteString)
+        }
+        guard (200..<300).contains(response.status) else {
+            throw FetchError.badStatus(url: urlString, status: response.status)
+        }
+        guard response.data.count <= maxBytes else {
+            throw FetchError.tooLarge(url: urlString, maxBytes: maxBytes)
+        }
+
+        let fileName = url.lastPathComponent.isEmpty || url.lastPathComponent == "/"
+            ? "docker-compose.yml"
+            : url.lastPathComponent
+        let path = (directory as NSString).appendingPathComponent(fileName)
+        do {
+            try response.data.write(to: URL(fileURLWithPath: path))
+        } catch {
+            throw FetchError.failed(url: urlString, reason: "could not save it: \(error.localizedDescription)")
+        }
+        return path
+    }
+
+    // MARK: - URLSession Transport
+
+    static func urlSessionTransport(_ request: URLRequest, maxBytes: Int) throws -> (status: Int, data: Data, finalURL: URL?) {
+        let download = CappedDownload(limit: maxBytes)
+        let session = URLSession(configuration: .ephemeral, delegate: download, delegateQueue: nil)
+        defer { session.invalidateAndCancel() }
+        session.dataTask(with: request).resume()
+        download.done.wait()
+        if let error = download.error, !download.exceeded {
+            throw error
+        }
+        return (download.status, download.data, download.finalURL)
+    }
+
+    /// Collects the body, cancelling as soon as it grows past `limit` so an oversized response
+    /// is never read in full.
+    private final class CappedDownload: NSObject, URLSessionDataDelegate {
+        let limit: Int
+        let done = DispatchSemaphore(value: 0)
+        var data = Data()
+        var status = 0
+        var finalURL: URL?
+        var error: Error?
+        var exceeded = false
+
+        init(limit: Int) {
+            self.limit = limit
+        }
+
+        func urlSession(
+            _ session: URLSession, dataTask: URLSessionDataTask, didReceive response: URLResponse,
+            completionHandler: @escaping (URLSession.ResponseDisposition) -> Void
+        ) {
+            status = (response as? HTTPURLResponse)?.statusCode ?? 0
+            finalURL = response.url
+            if response.expectedContentLength > Int64(limit) {
+                exceeded = true
+                data = Data(count: limit + 1)
+                completionHandler(.cancel)
+                return
+            }
+            completionHandler(.allow)
+        }
+
+        func urlSession(_ session: URLSession, dataTask: URLSessionDataTask, didReceive chunk: Data) {
+            data.append(chunk)
+            if data.count > limit {
+                exceeded = true
+                dataTask.cancel()
+            }
+        }
+
+        func urlSession(_ session: URLSession, task: URLSessionTask, didCompleteWithError error: Error?) {
+            self.error = error
+            done.signal()
+        }
+    }
+}
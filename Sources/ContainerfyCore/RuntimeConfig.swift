@@ -0,0 +1,185 @@
+import Foundation
+
+/// `Resources/runtime.json`, written by `pack` from the fully validated build-time config.
+/// The app reads its name, VM sizing and menu items from here instead of re-parsing the
+/// compose file, so pack is the only place compose parsing decisions are made. The compose
+/// file is still bundled because `podman compose up` runs it inside the VM.
+struct RuntimeConfig: Codable, Equatable, Sendable {
+
+    enum RuntimeConfigError: LocalizedError {
+        case unreadable(String)
+        case unsupportedSchema(Int)
+
+        var errorDescription: String? {
+            switch self {
+            case .unreadable(let path):
+                return "\(path) is not a valid runtime config"
+            case .unsupportedSchema(let version):
+                return "runtime config schema \(version) is newer than this containerfy supports (\(RuntimeConfig.currentSchemaVersion))"
+            }
+        }
+    }
+
+    /// Bump when a field is renamed or its meaning changes. Adding an optional field doesn't need a bump.
+    static let currentSchemaVersion = 1
+    static let fileName = "runtime.json"
+
+    struct VM: Codable, Equatable, Sendable {
+        var cpuMin: Int
+        var cpuRecommended: Int
+        var memoryMBMin: Int
+        var memoryMBRecommended: Int
+        var diskMB: Int
+        /// Size limit per named volume, for quota enforcement. nil when none are declared.
+        var volumeLimitsMB: [String: Int]?
+        /// Seeded named volumes: compose volume key to podman volume name. The seed itself is
+        /// bundled under the layout's `volume_seeds` directory. nil when none are declared.
+        var volumeSeeds: [String: String]?
+
+        enum CodingKeys: String, CodingKey {
+            case cpuMin = "cpu_min"
+            case cpuRecommended = "cpu_recommended"
+            case memoryMBMin = "memory_mb_min"
+            case memoryMBRecommended = "memory_mb_recommended"
+            case diskMB = "disk_mb"
+            case volumeLimitsMB = "volume_limits_mb"
+            case volumeSeeds = "volume_seeds"
+        }
+    }
+
+    struct Port: Codable, Equatable, Sendable {
+        var host: UInt16
+        var container: UInt16
+        /// nil in runtime configs written before UDP support; treated as tcp.
+        var `protocol`: String?
+    }
+
+    struct Service: Codable, Equatable, Sendable {
+        var name: String
+        var displayLabel: String
+        var image: String?
+        var ports: [Port]
+        var restart: String?
+
+        enum CodingKeys: String, CodingKey {
+            case name
+            case displayLabel = "display_label"
+            case image
+            case ports
+            case restart
+        }
+    }
+
+    var schemaVersion: Int
+    var name: String
+    var version: String
+    var identifier: String
+    var displayName: String
+    var vm: VM
+    /// Every service, sorted by name; services without ports get no menu item.
+    var services: [Service]
+    /// Service names in dependency order. nil in older runtime configs.
+    var startupOrder: [String]?
+    /// The first HTTP healthcheck's URL, kept for apps that predate `healthchecks`.
+    var healthcheckURL: String?
+    /// Every healthcheck; all must pass before the app is ready. nil in older runtime configs.
+    var healthchecks: [Healthcheck]?
+
+    enum CodingKeys: String, CodingKey {
+        case schemaVersion = "schema_version"
+        case name
+        case version
+        case identifier
+        case displayName = "display_name"
+        case vm
+        case services
+        case startupOrder = "startup_order"
+        case healthcheckURL = "healthcheck_url"
+        case healthchecks
+    }
+
+    /// Builds the runtime contract from a parseBuild result.
+    init(config: ComposeConfig) {
+        let name = config.name ?? "app"
+        self.schemaVersion = Self.currentSchemaVersion
+        self.name = name
+        self.version = config.version ?? "1.0.0"
+        self.identifier = config.identifier ?? "unknown"
+        self.displayName = config.displayName ?? name
+        let cpuMin = config.cpuMin ?? 2
+        let memoryMBMin = config.memoryMBMin ?? 2048
+        self.vm = VM(
+            cpuMin: cpuMin,
+            cpuRecommended: config.cpuRecommended ?? cpuMin,
+            memoryMBMin: memoryMBMin,
+            memoryMBRecommended: config.memoryMBRecommended ?? memoryMBMin,
+            diskMB: config.diskMB ?? 10240,
+            volumeLimitsMB: config.volumeLimitsMB.isEmpty ? nil : config.volumeLimitsMB,
+            volumeSeeds: config.volumeSeeds.isEmpty
+                ? nil : Dictionary(uniqueKeysWithValues: config.volumeSeeds.map { ($0.volume, $0.podmanName) })
+        )
+        self.services = config.serviceSpecs.map { spec in
+            let info = config.services.first { $0.name == spec.name }
+            return Service(
+                name: spec.name,
+                displayLabel: info?.displayLabel ?? spec.name,
+                image: spec.image,
+                ports: (info?.ports ?? []).map { Port(host: $0.hostPort, container: $0.containerPort, protocol: $0.protocol) },
+                restart: spec.restart
+            )
+        }
+        self.startupOrder = config.startupOrder.isEmpty ? nil : config.startupOrder
+        self.healthcheckURL = config.healthcheckURL
+        self.healthchecks = config.healthchecks.isEmpty ? nil : config.healthchecks
+    }
+
+    /// The runtime view of this config, in the shape the app already consumes.
+    var composeConfig: ComposeConfig {
+        let serviceInfos = services.filter { !$0.ports.isEmpty }.map { svc in
+            ServiceInfo(
+                name: svc.name,
+                displayLabel: svc.displayLabel,
+                ports: svc.ports.map { PortMapping(hostPort: $0.host, containerPort: $0.container, protocol: $0.protocol ?? "tcp") }
+            )
+        }
+        return ComposeConfig(
+            portMappings: serviceInfos.flatMap(\.ports),
+            displayName: displayName,
+            services: serviceInfos,
+            name: name, version: version, buildNumber: nil, identifier: identifier, icon: nil, license: nil, runsInBackground: true, minimumMacOS: nil, category: nil, infoPlistExtras: [:], updateFeed: nil,
+            cpuMin: vm.cpuMin, cpuRecommended: vm.cpuRecommended,
+            memoryMBMin: vm.memoryMBMin, memoryMBRecommended: vm.memoryMBRecommended, diskMB: vm.diskMB,
+            volumeLimitsMB: vm.volumeLimitsMB ?? [:], volumeSeeds: runtimeVolumeSeeds, images: [], envFiles: [], bundledFiles: [], composePath: nil, composeDir: nil, labels: [:], serviceSpecs: [],
+            startupOrder: startupOrder ?? [], healthchecks: runtimeHealthchecks, renderedCompose: nil, warnings: []
+        )
+    }
+
+    private var runtimeVolumeSeeds: [VolumeSeed] {
+        (vm.volumeSeeds ?? [:]).sorted { $0.key < $1.key }.map { VolumeSeed(volume: $0.key, podmanName: $0.value, source: "") }
+    }
+
+    private var runtimeHealthchecks: [Healthcheck] {
+        if let healthchecks { return healthchecks }
+        guard let url = healthcheckURL else { return [] }
+        let path = URLComponents(string: url)?.path ?? ""
+        return [.http(url: url, path: path.isEmpty ? "/" : path)]
+    }
+
+    static func load(path: String) throws -> RuntimeConfig {
+        guard let data = FileManager.default.contents(atPath: path),
+              let config = try? JSONDecoder().decode(RuntimeConfig.self, from: data) else {
+            throw RuntimeConfigError.unreadable(path)
+        }
+        guard config.schemaVersion <= currentSchemaVersion else {
+            throw RuntimeConfigError.unsupportedSchema(config.schemaVersion)
+        }
+        return config
+    }
+
+    func write(toResourcesPath resourcesPath: String) throws {
+        let encoder = JSONEncoder()
+        encoder.outputFormatting = [.prettyPrinted, .sortedKeys]
+        let path = (resourcesPath as NSString).appendingPathComponent(Self.fileName)
+        try encoder.encode(self).write(to: URL(fileURLWithPath: path))
+    }
+}
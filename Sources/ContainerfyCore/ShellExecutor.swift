@@ -19,6 +19,44 @@ struct ProcessResult {
     let stderr: String
 }
 
+/// Decorator for `pack --verbose` and `--log-file`: echoes each command and its output to
+/// stderr, the build log, or both. Values of credential flags are redacted.
+struct EchoingShellExecutor: ShellExecutor {
+    let base: ShellExecutor
+    /// Echo to stderr (`--verbose`).
+    var console = true
+    var log: BuildLog?
+
+    static let secretFlags: Set<String> = ["--password", "--app-password"]
+
+    func run(executable: String, arguments: [String], environment: [String: String]?) throws -> ProcessResult {
+        write("    $ \(Self.commandLine(executable: executable, arguments: arguments))")
+        let result = try base.run(executable: executable, arguments: arguments, environment: environment)
+        for line in [result.stdout, result.stderr].filter({ !$0.isEmpty }).flatMap({ $0.split(separator: "\n") }) {
+            write("      \(line)")
+        }
+        if result.exitCode != 0 {
+            write("      (exit \(result.exitCode))")
+        }
+        return result
+    }
+
+    static func commandLine(executable: String, arguments: [String]) -> String {
+        var shown = [executable]
+        for (index, argument) in arguments.enumerated() {
+            shown.append(index > 0 && secretFlags.contains(arguments[index - 1]) ? "<redacted>" : argument)
+        }
+        return shown.joined(separator: " ")
+    }
+
+    private func write(_ line: String) {
+        if console {
+            FileHandle.standardError.write((line + "\n").data(using: .utf8)!)
+        }
+        log?.write(line)
+    }
+}
+
 /// Default implementation that runs real processes via Foundation.Process.
 struct SystemShellExecutor: ShellExecutor {
     func run(executable: String, arguments: [String], environment: [String: String]? = nil) throws -> ProcessResult {
@@ -38,7 +76,10 @@ struct SystemShellExecutor: ShellExecutor {
         process.standardOutput = stdoutPipe
         process.standardError = stderrPipe
         try process.run()
+        // Let an interrupted pack terminate the command instead of orphaning it
+        InterruptCleanup.shared.track(process)
         process.waitUntilExit()
+        InterruptCleanup.shared.untrack(process)
         let stdout = String(data: stdoutPipe.fileHandleForReading.readDataToEndOfFile(), encoding: .utf8)?
             .trimmingCharacters(in: .whitespacesAndNewlines) ?? ""
         let stderr = String(data: stderrPipe.fileHandleForReading.readDataToEndOfFile(), encoding: .utf8)?
@@ -0,0 +1,165 @@
+import Foundation
+
+/// CLI `uninstall` command — removes what a packed app created outside its bundle, as listed in
+/// its `installed-paths.json`: the podman machine (VM disk included), then the listed files in
+/// the app's Application Support directory, then that directory if nothing else is left in it.
+/// Nothing outside that directory is deleted, and the .app itself is left for the user to trash.
+///
+/// Usage: containerfy uninstall <path-to-app> [--dry-run]
+public struct UninstallCommand {
+
+    enum UninstallError: LocalizedError {
+        case notABundle(String)
+        case noInstalledPaths(String)
+
+        var errorDescription: String? {
+            switch self {
+            case .notABundle(let path):
+                return "\(path) is not a .app bundle (no Contents/Resources)"
+            case .noInstalledPaths(let path):
+                return "\(path) has no \(InstalledPaths.fileName) — it was packed by an older containerfy"
+            }
+        }
+    }
+
+    let shell: ShellExecutor
+    /// The user's home directory, which `~` in the manifest stands for.
+    let home: String
+
+    public init() {
+        self.init(shell: SystemShellExecutor(), home: NSHomeDirectory())
+    }
+
+    init(shell: ShellExecutor, home: String) {
+        self.shell = shell
+        self.home = home
+    }
+
+    /// Runs the uninstall command. Returns an exit code (0 = everything listed is gone).
+    public func run(arguments: [String]) -> Int32 {
+        var appPath: String?
+        var dryRun = false
+        for argument in arguments {
+            switch argument {
+            case "--dry-run":
+                dryRun = true
+            case "--help", "-h":
+                Self.printUsage()
+                return 0
+            default:
+                guard appPath == nil, !argument.hasPrefix("-") else {
+                    Self.printError("unexpected argument: \(argument)")
+                    Self.printUsage()
+                    return 1
+                }
+                appPath = argument
+            }
+        }
+        guard let appPath else {
+            Self.printError("uninstall takes a .app path")
+            Self.printUsage()
+            return 1
+        }
+
+        do {
+            let installed = try Self.load(appPath: appPath)
+            let paths = try installed.removablePaths(home: home)
+            if dryRun {
+                print("Would remove podman machine \(installed.podmanMachine)")
+                for path in paths where Self.exists(path) { print("Would remove \(path)") }
+                return 0
+            }
+            var ok = removeMachine(installed.podmanMachine, appPath: appPath)
+            ok = removeFiles(paths) && ok
+            return ok ? 0 : 1
+        } catch {
+            Self.printError(error.localizedDescription)
+            return 1
+        }
+    }
+
+    /// Reads `installed-paths.json` from the bundle, located via layout.json.
+    static func load(appPath: String) throws -> InstalledPaths {
+        let resourcesDir = (appPath as NSString).appendingPathComponent("Contents/Resources")
+        var isDirectory: ObjCBool = false
+        guard FileManager.default.fileExists(atPath: resourcesDir, isDirectory: &isDirectory), isDirectory.boolValue else {
+            throw UninstallError.notABundle(appPath)
+        }
+        guard let name = try BundleLayout.load(resourcesPath: resourcesDir).installedPaths else {
+            throw UninstallError.noInstalledPaths(appPath)
+        }
+        return try InstalledPaths.load(path: (resourcesDir as NSString).appendingPathComponent(name))
+    }
+
+    /// `podman machine rm -f` with the bundle's own podman, which stops the VM first if it is running.
+    private func removeMachine(_ machine: String, appPath: String) -> Bool {
+        let macosDir = (appPath as NSString).appendingPathComponent("Contents/MacOS")
+        let podman = (macosDir as NSString).appendingPathComponent("podman")
+        guard FileManager.default.fileExists(atPath: podman) else {
+            Self.printError("\(podman) not found — remove the VM with: podman machine rm -f \(machine)")
+            return false
+        }
+        var env = ProcessInfo.processInfo.environment
+        env["CONTAINERS_HELPER_BINARY_DIR"] = macosDir
+        do {
+            let result = try shell.run(executable: podman, arguments: ["machine", "rm", "-f", machine], environment: env)
+            if result.exitCode == 0 {
+                print("Removed podman machine \(machine)")
+            } else if result.stderr.contains("does not exist") {
+                print("No podman machine \(machine)")
+            } else {
+                Self.printError("podman machine rm \(machine) failed: \(result.stderr.trimmingCharacters(in: .whitespacesAndNewlines))")
+                return false
+            }
+            return true
+        } catch {
+            Self.printError("podman machine rm \(machine) failed: \(error.localizedDescription)")
+            return false
+        }
+    }
+
+    /// Removes the listed files, then the support directory (always last) if it is now empty.
+    private func removeFiles(_ paths: [String]) -> Bool {
+        let fm = FileManager.default
+        var ok = true
+        for (index, path) in paths.enumerated() where Self.exists(path) {
+            if index == paths.count - 1, let left = try? fm.contentsOfDirectory(atPath: path), !left.isEmpty {
+                print("Kept \(path): it holds files the app didn't create (\(left.sorted().joined(separator: ", ")))")
+                continue
+            }
+            do {
+                try fm.removeItem(atPath: path)
+                print("Removed \(path)")
+            } catch {
+                Self.printError("could not remove \(path): \(error.localizedDescription)")
+                ok = false
+            }
+        }
+        return ok
+    }
+
+    /// Whether anything is at `path`, a dangling symlink included.
+    private static func exists(_ path: String) -> Bool {
+        (try? FileManager.default.attributesOfItem(atPath: path)) != nil
+    }
+
+    // MARK: - Output Helpers
+
+    private static func printError(_ message: String) {
+        let stderr = FileHandle.standardError
+        stderr.write("Error: \(message)\n".data(using: .utf8)!)
+    }
+
+    private static func printUsage() {
+        print("""
+        Usage: containerfy uninstall <path-to-app> [--dry-run]
+
+        Remove what a packed .app created outside its bundle: its podman
+        machine and VM disk, and its files in ~/Library/Application Support,
+        as listed in Resources/installed-paths.json. Quit the app first.
+        The .app itself is left in place.
+
+          --dry-run    List what would be removed without removing it
+        """)
+    }
+}
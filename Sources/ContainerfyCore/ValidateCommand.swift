@@ -0,0 +1,206 @@
+import Foundation
+
+/// CLI `validate` command — runs pack's compose validation and prints the resolved config,
+/// without locating binaries or building anything. Suitable as a pre-commit hook.
+///
+/// Usage: containerfy validate [--compose <path>] [--json] [--strict] [--require-pinned] [--allow-privileged] [--check-env] [--lint]
+public struct ValidateCommand {
+
+    public init() {}
+
+    /// Runs the validate command. Returns an exit code (0 = compose file is valid).
+    public func run(arguments: [String]) -> Int32 {
+        var composePath = "./docker-compose.yml"
+        var buildOptions = ComposeConfigParser.BuildOptions()
+        var json = false
+        var checkEnv = false
+        var lint = false
+        var composeGiven = false
+
+        var i = 0
+        while i < arguments.count {
+            switch arguments[i] {
+            case "--compose":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--compose requires a path argument")
+                    return 1
+                }
+                if composeGiven {
+                    buildOptions.overrideComposePaths.append(arguments[i])
+                } else {
+                    composePath = arguments[i]
+                }
+                composeGiven = true
+            case "--compose-format":
+                i += 1
+                guard i < arguments.count, let format = ComposeConfigParser.ComposeFormat(rawValue: arguments[i]) else {
+                    Self.printError("--compose-format must be yaml or json")
+                    return 1
+                }
+                buildOptions.composeFormat = format
+            case "--env-file-search-up":
+                i += 1
+                guard i < arguments.count, let levels = Int(arguments[i]), levels >= 0 else {
+                    Self.printError("--env-file-search-up requires a non-negative integer")
+                    return 1
+                }
+                buildOptions.envFileSearchUp = levels
+            case "--allow-env":
+                i += 1
+                guard i < arguments.count, !arguments[i].isEmpty, !arguments[i].contains("=") else {
+                    Self.printError("--allow-env requires a variable name")
+                    return 1
+                }
+                buildOptions.allowedEnvironment.insert(arguments[i])
+            case "--profile":
+                i += 1
+                guard i < arguments.count, !arguments[i].isEmpty, !arguments[i].hasPrefix("-") else {
+                    Self.printError("--profile requires a profile name")
+                    return 1
+                }
+                buildOptions.profiles.append(arguments[i])
+            case "--identifier":
+                i += 1
+                guard i < arguments.count else {
+                    Self.printError("--identifier requires a bundle ID")
+                    return 1
+                }
+                buildOptions.identifier = arguments[i]
+            case "--override-image":
+                i += 1
+                guard i < arguments.count, let eq = arguments[i].firstIndex(of: "="),
+                      eq != arguments[i].startIndex, eq != arguments[i].index(before: arguments[i].endIndex) else {
+                    Self.printError("--override-image requires <service>=<image>")
+                    return 1
+                }
+                let service = String(arguments[i][..<eq])
+                guard buildOptions.imageOverrides[service] == nil else {
+                    Self.printError("--override-image given twice for service \"\(service)\"")
+                    return 1
+                }
+                buildOptions.imageOverrides[service] = String(arguments[i][arguments[i].index(after: eq)...])
+            case "--json":
+                json = true
+            case "--strict":
+                buildOptions.strict = true
+            case "--require-pinned":
+                buildOptions.requirePinned = true
+            case "--allow-privileged":
+                buildOptions.allowPrivileged = true
+            case "--check-env":
+                checkEnv = true
+            case "--lint":
+                lint = true
+            case "--help", "-h":
+                Self.printUsage()
+                return 0
+            default:
+                Self.printError("Unknown flag: \(arguments[i])")
+                Self.printUsage()
+                return 1
+            }
+            i += 1
+        }
+
+        do {
+            if checkEnv {
+                let references = try ComposeConfigParser.environmentReferences(composePath: composePath, options: buildOptions)
+                print(json ? Self.referencesJSON(references) : Self.referencesText(references))
+                let missing = references.filter { $0.status == .missing }.map(\.name)
+                guard missing.isEmpty else {
+                    if !json {
+                        Self.printError("required variables not set: \(Array(Set(missing)).sorted().joined(separator: ", ")) — export them, add them to .env next to the compose file, or give them a default")
+                    }
+                    return 1
+                }
+                return 0
+            }
+            let config = try ComposeConfigParser.parseBuild(composePath: composePath, options: buildOptions)
+            print(json ? try PackCommand.configJSON(config) : PackCommand.configText(config))
+            guard lint else { return 0 }
+            // Findings follow the config; with --json they go to stderr so stdout stays parseable
+            let findings = ComposeLinter.lint(config)
+            let report = (findings.map(\.line) + [findings.isEmpty ? "No lint findings" : "\(findings.count) lint finding(s)"])
+                .joined(separator: "\n")
+            if json {
+                FileHandle.standardError.write(Data((report + "\n").utf8))
+            } else {
+                print("")
+                print(report)
+            }
+            return buildOptions.strict && !ComposeLinter.strictFailures(findings).isEmpty ? 1 : 0
+        } catch {
+            if json {
+                print(Self.problemsJSON(ComposeConfigParser.validationProblems(in: error)))
+            } else {
+                Self.printError("Compose validation failed: \(error.localizedDescription)")
+            }
+            return 1
+        }
+    }
+
+    /// `{"errors": [{"code": ..., "field": ..., "message": ...}]}`, printed instead of the config
+    /// when `--json` validation fails.
+    static func problemsJSON(_ problems: [ComposeConfigParser.ValidationProblem]) -> String {
+        let encoder = JSONEncoder()
+        encoder.outputFormatting = [.prettyPrinted, .sortedKeys, .withoutEscapingSlashes]
+        let data = (try? encoder.encode(["errors": problems])) ?? Data("{\"errors\": []}".utf8)
+        return String(decoding: data, as: UTF8.self)
+    }
+
+    /// One line per `--check-env` reference: variable, status, whether it's required, and where it's used.
+    static func referencesText(_ references: [ComposeInterpolation.Reference]) -> String {
+        guard !references.isEmpty else { return "No ${VAR} references." }
+        let width = references.map(\.name.count).max() ?? 0
+        return references.map { ref in
+            let name = ref.name.padding(toLength: width, withPad: " ", startingAt: 0)
+            let status = ref.status.rawValue.padding(toLength: 9, withPad: " ", startingAt: 0)
+            return "\(name)  \(status)  \(ref.required ? "required" : "optional")  \(ref.field)"
+        }.joined(separator: "\n")
+    }
+
+    /// `{"variables": [{"name": ..., "field": ..., "required": ..., "status": ...}]}` for `--check-env --json`.
+    static func referencesJSON(_ references: [ComposeInterpolation.Reference]) -> String {
+        let encoder = JSONEncoder()
+        encoder.outputFormatting = [.prettyPrinted, .sortedKeys, .withoutEscapingSlashes]
+        let data = (try? encoder.encode(["variables": references])) ?? Data("{\"variables\": []}".utf8)
+        return String(decoding: data, as: UTF8.self)
+    }
+
+    // MARK: - Output Helpers
+
+    private static func printError(_ message: String) {
+        let stderr = FileHandle.standardError
+        stderr.write("Error: \(message)\n".data(using: .utf8)!)
+    }
+
+    private static func printUsage() {
+        print("""
+        Usage: containerfy validate [flags]
+
+        Validate a docker-compose.yml the way pack does and print the resolved
+        configuration. Nothing is built and no binaries are needed.
+
+        Flags:
+          --compose <path>           Path to docker-compose.yml, or a directory containing one (default: ./docker-compose.yml).
+                                     Repeat to merge override files over the first, in order
+          --compose-format <fmt>     Parse the compose file as yaml or json (default: from the file extension)
+          --env-file-search-up <n>   Use the nearest .env in up to n parent directories for ${VAR}
+          --allow-env <name>         Let ${name} read the shell environment (repeatable)
+          --profile <name>           Also include services in this compose profile (repeatable)
+          --identifier <bundle-id>   Override x-containerfy.identifier
+          --override-image <svc>=<image>  Replace a service's image (repeatable)
+          --json                     Print the configuration as JSON, or the problems found with their
+                                     code (MISSING_FIELD, RANGE, UNSUPPORTED, ...) and field
+          --strict                   Treat warnings (e.g. privileged host ports) as errors
+          --require-pinned           Fail on images without a version tag or @sha256: digest
+          --allow-privileged         Accept privileged: true and cap_add: SYS_ADMIN (and similar) with a warning
+          --lint                     Also run the best-practice rules of 'containerfy lint' and print the findings
+                                     after the configuration; with --strict, any warning fails
+          --check-env                List every ${VAR} reference as set, defaulted or missing, with the field
+                                     it appears in, and fail if a required one is unset. Nothing else is checked
+          --help                     Show this help
+        """)
+    }
+}
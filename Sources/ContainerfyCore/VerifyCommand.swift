@@ -0,0 +1,109 @@
+import Foundation
+
+/// CLI `verify` command — checks that a packed .app still matches what `pack` produced:
+/// the compose digest in Info.plist and, for bundles that have one, every file in manifest.json.
+///
+/// Usage: containerfy verify <path-to-app>
+public struct VerifyCommand {
+
+    enum VerifyError: LocalizedError {
+        case notABundle(String)
+        case missingDigest
+        case composeMissing(String)
+        case composeModified(expected: String, actual: String)
+
+        var errorDescription: String? {
+            switch self {
+            case .notABundle(let path):
+                return "\(path) is not a .app bundle (no Contents/Info.plist)"
+            case .missingDigest:
+                return "Info.plist has no \(BundleAssembler.composeDigestKey) — the bundle was packed by an older containerfy"
+            case .composeMissing(let path):
+                return "embedded compose file is missing: \(path)"
+            case .composeModified(let expected, let actual):
+                return "embedded docker-compose.yml does not match the pack-time digest (expected \(expected), found \(actual)) — the bundle was modified or corrupted"
+            }
+        }
+    }
+
+    public init() {}
+
+    /// Runs the verify command. Returns an exit code (0 = bundle intact).
+    public func run(arguments: [String]) -> Int32 {
+        if arguments.first == "--help" || arguments.first == "-h" {
+            Self.printUsage()
+            return 0
+        }
+        guard arguments.count == 1 else {
+            Self.printError("verify takes exactly one .app path")
+            Self.printUsage()
+            return 1
+        }
+
+        let appPath = arguments[0]
+        do {
+            try Self.verifyComposeDigest(appPath: appPath)
+            if let count = try Self.verifyManifest(appPath: appPath) {
+                print("OK: \(appPath) — compose file and \(count) bundled files match pack-time digests")
+            } else {
+                print("OK: \(appPath) — compose file matches pack-time digest")
+            }
+            return 0
+        } catch {
+            Self.printError(error.localizedDescription)
+            return 1
+        }
+    }
+
+    /// Recomputes the SHA-256 of the bundled compose file (located via layout.json) and compares it
+    /// with the digest `pack` wrote into Info.plist.
+    static func verifyComposeDigest(appPath: String) throws {
+        let contentsDir = (appPath as NSString).appendingPathComponent("Contents")
+        let plistPath = (contentsDir as NSString).appendingPathComponent("Info.plist")
+        guard let data = FileManager.default.contents(atPath: plistPath),
+              let plist = try? PropertyListSerialization.propertyList(from: data, format: nil) as? [String: Any] else {
+            throw VerifyError.notABundle(appPath)
+        }
+        guard let expected = plist[BundleAssembler.composeDigestKey] as? String else {
+            throw VerifyError.missingDigest
+        }
+
+        let resourcesDir = (contentsDir as NSString).appendingPathComponent("Resources")
+        let layout = try BundleLayout.load(resourcesPath: resourcesDir)
+        let composePath = (resourcesDir as NSString).appendingPathComponent(layout.compose)
+        guard FileManager.default.fileExists(atPath: composePath) else {
+            throw VerifyError.composeMissing(composePath)
+        }
+        let actual = try Checksum.sha256(ofFile: composePath)
+        guard actual.caseInsensitiveCompare(expected) == .orderedSame else {
+            throw VerifyError.composeModified(expected: expected, actual: actual)
+        }
+    }
+
+    /// Re-checks every file listed in the bundle's manifest.json. Returns the number of files
+    /// checked, or nil if the bundle was packed before manifests existed.
+    static func verifyManifest(appPath: String) throws -> Int? {
+        let resourcesDir = (appPath as NSString).appendingPathComponent("Contents/Resources")
+        guard let name = try BundleLayout.load(resourcesPath: resourcesDir).manifest else { return nil }
+        let manifest = try BundleManifest.load(path: (resourcesDir as NSString).appendingPathComponent(name))
+        try manifest.verify(resourcesPath: resourcesDir)
+        return manifest.files.count
+    }
+
+    // MARK: - Output Helpers
+
+    private static func printError(_ message: String) {
+        let stderr = FileHandle.standardError
+        stderr.write("Error: \(message)\n".data(using: .utf8)!)
+    }
+
+    private static func printUsage() {
+        print("""
+        Usage: containerfy verify <path-to-app>
+
+        Check that a packed .app's embedded docker-compose.yml matches the
+        SHA-256 digest recorded in its Info.plist at pack time, and that every
+        file in Contents/Resources matches Resources/manifest.json.
+        """)
+    }
+}
@@ -0,0 +1,34 @@
+import Foundation
+
+/// Version of the running containerfy binary.
+/// Development builds report `0.0.0-dev`; the release workflow stamps the tag version, commit
+/// and build date before building.
+public enum ContainerfyVersion {
+    public static let current = "0.0.0-dev"
+    public static let commit = "unknown"
+    public static let buildDate = "unknown"
+
+    /// `containerfy version` output.
+    public static var description: String {
+        "containerfy \(current) (commit \(commit), built \(buildDate))"
+    }
+
+    /// Compares the numeric `major.minor.patch` prefixes of two version strings.
+    /// Pre-release and build suffixes are ignored.
+    static func compare(_ lhs: String, _ rhs: String) -> ComparisonResult {
+        let a = numericComponents(lhs)
+        let b = numericComponents(rhs)
+        for i in 0..<max(a.count, b.count) {
+            let x = i < a.count ? a[i] : 0
+            let y = i < b.count ? b[i] : 0
+            if x < y { return .orderedAscending }
+            if x > y { return .orderedDescending }
+        }
+        return .orderedSame
+    }
+
+    private static func numericComponents(_ version: String) -> [Int] {
+        let core = version.split(whereSeparator: { $0 == "-" || $0 == "+" }).first.map(String.init) ?? version
+        return core.split(separator: ".").map { Int($0) ?? 0 }
+    }
+}
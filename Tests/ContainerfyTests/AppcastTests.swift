@@ -0,0 +1,51 @@
+import XCTest
+@testable import ContainerfyCore
+
+final class AppcastTests: XCTestCase {
+
+    private var tmpDir: String!
+
+    override func setUp() {
+        super.setUp()
+        tmpDir = NSTemporaryDirectory() + "appcast-test-\(ProcessInfo.processInfo.globallyUniqueString)"
+        try? FileManager.default.createDirectory(atPath: tmpDir, withIntermediateDirectories: true)
+    }
+
+    override func tearDown() {
+        try? FileManager.default.removeItem(atPath: tmpDir)
+        super.tearDown()
+    }
+
+    private func makeDMG(bytes: Int) -> String {
+        let path = (tmpDir as NSString).appendingPathComponent("MyApp.dmg")
+        FileManager.default.createFile(atPath: path, contents: Data(count: bytes))
+        return path
+    }
+
+    func testItemCarriesVersionLengthAndMinimumSystem() throws {
+        let dmg = makeDMG(bytes: 4096)
+        let item = try Appcast.item(title: "My App", version: "1.2.0", dmgPath: dmg, minimumSystemVersion: "14.0")
+        XCTAssertTrue(item.contains("<sparkle:version>1.2.0</sparkle:version>"))
+        XCTAssertTrue(item.contains("length=\"4096\""))
+        XCTAssertTrue(item.contains("<sparkle:minimumSystemVersion>14.0</sparkle:minimumSystemVersion>"))
+        XCTAssertTrue(item.contains("\(Appcast.placeholderBaseURL)/MyApp.dmg"))
+    }
+
+    func testEmptyDMGRejected() {
+        let dmg = makeDMG(bytes: 0)
+        XCTAssertThrowsError(try Appcast.item(title: "My App", version: "1.0.0", dmgPath: dmg, minimumSystemVersion: "14.0"))
+    }
+
+    func testWriteCreatesThenAppends() throws {
+        let dmg = makeDMG(bytes: 10)
+        let feed = (tmpDir as NSString).appendingPathComponent("appcast.xml")
+
+        try Appcast.write(item: try Appcast.item(title: "My App", version: "1.0.0", dmgPath: dmg, minimumSystemVersion: "14.0"), title: "My App", to: feed)
+        try Appcast.write(item: try Appcast.item(title: "My App", version: "1.1.0", dmgPath: dmg, minimumSystemVersion: "14.0"), title: "My App", to: feed)
+
+        let contents = try String(contentsOfFile: feed, encoding: .utf8)
+        XCTAssertEqual(contents.components(separatedBy: "<item>").count - 1, 2)
+        XCTAssertEqual(contents.components(separatedBy: "</channel>").count - 1, 1)
+        XCTAssertTrue(try XCTUnwrap(contents.range(of: "1.0.0")).lowerBound < XCTUnwrap(contents.range(of: "1.1.0")).lowerBound)
+    }
+}
@@ -0,0 +1,60 @@
+import XCTest
+@testable import ContainerfyCore
+
+final class BundleArchiveTests: XCTestCase {
+
+    private var tempDir: String!
+
+    override func setUp() {
+        super.setUp()
+        tempDir = NSTemporaryDirectory() + "containerfy-archive-\(UUID().uuidString)"
+        try? FileManager.default.createDirectory(atPath: tempDir, withIntermediateDirectories: true)
+    }
+
+    override func tearDown() {
+        try? FileManager.default.removeItem(atPath: tempDir)
+        super.tearDown()
+    }
+
+    func testTarGzRoundTripKeepsModesAndSymlinks() throws {
+        let fm = FileManager.default
+        let appPath = (tempDir as NSString).appendingPathComponent("build/Test.app")
+        let macOS = (appPath as NSString).appendingPathComponent("Contents/MacOS")
+        try fm.createDirectory(atPath: macOS, withIntermediateDirectories: true)
+        let podman = (macOS as NSString).appendingPathComponent("podman")
+        fm.createFile(atPath: podman, contents: Data("#!/bin/sh\n".utf8), attributes: [.posixPermissions: 0o755])
+        let env = (appPath as NSString).appendingPathComponent("Contents/app.env")
+        fm.createFile(atPath: env, contents: Data("FOO=bar\n".utf8), attributes: [.posixPermissions: 0o600])
+        try fm.createSymbolicLink(atPath: (appPath as NSString).appendingPathComponent("Contents/current"), withDestinationPath: "MacOS")
+
+        let archive = try BundleArchive.create(
+            appPath: appPath, appName: "Test", format: .tarGz, outputDir: (tempDir as NSString).appendingPathComponent("build")
+        )
+        XCTAssertTrue(archive.hasSuffix("build/Test.tar.gz"))
+
+        let restored = (tempDir as NSString).appendingPathComponent("restored")
+        try BundleArchive.extract(archivePath: archive, format: .tarGz, into: restored)
+        let restoredApp = (restored as NSString).appendingPathComponent("Test.app")
+        func mode(_ relative: String) throws -> Int? {
+            let path = (restoredApp as NSString).appendingPathComponent(relative)
+            return (try fm.attributesOfItem(atPath: path)[.posixPermissions] as? NSNumber)?.intValue
+        }
+        XCTAssertEqual(try mode("Contents/MacOS/podman"), 0o755)
+        XCTAssertEqual(try mode("Contents/app.env"), 0o600)
+        XCTAssertEqual(
+            try fm.destinationOfSymbolicLink(atPath: (restoredApp as NSString).appendingPathComponent("Contents/current")),
+            "MacOS"
+        )
+    }
+
+    func testFailedArchiveCommandReported() {
+        let shell = MockShellExecutor()
+        shell.resultToReturn = ProcessResult(exitCode: 1, stdout: "", stderr: "ditto: Couldn't read")
+        XCTAssertThrowsError(try BundleArchive.create(
+            appPath: "/tmp/Test.app", appName: "Test", format: .zip, outputDir: tempDir, shell: shell
+        )) { error in
+            XCTAssertTrue(error.localizedDescription.contains("ditto exited 1"), error.localizedDescription)
+        }
+        XCTAssertEqual(shell.calls.first?.arguments, ["-c", "-k", "--keepParent", "/tmp/Test.app", tempDir + "/Test.zip"])
+    }
+}
@@ -0,0 +1,541 @@
+import XCTest
+@testable import ContainerfyCore
+
+final class BundleAssemblerTests: XCTestCase {
+
+    private var tmpDir: String!
+
+    override func setUp() {
+        super.setUp()
+        tmpDir = NSTemporaryDirectory() + "bundle-test-\(ProcessInfo.processInfo.globallyUniqueString)"
+        try? FileManager.default.createDirectory(atPath: tmpDir, withIntermediateDirectories: true)
+    }
+
+    override func tearDown() {
+        try? FileManager.default.removeItem(atPath: tmpDir)
+        super.tearDown()
+    }
+
+    private func writeFile(_ relativePath: String, bytes: Int) {
+        let path = (tmpDir as NSString).appendingPathComponent(relativePath)
+        let dir = (path as NSString).deletingLastPathComponent
+        try? FileManager.default.createDirectory(atPath: dir, withIntermediateDirectories: true)
+        FileManager.default.createFile(atPath: path, contents: Data(count: bytes))
+    }
+
+    /// The minimal valid config for a project in `tmpDir/src`, with its compose file at
+    /// `src/docker-compose.yml`.
+    private func makeConfig(
+        envFiles: [String] = [], bundledFiles: [BundledFile] = [], icon: String? = nil,
+        license: String? = nil, volumeSeeds: [VolumeSeed] = []
+    ) -> ComposeConfig {
+        let src = (tmpDir as NSString).appendingPathComponent("src")
+        return ComposeConfig(
+            portMappings: [], displayName: "Test", services: [],
+            name: "test", version: "1.0.0", buildNumber: nil, identifier: "com.example.test",
+            icon: icon, license: license, runsInBackground: true, minimumMacOS: nil, category: nil, infoPlistExtras: [:], updateFeed: nil,
+            cpuMin: 2, cpuRecommended: 2, memoryMBMin: 1024, memoryMBRecommended: 1024, diskMB: 4096,
+            volumeLimitsMB: [:], volumeSeeds: volumeSeeds, images: [], envFiles: envFiles, bundledFiles: bundledFiles,
+            composePath: (src as NSString).appendingPathComponent("docker-compose.yml"), composeDir: src,
+            labels: [:], serviceSpecs: [], startupOrder: [], healthchecks: [], renderedCompose: nil, warnings: []
+        )
+    }
+
+    // MARK: - Size Budget
+
+    func testSizeBudgetUnderLimitPasses() throws {
+        writeFile("Contents/MacOS/podman", bytes: 512 * 1024)
+        XCTAssertNoThrow(try BundleAssembler.checkSizeBudget(path: tmpDir, maxMB: 1))
+    }
+
+    func testSizeBudgetOverLimitListsLargestFiles() {
+        writeFile("Contents/MacOS/podman", bytes: 1536 * 1024)
+        writeFile("Contents/Resources/docker-compose.yml", bytes: 100)
+
+        XCTAssertThrowsError(try BundleAssembler.checkSizeBudget(path: tmpDir, maxMB: 1)) { error in
+            guard case BundleAssembler.AssemblyError.overBudget(_, let bytes, let budgetMB, let largest) = error else {
+                return XCTFail("Expected AssemblyError.overBudget, got: \(error)")
+            }
+            XCTAssertEqual(bytes, 1536 * 1024 + 100)
+            XCTAssertEqual(budgetMB, 1)
+            XCTAssertEqual(largest.first?.path, "Contents/MacOS/podman")
+            XCTAssertTrue(error.localizedDescription.contains("Contents/MacOS/podman"))
+        }
+    }
+
+    func testSizeBudgetSingleFile() {
+        writeFile("MyApp.dmg", bytes: 2 * 1024 * 1024)
+        let dmg = (tmpDir as NSString).appendingPathComponent("MyApp.dmg")
+        XCTAssertThrowsError(try BundleAssembler.checkSizeBudget(path: dmg, maxMB: 1))
+    }
+
+    // MARK: - Checksum
+
+    // MARK: - Free Space
+
+    func testSpaceNeededCountsDMGStaging() {
+        let mb: UInt64 = 1024 * 1024
+        let headroom = BundleAssembler.freeSpaceHeadroomBytes
+        let appOnly = BundleAssembler.spaceNeeded(appBytes: 100 * mb, outputDir: "/out", tempDir: "/tmp", dmg: false)
+        XCTAssertEqual(appOnly.map(\.path), ["/out"])
+        XCTAssertEqual(appOnly.map(\.bytes), [100 * mb + headroom])
+
+        let withDMG = BundleAssembler.spaceNeeded(appBytes: 100 * mb, outputDir: "/out", tempDir: "/tmp", dmg: true)
+        XCTAssertEqual(withDMG.map(\.path), ["/out", "/tmp"])
+        XCTAssertEqual(withDMG.map(\.bytes), [200 * mb + headroom, 100 * mb + headroom])
+    }
+
+    func testEstimatedAppBytesSumsBinariesAndBundledFiles() {
+        writeFile("src/podman", bytes: 3000)
+        writeFile("src/app.env", bytes: 20)
+        writeFile("src/docker-compose.yml", bytes: 100)
+        writeFile("src/seed/db/base.sql", bytes: 400)
+        writeFile("src/seed/db/nested/extra.sql", bytes: 80)
+        let src = (tmpDir as NSString).appendingPathComponent("src")
+        let seed = VolumeSeed(volume: "db", podmanName: "resources_db", source: (src as NSString).appendingPathComponent("seed/db"))
+        let config = makeConfig(envFiles: [(src as NSString).appendingPathComponent("app.env")], volumeSeeds: [seed])
+        let bytes = BundleAssembler.estimatedAppBytes(config: config, binaries: [(tmpDir as NSString).appendingPathComponent("src/podman")])
+        XCTAssertEqual(bytes, 3600)
+    }
+
+    func testInsufficientFreeSpaceReportsNeededAndAvailable() {
+        let mb: UInt64 = 1024 * 1024
+        let needed = [(path: "/out", bytes: 10 * mb), (path: "/tmp", bytes: 500 * mb)]
+        XCTAssertNoThrow(try BundleAssembler.checkFreeSpace(needed) { $0 == "/tmp" ? nil : Int64(20 * mb) })
+        XCTAssertThrowsError(try BundleAssembler.checkFreeSpace(needed) { _ in Int64(100 * mb) }) { error in
+            guard case BundleAssembler.AssemblyError.insufficientSpace("/tmp", 500 * mb, 100 * mb) = error else {
+                return XCTFail("Expected AssemblyError.insufficientSpace for /tmp, got: \(error)")
+            }
+            XCTAssertTrue(error.localizedDescription.contains("need 500.0 MB, have 100.0 MB"), error.localizedDescription)
+        }
+    }
+
+    func testChecksumSidecarFormat() throws {
+        writeFile("MyApp.dmg", bytes: 0)
+        let dmg = (tmpDir as NSString).appendingPathComponent("MyApp.dmg")
+        let sidecar = try Checksum.writeSidecar(for: dmg)
+        XCTAssertEqual(sidecar, dmg + ".sha256")
+        let contents = try String(contentsOfFile: sidecar, encoding: .utf8)
+        // SHA-256 of empty input
+        XCTAssertEqual(contents, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  MyApp.dmg\n")
+    }
+
+    func testDirectoryChecksumDependsOnContents() throws {
+        writeFile("MyApp.app/Contents/MacOS/podman", bytes: 16)
+        writeFile("MyApp.app/Contents/Resources/docker-compose.yml", bytes: 8)
+        let app = (tmpDir as NSString).appendingPathComponent("MyApp.app")
+
+        let first = try Checksum.sha256(atPath: app)
+        XCTAssertEqual(try Checksum.sha256(atPath: app), first)
+
+        writeFile("MyApp.app/Contents/Resources/docker-compose.yml", bytes: 9)
+        XCTAssertNotEqual(try Checksum.sha256(atPath: app), first)
+    }
+
+    // MARK: - Layout Manifest
+
+    func testLayoutRoundTrips() throws {
+        let layout = BundleLayout(
+            schemaVersion: BundleLayout.currentSchemaVersion,
+            compose: "docker-compose.yml",
+            runtime: "runtime.json",
+            envFiles: ["app.env"],
+            labels: "labels.json",
+            caCertificates: nil,
+            license: nil
+        )
+        try layout.write(toResourcesPath: tmpDir)
+        XCTAssertEqual(try BundleLayout.load(resourcesPath: tmpDir), layout)
+
+        let json = try String(contentsOfFile: (tmpDir as NSString).appendingPathComponent("layout.json"), encoding: .utf8)
+        XCTAssertTrue(json.contains("\"schema_version\" : 1"))
+        XCTAssertFalse(json.contains("ca_certificates"))
+    }
+
+    func testMissingLayoutIsLegacy() throws {
+        XCTAssertEqual(try BundleLayout.load(resourcesPath: tmpDir), .legacy)
+    }
+
+    func testNewerLayoutSchemaIsRejected() throws {
+        let json = #"{"schema_version": 99, "compose": "compose.yaml", "env_files": []}"#
+        try json.write(toFile: (tmpDir as NSString).appendingPathComponent("layout.json"), atomically: true, encoding: .utf8)
+        XCTAssertThrowsError(try BundleLayout.load(resourcesPath: tmpDir)) { error in
+            guard case BundleLayout.LayoutError.unsupportedSchema(99) = error else {
+                return XCTFail("Expected unsupportedSchema, got: \(error)")
+            }
+        }
+    }
+
+    // MARK: - Placeholder Artifacts
+
+    func testPlaceholderBinariesAreMarkedExecutableStubs() throws {
+        let dir = (tmpDir as NSString).appendingPathComponent("placeholders")
+        let (podman, gvproxy, vfkit) = try BundleAssembler.writePlaceholderBinaries(in: dir)
+
+        for path in [podman, gvproxy, vfkit] {
+            XCTAssertTrue(FileManager.default.isExecutableFile(atPath: path))
+            let script = try String(contentsOfFile: path, encoding: .utf8)
+            XCTAssertTrue(script.hasPrefix("#!/bin/sh"))
+            XCTAssertTrue(script.contains("CONTAINERFY PLACEHOLDER"))
+            XCTAssertTrue(script.contains("exit 1"))
+        }
+    }
+
+    // MARK: - Runtime Architecture
+
+    private static let arm64: UInt32 = 0x0100_000C
+    private static let x86_64: UInt32 = 0x0100_0007
+
+    /// A thin 64-bit Mach-O header (little-endian) for one CPU type, a universal header for several.
+    private func writeMachO(_ relativePath: String, cpuTypes: [UInt32]) {
+        func bigEndian(_ word: UInt32) -> [UInt8] { (0..<4).map { UInt8(truncatingIfNeeded: word >> (24 - 8 * $0)) } }
+        var bytes: [UInt8]
+        if cpuTypes.count == 1 {
+            bytes = bigEndian(0xCFFA_EDFE) + bigEndian(cpuTypes[0]).reversed()
+        } else {
+            bytes = bigEndian(0xCAFE_BABE) + bigEndian(UInt32(cpuTypes.count))
+            for cpuType in cpuTypes {
+                bytes += bigEndian(cpuType) + [UInt8](repeating: 0, count: 16)
+            }
+        }
+        let path = (tmpDir as NSString).appendingPathComponent(relativePath)
+        try? FileManager.default.createDirectory(atPath: (path as NSString).deletingLastPathComponent, withIntermediateDirectories: true)
+        FileManager.default.createFile(atPath: path, contents: Data(bytes + [UInt8](repeating: 0, count: 64)))
+    }
+
+    func testMachOArchitecturesReadsThinAndUniversalHeaders() {
+        writeMachO("thin", cpuTypes: [Self.x86_64])
+        writeMachO("universal", cpuTypes: [Self.x86_64, Self.arm64])
+        writeFile("script", bytes: 64)
+        XCTAssertEqual(BundleAssembler.machOArchitectures((tmpDir as NSString).appendingPathComponent("thin")), ["x86_64"])
+        XCTAssertEqual(BundleAssembler.machOArchitectures((tmpDir as NSString).appendingPathComponent("universal")), ["x86_64", "arm64"])
+        XCTAssertNil(BundleAssembler.machOArchitectures((tmpDir as NSString).appendingPathComponent("script")))
+    }
+
+    func testAssembleRejectsRuntimeBinaryForAnotherArchitecture() throws {
+        XCTAssertThrowsError(try assembleWithIcon("icon.icns", runtimeCPUTypes: [Self.x86_64], architecture: "arm64", shell: MockShellExecutor())) { error in
+            guard case BundleAssembler.AssemblyError.wrongArchitecture(_, ["x86_64"], "arm64") = error else {
+                return XCTFail("unexpected error: \(error)")
+            }
+            XCTAssertTrue(error.localizedDescription.contains("use an arm64 or universal containerfy build"), error.localizedDescription)
+        }
+        XCTAssertFalse(FileManager.default.fileExists(atPath: (tmpDir as NSString).appendingPathComponent("Test.app")))
+
+        // Thin binaries for the target and universal ones are bundled
+        for cpuTypes in [[Self.arm64], [Self.x86_64, Self.arm64]] {
+            let contents = try assembleWithIcon("icon.icns", runtimeCPUTypes: cpuTypes, architecture: "arm64", shell: MockShellExecutor())
+            XCTAssertEqual(BundleAssembler.machOArchitectures(contents + "/MacOS/Containerfy")?.last, "arm64")
+        }
+    }
+
+    // MARK: - File Modes
+
+    private func mode(_ path: String) throws -> Int {
+        try XCTUnwrap(FileManager.default.attributesOfItem(atPath: path)[.posixPermissions] as? Int)
+    }
+
+    // MARK: - Icon
+
+    private func assembleWithIcon(
+        _ iconName: String, license: String? = nil, runtimeCPUTypes: [UInt32]? = nil, architecture: String = "arm64",
+        shell: MockShellExecutor
+    ) throws -> String {
+        let src = (tmpDir as NSString).appendingPathComponent("src")
+        for name in ["docker-compose.yml", iconName, "podman", "gvproxy", "vfkit", "containerfy"] + [license].compactMap({ $0 }) {
+            writeFile("src/\(name)", bytes: 4)
+        }
+        if let runtimeCPUTypes {
+            writeMachO("src/containerfy", cpuTypes: runtimeCPUTypes)
+        }
+        let config = makeConfig(
+            icon: (src as NSString).appendingPathComponent(iconName),
+            license: license.map { (src as NSString).appendingPathComponent($0) }
+        )
+        let output = (tmpDir as NSString).appendingPathComponent("Test")
+        try BundleAssembler.assemble(
+            config: config,
+            podmanPath: (src as NSString).appendingPathComponent("podman"),
+            gvproxyPath: (src as NSString).appendingPathComponent("gvproxy"),
+            vfkitPath: (src as NSString).appendingPathComponent("vfkit"),
+            outputPath: output,
+            binaryPath: (src as NSString).appendingPathComponent("containerfy"),
+            architecture: architecture,
+            shell: shell
+        )
+        return output + ".app/Contents"
+    }
+
+    func testAssembleCopiesICNSIconAndSetsPlistKey() throws {
+        let contents = try assembleWithIcon("icon.icns", shell: MockShellExecutor())
+
+        XCTAssertTrue(FileManager.default.fileExists(atPath: contents + "/Resources/AppIcon.icns"))
+        let plist = try String(contentsOfFile: contents + "/Info.plist", encoding: .utf8)
+        XCTAssertTrue(plist.contains("<key>CFBundleIconFile</key>\n\t<string>AppIcon</string>"))
+        XCTAssertTrue(plist.contains("<key>ContainerfyBuilderVersion</key>\n\t<string>\(ContainerfyVersion.current)</string>"))
+        XCTAssertEqual(try BundleLayout.load(resourcesPath: contents + "/Resources").icon, "AppIcon.icns")
+        let manifest = try BundleManifest.load(path: contents + "/Resources/manifest.json")
+        XCTAssertTrue(manifest.files.contains { $0.path == "AppIcon.icns" })
+        XCTAssertNoThrow(try manifest.verify(resourcesPath: contents + "/Resources"))
+    }
+
+    func testAssembleConvertsPNGIcon() throws {
+        let shell = MockShellExecutor()
+        let contents = try assembleWithIcon("icon.png", shell: shell)
+
+        XCTAssertEqual(shell.calls.filter { $0.executable == "/usr/bin/sips" }.count, 10)
+        let iconutil = try XCTUnwrap(shell.calls.first { $0.executable == "/usr/bin/iconutil" })
+        XCTAssertEqual(iconutil.arguments.last, contents + "/Resources/AppIcon.icns")
+        let plist = try String(contentsOfFile: contents + "/Info.plist", encoding: .utf8)
+        XCTAssertTrue(plist.contains("CFBundleIconFile"))
+    }
+
+    func testAssembleBundlesLicense() throws {
+        let contents = try assembleWithIcon("icon.icns", license: "THIRD-PARTY-NOTICES.txt", shell: MockShellExecutor())
+
+        XCTAssertEqual(FileManager.default.contents(atPath: contents + "/Resources/LICENSE.txt")?.count, 4)
+        XCTAssertEqual(try BundleLayout.load(resourcesPath: contents + "/Resources").license, BundleAssembler.licenseFileName)
+        let manifest = try BundleManifest.load(path: contents + "/Resources/manifest.json")
+        XCTAssertTrue(manifest.files.contains { $0.path == BundleAssembler.licenseFileName })
+        let plist = try String(contentsOfFile: contents + "/Info.plist", encoding: .utf8)
+        XCTAssertTrue(plist.contains("<string>Licensed under the terms in Contents/Resources/LICENSE.txt</string>"), plist)
+        XCTAssertFalse(plist.contains("Built with Containerfy"))
+    }
+
+    func testAssembleRecordsInstalledPaths() throws {
+        let contents = try assembleWithIcon("icon.icns", shell: MockShellExecutor())
+        let resources = contents + "/Resources"
+
+        let layout = try BundleLayout.load(resourcesPath: resources)
+        XCTAssertEqual(layout.installedPaths, InstalledPaths.fileName)
+        let installed = try InstalledPaths.load(path: (resources as NSString).appendingPathComponent(InstalledPaths.fileName))
+        XCTAssertEqual(installed.supportDirectory, "~/Library/Application Support/com.example.test")
+        XCTAssertEqual(installed.files, ["state.json"])
+        XCTAssertEqual(installed.podmanMachine, "containerfy-test")
+        XCTAssertEqual(
+            try installed.removablePaths(home: "/Users/me"),
+            ["/Users/me/Library/Application Support/com.example.test/state.json", "/Users/me/Library/Application Support/com.example.test"]
+        )
+        let manifest = try BundleManifest.load(path: resources + "/manifest.json")
+        XCTAssertTrue(manifest.files.contains { $0.path == InstalledPaths.fileName })
+    }
+
+    // MARK: - Reproducibility
+
+    private func modificationDates(under path: String) throws -> [String: Date] {
+        var dates: [String: Date] = [:]
+        for case let rel as String in FileManager.default.enumerator(atPath: path)! {
+            let attrs = try FileManager.default.attributesOfItem(atPath: (path as NSString).appendingPathComponent(rel))
+            dates[rel] = attrs[.modificationDate] as? Date
+        }
+        return dates
+    }
+
+    func testAssemblingTwiceProducesIdenticalBundles() throws {
+        let first = (try assembleWithIcon("icon.icns", shell: MockShellExecutor()) as NSString).deletingLastPathComponent
+        let kept = (tmpDir as NSString).appendingPathComponent("first.app")
+        try FileManager.default.moveItem(atPath: first, toPath: kept)
+        let second = (try assembleWithIcon("icon.icns", shell: MockShellExecutor()) as NSString).deletingLastPathComponent
+
+        XCTAssertEqual(try Checksum.sha256(ofDirectory: kept), try Checksum.sha256(ofDirectory: second))
+        let dates = try modificationDates(under: second)
+        XCTAssertEqual(try modificationDates(under: kept), dates)
+        XCTAssertEqual(Set(dates.values), [BundleAssembler.sourceDate()])
+    }
+
+    private func configSHA256(assemblingWithEnv env: String) throws -> String? {
+        let src = (tmpDir as NSString).appendingPathComponent("src")
+        for name in ["docker-compose.yml", "podman", "gvproxy", "vfkit", "containerfy"] {
+            writeFile("src/\(name)", bytes: 4)
+        }
+        let envFile = (src as NSString).appendingPathComponent("app.env")
+        try env.write(toFile: envFile, atomically: true, encoding: .utf8)
+
+        let config = makeConfig(envFiles: [envFile])
+        let output = (tmpDir as NSString).appendingPathComponent("Test")
+        try BundleAssembler.assemble(
+            config: config,
+            podmanPath: (src as NSString).appendingPathComponent("podman"),
+            gvproxyPath: (src as NSString).appendingPathComponent("gvproxy"),
+            vfkitPath: (src as NSString).appendingPathComponent("vfkit"),
+            outputPath: output,
+            binaryPath: (src as NSString).appendingPathComponent("containerfy"),
+            shell: MockShellExecutor()
+        )
+        let data = try XCTUnwrap(FileManager.default.contents(atPath: output + ".app/Contents/Info.plist"))
+        let plist = try XCTUnwrap(PropertyListSerialization.propertyList(from: data, format: nil) as? [String: Any])
+        return plist[BundleAssembler.configDigestKey] as? String
+    }
+
+    func testEnvFilesBundledNormalized() throws {
+        _ = try configSHA256(assemblingWithEnv: "\u{FEFF}LOG_LEVEL=info\r\nPORT=8080\r\n")
+        let bundled = FileManager.default.contents(atPath: (tmpDir as NSString).appendingPathComponent("Test.app/Contents/Resources/app.env"))
+        XCTAssertEqual(bundled, Data("LOG_LEVEL=info\nPORT=8080\n".utf8))
+    }
+
+    func testVerifyBundleCatchesCorruption() throws {
+        _ = try configSHA256(assemblingWithEnv: "LOG_LEVEL=info\n")
+        let app = (tmpDir as NSString).appendingPathComponent("Test.app")
+        try BundleAssembler.verifyBundle(appPath: app)
+
+        func assertFails(_ expected: String, file: StaticString = #filePath, line: UInt = #line) {
+            XCTAssertThrowsError(try BundleAssembler.verifyBundle(appPath: app), file: file, line: line) { error in
+                guard case BundleAssembler.AssemblyError.verificationFailed(let reason)? = error as? BundleAssembler.AssemblyError else {
+                    return XCTFail("Expected verificationFailed, got: \(error)", file: file, line: line)
+                }
+                XCTAssertTrue(reason.contains(expected), reason, file: file, line: line)
+            }
+        }
+
+        // Truncated resource
+        let env = app + "/Contents/Resources/app.env"
+        try "LOG".write(toFile: env, atomically: true, encoding: .utf8)
+        assertFails("app.env")
+        try "LOG_LEVEL=info\n".write(toFile: env, atomically: true, encoding: .utf8)
+        try BundleAssembler.verifyBundle(appPath: app)
+
+        // Empty binary
+        FileManager.default.createFile(atPath: app + "/Contents/MacOS/vfkit", contents: Data(), attributes: [.posixPermissions: 0o755])
+        assertFails("Contents/MacOS/vfkit")
+        try FileManager.default.removeItem(atPath: app + "/Contents/MacOS/vfkit")
+        assertFails("Contents/MacOS/vfkit")
+        writeFile("Test.app/Contents/MacOS/vfkit", bytes: 4)
+        try FileManager.default.setAttributes([.posixPermissions: 0o755], ofItemAtPath: app + "/Contents/MacOS/vfkit")
+        try BundleAssembler.verifyBundle(appPath: app)
+
+        // Info.plist without a launch key
+        let plistPath = app + "/Contents/Info.plist"
+        var plist = try XCTUnwrap(PropertyListSerialization.propertyList(from: Data(contentsOf: URL(fileURLWithPath: plistPath)), format: nil) as? [String: Any])
+        plist["CFBundleExecutable"] = nil
+        try PropertyListSerialization.data(fromPropertyList: plist, format: .xml, options: 0).write(to: URL(fileURLWithPath: plistPath))
+        assertFails("CFBundleExecutable")
+    }
+
+    func testConfigDigestCoversEnvFiles() throws {
+        let first = try XCTUnwrap(try configSHA256(assemblingWithEnv: "LOG_LEVEL=info\n"))
+        XCTAssertEqual(first.count, 64)
+        XCTAssertEqual(try configSHA256(assemblingWithEnv: "LOG_LEVEL=info\n"), first)
+        XCTAssertNotEqual(try configSHA256(assemblingWithEnv: "LOG_LEVEL=debug\n"), first)
+    }
+
+    // MARK: - Build Manifest
+
+    func testBuildManifestRecordsImagesAndSizes() throws {
+        let compose = (tmpDir as NSString).appendingPathComponent("docker-compose.yml")
+        try """
+        services:
+          web:
+            image: nginx:1.27
+            ports:
+              - "8080:80"
+          db:
+            image: postgres@sha256:4c0f6e2a1b3d5c7e9f8a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e
+        x-containerfy:
+          name: myapp
+          version: "1.2.0"
+          identifier: com.example.myapp
+          vm:
+            cpu: { min: 2, recommended: 4 }
+            memory_mb: { min: 1024, recommended: 2048 }
+            disk_mb: 8192
+        """.write(toFile: compose, atomically: true, encoding: .utf8)
+        let config = try ComposeConfigParser.parseBuild(composePath: compose)
+        let binaries = try BundleAssembler.writePlaceholderBinaries(in: (tmpDir as NSString).appendingPathComponent("bin"))
+        writeFile("bin/containerfy", bytes: 4)
+        let output = (tmpDir as NSString).appendingPathComponent("out/MyApp")
+        try BundleAssembler.assemble(
+            config: config, podmanPath: binaries.podman, gvproxyPath: binaries.gvproxy, vfkitPath: binaries.vfkit,
+            outputPath: output, binaryPath: (tmpDir as NSString).appendingPathComponent("bin/containerfy"),
+            shell: MockShellExecutor()
+        )
+        let appPath = output + ".app"
+
+        let ca = CACertificates.Certificate(source: "corp-ca.pem", der: Data("test-ca".utf8))
+        let manifest = try BuildManifest.make(
+            config: config, appPath: appPath, artifactPath: appPath, caCertificates: [ca, ca], signed: false, notarized: false
+        )
+        XCTAssertEqual(manifest.images, [
+            BuildManifest.Image(
+                service: "db",
+                reference: "postgres@sha256:4c0f6e2a1b3d5c7e9f8a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e",
+                digest: "sha256:4c0f6e2a1b3d5c7e9f8a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e"
+            ),
+            BuildManifest.Image(service: "web", reference: "nginx:1.27", digest: nil),
+        ])
+        XCTAssertEqual(manifest.vm, BuildManifest.VM(cpu: 4, memoryMB: 2048, diskMB: 8192))
+        XCTAssertEqual(manifest.appBytes, BundleAssembler.fileSizes(under: appPath).reduce(0) { $0 + $1.bytes })
+        XCTAssertEqual(manifest.artifact, BuildManifest.Artifact(name: "MyApp.app", sha256: try Checksum.sha256(atPath: appPath), bytes: manifest.appBytes))
+        XCTAssertEqual(manifest.configSHA256?.count, 64)
+        XCTAssertEqual(manifest.caCertificates, [ca.fingerprint])
+
+        let path = try manifest.write(nextTo: appPath)
+        XCTAssertEqual(path, (tmpDir as NSString).appendingPathComponent("out/myapp.build-manifest.json"))
+        let json = try String(contentsOfFile: path, encoding: .utf8)
+        XCTAssertTrue(json.contains("\"schema_version\" : 1"))
+        XCTAssertTrue(json.contains("\"reference\" : \"nginx:1.27\""))
+        XCTAssertTrue(json.contains("\"ca_certificates\""), json)
+        XCTAssertTrue(json.contains("\"\(ca.fingerprint)\""), json)
+    }
+
+    func testCopyExecutablesCopiesAllAndReportsFirstFailureInOrder() throws {
+        let names = ["podman", "vfkit", "gvproxy", "Containerfy"]
+        for name in names { writeFile("src/\(name)", bytes: 64) }
+        let files = names.map {
+            (source: (tmpDir as NSString).appendingPathComponent("src/\($0)"), destination: (tmpDir as NSString).appendingPathComponent("dst-\($0)"))
+        }
+        try BundleAssembler.copyExecutables(files)
+        for file in files {
+            XCTAssertEqual(FileManager.default.contents(atPath: file.destination)?.count, 64)
+            XCTAssertEqual(try mode(file.destination), 0o755)
+        }
+
+        struct CopyFailed: Error, Equatable { let name: String }
+        XCTAssertThrowsError(try BundleAssembler.copyExecutables(files) { source, _ in
+            let name = (source as NSString).lastPathComponent
+            if name == "vfkit" || name == "Containerfy" { throw CopyFailed(name: name) }
+        }) { error in
+            XCTAssertEqual(error as? CopyFailed, CopyFailed(name: "vfkit"))
+        }
+    }
+
+    func testSourceDateEpoch() {
+        XCTAssertEqual(BundleAssembler.sourceDate(environment: [:]), Date(timeIntervalSince1970: 0))
+        XCTAssertEqual(BundleAssembler.sourceDate(environment: ["SOURCE_DATE_EPOCH": "1700000000"]), Date(timeIntervalSince1970: 1_700_000_000))
+    }
+
+    func testAssembleRestrictsEnvFilesAndSecretsAndKeepsBinariesExecutable() throws {
+        let fm = FileManager.default
+        let src = (tmpDir as NSString).appendingPathComponent("src")
+        for name in ["docker-compose.yml", "app.env", "token.txt", "podman", "gvproxy", "vfkit", "containerfy"] {
+            writeFile("src/\(name)", bytes: 4)
+        }
+        try fm.setAttributes([.posixPermissions: 0o644], ofItemAtPath: (src as NSString).appendingPathComponent("app.env"))
+
+        let config = makeConfig(
+            envFiles: [(src as NSString).appendingPathComponent("app.env")],
+            bundledFiles: [BundledFile(kind: .secret, name: "token", source: (src as NSString).appendingPathComponent("token.txt"), bundlePath: "secrets/token")]
+        )
+        let output = (tmpDir as NSString).appendingPathComponent("Test")
+        try BundleAssembler.assemble(
+            config: config,
+            podmanPath: (src as NSString).appendingPathComponent("podman"),
+            gvproxyPath: (src as NSString).appendingPathComponent("gvproxy"),
+            vfkitPath: (src as NSString).appendingPathComponent("vfkit"),
+            outputPath: output,
+            binaryPath: (src as NSString).appendingPathComponent("containerfy"),
+            shell: MockShellExecutor()
+        )
+
+        let contents = output + ".app/Contents"
+        XCTAssertEqual(try mode(contents + "/Resources/app.env"), 0o600)
+        XCTAssertEqual(try mode(contents + "/Resources/secrets/token"), 0o600)
+        XCTAssertEqual(try mode(contents + "/Resources/secrets"), 0o700)
+        for binary in ["Containerfy", "podman", "gvproxy", "vfkit"] {
+            XCTAssertEqual(try mode(contents + "/MacOS/\(binary)"), 0o755, binary)
+        }
+
+        // `pack --dry-run` lists exactly what was written
+        let planned = BundleAssembler.plannedResources(config: config, hasCACertificates: false)
+        XCTAssertEqual(planned, ["docker-compose.yml", "runtime.json", "layout.json", "installed-paths.json", "manifest.json", "app.env", "secrets/"])
+        XCTAssertEqual(Set(try fm.contentsOfDirectory(atPath: contents + "/Resources")), Set(planned.map { $0.hasSuffix("/") ? String($0.dropLast()) : $0 }))
+    }
+}
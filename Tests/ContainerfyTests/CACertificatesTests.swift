@@ -0,0 +1,89 @@
+import XCTest
+@testable import ContainerfyCore
+
+final class CACertificatesTests: XCTestCase {
+
+    private var tmpDir: String!
+
+    /// Self-signed P-256 CA (CN=containerfy-test-ca), used only as test data.
+    private let testCA = """
+    -----BEGIN CERTIFICATE-----
+    MIIBkzCCATmgAwIBAgIUNOxudyaALo2RTkCSb3BgbyavL0swCgYIKoZIzj0EAwIw
+    HjEcMBoGA1UEAwwTY29udGFpbmVyZnktdGVzdC1jYTAgFw0yNjEwMTcwMjExMTRa
+    GA8yMTI2MDkyMzAyMTExNFowHjEcMBoGA1UEAwwTY29udGFpbmVyZnktdGVzdC1j
+    YTBZMBMGByqGSM49AgEGCCqGSM49AwEHA0IABGHEJltCaD1Vhrcg6tG3HIu7IJAZ
+    whXdhTz7JlndiPysKu77ctQKNM65ac6DhK7LpJtVBanHxSu5ddAKFsJEHECjUzBR
+    MB0GA1UdDgQWBBRyZ/SdPE9LOIvw91+T84czoaVsDDAfBgNVHSMEGDAWgBRyZ/Sd
+    PE9LOIvw91+T84czoaVsDDAPBgNVHRMBAf8EBTADAQH/MAoGCCqGSM49BAMCA0gA
+    MEUCIDiEze4Dp+n+eRI4S7FuwRIDN3tx9x1T64BoJRVusPqPAiEAxuUgXoZlWjDR
+    HULGRrIuwKIGkLrYqNMRrqa/rgz67Lo=
+    -----END CERTIFICATE-----
+
+    """
+
+    override func setUp() {
+        super.setUp()
+        tmpDir = NSTemporaryDirectory() + "ca-test-\(ProcessInfo.processInfo.globallyUniqueString)"
+        try? FileManager.default.createDirectory(atPath: tmpDir, withIntermediateDirectories: true)
+    }
+
+    override func tearDown() {
+        try? FileManager.default.removeItem(atPath: tmpDir)
+        super.tearDown()
+    }
+
+    private func writePEM(_ contents: String, name: String = "ca.pem") -> String {
+        let path = (tmpDir as NSString).appendingPathComponent(name)
+        try? contents.write(toFile: path, atomically: true, encoding: .utf8)
+        return path
+    }
+
+    // MARK: - Loading
+
+    func testLoadValidCertificateReportsFingerprint() throws {
+        let certs = try CACertificates.load(path: writePEM(testCA))
+        XCTAssertEqual(certs.count, 1)
+        XCTAssertEqual(
+            certs[0].fingerprint,
+            "FF:CF:B5:B1:67:D9:ED:95:BD:2A:A2:E9:2D:FC:5F:8E:2A:66:B0:37:DA:00:06:82:89:F8:58:0E:F3:16:43:5A"
+        )
+        XCTAssertEqual(certs[0].fileName, "ffcfb5b167d9ed95.pem")
+    }
+
+    func testLoadBundleWithMultipleCertificates() throws {
+        let certs = try CACertificates.load(path: writePEM(testCA + testCA))
+        XCTAssertEqual(certs.count, 2)
+    }
+
+    func testLoadFileWithoutCertificatesThrows() {
+        let path = writePEM("not a certificate\n")
+        XCTAssertThrowsError(try CACertificates.load(path: path)) { error in
+            guard let ce = error as? CACertificates.CertificateError, case .noCertificates = ce else {
+                return XCTFail("Expected noCertificates, got \(error)")
+            }
+        }
+    }
+
+    func testLoadCorruptCertificateThrows() {
+        let path = writePEM("-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n")
+        XCTAssertThrowsError(try CACertificates.load(path: path)) { error in
+            guard let ce = error as? CACertificates.CertificateError, case .invalid(_, 1) = ce else {
+                return XCTFail("Expected invalid block 1, got \(error)")
+            }
+        }
+    }
+
+    func testLoadMissingFileThrows() {
+        XCTAssertThrowsError(try CACertificates.load(path: tmpDir + "/missing.pem"))
+    }
+
+    // MARK: - Install Command
+
+    func testInstallCommandWritesAnchorAndUpdatesTrust() throws {
+        let cert = try CACertificates.load(path: writePEM(testCA))[0]
+        let cmd = CACertificates.installCommand(pem: cert.pem, fileName: cert.fileName)
+        XCTAssertTrue(cmd.contains("/etc/pki/ca-trust/source/anchors/containerfy-ffcfb5b167d9ed95.pem"))
+        XCTAssertTrue(cmd.hasSuffix("sudo update-ca-trust"))
+        XCTAssertTrue(cmd.contains(Data(cert.pem.utf8).base64EncodedString()))
+    }
+}
@@ -0,0 +1,42 @@
+import XCTest
+@testable import ContainerfyCore
+
+final class CompletionCommandTests: XCTestCase {
+
+    func testEveryShellCoversCommandsAndFlags() {
+        for shell in CompletionCommand.Shell.allCases {
+            let script = CompletionCommand.script(for: shell)
+            XCTAssertFalse(script.isEmpty, "\(shell)")
+            XCTAssertTrue(script.hasSuffix("\n"), "\(shell)")
+            XCTAssertTrue(script.contains("containerfy completion \(shell.rawValue)"), "\(shell): no install instructions")
+            for command in CompletionCommand.commands {
+                XCTAssertTrue(script.contains(command.name), "\(shell): missing \(command.name)")
+            }
+            // fish names long flags without their dashes
+            let flag = shell == .fish ? "-l dry-run" : "--dry-run"
+            XCTAssertTrue(script.contains(flag), "\(shell): missing pack --dry-run")
+        }
+    }
+
+    func testScriptsAreSyntacticallyPlausible() {
+        let bash = CompletionCommand.script(for: .bash)
+        XCTAssertTrue(bash.contains("complete -o filenames -F _containerfy containerfy"))
+        XCTAssertEqual(bash.components(separatedBy: "case ").count, bash.components(separatedBy: "esac").count)
+        XCTAssertEqual(bash.components(separatedBy: "if [[").count, bash.components(separatedBy: "fi\n").count)
+
+        let zsh = CompletionCommand.script(for: .zsh)
+        XCTAssertTrue(zsh.hasPrefix("#compdef containerfy\n"))
+        XCTAssertTrue(zsh.contains("_describe 'command' commands"))
+
+        let fish = CompletionCommand.script(for: .fish)
+        for line in fish.split(separator: "\n") where !line.hasPrefix("#") {
+            XCTAssertTrue(line.hasPrefix("complete -c containerfy "), String(line))
+            XCTAssertEqual(line.filter { $0 == "'" }.count % 2, 0, "unbalanced quotes: \(line)")
+        }
+    }
+
+    func testRejectsUnknownShell() {
+        XCTAssertEqual(CompletionCommand().run(arguments: ["powershell"]), 1)
+        XCTAssertEqual(CompletionCommand().run(arguments: []), 1)
+    }
+}
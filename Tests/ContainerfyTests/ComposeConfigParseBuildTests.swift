@@ -78,6 +78,49 @@ final class ComposeConfigParseBuildTests: XCTestCase {
         XCTAssertNotNil(config.composeDir)
     }
 
+    // MARK: - Directory Discovery
+
+    func testDirectoryDiscoversDockerComposeYml() throws {
+        _ = writeCompose(validCompose, filename: "docker-compose.yml")
+        let config = try ComposeConfigParser.parseBuild(composePath: tempDir.path)
+        XCTAssertEqual(config.composePath, tempDir.appendingPathComponent("docker-compose.yml").path)
+        XCTAssertEqual(config.composeDir, tempDir.path)
+    }
+
+    func testDirectoryPrefersComposeYamlOverDockerCompose() throws {
+        _ = writeCompose(validCompose, filename: "docker-compose.yml")
+        _ = writeCompose(validCompose, filename: "compose.yaml")
+        let config = try ComposeConfigParser.parseBuild(composePath: tempDir.path)
+        XCTAssertEqual(config.composePath, tempDir.appendingPathComponent("compose.yaml").path)
+    }
+
+    func testDirectoryPrefersComposeYmlOverDockerComposeYaml() throws {
+        _ = writeCompose(validCompose, filename: "docker-compose.yaml")
+        _ = writeCompose(validCompose, filename: "compose.yml")
+        let config = try ComposeConfigParser.parseBuild(composePath: tempDir.path)
+        XCTAssertEqual(config.composePath, tempDir.appendingPathComponent("compose.yml").path)
+    }
+
+    func testDirectoryWithNoComposeFile() {
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: tempDir.path)) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("no compose file found"))
+        }
+    }
+
+    func testDirectoryWithAmbiguousComposeFiles() {
+        _ = writeCompose(validCompose, filename: "compose.yaml")
+        _ = writeCompose(validCompose, filename: "compose.yml")
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: tempDir.path)) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("ambiguous"))
+        }
+    }
+
     // MARK: - Missing x-containerfy
 
     func testMissingXContainerfy() {
@@ -219,6 +262,125 @@ final class ComposeConfigParseBuildTests: XCTestCase {
         }
     }
 
+    private func plistString(_ plist: String, key: String) -> String? {
+        guard let range = plist.range(of: "<key>\(key)</key>\n\t<string>"),
+              let end = plist[range.upperBound...].range(of: "</string>") else { return nil }
+        return String(plist[range.upperBound..<end.lowerBound])
+    }
+
+    func testBuildNumberSetsBundleVersionSeparately() throws {
+        let path = writeCompose(validCompose + "\n  build_number: 42")
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.buildNumber, "42")
+        let plist = BundleAssembler.generateInfoPlist(config: config, composeSHA256: nil, iconFile: nil)
+        XCTAssertEqual(plistString(plist, key: "CFBundleVersion"), "42")
+        XCTAssertEqual(plistString(plist, key: "CFBundleShortVersionString"), "1.0.0")
+
+        let dotted = try ComposeConfigParser.parseBuild(composePath: writeCompose(validCompose + "\n  build_number: \"1.2.42\""))
+        XCTAssertEqual(dotted.buildNumber, "1.2.42")
+    }
+
+    func testBundleVersionDefaultsToVersion() throws {
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(validCompose))
+        XCTAssertNil(config.buildNumber)
+        let plist = BundleAssembler.generateInfoPlist(config: config, composeSHA256: nil, iconFile: nil)
+        XCTAssertEqual(plistString(plist, key: "CFBundleVersion"), "1.0.0")
+        XCTAssertEqual(plistString(plist, key: "CFBundleShortVersionString"), "1.0.0")
+    }
+
+    func testBuildNumberMustBeDottedIntegers() {
+        for (value, shown) in [("\"42-beta\"", "42-beta"), ("\"1.2.3.4\"", "1.2.3.4"), ("1.10", "1.1")] {
+            let path = writeCompose(validCompose + "\n  build_number: \(value)")
+            XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path), value) { error in
+                guard let ce = error as? CError, case .invalidValue("x-containerfy.build_number", shown, _) = ce else {
+                    return XCTFail("Expected invalidValue for build_number \(value), got: \(error)")
+                }
+            }
+        }
+    }
+
+    // MARK: - Compose File Version
+
+    private func composeWithFileVersion(_ version: String?) -> String {
+        """
+        \(version.map { "version: \"\($0)\"" } ?? "")
+        services:
+          web:
+            image: nginx:1.27
+            ports:
+              - "8080:80"
+        \(validXContainerfy)
+        """
+    }
+
+    func testSupportedComposeFileVersionAccepted() throws {
+        for version in ["3.8", "3", "2.4"] {
+            let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(composeWithFileVersion(version)))
+            XCTAssertEqual(config.warnings, [], version)
+        }
+    }
+
+    func testOmittedComposeFileVersionAccepted() throws {
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(composeWithFileVersion(nil)))
+        XCTAssertEqual(config.warnings, [])
+    }
+
+    func testUnsupportedComposeFileVersionWarnsOrFailsWhenStrict() throws {
+        let path = writeCompose(composeWithFileVersion("4.0"))
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.warnings.count, 1)
+        XCTAssertTrue(config.warnings[0].contains("top-level version \"4.0\""), config.warnings[0])
+
+        var options = ComposeConfigParser.BuildOptions()
+        options.strict = true
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path, options: options)) { error in
+            guard let ce = error as? CError, case .invalidValue("version", "4.0", _) = ce else {
+                return XCTFail("Expected invalidValue for version, got: \(error)")
+            }
+        }
+    }
+
+    // MARK: - Minimum Containerfy Version
+
+    func testMinimumVersionOlderThanCurrentPasses() {
+        XCTAssertNoThrow(try ComposeConfigParser.checkMinimumVersion("1.2.0", current: "1.3.0"))
+    }
+
+    func testMinimumVersionEqualToCurrentPasses() {
+        XCTAssertNoThrow(try ComposeConfigParser.checkMinimumVersion("1.3.0", current: "1.3.0"))
+    }
+
+    func testMinimumVersionNewerThanCurrentFails() {
+        XCTAssertThrowsError(try ComposeConfigParser.checkMinimumVersion("1.10.0", current: "1.9.4")) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("upgrade containerfy"))
+        }
+    }
+
+    func testMinimumVersionSkippedForDevelopmentBuild() {
+        XCTAssertNoThrow(try ComposeConfigParser.checkMinimumVersion("99.0.0", current: "0.0.0-dev"))
+    }
+
+    func testMinimumVersionNotSemver() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+        \(validXContainerfy)
+          min_containerfy_version: "latest"
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.min_containerfy_version", "latest", _) = ce else {
+                return XCTFail("Expected invalidValue for min_containerfy_version, got: \(error)")
+            }
+        }
+    }
+
     // MARK: - Missing Required Fields
 
     func testMissingIdentifier() {
@@ -248,7 +410,7 @@ final class ComposeConfigParseBuildTests: XCTestCase {
         let yaml = """
         services:
           web:
-            image: nginx
+            image: nginx:1.27
             ports:
               - "8080:80"
         x-containerfy:
@@ -284,8 +446,8 @@ final class ComposeConfigParseBuildTests: XCTestCase {
         """
         let path = writeCompose(yaml)
         XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
-            guard let ce = error as? CError, case .invalidValue("x-containerfy.vm.cpu.min", "0", _) = ce else {
-                return XCTFail("Expected invalidValue for cpu.min, got: \(error)")
+            guard let ce = error as? CError, case .outOfRange("x-containerfy.vm.cpu.min", "0", _) = ce else {
+                return XCTFail("Expected outOfRange for cpu.min, got: \(error)")
             }
         }
     }
@@ -308,8 +470,8 @@ final class ComposeConfigParseBuildTests: XCTestCase {
         """
         let path = writeCompose(yaml)
         XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
-            guard let ce = error as? CError, case .invalidValue("x-containerfy.vm.cpu.min", "17", _) = ce else {
-                return XCTFail("Expected invalidValue for cpu.min=17, got: \(error)")
+            guard let ce = error as? CError, case .outOfRange("x-containerfy.vm.cpu.min", "17", _) = ce else {
+                return XCTFail("Expected outOfRange for cpu.min=17, got: \(error)")
             }
         }
     }
@@ -332,8 +494,8 @@ final class ComposeConfigParseBuildTests: XCTestCase {
         """
         let path = writeCompose(yaml)
         XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
-            guard let ce = error as? CError, case .invalidValue("x-containerfy.vm.cpu.recommended", "2", _) = ce else {
-                return XCTFail("Expected invalidValue for cpu.recommended, got: \(error)")
+            guard let ce = error as? CError, case .outOfRange("x-containerfy.vm.cpu.recommended", "2", _) = ce else {
+                return XCTFail("Expected outOfRange for cpu.recommended, got: \(error)")
             }
         }
     }
@@ -377,8 +539,8 @@ final class ComposeConfigParseBuildTests: XCTestCase {
         """
         let path = writeCompose(yaml)
         XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
-            guard let ce = error as? CError, case .invalidValue("x-containerfy.vm.memory_mb.min", "256", _) = ce else {
-                return XCTFail("Expected invalidValue for memory_mb.min, got: \(error)")
+            guard let ce = error as? CError, case .outOfRange("x-containerfy.vm.memory_mb.min", "256", _) = ce else {
+                return XCTFail("Expected outOfRange for memory_mb.min, got: \(error)")
             }
         }
     }
@@ -401,8 +563,8 @@ final class ComposeConfigParseBuildTests: XCTestCase {
         """
         let path = writeCompose(yaml)
         XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
-            guard let ce = error as? CError, case .invalidValue("x-containerfy.vm.memory_mb.min", "33000", _) = ce else {
-                return XCTFail("Expected invalidValue for memory_mb.min=33000, got: \(error)")
+            guard let ce = error as? CError, case .outOfRange("x-containerfy.vm.memory_mb.min", "33000", _) = ce else {
+                return XCTFail("Expected outOfRange for memory_mb.min=33000, got: \(error)")
             }
         }
     }
@@ -425,65 +587,109 @@ final class ComposeConfigParseBuildTests: XCTestCase {
         """
         let path = writeCompose(yaml)
         XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
-            guard let ce = error as? CError, case .invalidValue("x-containerfy.vm.disk_mb", "512", _) = ce else {
-                return XCTFail("Expected invalidValue for disk_mb, got: \(error)")
+            guard let ce = error as? CError, case .outOfRange("x-containerfy.vm.disk_mb", "512", _) = ce else {
+                return XCTFail("Expected outOfRange for disk_mb, got: \(error)")
             }
         }
     }
 
-    // MARK: - Hard Rejects
-
-    func testRejectBuild() {
-        let yaml = """
+    private func composeWithDisk(_ diskMB: Int) -> String {
+        """
         services:
           web:
-            build: .
+            image: nginx
             ports:
               - "8080:80"
-        \(validXContainerfy)
+        x-containerfy:
+          name: testapp
+          version: "1.0.0"
+          identifier: com.example.test
+          vm:
+            cpu: { min: 2 }
+            memory_mb: { min: 1024 }
+            disk_mb: \(diskMB)
         """
-        let path = writeCompose(yaml)
+    }
+
+    func testDiskAtMaximumAccepted() throws {
+        let path = writeCompose(composeWithDisk(131072))
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.diskMB, 131072)
+    }
+
+    func testDiskTooLarge() {
+        let path = writeCompose(composeWithDisk(200000))
         XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
-            guard let ce = error as? CError, case .rejected("web", "build:", _) = ce else {
-                return XCTFail("Expected rejected(web, build:), got: \(error)")
+            guard let ce = error as? CError, case .outOfRange("x-containerfy.vm.disk_mb", "200000", _) = ce else {
+                return XCTFail("Expected outOfRange for disk_mb, got: \(error)")
             }
         }
     }
 
-    func testRejectExtends() {
+    func testDiskMaximumOverride() throws {
+        let path = writeCompose(composeWithDisk(200000))
+        var options = ComposeConfigParser.BuildOptions()
+        options.maxDiskMB = 262144
+        let config = try ComposeConfigParser.parseBuild(composePath: path, options: options)
+        XCTAssertEqual(config.diskMB, 200000)
+    }
+
+    // MARK: - Aggregated Errors
+
+    func testAllValidationErrorsReportedTogether() {
         let yaml = """
         services:
+          api:
+            image: example/api:1.0
+            build: .
+          db:
+            image: postgres:16
+            volumes:
+              - ./data:/var/lib/postgresql/data
           web:
-            image: nginx
-            extends:
-              service: base
+            image: nginx:1.27
             ports:
               - "8080:80"
-        \(validXContainerfy)
+        x-containerfy:
+          name: "1badname"
+          version: "not-semver"
+          identifier: com.example.test
+          vm:
+            cpu: { min: 2 }
+            memory_mb: { min: 1024 }
+            disk_mb: 4096
         """
         let path = writeCompose(yaml)
         XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
-            guard let ce = error as? CError, case .rejected("web", "extends:", _) = ce else {
-                return XCTFail("Expected rejected(web, extends:), got: \(error)")
+            guard let ce = error as? CError, case .multiple(let errors) = ce else {
+                return XCTFail("Expected multiple errors, got: \(error)")
             }
+            let messages = errors.map(\.errorDescription)
+            XCTAssertEqual(messages, [
+                CError.invalidValue("x-containerfy.name", "1badname", "must match ^[a-zA-Z][a-zA-Z0-9-]{0,63}$").errorDescription,
+                CError.invalidValue("x-containerfy.version", "not-semver", "not valid semver").errorDescription,
+                CError.rejected("api", "build:", "use pre-built images only").errorDescription,
+                CError.rejected("db", "bind mount volume \"./data:/var/lib/postgresql/data\"", "only named volumes are supported").errorDescription,
+            ])
+            XCTAssertTrue(ce.localizedDescription.hasPrefix("4 problems:\n  - x-containerfy.name"))
         }
     }
 
-    func testRejectProfiles() {
+    // MARK: - Hard Rejects
+
+    func testRejectBuild() {
         let yaml = """
         services:
           web:
-            image: nginx
-            profiles:
-              - debug
+            build: .
             ports:
               - "8080:80"
         \(validXContainerfy)
         """
         let path = writeCompose(yaml)
         XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
-            guard let ce = error as? CError, case .rejected("web", "profiles:", _) = ce else {
-                return XCTFail("Expected rejected(web, profiles:), got: \(error)")
+            guard let ce = error as? CError, case .rejected("web", "build:", _) = ce else {
+                return XCTFail("Expected rejected(web, build:), got: \(error)")
             }
         }
     }
@@ -617,88 +823,216 @@ final class ComposeConfigParseBuildTests: XCTestCase {
         XCTAssertEqual(config.name, "testapp")
     }
 
-    // MARK: - env_file
+    // MARK: - Profiles
 
-    func testEnvFileString() throws {
-        writeEnvFile(".env")
-        let yaml = """
+    private let profilesCompose = """
+    services:
+      web:
+        image: nginx:1.27
+        ports:
+          - "8080:80"
+      debug:
+        image: example/debug:1.0
+        profiles: [debug]
+        ports:
+          - "9000:9000"
+      metrics:
+        image: example/metrics:1.0
+        profiles: [ops, monitoring]
+    """
+
+    func testInactiveProfileServicesSkipped() throws {
+        let path = writeCompose(profilesCompose + "\n" + validXContainerfy)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.serviceSpecs.map(\.name), ["web"])
+        XCTAssertEqual(config.images, ["nginx:1.27"])
+        XCTAssertEqual(config.portMappings.map(\.hostPort), [8080])
+        let rendered = try XCTUnwrap(config.renderedCompose)
+        XCTAssertFalse(rendered.contains("debug"), rendered)
+    }
+
+    func testActivatedProfilesIncluded() throws {
+        let path = writeCompose(profilesCompose + "\n" + validXContainerfy)
+        var options = ComposeConfigParser.BuildOptions()
+        options.profiles = ["debug", "monitoring"]
+        let config = try ComposeConfigParser.parseBuild(composePath: path, options: options)
+        XCTAssertEqual(config.serviceSpecs.map(\.name), ["debug", "metrics", "web"])
+        XCTAssertEqual(Set(config.portMappings.map(\.hostPort)), [8080, 9000])
+        let rendered = try XCTUnwrap(config.renderedCompose)
+        XCTAssertFalse(rendered.contains("profiles"), rendered)
+    }
+
+    // MARK: - restart
+
+    private func composeWithRestart(_ policy: String) -> String {
+        """
         services:
           web:
-            image: nginx
+            image: nginx:1.27
             ports:
               - "8080:80"
-            env_file: .env
+            restart: \(policy)
         \(validXContainerfy)
         """
-        let path = writeCompose(yaml)
-        let config = try ComposeConfigParser.parseBuild(composePath: path)
-        XCTAssertEqual(config.envFiles.count, 1)
-        XCTAssertTrue(config.envFiles[0].hasSuffix(".env"))
     }
 
-    func testEnvFileArray() throws {
-        writeEnvFile(".env")
-        writeEnvFile("app.env")
+    func testRestartPoliciesAccepted() throws {
+        for (policy, expected) in [("always", "always"), ("on-failure", "on-failure"), ("on-failure:3", "on-failure:3"), ("unless-stopped", "unless-stopped")] {
+            let path = writeCompose(composeWithRestart(policy))
+            let config = try ComposeConfigParser.parseBuild(composePath: path)
+            XCTAssertEqual(config.serviceSpecs.first?.restart, expected, policy)
+            XCTAssertTrue(config.warnings.isEmpty, policy)
+        }
+    }
+
+    func testRestartNoWarns() throws {
+        for policy in ["\"no\"", "no"] {
+            let path = writeCompose(composeWithRestart(policy))
+            let config = try ComposeConfigParser.parseBuild(composePath: path)
+            XCTAssertEqual(config.serviceSpecs.first?.restart, "no", policy)
+            XCTAssertEqual(config.warnings.count, 1, policy)
+            XCTAssertTrue(config.warnings[0].contains("restart"), config.warnings[0])
+        }
+    }
+
+    func testUnknownRestartPolicyRejected() {
+        for policy in ["sometimes", "always:3", "on-failure:0"] {
+            let path = writeCompose(composeWithRestart(policy))
+            XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path), policy) { error in
+                guard let ce = error as? CError, case .invalidValue("services.web.restart", policy, _) = ce else {
+                    return XCTFail("Expected invalidValue for \(policy), got: \(error)")
+                }
+            }
+        }
+    }
+
+    // MARK: - platform
+
+    func testMixedArchitecturePlatformsPerService() throws {
         let yaml = """
         services:
-          web:
-            image: nginx
+          app:
+            image: ghcr.io/acme/app:1.0
+            platform: linux/arm64
             ports:
               - "8080:80"
-            env_file:
-              - .env
-              - app.env
+          helper:
+            image: ghcr.io/acme/legacy-helper:2.3
+            platform: linux/amd64
+          cache:
+            image: redis:7
         \(validXContainerfy)
         """
-        let path = writeCompose(yaml)
-        let config = try ComposeConfigParser.parseBuild(composePath: path)
-        XCTAssertEqual(config.envFiles.count, 2)
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))
+        let platforms = Dictionary(uniqueKeysWithValues: config.serviceSpecs.map { ($0.name, $0.platform) })
+        XCTAssertEqual(platforms["app"], "linux/arm64")
+        XCTAssertEqual(platforms["helper"], "linux/amd64")
+        XCTAssertEqual(platforms["cache"], .some(nil))
+        XCTAssertEqual(config.warnings.count, 1, "\(config.warnings)")
+        XCTAssertTrue(config.warnings[0].contains("app: linux/arm64, helper: linux/amd64"), config.warnings[0])
+        XCTAssertTrue(PackCommand.configText(config).contains("platform: linux/amd64"))
     }
 
-    func testEnvFileDictWithPath() throws {
-        writeEnvFile("custom.env")
+    func testSamePlatformEverywhereDoesNotWarn() throws {
+        let yaml = """
+        services:
+          app:
+            image: ghcr.io/acme/app:1.0
+            platform: linux/arm64/v8
+            ports:
+              - "8080:80"
+          worker:
+            image: ghcr.io/acme/worker:1.0
+            platform: linux/arm64
+        \(validXContainerfy)
+        """
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))
+        XCTAssertEqual(config.serviceSpecs.map(\.platform), ["linux/arm64/v8", "linux/arm64"])
+        XCTAssertTrue(config.warnings.isEmpty, "\(config.warnings)")
+    }
+
+    func testUnsupportedPlatformRejected() {
+        for platform in ["windows/amd64", "linux/s390x", "arm64"] {
+            let yaml = """
+            services:
+              web:
+                image: nginx:1.27
+                platform: \(platform)
+                ports:
+                  - "8080:80"
+            \(validXContainerfy)
+            """
+            XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml)), platform) { error in
+                guard let ce = error as? CError, case .invalidValue("services.web.platform", platform, _) = ce else {
+                    return XCTFail("Expected invalidValue for platform \(platform), got: \(error)")
+                }
+            }
+        }
+    }
+
+    // MARK: - depends_on
+
+    func testDependsOnStartupOrder() throws {
         let yaml = """
         services:
           web:
             image: nginx
             ports:
               - "8080:80"
-            env_file:
-              - path: custom.env
+            depends_on:
+              api:
+                condition: service_healthy
+          api:
+            image: example/api:1.0
+            depends_on: [db, cache]
+          db:
+            image: postgres:16
+          cache:
+            image: redis:7
         \(validXContainerfy)
         """
         let path = writeCompose(yaml)
         let config = try ComposeConfigParser.parseBuild(composePath: path)
-        XCTAssertEqual(config.envFiles.count, 1)
-        XCTAssertTrue(config.envFiles[0].hasSuffix("custom.env"))
+        XCTAssertEqual(config.startupOrder, ["cache", "db", "api", "web"])
+        XCTAssertEqual(config.serviceSpecs.first { $0.name == "api" }?.dependsOn, ["cache", "db"])
+        XCTAssertEqual(RuntimeConfig(config: config).startupOrder, ["cache", "db", "api", "web"])
     }
 
-    func testEnvFileNotFoundThrows() {
+    func testDependsOnMissingServiceRejected() {
         let yaml = """
         services:
           web:
             image: nginx
             ports:
               - "8080:80"
-            env_file: missing.env
+            depends_on:
+              - databse
         \(validXContainerfy)
         """
         let path = writeCompose(yaml)
         XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
-            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
-                return XCTFail("Expected validationFailed for missing env_file, got: \(error)")
+            guard let ce = error as? CError, case .invalidValue(let field, let value, _) = ce else {
+                return XCTFail("Expected invalidValue, got: \(error)")
             }
-            XCTAssertTrue(msg.contains("missing.env"), "Error should mention the missing file")
+            XCTAssertEqual(field, "services.web.depends_on")
+            XCTAssertEqual(value, "databse")
         }
     }
 
-    // MARK: - No Exposed Ports
-
-    func testNoExposedPortsError() {
+    func testDependsOnCycleRejected() {
         let yaml = """
         services:
-          worker:
-            image: myworker
+          a:
+            image: nginx
+            ports:
+              - "8080:80"
+            depends_on: [b]
+          b:
+            image: nginx
+            depends_on: [c]
+          c:
+            image: nginx
+            depends_on: [a]
         \(validXContainerfy)
         """
         let path = writeCompose(yaml)
@@ -706,47 +1040,2612 @@ final class ComposeConfigParseBuildTests: XCTestCase {
             guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
                 return XCTFail("Expected validationFailed, got: \(error)")
             }
-            XCTAssertTrue(msg.contains("port"), "Error should mention missing ports")
+            XCTAssertTrue(msg.contains("a -> b -> c -> a"), msg)
         }
     }
 
-    // MARK: - Duplicate Image Deduplication
+    // MARK: - UI
 
-    func testDuplicateImageDedup() throws {
-        let yaml = """
-        services:
-          web1:
-            image: nginx:latest
-            ports:
-              - "8080:80"
-          web2:
-            image: nginx:latest
-            ports:
-              - "8081:80"
-        \(validXContainerfy)
-        """
-        let path = writeCompose(yaml)
+    func testUIBackgroundDefaultsToMenuBarOnly() throws {
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(validCompose))
+        XCTAssertTrue(config.runsInBackground)
+        let plist = BundleAssembler.generateInfoPlist(config: config, composeSHA256: nil, iconFile: nil)
+        XCTAssertTrue(plist.contains("<key>LSUIElement</key>\n\t<true/>"))
+    }
+
+    func testUIBackgroundFalseOmitsLSUIElement() throws {
+        let path = writeCompose(validCompose + "\n  ui:\n    background: false")
         let config = try ComposeConfigParser.parseBuild(composePath: path)
-        XCTAssertEqual(config.images.count, 1)
-        XCTAssertEqual(config.images[0], "nginx:latest")
+        XCTAssertFalse(config.runsInBackground)
+        let plist = BundleAssembler.generateInfoPlist(config: config, composeSHA256: nil, iconFile: nil)
+        XCTAssertFalse(plist.contains("LSUIElement"))
+        XCTAssertNotNil(try PropertyListSerialization.propertyList(from: Data(plist.utf8), format: nil) as? [String: Any])
     }
 
-    func testMultipleDistinctImages() throws {
-        let yaml = """
-        services:
-          web:
-            image: nginx:latest
-            ports:
-              - "8080:80"
-          db:
-            image: postgres:16
-        \(validXContainerfy)
-        """
-        let path = writeCompose(yaml)
+    func testUIBackgroundMustBeBoolean() {
+        let path = writeCompose(validCompose + "\n  ui:\n    background: sometimes")
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.ui.background", _, _) = ce else {
+                return XCTFail("Expected invalidValue for x-containerfy.ui.background, got: \(error)")
+            }
+        }
+    }
+
+    // MARK: - min_macos
+
+    func testMinMacOSDefaultAndOverride() throws {
+        let defaulted = try ComposeConfigParser.parseBuild(composePath: writeCompose(validCompose))
+        XCTAssertNil(defaulted.minimumMacOS)
+        XCTAssertTrue(BundleAssembler.generateInfoPlist(config: defaulted, composeSHA256: nil, iconFile: nil)
+            .contains("<key>LSMinimumSystemVersion</key>\n\t<string>14.0</string>"))
+
+        let path = writeCompose(validCompose + "\n  min_macos: \"15.2\"")
         let config = try ComposeConfigParser.parseBuild(composePath: path)
-        XCTAssertEqual(config.images.count, 2)
-        XCTAssertTrue(config.images.contains("nginx:latest"))
-        XCTAssertTrue(config.images.contains("postgres:16"))
+        XCTAssertEqual(config.minimumMacOS, "15.2")
+        XCTAssertTrue(BundleAssembler.generateInfoPlist(config: config, composeSHA256: nil, iconFile: nil)
+            .contains("<key>LSMinimumSystemVersion</key>\n\t<string>15.2</string>"))
+    }
+
+    func testInvalidMinMacOSRejected() {
+        for value in ["\"13.0\"", "\"fifteen\"", "\"15..1\"", "\"15.1.2.3\""] {
+            let path = writeCompose(validCompose + "\n  min_macos: \(value)")
+            XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path), value) { error in
+                guard let ce = error as? CError, case .invalidValue("x-containerfy.min_macos", _, _) = ce else {
+                    return XCTFail("Expected invalidValue for x-containerfy.min_macos, got: \(error)")
+                }
+            }
+        }
+    }
+
+    // MARK: - category
+
+    func testCategoryWrittenToPlist() throws {
+        let defaulted = try ComposeConfigParser.parseBuild(composePath: writeCompose(validCompose))
+        XCTAssertFalse(BundleAssembler.generateInfoPlist(config: defaulted, composeSHA256: nil, iconFile: nil).contains("LSApplicationCategoryType"))
+
+        let path = writeCompose(validCompose + "\n  category: public.app-category.developer-tools")
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.category, "public.app-category.developer-tools")
+        XCTAssertTrue(BundleAssembler.generateInfoPlist(config: config, composeSHA256: nil, iconFile: nil)
+            .contains("<key>LSApplicationCategoryType</key>\n\t<string>public.app-category.developer-tools</string>"))
+    }
+
+    func testUnknownCategoryRejected() {
+        let path = writeCompose(validCompose + "\n  category: developer-tools")
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.category", "developer-tools", _) = ce else {
+                return XCTFail("Expected invalidValue for x-containerfy.category, got: \(error)")
+            }
+        }
+    }
+
+    // MARK: - Info.plist Extras
+
+    func testPlistExtrasMergedIntoInfoPlist() throws {
+        let path = writeCompose(validCompose + """
+
+          plist:
+            NSUserNotificationAlertStyle: alert
+            NSAppTransportSecurity:
+              NSAllowsLocalNetworking: true
+              NSExceptionDomains:
+                example.com: { NSIncludesSubdomains: true, NSExceptionMinimumTLSVersion: "TLSv1.2" }
+            CFBundleURLTypes:
+              - CFBundleURLName: com.example.testapp
+                CFBundleURLSchemes: [testapp]
+            LSUIElement: false
+        """)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.infoPlistExtras["NSUserNotificationAlertStyle"], .string("alert"))
+        XCTAssertNil(config.infoPlistExtras["LSUIElement"])
+        XCTAssertTrue(config.warnings.contains { $0.contains("x-containerfy.plist.LSUIElement is ignored") && $0.contains("x-containerfy.ui.background") })
+
+        let xml = BundleAssembler.generateInfoPlist(config: config, composeSHA256: nil, iconFile: nil)
+        let plist = try XCTUnwrap(
+            PropertyListSerialization.propertyList(from: Data(xml.utf8), format: nil) as? [String: Any]
+        )
+        XCTAssertEqual(plist["NSUserNotificationAlertStyle"] as? String, "alert")
+        XCTAssertEqual(plist["LSUIElement"] as? Bool, true)
+        let ats = try XCTUnwrap(plist["NSAppTransportSecurity"] as? [String: Any])
+        XCTAssertEqual(ats["NSAllowsLocalNetworking"] as? Bool, true)
+        let domain = try XCTUnwrap((ats["NSExceptionDomains"] as? [String: Any])?["example.com"] as? [String: Any])
+        XCTAssertEqual(domain["NSExceptionMinimumTLSVersion"] as? String, "TLSv1.2")
+        let urlTypes = try XCTUnwrap(plist["CFBundleURLTypes"] as? [[String: Any]])
+        XCTAssertEqual(urlTypes.first?["CFBundleURLSchemes"] as? [String], ["testapp"])
+    }
+
+    func testPlistNullValueRejected() {
+        let path = writeCompose(validCompose + "\n  plist:\n    NSCameraUsageDescription: null")
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.plist.NSCameraUsageDescription", _, _) = ce else {
+                return XCTFail("Expected invalidValue for x-containerfy.plist, got: \(error)")
+            }
+        }
+    }
+
+    // MARK: - Update Feed
+
+    private let edKey = Data(repeating: 7, count: 32).base64EncodedString()
+
+    private func updateCompose(feedURL: String, key: String) -> String {
+        validCompose + "\n  update:\n    feed_url: \"\(feedURL)\"\n    public_ed_key: \"\(key)\""
+    }
+
+    func testUpdateFeedWrittenToInfoPlist() throws {
+        let path = writeCompose(updateCompose(feedURL: "https://updates.example.com/appcast.xml", key: edKey))
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.updateFeed, UpdateFeed(feedURL: "https://updates.example.com/appcast.xml", publicEDKey: edKey))
+        let plist = BundleAssembler.generateInfoPlist(config: config, composeSHA256: nil, iconFile: nil)
+        XCTAssertTrue(plist.contains("<key>SUFeedURL</key>\n\t<string>https://updates.example.com/appcast.xml</string>"), plist)
+        XCTAssertTrue(plist.contains("<key>SUPublicEDKey</key>\n\t<string>\(edKey)</string>"), plist)
+    }
+
+    func testUpdateKeysAbsentWithoutBlock() throws {
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(validCompose))
+        XCTAssertNil(config.updateFeed)
+        let plist = BundleAssembler.generateInfoPlist(config: config, composeSHA256: nil, iconFile: nil)
+        XCTAssertFalse(plist.contains("SUFeedURL"))
+        XCTAssertFalse(plist.contains("SUPublicEDKey"))
+    }
+
+    func testUpdateFeedURLMustBeHTTPS() {
+        let path = writeCompose(updateCompose(feedURL: "http://updates.example.com/appcast.xml", key: edKey))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.update.feed_url", _, _) = ce else {
+                return XCTFail("Expected invalidValue for feed_url, got: \(error)")
+            }
+        }
+    }
+
+    func testUpdatePublicKeyMustBeBase64EdDSAKey() {
+        let path = writeCompose(updateCompose(feedURL: "https://updates.example.com/appcast.xml", key: "not base64!"))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.update.public_ed_key", _, _) = ce else {
+                return XCTFail("Expected invalidValue for public_ed_key, got: \(error)")
+            }
+        }
+    }
+
+    // MARK: - Volume Limits
+
+    func testVolumeLimitsParsedAndUnlimitedVolumeWarned() throws {
+        let yaml = """
+        services:
+          web:
+            image: nginx:1.27
+            ports:
+              - "8080:80"
+            volumes:
+              - db:/var/lib/db
+              - cache:/cache
+        volumes:
+          db:
+          cache:
+        \(validXContainerfy)
+          volumes:
+            db:
+              max_mb: 2048
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.volumeLimitsMB, ["db": 2048])
+        XCTAssertEqual(config.warnings.count, 1)
+        XCTAssertTrue(config.warnings[0].contains("\"cache\""), config.warnings[0])
+        XCTAssertEqual(RuntimeConfig(config: config).vm.volumeLimitsMB, ["db": 2048])
+    }
+
+    func testVolumeLimitsOverDiskBudgetRejected() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            volumes:
+              - db:/var/lib/db
+              - media:/media
+        volumes:
+          db:
+          media:
+        \(validXContainerfy)
+          volumes:
+            db:
+              max_mb: 2048
+            media:
+              max_mb: 1500
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("3548 MB"), msg)
+            XCTAssertTrue(msg.contains("3072 MB"), msg)
+        }
+    }
+
+    func testVolumeLimitForUndeclaredVolumeRejected() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+        \(validXContainerfy)
+          volumes:
+            db:
+              max_mb: 512
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.volumes.db", _, _) = ce else {
+                return XCTFail("Expected invalidValue for x-containerfy.volumes.db, got: \(error)")
+            }
+        }
+    }
+
+    private func seedCompose(_ entry: String) -> String {
+        """
+        services:
+          db:
+            image: postgres:16
+            ports:
+              - "5432:5432"
+            volumes:
+              - pgdata:/var/lib/postgresql/data
+        volumes:
+          pgdata:
+        \(validXContainerfy)
+          volumes:
+            pgdata:
+        \(entry)
+        """
+    }
+
+    func testVolumeSeedResolvedAndRecordedForRuntime() throws {
+        let seedDir = tempDir.appendingPathComponent("seed/pgdata")
+        try FileManager.default.createDirectory(at: seedDir, withIntermediateDirectories: true)
+        FileManager.default.createFile(atPath: seedDir.appendingPathComponent("init.sql").path, contents: Data(count: 100))
+
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(seedCompose("      seed: ./seed/pgdata")))
+        XCTAssertEqual(config.volumeSeeds.map(\.volume), ["pgdata"])
+        XCTAssertEqual(config.volumeSeeds.first?.podmanName, "resources_pgdata")
+        XCTAssertEqual(
+            config.volumeSeeds.first.map { ($0.source as NSString).resolvingSymlinksInPath },
+            (seedDir.path as NSString).resolvingSymlinksInPath
+        )
+        XCTAssertTrue(config.volumeLimitsMB.isEmpty)
+        XCTAssertTrue(config.warnings.contains { $0.contains("\"pgdata\"") }, "\(config.warnings)")
+        XCTAssertEqual(RuntimeConfig(config: config).vm.volumeSeeds, ["pgdata": "resources_pgdata"])
+        XCTAssertEqual(InstalledPaths.make(config: config).files, ["state.json", "seed-pgdata.tar"])
+    }
+
+    func testVolumeSeedMissingDirectoryRejected() {
+        let path = writeCompose(seedCompose("      max_mb: 512\n      seed: ./seed/missing"))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue(let field, _, let reason) = ce else {
+                return XCTFail("Expected invalidValue, got: \(error)")
+            }
+            XCTAssertEqual(field, "x-containerfy.volumes.pgdata.seed")
+            XCTAssertTrue(reason.hasPrefix("no such directory: /") && reason.hasSuffix("seed/missing"), reason)
+        }
+    }
+
+    func testVolumeSeedLargerThanLimitRejected() throws {
+        let seedDir = tempDir.appendingPathComponent("seed/pgdata")
+        try FileManager.default.createDirectory(at: seedDir, withIntermediateDirectories: true)
+        FileManager.default.createFile(atPath: seedDir.appendingPathComponent("dump.sql").path, contents: Data(count: 1024 * 1024 + 1))
+
+        let path = writeCompose(seedCompose("      max_mb: 1\n      seed: ./seed/pgdata"))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.volumes.pgdata.seed", _, let reason) = ce else {
+                return XCTFail("Expected invalidValue for the seed, got: \(error)")
+            }
+            XCTAssertTrue(reason.contains("2 MB"), reason)
+        }
+    }
+
+    // MARK: - Labels
+
+    func testLabelsParsed() throws {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+        \(validXContainerfy)
+          labels:
+            team: platform
+            cost-center: "1234"
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.labels, ["team": "platform", "cost-center": "1234"])
+    }
+
+    func testLabelsDefaultEmpty() throws {
+        let path = writeCompose(validCompose)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertTrue(config.labels.isEmpty)
+    }
+
+    func testLabelsRejectNonStringValue() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+        \(validXContainerfy)
+          labels:
+            cost-center: 1234
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.labels.cost-center", _, _) = ce else {
+                return XCTFail("Expected invalidValue for labels.cost-center, got: \(error)")
+            }
+        }
+    }
+
+    func testLabelsRejectInvalidKey() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+        \(validXContainerfy)
+          labels:
+            "bad key!": value
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.labels", "bad key!", _) = ce else {
+                return XCTFail("Expected invalidValue for labels key, got: \(error)")
+            }
+        }
+    }
+
+    // MARK: - Capabilities
+
+    func testCapabilitiesNormalized() throws {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            cap_add:
+              - CAP_NET_ADMIN
+              - net_bind_service
+            cap_drop:
+              - ALL
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.serviceSpecs.count, 1)
+        XCTAssertEqual(config.serviceSpecs[0].capAdd, ["NET_ADMIN", "NET_BIND_SERVICE"])
+        XCTAssertEqual(config.serviceSpecs[0].capDrop, ["ALL"])
+    }
+
+    func testUnknownCapabilityRejected() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            cap_add:
+              - NET_WIZARD
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("services.web.cap_add", "NET_WIZARD", _) = ce else {
+                return XCTFail("Expected invalidValue for cap_add, got: \(error)")
+            }
+        }
+    }
+
+    private func composeWithPrivilegedService(_ setting: String) -> String {
+        """
+        services:
+          web:
+            image: nginx:1.27
+            ports:
+              - "8080:80"
+            \(setting)
+        \(validXContainerfy)
+        """
+    }
+
+    func testPrivilegedRejected() {
+        let path = writeCompose(composeWithPrivilegedService("privileged: true"))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .rejected("web", "privileged: true", let reason) = ce else {
+                return XCTFail("Expected ComposeError.rejected for privileged, got: \(error)")
+            }
+            XCTAssertTrue(reason.contains("--allow-privileged"))
+        }
+    }
+
+    func testPrivilegedCapabilityRejected() {
+        let path = writeCompose(composeWithPrivilegedService("cap_add: [NET_ADMIN, cap_sys_admin]"))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .rejected("web", "cap_add: SYS_ADMIN", _) = ce else {
+                return XCTFail("Expected ComposeError.rejected for cap_add, got: \(error)")
+            }
+        }
+    }
+
+    func testAllowPrivilegedWarnsInstead() throws {
+        var options = ComposeConfigParser.BuildOptions()
+        options.allowPrivileged = true
+        let privileged = try ComposeConfigParser.parseBuild(
+            composePath: writeCompose(composeWithPrivilegedService("privileged: true")), options: options
+        )
+        XCTAssertEqual(privileged.warnings.count, 1)
+        XCTAssertTrue(privileged.warnings[0].contains("runs privileged"))
+
+        let capability = try ComposeConfigParser.parseBuild(
+            composePath: writeCompose(composeWithPrivilegedService("cap_add: [SYS_MODULE]"), filename: "other.yml"), options: options
+        )
+        XCTAssertEqual(capability.serviceSpecs[0].capAdd, ["SYS_MODULE"])
+        XCTAssertEqual(capability.warnings.count, 1)
+    }
+
+    // MARK: - container_name
+
+    private func composeWithContainerNames(_ web: String, _ worker: String) -> String {
+        """
+        services:
+          web:
+            image: nginx:1.27
+            container_name: \(web)
+            ports:
+              - "8080:80"
+          worker:
+            image: nginx:1.27
+            container_name: \(worker)
+        \(validXContainerfy)
+        """
+    }
+
+    func testContainerNamesParsed() throws {
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(composeWithContainerNames("my-web", "my-worker")))
+        XCTAssertEqual(config.serviceSpecs.map(\.containerName), ["my-web", "my-worker"])
+    }
+
+    func testDuplicateContainerNamesRejected() {
+        let path = writeCompose(composeWithContainerNames("shared", "shared"))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("\"shared\" (services web, worker)"), msg)
+        }
+    }
+
+    func testReservedContainerNameRejected() {
+        let path = writeCompose(composeWithContainerNames("containerfy-web", "worker"))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("services.web.container_name", "containerfy-web", _) = ce else {
+                return XCTFail("Expected invalidValue for container_name, got: \(error)")
+            }
+        }
+    }
+
+    // MARK: - Anchors and Merge Keys
+
+    func testMergeKeysExpandedAtBuild() throws {
+        let yaml = """
+        x-base: &base
+          image: nginx:1.25
+          cap_drop:
+            - ALL
+        services:
+          web:
+            <<: *base
+            ports:
+              - "8080:80"
+          worker:
+            <<: *base
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.images, ["nginx:1.25"])
+        XCTAssertEqual(config.serviceSpecs.map(\.name), ["web", "worker"])
+        XCTAssertEqual(config.serviceSpecs.map(\.image), ["nginx:1.25", "nginx:1.25"])
+        XCTAssertEqual(config.serviceSpecs[1].capDrop, ["ALL"])
+    }
+
+    func testMergeKeyLocalValuesOverrideDefaults() throws {
+        let yaml = """
+        x-defaults: &defaults
+          image: nginx:1.25
+          restart: unless-stopped
+          ports:
+            - "8080:80"
+        services:
+          web:
+            <<: *defaults
+          api:
+            <<: *defaults
+            image: ghcr.io/acme/api:2.0
+            ports:
+              - "9090:9000"
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.serviceSpecs.map(\.image), ["nginx:1.25", "ghcr.io/acme/api:2.0"])
+        XCTAssertEqual(Set(config.images), ["nginx:1.25", "ghcr.io/acme/api:2.0"])
+        XCTAssertEqual(config.portMappings.map(\.hostPort).sorted(), [8080, 9090])
+    }
+
+    func testAnchorSharedAcrossServices() throws {
+        let yaml = """
+        services:
+          web:
+            image: &image nginx:1.25
+            ports: &ports
+              - "8080:80"
+          worker:
+            image: *image
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.images, ["nginx:1.25"])
+        XCTAssertEqual(config.serviceSpecs.map(\.image), ["nginx:1.25", "nginx:1.25"])
+        XCTAssertEqual(config.portMappings.map(\.hostPort), [8080])
+    }
+
+    func testMergeKeyInXContainerfy() throws {
+        let yaml = """
+        x-vm: &vm
+          cpu:
+            min: 2
+            recommended: 4
+          memory_mb:
+            min: 2048
+            recommended: 4096
+          disk_mb: 10000
+        services:
+          web:
+            image: nginx:1.25
+        x-containerfy:
+          name: merged
+          version: "1.0.0"
+          identifier: com.example.merged
+          vm:
+            <<: *vm
+            disk_mb: 20000
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.cpuRecommended, 4)
+        XCTAssertEqual(config.diskMB, 20000)
+    }
+
+    func testMergeOfNonMapRejected() {
+        let yaml = """
+        x-image: &image nginx:1.25
+        services:
+          web:
+            <<: *image
+            ports:
+              - "8080:80"
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("services.web.<<", "nginx:1.25", _) = ce else {
+                return XCTFail("Expected invalidValue for the merge key, got: \(error)")
+            }
+        }
+    }
+
+    func testUndefinedAliasRejected() {
+        let yaml = """
+        services:
+          web:
+            <<: *missing
+            image: nginx:1.25
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .validationFailed(let message) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(message.contains("docker-compose.yml line 3: alias *missing has no matching anchor (&missing)"), message)
+        }
+    }
+
+    // MARK: - Port Validation
+
+    func testOutOfRangePortRejected() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "70000:80"
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .outOfRange("services.web.ports", "70000:80", _) = ce else {
+                return XCTFail("Expected outOfRange for ports, got: \(error)")
+            }
+        }
+    }
+
+    func testNonNumericPortRejected() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "abc:80"
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("services.web.ports", "abc:80", _) = ce else {
+                return XCTFail("Expected invalidValue for ports, got: \(error)")
+            }
+        }
+    }
+
+    func testPrivilegedPortWarns() throws {
+        let yaml = """
+        services:
+          web:
+            image: nginx:1.27
+            ports:
+              - "80:80"
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.portMappings.count, 1)
+        XCTAssertEqual(config.warnings.count, 1)
+        XCTAssertTrue(config.warnings[0].contains("80"))
+    }
+
+    func testPrivilegedPortRejectedWhenStrict() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "80:80"
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        var options = ComposeConfigParser.BuildOptions()
+        options.strict = true
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path, options: options)) { error in
+            guard let ce = error as? CError, case .invalidValue("services.web.ports", "80:80", _) = ce else {
+                return XCTFail("Expected invalidValue for ports, got: \(error)")
+            }
+        }
+    }
+
+    func testHostPortPublishedByTwoServicesRejected() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+          api:
+            image: myapi:1.0
+            ports:
+              - "127.0.0.1:8080:3000"
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("8080"))
+            XCTAssertTrue(msg.contains("\"api\" and \"web\""))
+        }
+    }
+
+    func testSameHostPortOverTCPAndUDPAllowed() throws {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+          dns:
+            image: coredns/coredns
+            ports:
+              - "8080:53/udp"
+              - "5353:53/udp"
+        \(validXContainerfy)
+        """
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))
+        XCTAssertEqual(config.portMappings.filter { $0.protocol == "udp" }.count, 2)
+    }
+
+    func testHealthcheckOnUDPOnlyPortRejected() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+              - "5353:53/udp"
+        \(validXContainerfy)
+          healthcheck:
+            url: http://127.0.0.1:5353/health
+        """
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.healthcheck.url", _, _) = ce else {
+                return XCTFail("Expected invalidValue for healthcheck.url, got: \(error)")
+            }
+        }
+    }
+
+    private func portsCompose(_ entry: String) -> String {
+        """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "\(entry)"
+        \(validXContainerfy)
+        """
+    }
+
+    func testSinglePortStillParses() throws {
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(portsCompose("127.0.0.1:8080:80")))
+        XCTAssertEqual(config.portMappings, [PortMapping(hostPort: 8080, containerPort: 80)])
+    }
+
+    func testPortRangePublishesEachPort() throws {
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(portsCompose("8000-8002:9000-9002/tcp")))
+        XCTAssertEqual(config.portMappings, [
+            PortMapping(hostPort: 8000, containerPort: 9000),
+            PortMapping(hostPort: 8001, containerPort: 9001),
+            PortMapping(hostPort: 8002, containerPort: 9002),
+        ])
+
+        let same = try ComposeConfigParser.parseBuild(composePath: writeCompose(portsCompose("8000-8001")))
+        XCTAssertEqual(same.portMappings.map(\.hostPort), [8000, 8001])
+        XCTAssertEqual(same.portMappings.map(\.containerPort), [8000, 8001])
+    }
+
+    func testTooManyPublishedPortsRejected() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "10000-10599:10000-10599"
+          api:
+            image: nginx
+            ports:
+              - "20000-20599:20000-20599"
+        \(validXContainerfy)
+        """
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))) { error in
+            guard let ce = error as? CError, case .validationFailed(let message) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(message.contains("1200 host ports"), message)
+            XCTAssertTrue(message.contains("limit of \(ComposeConfigParser.maxPublishedPorts)"), message)
+        }
+
+        // Exactly at the limit is fine
+        let atLimit = portsCompose("10000-\(10000 + ComposeConfigParser.maxPublishedPorts - 1)")
+        XCTAssertNoThrow(try ComposeConfigParser.parseBuild(composePath: writeCompose(atLimit)))
+    }
+
+    func testMalformedPortRangesRejected() {
+        for entry in ["8000-8005:9000-9001", "8005-8000:8005-8000", "8000-9100:8000-9100", "8000-:80", "8000-8001-8002:80"] {
+            let path = writeCompose(portsCompose(entry))
+            XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path), entry) { error in
+                guard let ce = error as? CError, case .invalidValue("services.web.ports", entry, _) = ce else {
+                    return XCTFail("Expected invalidValue for \(entry), got: \(error)")
+                }
+            }
+        }
+    }
+
+    // MARK: - Pinned Images
+
+    func testUnpinnedImagesWarn() throws {
+        let yaml = """
+        services:
+          web:
+            image: nginx:latest
+            ports:
+              - "8080:80"
+          db:
+            image: postgres
+          cache:
+            image: registry.local:5000/redis:7.2
+          worker:
+            image: myorg/worker@sha256:\(String(repeating: "a", count: 64))
+        \(validXContainerfy)
+        """
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))
+        XCTAssertEqual(config.warnings.count, 2)
+        XCTAssertTrue(config.warnings.contains { $0.contains("nginx:latest") })
+        XCTAssertTrue(config.warnings.contains { $0.contains("\"db\"") })
+    }
+
+    func testUnpinnedImageRejectedWhenRequired() {
+        var options = ComposeConfigParser.BuildOptions()
+        options.requirePinned = true
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: writeCompose(validCompose), options: options)) { error in
+            guard let ce = error as? CError, case .invalidValue("services.web.image", "nginx:latest", _) = ce else {
+                return XCTFail("Expected invalidValue for image, got: \(error)")
+            }
+        }
+    }
+
+    // MARK: - JSON Compose
+
+    func testJSONComposeByExtension() throws {
+        let json = """
+        {
+          "services": {"web": {"image": "nginx", "ports": ["8080:80"]}},
+          "x-containerfy": {
+            "name": "testapp", "version": "1.0.0", "identifier": "com.example.testapp",
+            "vm": {"cpu": {"min": 2}, "memory_mb": {"min": 1024}, "disk_mb": 4096}
+          }
+        }
+        """
+        let path = writeCompose(json, filename: "compose.json")
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.name, "testapp")
+        XCTAssertEqual(config.portMappings.first?.hostPort, 8080)
+    }
+
+    func testMalformedJSONComposeReportsJSONError() {
+        let path = writeCompose("{\"services\": {", filename: "compose.json")
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("not valid JSON"))
+        }
+    }
+
+    // MARK: - Identifier
+
+    private func identifierCompose(_ identifier: String) -> String {
+        validCompose.replacingOccurrences(of: "identifier: com.example.testapp", with: "identifier: \"\(identifier)\"")
+    }
+
+    func testRepositoryURLIdentifiersAreConverted() throws {
+        let cases = [
+            "com.example.testapp": "com.example.testapp",
+            "github.com/acme/my-app": "com.github.acme.my-app",
+            "https://github.com/acme/my-app.git": "com.github.acme.my-app",
+            "acme/my-app": "acme.my-app",
+        ]
+        for (raw, expected) in cases {
+            let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(identifierCompose(raw)))
+            XCTAssertEqual(config.identifier, expected, raw)
+        }
+    }
+
+    func testInvalidIdentifiersRejected() {
+        for raw in ["myapp", "com.example.my_app", "com example app", "github.com/acme/my_app", "com..example"] {
+            XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: writeCompose(identifierCompose(raw))), raw) { error in
+                guard let ce = error as? CError, case .invalidValue("x-containerfy.identifier", raw, _) = ce else {
+                    return XCTFail("Expected invalidValue for identifier \(raw), got: \(error)")
+                }
+            }
+        }
+    }
+
+    // MARK: - Identifier Override
+
+    func testIdentifierOverride() throws {
+        let path = writeCompose(validCompose)
+        var options = ComposeConfigParser.BuildOptions()
+        options.identifier = "com.customer.whitelabel"
+        let config = try ComposeConfigParser.parseBuild(composePath: path, options: options)
+        XCTAssertEqual(config.identifier, "com.customer.whitelabel")
+    }
+
+    func testInvalidIdentifierOverrideRejected() {
+        let path = writeCompose(validCompose)
+        var options = ComposeConfigParser.BuildOptions()
+        options.identifier = "not a bundle id"
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path, options: options)) { error in
+            guard let ce = error as? CError, case .invalidValue("--identifier", "not a bundle id", _) = ce else {
+                return XCTFail("Expected invalidValue for --identifier, got: \(error)")
+            }
+        }
+    }
+
+    // MARK: - Service Names
+
+    func testDNSCompatibleServiceNamesAccepted() throws {
+        let yaml = """
+        services:
+          web-1:
+            image: nginx
+            ports:
+              - "8080:80"
+          2fa:
+            image: redis
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.serviceSpecs.map(\.name), ["2fa", "web-1"])
+    }
+
+    func testInvalidServiceNamesRejected() {
+        for name in ["my_app", "MyApp", "-web", "web-"] {
+            let yaml = """
+            services:
+              \(name):
+                image: nginx
+                ports:
+                  - "8080:80"
+            \(validXContainerfy)
+            """
+            let path = writeCompose(yaml)
+            XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path), name) { error in
+                guard let ce = error as? CError, case .invalidValue(_, let value, _) = ce, value == name else {
+                    return XCTFail("Expected invalidValue for service name \(name), got: \(error)")
+                }
+            }
+        }
+    }
+
+    func testReservedServiceNamesRejected() {
+        for name in ["localhost", "containerfy"] {
+            let yaml = """
+            services:
+              \(name):
+                image: nginx
+                ports:
+                  - "8080:80"
+            \(validXContainerfy)
+            """
+            let path = writeCompose(yaml)
+            XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path), name) { error in
+                guard let ce = error as? CError, case .invalidValue("services.\(name)", name, let reason) = ce else {
+                    return XCTFail("Expected invalidValue for reserved service name \(name), got: \(error)")
+                }
+                XCTAssertTrue(reason.contains("reserved"), reason)
+            }
+        }
+    }
+
+    // MARK: - Healthcheck URL
+
+    private func composeWithHealthcheck(_ url: String) -> String {
+        """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+        x-containerfy:
+          name: testapp
+          version: "1.0.0"
+          identifier: com.example.test
+          vm:
+            cpu: { min: 2 }
+            memory_mb: { min: 1024 }
+            disk_mb: 4096
+          healthcheck:
+            url: "\(url)"
+        """
+    }
+
+    func testHealthcheckPathStored() throws {
+        let path = writeCompose(composeWithHealthcheck("http://127.0.0.1:8080/health"))
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.healthcheckURL, "http://127.0.0.1:8080/health")
+        XCTAssertEqual(config.healthcheckPath, "/health")
+        XCTAssertTrue(config.warnings.isEmpty)
+    }
+
+    func testHealthcheckResolvesTargetService() throws {
+        let yaml = """
+        services:
+          api:
+            image: nginx:1.27
+            ports:
+              - "8080:80"
+          db:
+            image: postgres:16
+            ports:
+              - "5432:5432"
+              - "8080:8080/udp"
+        \(validXContainerfy)
+          healthchecks:
+            - url: "http://localhost:8080/health"
+            - tcp: { port: 5432 }
+        """
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))
+        XCTAssertEqual(config.healthchecks.map { config.targetService(of: $0) }, ["api", "db"])
+        XCTAssertTrue(PackCommand.configText(config).contains("(path /health, service api)"))
+    }
+
+    func testHealthcheckPortPublishedByTwoServicesRejected() {
+        let yaml = """
+        services:
+          api:
+            image: nginx:1.27
+            ports:
+              - "8080:80"
+          admin:
+            image: nginx:1.27
+            ports:
+              - "127.0.0.1:8080:8080"
+        \(validXContainerfy)
+          healthcheck:
+            url: "http://127.0.0.1:8080/health"
+        """
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("published by both \"admin\" and \"api\""), msg)
+        }
+    }
+
+    func testHealthcheckWithoutPathWarns() throws {
+        for url in ["http://127.0.0.1:8080", "http://127.0.0.1:8080/"] {
+            let path = writeCompose(composeWithHealthcheck(url))
+            let config = try ComposeConfigParser.parseBuild(composePath: path)
+            XCTAssertEqual(config.healthcheckPath, "/", url)
+            XCTAssertEqual(config.warnings.count, 1, url)
+            XCTAssertTrue(config.warnings[0].contains("/health"), url)
+        }
+    }
+
+    func testHealthcheckWithoutPathRejectedWhenStrict() {
+        let path = writeCompose(composeWithHealthcheck("http://127.0.0.1:8080"))
+        var options = ComposeConfigParser.BuildOptions()
+        options.strict = true
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path, options: options)) { error in
+            guard let ce = error as? CError, case .invalidValue(let field, _, _) = ce else {
+                return XCTFail("Expected invalidValue, got \(error)")
+            }
+            XCTAssertEqual(field, "x-containerfy.healthcheck.url")
+        }
+    }
+
+    func testHealthcheckAcceptsLoopbackSpellings() throws {
+        for url in ["http://localhost:8080/health", "http://LOCALHOST:8080/health", "http://[::1]:8080/health"] {
+            let path = writeCompose(composeWithHealthcheck(url))
+            let config = try ComposeConfigParser.parseBuild(composePath: path)
+            XCTAssertEqual(config.healthcheckURL, "http://127.0.0.1:8080/health", url)
+            XCTAssertEqual(config.healthcheckPath, "/health", url)
+        }
+    }
+
+    func testHealthcheckMustTargetPublishedLocalPort() {
+        for url in ["http://10.0.0.5:8080/health", "http://example.com:8080/health", "http://127.0.0.1:9090/health", "ftp://127.0.0.1:8080/health"] {
+            let path = writeCompose(composeWithHealthcheck(url))
+            XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path), url) { error in
+                guard let ce = error as? CError, case .invalidValue = ce else {
+                    return XCTFail("Expected invalidValue for \(url), got \(error)")
+                }
+            }
+        }
+    }
+
+    private func composeWithHealthcheckBlock(_ block: String) -> String {
+        """
+        services:
+          web:
+            image: nginx:1.27
+            ports:
+              - "8080:80"
+          db:
+            image: postgres:16
+            ports:
+              - "5432:5432"
+        \(validXContainerfy)
+          healthcheck:
+        \(block)
+        """
+    }
+
+    func testTCPHealthcheck() throws {
+        let path = writeCompose(composeWithHealthcheckBlock("""
+            tcp:
+              host: localhost
+              port: 5432
+        """))
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.healthchecks, [.tcp(port: 5432)])
+        XCTAssertNil(config.healthcheckURL)
+        XCTAssertTrue(config.warnings.isEmpty)
+        XCTAssertEqual(RuntimeConfig(config: config).healthchecks, [.tcp(port: 5432)])
+    }
+
+    func testTCPHealthcheckHostDefaultsToLoopback() throws {
+        let path = writeCompose(composeWithHealthcheckBlock("""
+            tcp: { port: 8080 }
+        """))
+        XCTAssertEqual(try ComposeConfigParser.parseBuild(composePath: path).healthchecks, [.tcp(port: 8080)])
+    }
+
+    func testTCPHealthcheckValidated() {
+        let cases: [(block: String, field: String)] = [
+            ("    tcp: { port: 6379 }", "x-containerfy.healthcheck.tcp.port"),
+            ("    tcp: { host: 10.0.0.5, port: 5432 }", "x-containerfy.healthcheck.tcp.host"),
+            ("    tcp: { host: 127.0.0.1 }", "x-containerfy.healthcheck.tcp"),
+            ("    url: http://127.0.0.1:8080/health\n    tcp: { port: 5432 }", "x-containerfy.healthcheck"),
+        ]
+        for (block, field) in cases {
+            let path = writeCompose(composeWithHealthcheckBlock(block))
+            XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path), block) { error in
+                guard let ce = error as? CError, case .invalidValue(field, _, _) = ce else {
+                    return XCTFail("Expected invalidValue for \(field), got \(error)")
+                }
+            }
+        }
+    }
+
+    func testMultipleHealthchecks() throws {
+        let yaml = """
+        services:
+          web:
+            image: nginx:1.27
+            ports:
+              - "8080:80"
+          api:
+            image: myapi:1.0
+            ports:
+              - "3000:3000"
+        \(validXContainerfy)
+          healthchecks:
+            - url: http://127.0.0.1:8080/health
+            - url: http://localhost:3000/ready
+            - tcp: { port: 3000 }
+        """
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))
+        XCTAssertEqual(config.healthchecks, [
+            .http(url: "http://127.0.0.1:8080/health", path: "/health"),
+            .http(url: "http://127.0.0.1:3000/ready", path: "/ready"),
+            .tcp(port: 3000),
+        ])
+        XCTAssertEqual(config.healthcheckURL, "http://127.0.0.1:8080/health")
+
+        let runtime = RuntimeConfig(config: config)
+        XCTAssertEqual(runtime.composeConfig.healthchecks, config.healthchecks)
+    }
+
+    func testEveryHealthcheckEntryIsValidated() {
+        let yaml = """
+        services:
+          web:
+            image: nginx:1.27
+            ports:
+              - "8080:80"
+        \(validXContainerfy)
+          healthchecks:
+            - url: http://127.0.0.1:8080/health
+            - url: http://127.0.0.1:3000/ready
+        """
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.healthchecks[1].url", _, _) = ce else {
+                return XCTFail("Expected invalidValue for healthchecks[1], got \(error)")
+            }
+        }
+    }
+
+    func testHealthcheckAndHealthchecksAreExclusive() {
+        let path = writeCompose(composeWithHealthcheckBlock("""
+            url: http://127.0.0.1:8080/health
+          healthchecks:
+            - tcp: { port: 5432 }
+        """))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy", _, _) = ce else {
+                return XCTFail("Expected invalidValue for x-containerfy, got \(error)")
+            }
+        }
+    }
+
+    func testHealthcheckNeedsURLOrTCP() {
+        let path = writeCompose(composeWithHealthcheckBlock("""
+            interval_seconds: 10
+        """))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .missingField = ce else {
+                return XCTFail("Expected missingField, got \(error)")
+            }
+        }
+    }
+
+    // MARK: - Image Overrides
+
+    func testImageOverrideReplacesServiceImage() throws {
+        let path = writeCompose(validCompose)
+        var options = ComposeConfigParser.BuildOptions()
+        options.imageOverrides = ["web": "registry.example.com:5000/team/nginx:1.27-rc1"]
+        let config = try ComposeConfigParser.parseBuild(composePath: path, options: options)
+
+        XCTAssertEqual(config.images, ["registry.example.com:5000/team/nginx:1.27-rc1"])
+        XCTAssertEqual(config.serviceSpecs.first?.image, "registry.example.com:5000/team/nginx:1.27-rc1")
+        let rendered = try XCTUnwrap(config.renderedCompose)
+        XCTAssertTrue(rendered.contains("registry.example.com:5000/team/nginx:1.27-rc1"))
+        XCTAssertFalse(rendered.contains("nginx:latest"))
+    }
+
+    func testNoOverrideBundlesFileUnchanged() throws {
+        let path = writeCompose(validCompose)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertNil(config.renderedCompose)
+    }
+
+    func testImageOverrideUnknownService() {
+        let path = writeCompose(validCompose)
+        var options = ComposeConfigParser.BuildOptions()
+        options.imageOverrides = ["api": "nginx:1.27"]
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path, options: options)) { error in
+            guard let ce = error as? CError, case .invalidValue("--override-image", _, let reason) = ce else {
+                return XCTFail("Expected invalidValue, got \(error)")
+            }
+            XCTAssertTrue(reason.contains("web"))
+        }
+    }
+
+    func testImageReferenceValidation() {
+        for valid in ["nginx", "nginx:1.27", "library/nginx", "ghcr.io/org/app:v2", "localhost:5000/app",
+                      "nginx@sha256:" + String(repeating: "a", count: 64)] {
+            XCTAssertTrue(ComposeConfigParser.isValidImageReference(valid), valid)
+        }
+        for invalid in ["", "Nginx", "nginx:", "nginx:tag with space", "nginx@sha256:abc", "-nginx"] {
+            XCTAssertFalse(ComposeConfigParser.isValidImageReference(invalid), invalid)
+        }
+    }
+
+    // MARK: - License
+
+    private func composeWithLicense(_ license: String) -> String {
+        validCompose.replacingOccurrences(of: "  identifier: com.example.testapp\n", with: "  identifier: com.example.testapp\n  license: \(license)\n")
+    }
+
+    func testLicenseResolvedRelativeToCompose() throws {
+        writeEnvFile("EULA.txt", contents: "Terms")
+        let path = writeCompose(composeWithLicense("EULA.txt"))
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.license, tempDir.appendingPathComponent("EULA.txt").path)
+    }
+
+    func testMissingLicenseRejected() {
+        let path = writeCompose(composeWithLicense("EULA.txt"))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue(let field, _, let reason) = ce else {
+                return XCTFail("Expected invalidValue, got \(error)")
+            }
+            XCTAssertEqual(field, "x-containerfy.license")
+            XCTAssertTrue(reason.hasPrefix("no such file: /") && reason.hasSuffix("/EULA.txt"), reason)
+        }
+    }
+
+    // MARK: - Icon
+
+    private func composeWithIcon(_ icon: String) -> String {
+        validCompose.replacingOccurrences(of: "  identifier: com.example.testapp\n", with: "  identifier: com.example.testapp\n  icon: \(icon)\n")
+    }
+
+    /// The PNG signature and IHDR chunk, which is all pack reads to size an icon.
+    private func writePNG(_ name: String, width: UInt32, height: UInt32) {
+        var bytes: [UInt8] = [0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A, 0, 0, 0, 13]
+        bytes += Array("IHDR".utf8)
+        for value in [width, height] {
+            bytes += [24, 16, 8, 0].map { UInt8(truncatingIfNeeded: value >> $0) }
+        }
+        bytes += [8, 6, 0, 0, 0]
+        FileManager.default.createFile(atPath: tempDir.appendingPathComponent(name).path, contents: Data(bytes))
+    }
+
+    func testIconResolvedAgainstComposeDir() throws {
+        writePNG("icon.png", width: 1024, height: 1024)
+        let yaml = composeWithIcon("icon.png")
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))
+        XCTAssertEqual(config.icon, tempDir.appendingPathComponent("icon.png").path)
+        XCTAssertFalse(config.warnings.contains { $0.contains("x-containerfy.icon") })
+    }
+
+    func testIconTooSmallFails() {
+        writePNG("icon.png", width: 256, height: 256)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: writeCompose(composeWithIcon("icon.png")))) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.icon", "icon.png", let reason) = ce else {
+                return XCTFail("Expected invalidValue for icon, got \(error)")
+            }
+            XCTAssertTrue(reason.contains("256x256"))
+        }
+    }
+
+    func testNonSquareIconFails() {
+        writePNG("icon.png", width: 1024, height: 768)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: writeCompose(composeWithIcon("icon.png")))) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.icon", "icon.png", let reason) = ce else {
+                return XCTFail("Expected invalidValue for icon, got \(error)")
+            }
+            XCTAssertTrue(reason.contains("must be square"))
+        }
+    }
+
+    func testIconBelow1024Warns() throws {
+        writePNG("icon.png", width: 512, height: 512)
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(composeWithIcon("icon.png")))
+        XCTAssertTrue(config.warnings.contains { $0.contains("x-containerfy.icon is 512x512") })
+    }
+
+    func testICNSSizedByLargestImage() throws {
+        // "icns" header, then an ic09 (512x512) and an ic10 (1024x1024) element with empty payloads
+        var bytes = Array("icns".utf8) + [0, 0, 0, 24]
+        bytes += Array("ic09".utf8) + [0, 0, 0, 8] + Array("ic10".utf8) + [0, 0, 0, 8]
+        let path = tempDir.appendingPathComponent("icon.icns").path
+        FileManager.default.createFile(atPath: path, contents: Data(bytes))
+        let size = try XCTUnwrap(BundleAssembler.iconPixelSize(atPath: path))
+        XCTAssertEqual(size.width, 1024)
+        XCTAssertEqual(size.height, 1024)
+
+        writeEnvFile("icon.png", contents: "png")
+        XCTAssertNil(BundleAssembler.iconPixelSize(atPath: tempDir.appendingPathComponent("icon.png").path))
+    }
+
+    func testMissingIconFails() {
+        let yaml = composeWithIcon("missing.icns")
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))) { error in
+            guard let ce = error as? CError, case .invalidValue(let field, _, let reason) = ce else {
+                return XCTFail("Expected invalidValue, got \(error)")
+            }
+            XCTAssertEqual(field, "x-containerfy.icon")
+            XCTAssertTrue(reason.hasPrefix("no such file: /") && reason.hasSuffix("/missing.icns"), reason)
+            XCTAssertFalse(error.localizedDescription.contains("compose file"), error.localizedDescription)
+        }
+    }
+
+    func testUnsupportedIconFormatFails() {
+        writeEnvFile("icon.jpg", contents: "jpg")
+        let yaml = composeWithIcon("icon.jpg")
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))) { error in
+            guard let ce = error as? CError, case .invalidValue("x-containerfy.icon", "icon.jpg", _) = ce else {
+                return XCTFail("Expected invalidValue for icon, got \(error)")
+            }
+        }
+    }
+
+    // MARK: - Path Confinement
+
+    private func composeWithEnvFile(_ envFile: String) -> String {
+        """
+        services:
+          web:
+            image: nginx
+            env_file: \(envFile)
+            ports:
+              - "8080:80"
+        \(validXContainerfy)
+        """
+    }
+
+    private func confinedOptions() -> ComposeConfigParser.BuildOptions {
+        var options = ComposeConfigParser.BuildOptions()
+        options.confinePaths = true
+        return options
+    }
+
+    private func assertEscapeRejected(_ envFile: String, file: StaticString = #filePath, line: UInt = #line) {
+        let path = writeCompose(composeWithEnvFile(envFile), filename: "project/docker-compose.yml")
+        XCTAssertNoThrow(try ComposeConfigParser.parseBuild(composePath: path), "Unconfined parse should accept \(envFile)", file: file, line: line)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path, options: confinedOptions()), file: file, line: line) { error in
+            guard let ce = error as? CError, case .invalidValue(let field, _, let reason) = ce else {
+                return XCTFail("Expected invalidValue, got \(error)", file: file, line: line)
+            }
+            XCTAssertEqual(field, "services.web.env_file", file: file, line: line)
+            XCTAssertTrue(reason.contains("outside"), file: file, line: line)
+        }
+    }
+
+    private func makeProjectDir() {
+        try! FileManager.default.createDirectory(at: tempDir.appendingPathComponent("project"), withIntermediateDirectories: true)
+    }
+
+    func testConfinedEnvFileInsideProjectAccepted() throws {
+        makeProjectDir()
+        writeEnvFile("project/app.env")
+        let path = writeCompose(composeWithEnvFile("app.env"), filename: "project/docker-compose.yml")
+        let config = try ComposeConfigParser.parseBuild(composePath: path, options: confinedOptions())
+        XCTAssertEqual(config.envFiles.count, 1)
+    }
+
+    func testConfinedRejectsDotDotEscape() {
+        makeProjectDir()
+        writeEnvFile("secrets.env")
+        assertEscapeRejected("../secrets.env")
+    }
+
+    func testConfinedRejectsAbsolutePathEscape() {
+        makeProjectDir()
+        writeEnvFile("secrets.env")
+        assertEscapeRejected(tempDir.appendingPathComponent("secrets.env").path)
+    }
+
+    func testConfinedRejectsSymlinkEscape() throws {
+        makeProjectDir()
+        writeEnvFile("secrets.env")
+        try FileManager.default.createSymbolicLink(
+            atPath: tempDir.appendingPathComponent("project/link.env").path,
+            withDestinationPath: tempDir.appendingPathComponent("secrets.env").path
+        )
+        assertEscapeRejected("link.env")
+    }
+
+    func testConfineRootWidensAllowedTree() throws {
+        makeProjectDir()
+        writeEnvFile("shared.env")
+        let path = writeCompose(composeWithEnvFile("../shared.env"), filename: "project/docker-compose.yml")
+        var options = confinedOptions()
+        options.confineRoot = tempDir.path
+        XCTAssertNoThrow(try ComposeConfigParser.parseBuild(composePath: path, options: options))
+    }
+
+    // MARK: - Interpolation
+
+    private func composeWithImage(_ image: String) -> String {
+        """
+        services:
+          web:
+            image: "\(image)"
+            command: ["sh", "-c", "echo $$HOME"]
+            ports:
+              - "8080:80"
+        \(validXContainerfy)
+        """
+    }
+
+    private func options(environment: [String: String]) -> ComposeConfigParser.BuildOptions {
+        var options = ComposeConfigParser.BuildOptions()
+        options.environment = environment
+        return options
+    }
+
+    func testInterpolatesImageFromEnvironment() throws {
+        let path = writeCompose(composeWithImage("${REGISTRY}/web:${TAG:-1.0}"))
+        let config = try ComposeConfigParser.parseBuild(composePath: path, options: options(environment: ["REGISTRY": "ghcr.io/acme"]))
+        XCTAssertEqual(config.images, ["ghcr.io/acme/web:1.0"])
+
+        let rendered = try XCTUnwrap(config.renderedCompose)
+        XCTAssertTrue(rendered.contains("ghcr.io/acme/web:1.0"))
+        XCTAssertTrue(rendered.contains("$$HOME"), "Escaped dollars must survive for compose to read at runtime")
+    }
+
+    func testDotEnvFillsUnsetVariables() throws {
+        writeEnvFile(".env", contents: "TAG=2.0\nREGISTRY=docker.io/acme\n")
+        let path = writeCompose(composeWithImage("${REGISTRY}/web:${TAG}"))
+        let config = try ComposeConfigParser.parseBuild(composePath: path, options: options(environment: ["TAG": "3.0"]))
+        XCTAssertEqual(config.images, ["docker.io/acme/web:3.0"], "Environment wins over .env")
+    }
+
+    func testDotEnvSearchUpUsesNearestParent() throws {
+        try FileManager.default.createDirectory(at: tempDir.appendingPathComponent("apps/web"), withIntermediateDirectories: true)
+        writeEnvFile(".env", contents: "TAG=1.0\n")
+        writeEnvFile("apps/.env", contents: "TAG=2.0\n")
+        let path = writeCompose(composeWithImage("nginx:${TAG}"), filename: "apps/web/docker-compose.yml")
+
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path, options: options(environment: [:])))
+        var searching = options(environment: [:])
+        searching.envFileSearchUp = 1
+        XCTAssertEqual(try ComposeConfigParser.parseBuild(composePath: path, options: searching).images, ["nginx:2.0"])
+
+        // A .env next to the compose file wins over any parent's
+        writeEnvFile("apps/web/.env", contents: "TAG=3.0\n")
+        searching.envFileSearchUp = 2
+        XCTAssertEqual(try ComposeConfigParser.parseBuild(composePath: path, options: searching).images, ["nginx:3.0"])
+    }
+
+    func testEnvFileSearchUpRejectsNegative() {
+        let path = writeCompose(composeWithImage("nginx:1.27"))
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", path, "--env-file-search-up", "-1"]), 1)
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", path, "--env-file-search-up", "0"]), 0)
+    }
+
+    func testMissingVariableNamesIt() {
+        let path = writeCompose(composeWithImage("nginx:${NGINX_TAG}"))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path, options: options(environment: [:]))) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got \(error)")
+            }
+            XCTAssertTrue(msg.contains("NGINX_TAG"))
+            XCTAssertTrue(msg.contains("services.web.image"))
+        }
+    }
+
+    func testShellEnvironmentNeedsAllowEnv() throws {
+        setenv("CONTAINERFY_TEST_DB_PASSWORD", "hunter2", 1)
+        defer { unsetenv("CONTAINERFY_TEST_DB_PASSWORD") }
+        let path = writeCompose(composeWithImage("nginx:1.27-${CONTAINERFY_TEST_DB_PASSWORD}"))
+
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            XCTAssertTrue(error.localizedDescription.contains("--allow-env CONTAINERFY_TEST_DB_PASSWORD"), error.localizedDescription)
+        }
+        var options = ComposeConfigParser.BuildOptions()
+        options.allowedEnvironment = ["CONTAINERFY_TEST_DB_PASSWORD"]
+        XCTAssertEqual(try ComposeConfigParser.parseBuild(composePath: path, options: options).images, ["nginx:1.27-hunter2"])
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", path]), 1)
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", path, "--allow-env", "CONTAINERFY_TEST_DB_PASSWORD"]), 0)
+    }
+
+    func testNestedDefaultsResolveInnerReferences() throws {
+        let path = writeCompose(composeWithImage("nginx:${TAG:-${FALLBACK_TAG:-1.27}}-${VARIANT-${BASE}}"))
+        let config = try ComposeConfigParser.parseBuild(composePath: path, options: options(environment: ["BASE": "alpine"]))
+        XCTAssertEqual(config.images, ["nginx:1.27-alpine"])
+
+        // An unused default is not resolved, so its unset variables don't fail the pack
+        let used = writeCompose(composeWithImage("nginx:${TAG:-${UNSET_TAG}}"), filename: "used.yml")
+        XCTAssertEqual(try ComposeConfigParser.parseBuild(composePath: used, options: options(environment: ["TAG": "2.0"])).images, ["nginx:2.0"])
+
+        let refs = try ComposeConfigParser.environmentReferences(composePath: used, options: options(environment: ["TAG": "2.0"]))
+        XCTAssertEqual(refs.map(\.name), ["TAG", "UNSET_TAG"])
+    }
+
+    func testNestedReferenceAsVariableNameIsRejected() {
+        let path = writeCompose(composeWithImage("nginx:${${TAG}}"))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path, options: options(environment: ["TAG": "1.27"]))) { error in
+            guard let ce = error as? CError, case .invalidValue(let field, _, let reason) = ce else {
+                return XCTFail("Expected invalidValue, got \(error)")
+            }
+            XCTAssertEqual(field, "services.web.image")
+            XCTAssertTrue(reason.contains("invalid variable name"), reason)
+        }
+    }
+
+    func testRequiredVariableMessage() {
+        let path = writeCompose(composeWithImage("nginx:${NGINX_TAG:?set NGINX_TAG to the release}"))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path, options: options(environment: ["NGINX_TAG": ""]))) { error in
+            XCTAssertTrue(error.localizedDescription.contains("set NGINX_TAG to the release"))
+        }
+    }
+
+    func testNoVariablesBundlesFileUnchanged() throws {
+        let path = writeCompose(composeWithImage("nginx:1.27"))
+        let config = try ComposeConfigParser.parseBuild(composePath: path, options: options(environment: [:]))
+        XCTAssertNil(config.renderedCompose)
+    }
+
+    func testEnvironmentReferencesListResolvedDefaultedAndMissing() throws {
+        writeEnvFile(".env", contents: "TAG=2.0\n")
+        let yaml = """
+        services:
+          web:
+            image: "nginx:${TAG}"
+            environment:
+              LOG_LEVEL: "${LOG_LEVEL:-info}"
+              API_URL: "${API_URL:?set the API endpoint}"
+              DEBUG: "${DEBUG+1}"
+            command: ["sh", "-c", "echo $$HOME"]
+            ports:
+              - "8080:80"
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let refs = try ComposeConfigParser.environmentReferences(composePath: path, options: options(environment: ["DEBUG": ""]))
+        XCTAssertEqual(refs, [
+            .init(name: "API_URL", field: "services.web.environment.API_URL", required: true, status: .missing),
+            .init(name: "DEBUG", field: "services.web.environment.DEBUG", required: false, status: .set),
+            .init(name: "LOG_LEVEL", field: "services.web.environment.LOG_LEVEL", required: false, status: .defaulted),
+            .init(name: "TAG", field: "services.web.image", required: true, status: .set),
+        ])
+
+        XCTAssertEqual(
+            ValidateCommand.referencesText(Array(refs.prefix(1))),
+            "API_URL  missing    required  services.web.environment.API_URL"
+        )
+        XCTAssertEqual(ValidateCommand.referencesText([]), "No ${VAR} references.")
+    }
+
+    func testCheckEnvFailsOnlyWhenARequiredVariableIsMissing() {
+        let path = writeCompose(composeWithImage("nginx:${NGINX_TAG_FOR_CHECK_ENV:-1.27}"))
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", path, "--check-env"]), 0)
+
+        let missing = writeCompose(composeWithImage("nginx:${NGINX_TAG_FOR_CHECK_ENV}"), filename: "missing.yml")
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", missing, "--check-env"]), 1)
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", missing, "--check-env", "--json"]), 1)
+    }
+
+    // MARK: - Override Files
+
+    func testOverrideFileMergesServiceMaps() throws {
+        let base = writeCompose(validCompose)
+        let overlay = writeCompose("""
+        services:
+          web:
+            restart: always
+            ports:
+              - "8443:443"
+          db:
+            image: postgres:16
+        """, filename: "compose.prod.yml")
+
+        var options = ComposeConfigParser.BuildOptions()
+        options.overrideComposePaths = [overlay]
+        let config = try ComposeConfigParser.parseBuild(composePath: base, options: options)
+
+        XCTAssertEqual(config.serviceSpecs.map(\.name), ["db", "web"])
+        XCTAssertEqual(config.serviceSpecs.first { $0.name == "web" }?.restart, "always")
+        XCTAssertEqual(config.portMappings.map(\.hostPort), [8080, 8443])
+        XCTAssertEqual(config.composeDir, tempDir.path)
+        XCTAssertNotNil(config.renderedCompose)
+    }
+
+    func testOverrideFileScalarsWinInOrder() throws {
+        let base = writeCompose(validCompose)
+        let first = writeCompose("""
+        services:
+          web:
+            image: nginx:1.26
+            environment:
+              - LOG_LEVEL=info
+              - MODE=base
+        x-containerfy:
+          version: "2.0.0"
+        """, filename: "compose.a.yml")
+        let second = writeCompose("""
+        services:
+          web:
+            image: nginx:1.27
+            environment:
+              MODE: prod
+        """, filename: "compose.b.yml")
+
+        var options = ComposeConfigParser.BuildOptions()
+        options.overrideComposePaths = [first, second]
+        let config = try ComposeConfigParser.parseBuild(composePath: base, options: options)
+
+        XCTAssertEqual(config.images, ["nginx:1.27"])
+        XCTAssertEqual(config.version, "2.0.0")
+        XCTAssertEqual(config.name, "testapp")
+        XCTAssertEqual(config.cpuRecommended, 4)
+        XCTAssertEqual(config.serviceSpecs.first?.inlineEnvironmentKeys.sorted(), ["LOG_LEVEL", "MODE"])
+    }
+
+    func testMissingOverrideFileFails() {
+        let base = writeCompose(validCompose)
+        var options = ComposeConfigParser.BuildOptions()
+        options.overrideComposePaths = [tempDir.appendingPathComponent("nope.yml").path]
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: base, options: options)) { error in
+            guard let ce = error as? ComposeConfigParser.ComposeError, case .fileNotFound = ce else {
+                return XCTFail("Expected fileNotFound, got \(error)")
+            }
+        }
+    }
+
+    func testListsAppendAndCommandIsReplaced() {
+        let merged = ComposeMerge.merge(
+            ["command": ["serve", "--dev"], "ports": ["80:80"], "healthcheck": ["test": ["CMD", "a"], "interval": "5s"]],
+            ["command": ["serve"], "ports": ["80:80", "443:443"], "healthcheck": ["test": ["CMD", "b"]]]
+        )
+        XCTAssertEqual(merged["command"] as? [String], ["serve"])
+        XCTAssertEqual(merged["ports"] as? [String], ["80:80", "443:443"])
+        let healthcheck = merged["healthcheck"] as? [String: Any]
+        XCTAssertEqual(healthcheck?["test"] as? [String], ["CMD", "b"])
+        XCTAssertEqual(healthcheck?["interval"] as? String, "5s")
+    }
+
+    // MARK: - extends
+
+    func testExtendsSameFileService() throws {
+        let yaml = """
+        services:
+          base:
+            image: example/app:1.0
+            environment:
+              LOG_LEVEL: info
+          web:
+            extends: base
+            ports:
+              - "8080:80"
+          worker:
+            extends:
+              service: base
+            environment:
+              LOG_LEVEL: debug
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.serviceSpecs.map(\.image), ["example/app:1.0", "example/app:1.0", "example/app:1.0"])
+        XCTAssertEqual(config.portMappings.map(\.hostPort), [8080])
+        let rendered = try XCTUnwrap(config.renderedCompose)
+        XCTAssertFalse(rendered.contains("extends"), rendered)
+        XCTAssertTrue(rendered.contains("LOG_LEVEL: debug"), rendered)
+    }
+
+    func testExtendsServiceFromAnotherFile() throws {
+        _ = writeCompose("""
+        services:
+          common:
+            image: example/app:2.0
+            ports:
+              - "9090:90"
+        """, filename: "common.yml")
+        let yaml = """
+        services:
+          web:
+            extends:
+              file: common.yml
+              service: common
+            ports:
+              - "8080:80"
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.images, ["example/app:2.0"])
+        XCTAssertEqual(config.portMappings.map(\.hostPort), [9090, 8080])
+    }
+
+    func testExtendsCycleRejected() {
+        let yaml = """
+        services:
+          web:
+            extends: base
+            image: nginx:1.27
+            ports:
+              - "8080:80"
+          base:
+            extends: web
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("base -> web -> base"), msg)
+        }
+    }
+
+    func testExtendsMissingFileOrServiceRejected() {
+        for (extends, expected) in [("{ file: missing.yml, service: base }", "missing.yml"), ("nothere", "\"nothere\"")] {
+            let yaml = """
+            services:
+              web:
+                image: nginx:1.27
+                extends: \(extends)
+                ports:
+                  - "8080:80"
+            \(validXContainerfy)
+            """
+            let path = writeCompose(yaml)
+            XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+                guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                    return XCTFail("Expected validationFailed, got: \(error)")
+                }
+                XCTAssertTrue(msg.contains(expected), msg)
+            }
+        }
+    }
+
+    // MARK: - Memory Tuning
+
+    func testMemoryTuningParsed() throws {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            mem_swappiness: 10
+            oom_kill_disable: true
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.serviceSpecs[0].memSwappiness, 10)
+        XCTAssertEqual(config.serviceSpecs[0].oomKillDisable, true)
+        XCTAssertTrue(config.warnings.contains { $0.contains("oom_kill_disable") })
+    }
+
+    func testMemSwappinessOutOfRangeRejected() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            mem_swappiness: 150
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .outOfRange("services.web.mem_swappiness", "150", _) = ce else {
+                return XCTFail("Expected outOfRange for mem_swappiness, got: \(error)")
+            }
+        }
+    }
+
+    // MARK: - Devices
+
+    func testDevicesParsed() throws {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            devices:
+              - /dev/net/tun
+              - "/dev/fuse:/dev/fuse:r"
+              - source: /dev/urandom
+                target: /dev/random
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.serviceSpecs[0].devices, [
+            DeviceMapping(hostPath: "/dev/net/tun", containerPath: "/dev/net/tun", permissions: "rwm"),
+            DeviceMapping(hostPath: "/dev/fuse", containerPath: "/dev/fuse", permissions: "r"),
+            DeviceMapping(hostPath: "/dev/urandom", containerPath: "/dev/random", permissions: "rwm"),
+        ])
+    }
+
+    func testHostOnlyDeviceRejected() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            devices:
+              - /dev/ttyUSB0:/dev/ttyUSB0
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .rejected("web", _, _) = ce else {
+                return XCTFail("Expected ComposeError.rejected for device, got: \(error)")
+            }
+        }
+    }
+
+    func testDeviceBadPermissionsRejected() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            devices:
+              - /dev/fuse:/dev/fuse:rx
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue("services.web.devices", "rx", _) = ce else {
+                return XCTFail("Expected invalidValue for devices, got: \(error)")
+            }
+        }
+    }
+
+    // MARK: - environment
+
+    func testEnvironmentMapForm() throws {
+        let yaml = """
+        services:
+          web:
+            image: nginx:1.27
+            ports:
+              - "8080:80"
+            environment:
+              LOG_LEVEL: ${LEVEL:-info}
+              WORKERS: 4
+              DB_PASSWORD: hunter2
+              HOME_DIR:
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        var options = ComposeConfigParser.BuildOptions()
+        options.environment = [:]
+        let config = try ComposeConfigParser.parseBuild(composePath: path, options: options)
+        let environment = try XCTUnwrap(config.serviceSpecs.first?.environment)
+        XCTAssertEqual(environment, [
+            EnvironmentVariable(name: "DB_PASSWORD", value: "hunter2"),
+            EnvironmentVariable(name: "HOME_DIR", value: nil),
+            EnvironmentVariable(name: "LOG_LEVEL", value: "info"),
+            EnvironmentVariable(name: "WORKERS", value: "4"),
+        ])
+        XCTAssertTrue(try XCTUnwrap(config.renderedCompose).contains("LOG_LEVEL: info"))
+
+        let json = try PackCommand.configJSON(config)
+        XCTAssertFalse(json.contains("hunter2"), json)
+        XCTAssertTrue(json.contains(EnvironmentVariable.mask))
+        XCTAssertFalse(PackCommand.configText(config).contains("hunter2"))
+        XCTAssertTrue(PackCommand.configText(config).contains("WORKERS=4"))
+    }
+
+    func testEnvironmentListForm() throws {
+        let yaml = """
+        services:
+          web:
+            image: nginx:1.27
+            ports:
+              - "8080:80"
+            environment:
+              - MODE=prod
+              - EQUATION=a=b
+              - PASSTHROUGH
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.serviceSpecs.first?.environment, [
+            EnvironmentVariable(name: "EQUATION", value: "a=b"),
+            EnvironmentVariable(name: "MODE", value: "prod"),
+            EnvironmentVariable(name: "PASSTHROUGH", value: nil),
+        ])
+        XCTAssertEqual(config.serviceSpecs.first?.inlineEnvironmentKeys, ["EQUATION", "MODE"])
+    }
+
+    // MARK: - Global Environment
+
+    private func composeWithGlobalEnv(_ services: String, env: String) -> String {
+        """
+        services:
+        \(services)
+        \(validXContainerfy)
+          env:
+        \(env)
+        """
+    }
+
+    func testGlobalEnvMergedWithServiceValuesWinning() throws {
+        writeEnvFile("worker.env", contents: "TZ=Asia/Tokyo\n")
+        let yaml = composeWithGlobalEnv("""
+          web:
+            image: nginx:1.27
+            ports:
+              - "8080:80"
+            environment:
+              LOG_LEVEL: debug
+          worker:
+            image: busybox:1.36
+            env_file: worker.env
+            environment:
+              - MODE=batch
+              - LOG_LEVEL
+        """, env: """
+            LOG_LEVEL: info
+            TZ: UTC
+            WORKERS: 4
+        """)
+        var options = ComposeConfigParser.BuildOptions()
+        options.environment = [:]
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml), options: options)
+        let web = try XCTUnwrap(config.serviceSpecs.first { $0.name == "web" })
+        XCTAssertEqual(web.environment, [
+            EnvironmentVariable(name: "LOG_LEVEL", value: "debug"),
+            EnvironmentVariable(name: "TZ", value: "UTC"),
+            EnvironmentVariable(name: "WORKERS", value: "4"),
+        ])
+        // worker sets LOG_LEVEL bare and TZ in its env file, so only WORKERS is added
+        let worker = try XCTUnwrap(config.serviceSpecs.first { $0.name == "worker" })
+        XCTAssertEqual(worker.environment, [
+            EnvironmentVariable(name: "LOG_LEVEL", value: nil),
+            EnvironmentVariable(name: "MODE", value: "batch"),
+            EnvironmentVariable(name: "WORKERS", value: "4"),
+        ])
+        let rendered = try XCTUnwrap(config.renderedCompose)
+        XCTAssertTrue(rendered.contains("WORKERS=4"), rendered)
+        XCTAssertTrue(rendered.contains("TZ: UTC"), rendered)
+    }
+
+    func testGlobalEnvInterpolated() throws {
+        let yaml = composeWithGlobalEnv("""
+          web:
+            image: nginx:1.27
+            ports:
+              - "8080:80"
+        """, env: """
+            TZ: ${HOST_TZ:-UTC}
+            RELEASE: ${RELEASE}
+            LITERAL: $$HOME
+        """)
+        var options = ComposeConfigParser.BuildOptions()
+        options.environment = ["RELEASE": "2024.1"]
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml), options: options)
+        XCTAssertEqual(config.serviceSpecs.first?.environment, [
+            EnvironmentVariable(name: "LITERAL", value: "$HOME"),
+            EnvironmentVariable(name: "RELEASE", value: "2024.1"),
+            EnvironmentVariable(name: "TZ", value: "UTC"),
+        ])
+        let rendered = try XCTUnwrap(config.renderedCompose)
+        XCTAssertTrue(rendered.contains("RELEASE: '2024.1'") || rendered.contains("RELEASE: \"2024.1\""), rendered)
+        XCTAssertTrue(rendered.contains("LITERAL: $$HOME"), "Escaped dollars must survive: \(rendered)")
+    }
+
+    func testGlobalEnvRejectsBadNamesAndValues() {
+        for env in ["    1BAD: x", "    NESTED:\n      a: b"] {
+            let yaml = composeWithGlobalEnv("""
+              web:
+                image: nginx:1.27
+                ports:
+                  - "8080:80"
+            """, env: env)
+            XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))) { error in
+                guard let ce = error as? CError, case .invalidValue(let field, _, _) = ce else {
+                    return XCTFail("Expected invalidValue, got: \(error)")
+                }
+                XCTAssertTrue(field.hasPrefix("x-containerfy.env"), field)
+            }
+        }
+    }
+
+    // MARK: - env_file
+
+    func testEnvFileString() throws {
+        writeEnvFile(".env")
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            env_file: .env
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.envFiles.count, 1)
+        XCTAssertTrue(config.envFiles[0].hasSuffix(".env"))
+    }
+
+    func testEnvFileArray() throws {
+        writeEnvFile(".env")
+        writeEnvFile("app.env")
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            env_file:
+              - .env
+              - app.env
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.envFiles.count, 2)
+    }
+
+    func testEnvFileDictWithPath() throws {
+        writeEnvFile("custom.env")
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            env_file:
+              - path: custom.env
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.envFiles.count, 1)
+        XCTAssertTrue(config.envFiles[0].hasSuffix("custom.env"))
+    }
+
+    func testEnvFileNotFoundThrows() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            env_file: missing.env
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed for missing env_file, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("missing.env"), "Error should mention the missing file")
+        }
+    }
+
+    func testOversizedEnvFileRejected() {
+        writeEnvFile("app.log", contents: String(repeating: "x", count: 2048))
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            env_file: app.log
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        var options = ComposeConfigParser.BuildOptions()
+        options.maxEnvFileKB = 1
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path, options: options)) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("app.log"))
+        }
+    }
+
+    private func composeWithEnvFile(_ envFile: String) -> String {
+        """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            env_file: \(envFile)
+        \(validXContainerfy)
+        """
+    }
+
+    func testEnvFileGlobExpanded() throws {
+        try FileManager.default.createDirectory(at: tempDir.appendingPathComponent("config"), withIntermediateDirectories: true)
+        writeEnvFile("config/b.env")
+        writeEnvFile("config/a.env")
+        writeEnvFile("config/notes.txt")
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(composeWithEnvFile("./config/*.env")))
+        XCTAssertEqual(config.envFiles.map { ($0 as NSString).lastPathComponent }, ["a.env", "b.env"])
+        let rendered = try XCTUnwrap(config.renderedCompose)
+        XCTAssertTrue(rendered.contains("config/a.env"), rendered)
+        XCTAssertTrue(rendered.contains("config/b.env"), rendered)
+        XCTAssertFalse(rendered.contains("*.env"), rendered)
+    }
+
+    func testEnvFileGlobMatchingNothingRejected() {
+        let path = writeCompose(composeWithEnvFile("./config/*.env"))
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("matches no files"), msg)
+        }
+    }
+
+    func testEnvFilesWithSameNameRejected() throws {
+        try FileManager.default.createDirectory(at: tempDir.appendingPathComponent("prod"), withIntermediateDirectories: true)
+        writeEnvFile("app.env")
+        writeEnvFile("prod/app.env")
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            env_file:
+              - app.env
+              - prod/app.env
+        \(validXContainerfy)
+        """
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("would collide"), msg)
+        }
+    }
+
+    func testMalformedEnvFileLineRejectedWithLineNumber() {
+        writeEnvFile("app.env", contents: "# settings\nLOG_LEVEL=info\nAPI_TOKEN: s3cr3t-token\n")
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: writeCompose(composeWithEnvFile("app.env")))) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("env_file \"app.env\" line 3: \"API_TOKEN\" has no \"=\""), msg)
+            XCTAssertFalse(msg.contains("s3cr3t"), "the value must not be echoed: \(msg)")
+        }
+    }
+
+    func testEnvFileCommentsBlankLinesAndExportAccepted() throws {
+        writeEnvFile("app.env", contents: "# comment\n\n  # indented comment\nexport TOKEN=abc\nEMPTY=\nURL=http://x/?a=b\n")
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(composeWithEnvFile("app.env")))
+        XCTAssertEqual(config.envFiles.count, 1)
+    }
+
+    func testEnvFileWithBOMAndCRLFAccepted() throws {
+        let path = tempDir.appendingPathComponent("app.env").path
+        FileManager.default.createFile(atPath: path, contents: Data([0xEF, 0xBB, 0xBF]) + Data("FOO=bar\r\nBAZ=qux\r\n".utf8))
+        XCTAssertNoThrow(try ComposeConfigParser.parseBuild(composePath: writeCompose(composeWithEnvFile("app.env"))))
+        XCTAssertEqual(EnvFile.normalize(FileManager.default.contents(atPath: path)!), Data("FOO=bar\nBAZ=qux\n".utf8))
+    }
+
+    // MARK: - Secrets
+
+    func testFileSecretBundled() throws {
+        writeEnvFile("db_password.txt", contents: "hunter2")
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            secrets:
+              - db_password
+              - source: db_password
+                target: /run/secrets/password
+        secrets:
+          db_password:
+            file: ./db_password.txt
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.bundledFiles, [BundledFile(
+            kind: .secret, name: "db_password",
+            source: tempDir.appendingPathComponent("./db_password.txt").path, bundlePath: "secrets/db_password"
+        )])
+        let rendered = try XCTUnwrap(config.renderedCompose)
+        XCTAssertTrue(rendered.contains("file: ./secrets/db_password"), rendered)
+    }
+
+    func testSecretSourceFileNotFoundThrows() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+        secrets:
+          api_key:
+            file: missing.txt
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed for missing secret file, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("missing.txt"))
+        }
+    }
+
+    func testExternalSecretRejected() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+        secrets:
+          api_key:
+            external: true
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue(let field, _, let reason) = ce else {
+                return XCTFail("Expected invalidValue, got: \(error)")
+            }
+            XCTAssertEqual(field, "secrets.api_key")
+            XCTAssertTrue(reason.contains("not supported"))
+        }
+    }
+
+    func testUndeclaredSecretReferenceRejected() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            secrets:
+              - api_key
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .invalidValue(let field, let value, _) = ce else {
+                return XCTFail("Expected invalidValue, got: \(error)")
+            }
+            XCTAssertEqual(field, "services.web.secrets")
+            XCTAssertEqual(value, "api_key")
+        }
+    }
+
+    // MARK: - Configs
+
+    func testConfigsShortAndLongFormsBundled() throws {
+        writeEnvFile("nginx.conf", contents: "server {}")
+        writeEnvFile("site.conf", contents: "location / {}")
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            configs:
+              - nginx_conf
+              - source: site_conf
+                target: /etc/nginx/conf.d/site.conf
+              - source: banner
+        configs:
+          nginx_conf:
+            file: nginx.conf
+          site_conf:
+            file: ./site.conf
+          banner:
+            content: hello
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.bundledFiles.map(\.name), ["nginx_conf", "site_conf"])
+        XCTAssertEqual(config.bundledFiles.map(\.bundlePath), ["configs/nginx_conf", "configs/site_conf"])
+        XCTAssertTrue(config.bundledFiles.allSatisfy { $0.kind == .config })
+        let rendered = try XCTUnwrap(config.renderedCompose)
+        XCTAssertTrue(rendered.contains("file: ./configs/site_conf"), rendered)
+        XCTAssertTrue(rendered.contains("content: hello"), rendered)
+    }
+
+    func testConfigSourceFileNotFoundThrows() {
+        let yaml = """
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+            configs:
+              - source: app_conf
+                target: /etc/app.conf
+        configs:
+          app_conf:
+            file: missing.conf
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed for missing config file, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("missing.conf"))
+        }
+    }
+
+    // MARK: - No Exposed Ports
+
+    func testNoExposedPortsError() {
+        let yaml = """
+        services:
+          worker:
+            image: myworker
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path)) { error in
+            guard let ce = error as? CError, case .validationFailed(let msg) = ce else {
+                return XCTFail("Expected validationFailed, got: \(error)")
+            }
+            XCTAssertTrue(msg.contains("port"), "Error should mention missing ports")
+        }
+    }
+
+    // MARK: - Duplicate Image Deduplication
+
+    func testDuplicateImageDedup() throws {
+        let yaml = """
+        services:
+          web1:
+            image: nginx:latest
+            ports:
+              - "8080:80"
+          web2:
+            image: nginx:latest
+            ports:
+              - "8081:80"
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.images.count, 1)
+        XCTAssertEqual(config.images[0], "nginx:latest")
+    }
+
+    func testMultipleDistinctImages() throws {
+        let yaml = """
+        services:
+          web:
+            image: nginx:latest
+            ports:
+              - "8080:80"
+          db:
+            image: postgres:16
+        \(validXContainerfy)
+        """
+        let path = writeCompose(yaml)
+        let config = try ComposeConfigParser.parseBuild(composePath: path)
+        XCTAssertEqual(config.images.count, 2)
+        XCTAssertTrue(config.images.contains("nginx:latest"))
+        XCTAssertTrue(config.images.contains("postgres:16"))
+    }
+
+    // MARK: - JSON Round Trip
+
+    private func roundTripCompose() -> String {
+        """
+        services:
+          web:
+            image: nginx:1.27
+            container_name: web
+            ports:
+              - "8080:80"
+            depends_on: [db]
+            environment:
+              LOG_LEVEL: debug
+          db:
+            image: postgres:16
+        x-containerfy:
+          name: testapp
+          version: "1.0.0"
+          identifier: com.example.test
+          plist:
+            NSRequiresAquaSystemAppearance: true
+            ExampleRatio: 1.5
+            ExampleList: [a, b]
+          vm:
+            cpu: { min: 2 }
+            memory_mb: { min: 1024 }
+            disk_mb: 4096
+          healthcheck:
+            url: http://localhost:8080/health
+        """
+    }
+
+    func testConfigJSONRoundTrip() throws {
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(roundTripCompose()))
+        let json = try config.jsonData()
+        let decoded = try ComposeConfig(json: json)
+        XCTAssertEqual(String(decoding: try decoded.jsonData(), as: UTF8.self), String(decoding: json, as: UTF8.self))
+        XCTAssertEqual(decoded.startupOrder, ["db", "web"])
+        XCTAssertEqual(decoded.infoPlistExtras["ExampleRatio"], .real(1.5))
+        XCTAssertEqual(decoded.healthchecks, [.http(url: "http://127.0.0.1:8080/health", path: "/health")])
+        XCTAssertNoThrow(try decoded.validate())
+    }
+
+    func testConfigJSONRoundTripKeepsSecrets() throws {
+        let yaml = """
+        services:
+          db:
+            image: postgres:16
+            environment:
+              DB_PASSWORD: ${DB_PASSWORD:-hunter2}
+        \(validXContainerfy)
+        """
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))
+        let decoded = try ComposeConfig(json: try config.jsonData())
+        XCTAssertEqual(decoded.serviceSpecs.first?.environment, [EnvironmentVariable(name: "DB_PASSWORD", value: "hunter2")])
+        XCTAssertEqual(decoded.renderedCompose, config.renderedCompose)
+        XCTAssertTrue(try XCTUnwrap(decoded.renderedCompose).contains("DB_PASSWORD: hunter2"))
+
+        // Only the printed forms are masked, the rendered compose file included
+        let printed = try PackCommand.configJSON(config)
+        XCTAssertFalse(printed.contains("hunter2"), printed)
+        XCTAssertTrue(printed.contains("DB_PASSWORD: \(EnvironmentVariable.mask)"), printed)
+        XCTAssertFalse(PackCommand.configText(config).contains("hunter2"))
+    }
+
+    func testValidateReportsEveryProblemInAnEditedConfig() throws {
+        let config = try ComposeConfigParser.parseBuild(composePath: writeCompose(roundTripCompose()))
+        var object = try XCTUnwrap(JSONSerialization.jsonObject(with: try config.jsonData()) as? [String: Any])
+        object["cpuMin"] = 0
+        object["identifier"] = "not a bundle id"
+        object["healthchecks"] = [["tcp": ["port": 9999]]]
+        let edited = try ComposeConfig(json: JSONSerialization.data(withJSONObject: object))
+
+        XCTAssertThrowsError(try edited.validate()) { error in
+            guard let ce = error as? CError, case .multiple(let errors) = ce else {
+                return XCTFail("Expected multiple, got: \(error)")
+            }
+            XCTAssertEqual(errors.count, 3, "\(errors)")
+            guard case .outOfRange("x-containerfy.vm.cpu.min", "0", _) = errors[1],
+                  case .invalidValue("x-containerfy.healthchecks[0].tcp.port", "9999", _) = errors[2] else {
+                return XCTFail("Unexpected errors: \(errors)")
+            }
+        }
+    }
+
+    // MARK: - Error Codes
+
+    private func problems(_ yaml: String) -> [ComposeConfigParser.ValidationProblem] {
+        do {
+            _ = try ComposeConfigParser.parseBuild(composePath: writeCompose(yaml))
+            XCTFail("Expected validation to fail")
+            return []
+        } catch {
+            return ComposeConfigParser.validationProblems(in: error)
+        }
+    }
+
+    func testErrorCodesAndFieldPaths() {
+        let missing = problems("""
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+        x-containerfy:
+          name: testapp
+          version: "1.0.0"
+          identifier: com.example.testapp
+          vm:
+            memory_mb:
+              min: 1024
+            disk_mb: 4096
+        """)
+        XCTAssertEqual(missing, [ComposeConfigParser.ValidationProblem(
+            code: .missingField, field: "x-containerfy.vm.cpu", message: "x-containerfy.vm.cpu is required"
+        )])
+
+        let range = problems(validXContainerfy.replacingOccurrences(of: "min: 2", with: "min: 0") + """
+
+        services:
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+        """)
+        XCTAssertEqual(range.map(\.code), [.range])
+        XCTAssertEqual(range.first?.field, "x-containerfy.vm.cpu.min")
+        XCTAssertEqual(range.first?.message, "x-containerfy.vm.cpu.min \"0\" is invalid: must be 1-16")
+    }
+
+    func testMultipleProblemsAreFlattenedWithCodes() {
+        let found = problems("""
+        services:
+          web:
+            build: .
+            ports:
+              - "8080:80"
+          worker:
+            image: nginx
+            ports:
+              - "70000:80"
+        \(validXContainerfy)
+        """)
+        XCTAssertEqual(found.map(\.code), [.unsupported, .range])
+        XCTAssertEqual(found.map(\.field), ["services.web", "services.worker.ports"])
+    }
+
+    func testYAMLSyntaxErrorIsInvalidFormat() {
+        let found = problems("services:\n  web: [unclosed\n")
+        XCTAssertEqual(found.map(\.code), [.invalidFormat])
+        XCTAssertNil(found.first?.field)
+    }
+
+    func testProblemsJSON() throws {
+        let json = ValidateCommand.problemsJSON([
+            ComposeConfigParser.ValidationProblem(code: .unsupported, field: "services.web", message: "no build"),
+            ComposeConfigParser.ValidationProblem(code: .invalid, field: nil, message: "bad"),
+        ])
+        let object = try JSONSerialization.jsonObject(with: Data(json.utf8)) as? [String: [[String: String]]]
+        XCTAssertEqual(object?["errors"], [
+            ["code": "UNSUPPORTED", "field": "services.web", "message": "no build"],
+            ["code": "INVALID", "message": "bad"],
+        ])
     }
 
     // MARK: - File Not Found
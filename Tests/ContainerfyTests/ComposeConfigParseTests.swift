@@ -19,6 +19,7 @@ final class ComposeConfigParseTests: XCTestCase {
         XCTAssertEqual(config.portMappings.count, 1)
         XCTAssertEqual(config.portMappings[0].hostPort, 8080)
         XCTAssertEqual(config.portMappings[0].containerPort, 80)
+        XCTAssertEqual(config.portMappings[0].protocol, "tcp")
     }
 
     func testPortStringSamePort() throws {
@@ -33,6 +34,7 @@ final class ComposeConfigParseTests: XCTestCase {
         XCTAssertEqual(config.portMappings.count, 1)
         XCTAssertEqual(config.portMappings[0].hostPort, 8080)
         XCTAssertEqual(config.portMappings[0].containerPort, 8080)
+        XCTAssertEqual(config.portMappings[0].protocol, "tcp")
     }
 
     func testPortInteger() throws {
@@ -47,6 +49,7 @@ final class ComposeConfigParseTests: XCTestCase {
         XCTAssertEqual(config.portMappings.count, 1)
         XCTAssertEqual(config.portMappings[0].hostPort, 8080)
         XCTAssertEqual(config.portMappings[0].containerPort, 8080)
+        XCTAssertEqual(config.portMappings[0].protocol, "tcp")
     }
 
     func testPortLongForm() throws {
@@ -62,6 +65,7 @@ final class ComposeConfigParseTests: XCTestCase {
         XCTAssertEqual(config.portMappings.count, 1)
         XCTAssertEqual(config.portMappings[0].hostPort, 8080)
         XCTAssertEqual(config.portMappings[0].containerPort, 80)
+        XCTAssertEqual(config.portMappings[0].protocol, "tcp")
     }
 
     func testPortWithIPPrefix() throws {
@@ -76,6 +80,7 @@ final class ComposeConfigParseTests: XCTestCase {
         XCTAssertEqual(config.portMappings.count, 1)
         XCTAssertEqual(config.portMappings[0].hostPort, 8080)
         XCTAssertEqual(config.portMappings[0].containerPort, 80)
+        XCTAssertEqual(config.portMappings[0].protocol, "tcp")
     }
 
     func testPortWithProtocol() throws {
@@ -90,6 +95,40 @@ final class ComposeConfigParseTests: XCTestCase {
         XCTAssertEqual(config.portMappings.count, 1)
         XCTAssertEqual(config.portMappings[0].hostPort, 8080)
         XCTAssertEqual(config.portMappings[0].containerPort, 80)
+        XCTAssertEqual(config.portMappings[0].protocol, "tcp")
+    }
+
+    func testPortUDPSuffix() throws {
+        let yaml = """
+        services:
+          dns:
+            image: coredns/coredns
+            ports:
+              - "5353:53/udp"
+              - "5353:53/tcp"
+        """
+        let config = try ComposeConfigParser.parse(yaml: yaml)
+        XCTAssertEqual(config.portMappings, [
+            PortMapping(hostPort: 5353, containerPort: 53, protocol: "udp"),
+            PortMapping(hostPort: 5353, containerPort: 53, protocol: "tcp"),
+        ])
+        XCTAssertEqual(config.services[0].openURL?.absoluteString, "http://127.0.0.1:5353")
+    }
+
+    func testPortLongFormUDP() throws {
+        let yaml = """
+        services:
+          syslog:
+            image: rsyslog
+            ports:
+              - published: 5514
+                target: 514
+                protocol: UDP
+        """
+        let config = try ComposeConfigParser.parse(yaml: yaml)
+        XCTAssertEqual(config.portMappings, [PortMapping(hostPort: 5514, containerPort: 514, protocol: "udp")])
+        XCTAssertEqual(config.portMappings[0].notation, "5514:514/udp")
+        XCTAssertNil(config.services[0].openURL, "UDP-only services get no Open menu item")
     }
 
     // MARK: - Port Edge Cases
@@ -332,6 +371,28 @@ final class ComposeConfigParseTests: XCTestCase {
         XCTAssertEqual(config.portMappings.count, 2)
     }
 
+    // MARK: - Anchors and Merge Keys
+
+    func testMergeKeysExpandedIntoServices() throws {
+        let yaml = """
+        x-base: &base
+          image: nginx
+          ports:
+            - "8080:80"
+        services:
+          alpha:
+            <<: *base
+          beta:
+            <<: *base
+            ports:
+              - "8081:80"
+        """
+        let config = try ComposeConfigParser.parse(yaml: yaml)
+        XCTAssertEqual(config.services.map(\.name), ["alpha", "beta"])
+        XCTAssertEqual(config.services[0].ports.map(\.hostPort), [8080])
+        XCTAssertEqual(config.services[1].ports.map(\.hostPort), [8081], "Explicit keys override merged ones")
+    }
+
     // MARK: - Invalid YAML / Structure
 
     func testInvalidYAMLThrows() {
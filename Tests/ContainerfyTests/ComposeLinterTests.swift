@@ -0,0 +1,211 @@
+import XCTest
+@testable import ContainerfyCore
+
+final class ComposeLinterTests: XCTestCase {
+
+    private var tempDir: URL!
+
+    override func setUp() {
+        super.setUp()
+        tempDir = FileManager.default.temporaryDirectory
+            .appendingPathComponent("containerfy-lint-tests-\(UUID().uuidString)")
+        try! FileManager.default.createDirectory(at: tempDir, withIntermediateDirectories: true)
+    }
+
+    override func tearDown() {
+        try? FileManager.default.removeItem(at: tempDir)
+        super.tearDown()
+    }
+
+    /// A 1024x1024 PNG header, enough for parseBuild to accept the icon.
+    private func writeIcon() {
+        var bytes: [UInt8] = [0x89, 0x50, 0x4E, 0x47, 0x0D, 0x0A, 0x1A, 0x0A, 0, 0, 0, 13]
+        bytes += Array("IHDR".utf8)
+        bytes += [0, 0, 4, 0, 0, 0, 4, 0, 8, 6, 0, 0, 0]
+        FileManager.default.createFile(atPath: tempDir.appendingPathComponent("icon.png").path, contents: Data(bytes))
+    }
+
+    private func parse(
+        services: String, cpuRecommended: Int = 4, diskMB: Int = 4096, polished: Bool = true
+    ) throws -> ComposeConfig {
+        if polished { writeIcon() }
+        let yaml = """
+        services:
+        \(services)
+        x-containerfy:
+          name: testapp
+          \(polished ? "display_name: Test App" : "")
+          \(polished ? "icon: icon.png" : "")
+          version: "1.0.0"
+          identifier: com.example.testapp
+          vm:
+            cpu:
+              min: 2
+              recommended: \(cpuRecommended)
+            memory_mb:
+              min: 1024
+              recommended: 2048
+            disk_mb: \(diskMB)
+        """
+        let path = tempDir.appendingPathComponent("docker-compose.yml").path
+        FileManager.default.createFile(atPath: path, contents: yaml.data(using: .utf8))
+        return try ComposeConfigParser.parseBuild(composePath: path)
+    }
+
+    private func rules(_ findings: [ComposeLinter.Finding]) -> [String] {
+        findings.map(\.rule)
+    }
+
+    // MARK: - Rules
+
+    func testCleanServiceHasNoFindings() throws {
+        let config = try parse(services: """
+          web:
+            image: nginx:1.27
+            restart: unless-stopped
+            ports:
+              - "8080:80"
+            healthcheck:
+              test: ["CMD", "curl", "-f", "http://localhost"]
+              timeout: 5s
+        """)
+        XCTAssertEqual(ComposeLinter.lint(config), [])
+    }
+
+    func testUnpinnedImages() {
+        XCTAssertFalse(ComposeLinter.isPinned("nginx"))
+        XCTAssertFalse(ComposeLinter.isPinned("nginx:latest"))
+        XCTAssertFalse(ComposeLinter.isPinned("registry.local:5000/team/app"))
+        XCTAssertTrue(ComposeLinter.isPinned("registry.local:5000/team/app:2.1"))
+        XCTAssertTrue(ComposeLinter.isPinned("nginx@sha256:0123abcd"))
+    }
+
+    func testFlagsEachBestPracticeRule() throws {
+        let config = try parse(services: """
+          web:
+            image: nginx:latest
+            ports:
+              - "8080:80"
+            healthcheck:
+              test: ["CMD", "true"]
+            environment:
+              DB_PASSWORD: hunter2
+              API_TOKEN: ${API_TOKEN:-}
+              LOG_LEVEL: debug
+        """, cpuRecommended: 16)
+
+        let findings = ComposeLinter.lint(config)
+        XCTAssertEqual(Set(rules(findings)), ["unpinned-image", "healthcheck-timeout", "no-restart-policy", "large-vm", "plaintext-secret"])
+        let secrets = findings.filter { $0.rule == "plaintext-secret" }
+        XCTAssertEqual(secrets.count, 1)
+        XCTAssertTrue(secrets[0].message.contains("DB_PASSWORD"))
+    }
+
+    func testFlagsMissingPolishAndTightSizing() throws {
+        let config = try parse(services: """
+          web:
+            image: nginx:1.27
+            restart: always
+            ports:
+              - "8080:80"
+        """, cpuRecommended: 2, diskMB: 3000, polished: false)
+
+        let findings = ComposeLinter.lint(config)
+        XCTAssertEqual(rules(findings), ["missing-display-name", "missing-icon", "tight-disk", "no-vm-headroom"])
+        let disk = try XCTUnwrap(findings.first { $0.rule == "tight-disk" })
+        XCTAssertTrue(disk.message.contains("leaves 1976 MB"), disk.message)
+        let headroom = findings.filter { $0.rule == "no-vm-headroom" }
+        XCTAssertEqual(headroom.count, 1)
+        XCTAssertTrue(headroom[0].message.contains("cpu.recommended"))
+        XCTAssertEqual(headroom[0].line, "info: [no-vm-headroom] \(headroom[0].message)")
+    }
+
+    func testListFormEnvironmentIsChecked() throws {
+        let config = try parse(services: """
+          web:
+            image: nginx:1.27
+            restart: always
+            ports:
+              - "8080:80"
+            environment:
+              - SECRET_KEY=abc
+              - AWS_SECRET_ACCESS_KEY
+        """)
+        let findings = ComposeLinter.lint(config)
+        XCTAssertEqual(rules(findings), ["plaintext-secret"])
+        XCTAssertTrue(findings[0].message.contains("SECRET_KEY"))
+    }
+
+    func testParserWarningsBecomeFindings() throws {
+        let config = try parse(services: """
+          web:
+            image: nginx:1.27
+            restart: always
+            ports:
+              - "80:80"
+        """)
+        XCTAssertEqual(rules(ComposeLinter.lint(config)), [ComposeLinter.parserRuleID])
+    }
+
+    func testDisabledRulesAreSkipped() throws {
+        let config = try parse(services: """
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+        """)
+        let findings = ComposeLinter.lint(config, disabled: ["unpinned-image", "no-restart-policy"])
+        XCTAssertEqual(findings, [])
+    }
+
+    // MARK: - Command
+
+    func testStrictExitsNonZeroOnFindings() throws {
+        _ = try parse(services: """
+          web:
+            image: nginx
+            ports:
+              - "8080:80"
+        """)
+        let path = tempDir.appendingPathComponent("docker-compose.yml").path
+        XCTAssertEqual(LintCommand().run(arguments: ["--compose", path]), 0)
+        XCTAssertEqual(LintCommand().run(arguments: ["--compose", path, "--strict"]), 1)
+        XCTAssertEqual(LintCommand().run(arguments: [
+            "--compose", path, "--strict", "--disable-rule", "unpinned-image",
+        ]), 0, "Info findings don't fail --strict")
+        XCTAssertEqual(LintCommand().run(arguments: [
+            "--compose", path, "--strict", "--override-image", "web=nginx:1.27",
+        ]), 0, "The overridden image is linted")
+        XCTAssertEqual(LintCommand().run(arguments: [
+            "--compose", path, "--strict",
+            "--disable-rule", "unpinned-image", "--disable-rule", "no-restart-policy",
+        ]), 0)
+    }
+
+    func testValidateLintFailsOnlyUnderStrict() throws {
+        _ = try parse(services: """
+          web:
+            image: nginx:1.27
+            restart: always
+            ports:
+              - "8080:80"
+        """, polished: false)
+        let path = tempDir.appendingPathComponent("docker-compose.yml").path
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", path, "--strict"]), 0, "Lint rules only run with --lint")
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", path, "--lint"]), 0)
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", path, "--lint", "--strict"]), 0, "Info findings don't fail --strict")
+
+        _ = try parse(services: """
+          web:
+            image: nginx
+            restart: always
+            ports:
+              - "8080:80"
+        """, polished: false)
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", path, "--lint", "--strict"]), 1, "Unpinned image is a warning")
+    }
+
+    func testUnknownRuleIsRejected() {
+        XCTAssertEqual(LintCommand().run(arguments: ["--disable-rule", "no-such-rule"]), 1)
+    }
+}
@@ -0,0 +1,142 @@
+import XCTest
+@testable import ContainerfyCore
+
+final class DoctorCommandTests: XCTestCase {
+
+    private func doctor(
+        shell: MockShellExecutor = MockShellExecutor(),
+        missingTools: Set<String> = [],
+        freeMB: Int64? = 10_000,
+        binariesFound: Bool = true
+    ) -> DoctorCommand {
+        DoctorCommand(
+            signer: CodeSigner(shell: shell),
+            isExecutable: { !missingTools.contains($0) },
+            freeBytes: { _ in freeMB.map { $0 * 1024 * 1024 } },
+            locateBinaries: {
+                guard binariesFound else {
+                    throw BundleAssembler.AssemblyError.missingArtifact("podman not found at /opt/containerfy/podman")
+                }
+                return ("/opt/containerfy/podman", "/opt/containerfy/gvproxy", "/opt/containerfy/vfkit")
+            }
+        )
+    }
+
+    private func status(_ checks: [DoctorCommand.Check], _ name: String) -> DoctorCommand.Check.Status? {
+        checks.first { $0.name == name }?.status
+    }
+
+    func testAllChecksPass() {
+        let checks = doctor().checks(identity: nil, notary: nil, tempDir: "/tmp")
+        XCTAssertTrue(checks.allSatisfy { $0.status == .pass }, DoctorCommand.table(checks))
+        XCTAssertEqual(checks.first?.detail, "/opt/containerfy")
+        XCTAssertEqual(doctor().run(arguments: []), 0)
+    }
+
+    func testMissingBinariesAndLowDiskFail() {
+        let checks = doctor(freeMB: 512, binariesFound: false).checks(identity: nil, notary: nil, tempDir: "/tmp")
+        XCTAssertEqual(status(checks, "podman binaries"), .fail)
+        XCTAssertEqual(status(checks, "free disk"), .fail)
+        XCTAssertEqual(doctor(binariesFound: false).run(arguments: []), 1)
+    }
+
+    func testSigningToolsAreHardRequirementsOnlyWhenRequested() {
+        let missing: Set<String> = ["/usr/bin/codesign", "/usr/bin/xcrun", "/usr/bin/iconutil"]
+        let unsigned = doctor(missingTools: missing).checks(identity: nil, notary: nil, tempDir: "/tmp")
+        XCTAssertEqual(status(unsigned, "codesign"), .warn)
+        XCTAssertEqual(status(unsigned, "xcrun"), .warn)
+        XCTAssertEqual(status(unsigned, "iconutil"), .warn)
+        XCTAssertFalse(unsigned.contains { $0.status == .fail })
+
+        let signed = doctor(missingTools: missing).checks(identity: "Developer ID Application: Example", notary: .keychainProfile("notary"), tempDir: "/tmp")
+        XCTAssertEqual(status(signed, "codesign"), .fail)
+        XCTAssertEqual(status(signed, "xcrun"), .fail)
+    }
+
+    func testSigningIdentityMustBeInKeychain() {
+        let shell = MockShellExecutor()
+        shell.resultToReturn = ProcessResult(exitCode: 0, stdout: """
+              1) 0123456789ABCDEF0123456789ABCDEF01234567 "Developer ID Application: Example Corp (TEAM123456)"
+                 1 valid identities found
+            """, stderr: "")
+
+        let found = doctor(shell: shell).checks(identity: "Developer ID Application: Example Corp (TEAM123456)", notary: nil, tempDir: "/tmp")
+        XCTAssertEqual(status(found, "signing identity"), .pass)
+
+        let missing = doctor(shell: shell).checks(identity: "Developer ID Application: Someone Else", notary: nil, tempDir: "/tmp")
+        XCTAssertEqual(status(missing, "signing identity"), .fail)
+    }
+
+    /// Fake `security` and `xcrun`: one certificate, one saved notary profile ("release"), and
+    /// whichever xcrun tools are listed.
+    private func signingShell(xcrunTools: Set<String> = ["notarytool", "stapler"]) -> MockShellExecutor {
+        let shell = MockShellExecutor()
+        shell.handler = { call in
+            switch (call.executable, call.arguments.first) {
+            case ("/usr/bin/security", "find-identity"):
+                return ProcessResult(exitCode: 0, stdout: """
+                      1) 0123456789ABCDEF0123456789ABCDEF01234567 "Developer ID Application: Example Corp (TEAM123456)"
+                         1 valid identities found
+                    """, stderr: "")
+            case ("/usr/bin/security", "find-generic-password"):
+                let found = call.arguments.last == "com.apple.gke.notary.tool.saved-creds.release"
+                return ProcessResult(exitCode: found ? 0 : 44, stdout: "", stderr: found ? "" : "The specified item could not be found in the keychain.")
+            case ("/usr/bin/xcrun", "--find"):
+                let tool = call.arguments[1]
+                return xcrunTools.contains(tool)
+                    ? ProcessResult(exitCode: 0, stdout: "/Library/Developer/CommandLineTools/usr/bin/\(tool)\n", stderr: "")
+                    : ProcessResult(exitCode: 72, stdout: "", stderr: "xcrun: error: unable to find utility \"\(tool)\"")
+            default:
+                return ProcessResult(exitCode: 1, stdout: "", stderr: "unexpected command")
+            }
+        }
+        return shell
+    }
+
+    func testSigningChecksPassWithIdentityProfileAndTools() {
+        let shell = signingShell()
+        let checks = doctor(shell: shell).signingChecks(
+            identity: "Developer ID Application: Example Corp (TEAM123456)", notary: .keychainProfile("release")
+        )
+        XCTAssertEqual(checks.map(\.name), ["codesign", "signing identity", "xcrun", "notarytool", "stapler", "notary profile"])
+        XCTAssertTrue(checks.allSatisfy { $0.status == .pass }, DoctorCommand.table(checks))
+        XCTAssertEqual(checks.first { $0.name == "stapler" }?.detail, "/Library/Developer/CommandLineTools/usr/bin/stapler")
+    }
+
+    func testSigningChecksReportMissingProfileAndTool() {
+        let checks = doctor(shell: signingShell(xcrunTools: ["notarytool"])).signingChecks(
+            identity: "Developer ID Application: Someone Else", notary: .keychainProfile("staging")
+        )
+        XCTAssertEqual(status(checks, "signing identity"), .fail)
+        XCTAssertEqual(status(checks, "notarytool"), .pass)
+        XCTAssertEqual(status(checks, "stapler"), .fail)
+        XCTAssertEqual(status(checks, "notary profile"), .fail)
+        XCTAssertTrue(checks.first { $0.name == "notary profile" }?.detail.contains("store-credentials staging") == true)
+    }
+
+    func testSigningChecksSkipNotarizationWithoutNotary() {
+        let shell = signingShell()
+        let checks = doctor(shell: shell).signingChecks(identity: "Developer ID Application: Example Corp (TEAM123456)", notary: nil)
+        XCTAssertEqual(checks.map(\.name), ["codesign", "signing identity", "xcrun"])
+        XCTAssertFalse(shell.calls.contains { $0.executable == "/usr/bin/xcrun" })
+    }
+
+    func testSigningChecksDontLookUpAProfileForAppleIDCredentials() {
+        let shell = signingShell()
+        let checks = doctor(shell: shell).signingChecks(identity: nil, notary: .appleID("dev@example.com", teamID: "TEAM123456", password: "secret"))
+        XCTAssertEqual(checks.map(\.name), ["codesign", "xcrun", "notarytool", "stapler"])
+        XCTAssertFalse(shell.calls.contains { $0.arguments.first == "find-generic-password" })
+    }
+
+    func testTableAlignsColumns() {
+        let table = DoctorCommand.table([
+            DoctorCommand.Check(name: "codesign", status: .pass, detail: "/usr/bin/codesign"),
+            DoctorCommand.Check(name: "free disk", status: .fail, detail: "512 MB free"),
+        ])
+        XCTAssertEqual(table, """
+            Check      Status  Detail
+            codesign   ok      /usr/bin/codesign
+            free disk  FAIL    512 MB free
+            """)
+    }
+}
@@ -0,0 +1,95 @@
+import XCTest
+@testable import ContainerfyCore
+
+final class InspectCommandTests: XCTestCase {
+
+    private var appPath: String!
+
+    override func setUp() {
+        super.setUp()
+        appPath = NSTemporaryDirectory() + "inspect-test-\(ProcessInfo.processInfo.globallyUniqueString)/MyApp.app"
+        let resources = (appPath as NSString).appendingPathComponent("Contents/Resources")
+        try? FileManager.default.createDirectory(atPath: resources, withIntermediateDirectories: true)
+    }
+
+    override func tearDown() {
+        try? FileManager.default.removeItem(atPath: (appPath as NSString).deletingLastPathComponent)
+        super.tearDown()
+    }
+
+    private var resources: String {
+        (appPath as NSString).appendingPathComponent("Contents/Resources")
+    }
+
+    private func writeBundle() throws {
+        let plist: [String: Any] = [
+            "CFBundleName": "myapp",
+            "CFBundleDisplayName": "My App",
+            "CFBundleIdentifier": "com.example.myapp",
+            "CFBundleShortVersionString": "1.2.0",
+            BundleAssembler.composeDigestKey: "abc123",
+            BundleAssembler.configDigestKey: "def456",
+            BundleAssembler.builderVersionKey: "1.4.0",
+        ]
+        let data = try PropertyListSerialization.data(fromPropertyList: plist, format: .xml, options: 0)
+        FileManager.default.createFile(atPath: (appPath as NSString).appendingPathComponent("Contents/Info.plist"), contents: data)
+
+        try "services: {}\n".write(toFile: (resources as NSString).appendingPathComponent("docker-compose.yml"), atomically: true, encoding: .utf8)
+        var runtime = RuntimeConfig(config: .empty)
+        runtime.services = [
+            RuntimeConfig.Service(name: "web", displayLabel: "Web", image: "nginx:1.27", ports: [RuntimeConfig.Port(host: 8080, container: 80, protocol: "tcp")], restart: nil),
+            RuntimeConfig.Service(name: "dns", displayLabel: "dns", image: "coredns:1.11", ports: [RuntimeConfig.Port(host: 5353, container: 53, protocol: "udp")], restart: nil),
+        ]
+        try runtime.write(toResourcesPath: resources)
+        try BundleLayout(
+            schemaVersion: 1, compose: "docker-compose.yml", runtime: RuntimeConfig.fileName, envFiles: [],
+            labels: nil, caCertificates: nil, license: nil
+        ).write(toResourcesPath: resources)
+    }
+
+    func testInspectReportsBundleContents() throws {
+        try writeBundle()
+        let shell = MockShellExecutor()
+        shell.resultToReturn = ProcessResult(exitCode: 0, stdout: "", stderr: "Executable=/x\nSignature=adhoc\nTeamIdentifier=not set")
+
+        let report = try InspectCommand(signer: CodeSigner(shell: shell)).inspect(appPath: appPath)
+        XCTAssertEqual(report.identifier, "com.example.myapp")
+        XCTAssertEqual(report.version, "1.2.0")
+        XCTAssertEqual(report.displayName, "My App")
+        XCTAssertEqual(report.composeSHA256, "abc123")
+        XCTAssertEqual(report.configSHA256, "def456")
+        XCTAssertEqual(report.builderVersion, "1.4.0")
+        XCTAssertEqual(report.images, ["coredns:1.11", "nginx:1.27"])
+        XCTAssertEqual(report.services.map(\.ports), [["8080:80"], ["5353:53/udp"]])
+        XCTAssertEqual(report.files.map(\.path), ["docker-compose.yml", "layout.json", "runtime.json"])
+        XCTAssertEqual(report.signature.summary, "ad-hoc signed")
+        XCTAssertEqual(shell.calls.first?.arguments, ["-dv", "--verbose=2", appPath])
+
+        let json = try InspectCommand.reportJSON(report)
+        XCTAssertTrue(json.contains("\"identifier\" : \"com.example.myapp\""))
+        XCTAssertTrue(json.contains("\"ad_hoc\" : true"))
+    }
+
+    func testNotABundleFails() {
+        let command = InspectCommand(signer: CodeSigner(shell: MockShellExecutor()))
+        XCTAssertEqual(command.run(arguments: [appPath]), 1)
+        XCTAssertEqual(command.run(arguments: []), 1)
+        XCTAssertEqual(command.run(arguments: ["--bogus"]), 1)
+    }
+
+    func testParseSignatureInfo() {
+        let developerID = CodeSigner.parseSignatureInfo(ProcessResult(exitCode: 0, stdout: "", stderr: """
+            Executable=/Applications/MyApp.app/Contents/MacOS/Containerfy
+            Authority=Developer ID Application: Example Corp (TEAM123456)
+            Authority=Developer ID Certification Authority
+            Authority=Apple Root CA
+            TeamIdentifier=TEAM123456
+            """))
+        XCTAssertEqual(developerID, CodeSigner.SignatureInfo(
+            signed: true, adHoc: false, authority: "Developer ID Application: Example Corp (TEAM123456)", teamID: "TEAM123456"
+        ))
+
+        let unsigned = CodeSigner.parseSignatureInfo(ProcessResult(exitCode: 1, stdout: "", stderr: "MyApp.app: code object is not signed at all"))
+        XCTAssertEqual(unsigned.summary, "unsigned")
+    }
+}
@@ -0,0 +1,54 @@
+import XCTest
+@testable import ContainerfyCore
+
+final class InterruptCleanupTests: XCTestCase {
+
+    private var tmpDir: String!
+
+    override func setUp() {
+        super.setUp()
+        tmpDir = NSTemporaryDirectory() + "cleanup-test-\(ProcessInfo.processInfo.globallyUniqueString)"
+        try? FileManager.default.createDirectory(atPath: tmpDir, withIntermediateDirectories: true)
+    }
+
+    override func tearDown() {
+        try? FileManager.default.removeItem(atPath: tmpDir)
+        super.tearDown()
+    }
+
+    func testCleanUpRemovesTrackedPathsOnly() throws {
+        let fm = FileManager.default
+        let staging = (tmpDir as NSString).appendingPathComponent("staging")
+        let partial = (tmpDir as NSString).appendingPathComponent("Test.dmg")
+        let finished = (tmpDir as NSString).appendingPathComponent("Done.app")
+        try fm.createDirectory(atPath: staging, withIntermediateDirectories: true)
+        try fm.createDirectory(atPath: finished, withIntermediateDirectories: true)
+        fm.createFile(atPath: partial, contents: Data(count: 8))
+
+        let cleanup = InterruptCleanup()
+        cleanup.track(staging)
+        cleanup.track(partial)
+        cleanup.track(finished)
+        cleanup.untrack(finished)
+
+        XCTAssertEqual(cleanup.cleanUp(), [partial, staging])
+        XCTAssertFalse(fm.fileExists(atPath: staging))
+        XCTAssertFalse(fm.fileExists(atPath: partial))
+        XCTAssertTrue(fm.fileExists(atPath: finished))
+        XCTAssertEqual(cleanup.cleanUp(), [], "Cleanup runs once")
+    }
+
+    func testCleanUpTerminatesTrackedProcesses() throws {
+        let process = Process()
+        process.executableURL = URL(fileURLWithPath: "/bin/sleep")
+        process.arguments = ["30"]
+        try process.run()
+
+        let cleanup = InterruptCleanup()
+        cleanup.track(process)
+        cleanup.cleanUp()
+
+        XCTAssertFalse(process.isRunning)
+        XCTAssertEqual(process.terminationReason, .uncaughtSignal)
+    }
+}
@@ -11,12 +11,15 @@ final class MockShellExecutor: ShellExecutor {
 
     var calls: [Call] = []
     var resultToReturn: ProcessResult = ProcessResult(exitCode: 0, stdout: "", stderr: "")
+    /// Answers each call when set, for tests that run several different commands.
+    var handler: ((Call) -> ProcessResult)?
     var errorToThrow: Error?
 
     func run(executable: String, arguments: [String], environment: [String: String]?) throws -> ProcessResult {
-        calls.append(Call(executable: executable, arguments: arguments))
+        let call = Call(executable: executable, arguments: arguments)
+        calls.append(call)
         if let error = errorToThrow { throw error }
-        return resultToReturn
+        return handler?(call) ?? resultToReturn
     }
 }
 
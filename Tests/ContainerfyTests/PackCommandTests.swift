@@ -3,6 +3,34 @@ import XCTest
 
 final class PackCommandTests: XCTestCase {
 
+    /// One pinned nginx service, named testapp, with the smallest VM pack accepts.
+    private static let compose = """
+    services:
+      web:
+        image: nginx:1.27
+        ports:
+          - "8080:80"
+    x-containerfy:
+      name: testapp
+      version: "1.0.0"
+      identifier: com.test.app
+      vm:
+        cpu: { min: 2 }
+        memory_mb: { min: 1024 }
+        disk_mb: 4096
+    """
+
+    /// A scratch project directory with `compose` as its docker-compose.yml, removed when the
+    /// test ends. Returns the directory and the compose file's path.
+    private func makeProject(compose: String = PackCommandTests.compose) throws -> (dir: String, composePath: String) {
+        let dir = NSTemporaryDirectory() + "pack-test-\(ProcessInfo.processInfo.globallyUniqueString)"
+        try FileManager.default.createDirectory(atPath: dir, withIntermediateDirectories: true)
+        addTeardownBlock { try? FileManager.default.removeItem(atPath: dir) }
+        let composePath = (dir as NSString).appendingPathComponent("docker-compose.yml")
+        try compose.write(toFile: composePath, atomically: true, encoding: .utf8)
+        return (dir, composePath)
+    }
+
     func testPackFailsOnBadComposePath() {
         let signer = CodeSigner(shell: MockShellExecutor())
         let command = PackCommand(signer: signer)
@@ -11,20 +39,592 @@ final class PackCommandTests: XCTestCase {
         XCTAssertEqual(exitCode, 1)
     }
 
+    func testPackEmitsEventsToEmbedder() {
+        var events: [PackEvent] = []
+        let signer = CodeSigner(shell: MockShellExecutor())
+        let command = PackCommand(signer: signer, onEvent: { events.append($0) })
+
+        let exitCode = command.run(arguments: ["--compose", "/nonexistent/docker-compose.yml"])
+        XCTAssertEqual(exitCode, 1)
+        XCTAssertEqual(events.map(\.phase), [.parse, .parse])
+        XCTAssertEqual(events.map(\.status), [.started, .failed])
+        XCTAssertEqual(events.first?.step, 1)
+        XCTAssertEqual(events.first?.totalSteps, 3)
+    }
+
+    func testReleaseDMGRequiresIdentityAndProfile() {
+        let shell = MockShellExecutor()
+        let command = PackCommand(signer: CodeSigner(shell: shell))
+
+        XCTAssertEqual(command.run(arguments: ["--release-dmg"]), 1)
+        XCTAssertEqual(command.run(arguments: ["--release-dmg", "--notarize-profile", "release"]), 1)
+        XCTAssertTrue(shell.calls.isEmpty, "Flag validation should fail before any signing tool runs")
+    }
+
+    func testRequireSignedRejectsUnsignedBuild() {
+        var events: [PackEvent] = []
+        let command = PackCommand(signer: CodeSigner(shell: MockShellExecutor()), onEvent: { events.append($0) })
+        XCTAssertEqual(command.run(arguments: ["--require-signed"]), 1)
+        XCTAssertTrue(events.isEmpty, "Should fail before parsing the compose file")
+    }
+
+    func testSignFailsFastOnUnknownIdentity() {
+        var events: [PackEvent] = []
+        let shell = MockShellExecutor()
+        shell.resultToReturn = ProcessResult(exitCode: 0, stdout: "     0 valid identities found", stderr: "")
+        let command = PackCommand(signer: CodeSigner(shell: shell), onEvent: { events.append($0) })
+
+        XCTAssertEqual(command.run(arguments: ["--sign", "Developer ID Application: Nobody"]), 1)
+        XCTAssertTrue(events.isEmpty, "Should fail before parsing the compose file")
+        XCTAssertEqual(shell.calls.map(\.executable), ["/usr/bin/security"])
+    }
+
+    func testSignAppSignsThenVerifies() throws {
+        let shell = MockShellExecutor()
+        try CodeSigner(shell: shell).signApp(appPath: "/tmp/Test.app", identity: "AAAA", onProgress: { _ in })
+
+        XCTAssertEqual(shell.calls.count, 2)
+        XCTAssertEqual(shell.calls[0].arguments.prefix(3), ["--force", "--sign", "AAAA"])
+        XCTAssertEqual(shell.calls[1].arguments, ["--verify", "--deep", "--strict", "/tmp/Test.app"])
+        let entitlements = try XCTUnwrap(shell.calls[0].arguments.firstIndex(of: "--entitlements"))
+        XCTAssertFalse(FileManager.default.fileExists(atPath: shell.calls[0].arguments[entitlements + 1]), "Generated entitlements are removed")
+
+        try CodeSigner(shell: shell).signApp(appPath: "/tmp/Test.app", identity: "AAAA", entitlements: "/tmp/custom.plist", onProgress: { _ in })
+        XCTAssertEqual(shell.calls[2].arguments.suffix(3), ["--entitlements", "/tmp/custom.plist", "/tmp/Test.app"])
+    }
+
+    func testGeneratedEntitlements() throws {
+        let data = Data(BundleAssembler.generateEntitlementsPlist().utf8)
+        let plist = try XCTUnwrap(PropertyListSerialization.propertyList(from: data, format: nil) as? [String: Bool])
+        XCTAssertEqual(plist, [
+            "com.apple.security.virtualization": true,
+            "com.apple.security.hypervisor": true,
+            "com.apple.security.network.server": true,
+            "com.apple.security.network.client": true,
+        ])
+    }
+
+    func testEntitlementsFlagRequiresSigning() throws {
+        let path = FileManager.default.temporaryDirectory.appendingPathComponent("entitlements-\(UUID().uuidString).plist").path
+        try BundleAssembler.generateEntitlementsPlist().write(toFile: path, atomically: true, encoding: .utf8)
+        defer { try? FileManager.default.removeItem(atPath: path) }
+
+        let command = PackCommand(signer: CodeSigner(shell: MockShellExecutor()))
+        XCTAssertEqual(command.run(arguments: ["--entitlements", path]), 1)
+        XCTAssertEqual(command.run(arguments: ["--entitlements", "/nonexistent.plist", "--sign", "AAAA"]), 1)
+    }
+
+    func testCreateDMGUsesVolumeName() throws {
+        let tmp = FileManager.default.temporaryDirectory.appendingPathComponent("containerfy-dmg-test-\(UUID().uuidString)")
+        let app = tmp.appendingPathComponent("Test.app")
+        try FileManager.default.createDirectory(at: app, withIntermediateDirectories: true)
+        defer { try? FileManager.default.removeItem(at: tmp) }
+
+        let shell = MockShellExecutor()
+        let dmgPath = try CodeSigner(shell: shell).createDMG(
+            appPath: app.path, appName: "Test", volumeName: "Test App", outputDir: tmp.path
+        )
+        XCTAssertEqual(dmgPath, tmp.appendingPathComponent("Test.dmg").path)
+        XCTAssertEqual(shell.calls.map(\.executable), ["/usr/bin/hdiutil"])
+        XCTAssertEqual(shell.calls[0].arguments.prefix(3), ["create", "-volname", "Test App"])
+    }
+
+    func testCreateDMGExplainsMissingHdiutil() throws {
+        let tmp = FileManager.default.temporaryDirectory.appendingPathComponent("containerfy-dmg-test-\(UUID().uuidString)")
+        let app = tmp.appendingPathComponent("Test.app")
+        try FileManager.default.createDirectory(at: app, withIntermediateDirectories: true)
+        defer { try? FileManager.default.removeItem(at: tmp) }
+
+        let shell = MockShellExecutor()
+        shell.errorToThrow = NSError(domain: NSCocoaErrorDomain, code: NSFileNoSuchFileError)
+        XCTAssertThrowsError(try CodeSigner(shell: shell).createDMG(
+            appPath: app.path, appName: "Test", volumeName: "Test", outputDir: tmp.path
+        )) { error in
+            XCTAssertTrue(error.localizedDescription.contains("hdiutil could not be run"))
+        }
+    }
+
+    func testIncompleteAppleIDCredentialsRejected() {
+        let shell = MockShellExecutor()
+        let command = PackCommand(signer: CodeSigner(shell: shell))
+
+        XCTAssertEqual(command.run(arguments: ["--apple-id", "dev@example.com", "--team-id", "TEAM1"]), 1)
+        XCTAssertEqual(command.run(arguments: [
+            "--signed", "release", "--apple-id", "dev@example.com", "--team-id", "TEAM1", "--app-password", "abcd",
+        ]), 1)
+        XCTAssertTrue(shell.calls.isEmpty)
+    }
+
+    func testNotaryCredentialArguments() {
+        XCTAssertEqual(CodeSigner.NotaryCredentials.keychainProfile("release").notarytoolArguments, ["--keychain-profile", "release"])
+        XCTAssertEqual(
+            CodeSigner.NotaryCredentials.appleID("dev@example.com", teamID: "TEAM1", password: "abcd").notarytoolArguments,
+            ["--apple-id", "dev@example.com", "--team-id", "TEAM1", "--password", "abcd"]
+        )
+    }
+
+    func testParseNotarySubmission() {
+        let submission = CodeSigner.parseNotarySubmission("""
+            {"id":"2efe2717-52ef-43a5-96dc-0797e4ca1041","message":"Processing complete","status":"Invalid"}
+            """)
+        XCTAssertEqual(submission, CodeSigner.NotarySubmission(
+            id: "2efe2717-52ef-43a5-96dc-0797e4ca1041", status: "Invalid", message: "Processing complete"
+        ))
+        XCTAssertNil(CodeSigner.parseNotarySubmission("Error: HTTP status code: 401"))
+    }
+
+    func testResolveIdentityPrefersRequestedIdentity() throws {
+        let shell = MockShellExecutor()
+        shell.resultToReturn = ProcessResult(exitCode: 0, stdout: """
+              1) AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA "Developer ID Application: One (TEAM1)"
+              2) BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB "Developer ID Application: Two (TEAM2)"
+                 2 valid identities found
+            """, stderr: "")
+        let signer = CodeSigner(shell: shell)
+
+        XCTAssertEqual(try signer.resolveIdentity(preferred: "Developer ID Application: Two (TEAM2)"), "BBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBBB")
+        XCTAssertEqual(try signer.resolveIdentity(preferred: "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa"), "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA")
+        XCTAssertThrowsError(try signer.resolveIdentity(preferred: "Developer ID Application: Three"))
+    }
+
     func testPackFailsWhenPodmanNotInstalled() throws {
-        // Create a temporary compose file
+        let (_, composePath) = try makeProject()
+
+        // Pack will fail at "Locating podman binaries" step if podman is not installed,
+        // or succeed if it is. Either way, compose parsing should succeed.
+        let signer = CodeSigner(shell: MockShellExecutor())
+        let command = PackCommand(signer: signer)
+        let exitCode = command.run(arguments: ["--compose", composePath])
+        // We just verify it doesn't crash — exit code depends on whether podman is installed
+        XCTAssertTrue(exitCode == 0 || exitCode == 1)
+    }
+
+    func testPrintConfigStopsBeforeBuilding() throws {
+        let (_, composePath) = try makeProject()
+
+        var events: [PackEvent] = []
+        let command = PackCommand(signer: CodeSigner(shell: MockShellExecutor()), onEvent: { events.append($0) })
+        XCTAssertEqual(command.run(arguments: ["--compose", composePath, "--print-config", "--json"]), 0)
+        XCTAssertTrue(events.isEmpty, "--print-config should not start the build pipeline")
+
+        let config = try ComposeConfigParser.parseBuild(composePath: composePath)
+        let json = try PackCommand.configJSON(config)
+        XCTAssertTrue(json.contains("\"identifier\" : \"com.test.app\""))
+        XCTAssertTrue(PackCommand.configText(config).contains("web: nginx:1.27"))
+    }
+
+    func testDryRunRunsNoToolsAndWritesNothing() throws {
+        let (tmpDir, composePath) = try makeProject()
+        let fm = FileManager.default
+
+        let shell = MockShellExecutor()
+        var events: [PackEvent] = []
+        let command = PackCommand(signer: CodeSigner(shell: shell), onEvent: { events.append($0) })
+        let output = (tmpDir as NSString).appendingPathComponent("out/testapp")
+        XCTAssertEqual(command.run(arguments: [
+            "--compose", composePath, "--output", output, "--dmg", "--placeholder-artifacts", "--dry-run",
+        ]), 0)
+
+        XCTAssertTrue(shell.calls.isEmpty, "--dry-run should not run any tools: \(shell.calls.map(\.executable))")
+        XCTAssertTrue(events.isEmpty, "--dry-run should not start the build pipeline")
+        XCTAssertFalse(fm.fileExists(atPath: (tmpDir as NSString).appendingPathComponent("out")))
+    }
+
+    func testSigningCheckRunsOnlySigningChecks() {
+        let shell = MockShellExecutor()
+        var events: [PackEvent] = []
+        let command = PackCommand(signer: CodeSigner(shell: shell), onEvent: { events.append($0) })
+        XCTAssertEqual(command.run(arguments: ["--signing-check"]), 1)
+        XCTAssertTrue(shell.calls.isEmpty)
+
+        // The compose file doesn't exist: nothing is parsed or built, only the keychain is asked
+        _ = command.run(arguments: [
+            "--compose", "/nonexistent/docker-compose.yml", "--signing-check", "--sign", "Developer ID Application: Example",
+        ])
+        XCTAssertEqual(shell.calls.map(\.arguments.first), ["find-identity"])
+        XCTAssertTrue(events.isEmpty, "--signing-check should not start the build pipeline")
+    }
+
+    func testQuietAndVerboseConflict() {
+        let command = PackCommand(signer: CodeSigner(shell: MockShellExecutor()))
+        XCTAssertEqual(command.run(arguments: ["--quiet", "--verbose"]), 1)
+        XCTAssertEqual(command.run(arguments: ["-v", "-q"]), 1)
+    }
+
+    func testVerboseShellEchoesCommandsWithoutSecrets() throws {
+        XCTAssertEqual(
+            EchoingShellExecutor.commandLine(
+                executable: "/usr/bin/xcrun",
+                arguments: ["notarytool", "submit", "--apple-id", "dev@example.com", "--password", "abcd-efgh"]
+            ),
+            "/usr/bin/xcrun notarytool submit --apple-id dev@example.com --password <redacted>"
+        )
+
+        let base = MockShellExecutor()
+        let result = try EchoingShellExecutor(base: base).run(executable: "/usr/bin/codesign", arguments: ["--verify", "X.app"])
+        XCTAssertEqual(result.exitCode, 0)
+        XCTAssertEqual(base.calls.map(\.arguments), [["--verify", "X.app"]])
+    }
+
+    func testArchiveFlagValidated() {
+        let shell = MockShellExecutor()
+        let command = PackCommand(signer: CodeSigner(shell: shell))
+        XCTAssertEqual(command.run(arguments: ["--archive", "rar"]), 1)
+        XCTAssertEqual(command.run(arguments: ["--archive", "zip", "--dmg"]), 1)
+        XCTAssertEqual(command.run(arguments: ["--archive", "tar.gz", "--signed", "release"]), 1)
+        XCTAssertTrue(shell.calls.isEmpty, "Flag validation should fail before any tool runs")
+    }
+
+    func testLibraryRunReturnsResult() throws {
+        let (tmpDir, composePath) = try makeProject()
+        let fm = FileManager.default
+
+        var events: [PackEvent] = []
+        let command = PackCommand(signer: CodeSigner(shell: MockShellExecutor()), onEvent: { events.append($0) })
+        var options = PackOptions(composePath: composePath)
+        options.outputPath = (tmpDir as NSString).appendingPathComponent("TestApp")
+        options.placeholderArtifacts = true
+        options.buildManifest = true
+
+        // A library caller isn't containerfy, so there is no executable to fall back to
+        XCTAssertThrowsError(try command.run(options)) { error in
+            guard case PackError.missingBinaries(let message) = error else { return XCTFail("Expected PackError.missingBinaries, got: \(error)") }
+            XCTAssertTrue(message.hasPrefix("runtimeBinary is required"), message)
+        }
+        XCTAssertFalse(fm.fileExists(atPath: options.outputPath! + ".app"))
+        options.runtimeBinary = try makeRuntimeBinary(in: tmpDir)
+
+        let result = try command.run(options)
+        XCTAssertEqual(result.path, options.outputPath! + ".app")
+        XCTAssertEqual(result.identifier, "com.test.app")
+        XCTAssertEqual(result.images, ["nginx:1.27"])
+        XCTAssertFalse(result.signed)
+        XCTAssertEqual(result.buildManifest, (tmpDir as NSString).appendingPathComponent("testapp.build-manifest.json"))
+        XCTAssertTrue(fm.fileExists(atPath: result.path + "/Contents/Info.plist"))
+        XCTAssertEqual(events.last?.phase, .assemble)
+
+        // --dry-run and --print-config are reachable without a command line
+        XCTAssertTrue(try command.plan(options).hasPrefix("Plan for testapp v1.0.0 (com.test.app)"))
+        XCTAssertTrue(try command.resolvedConfig(options).contains("identifier:   com.test.app"))
+        XCTAssertTrue(try command.resolvedConfig(options, json: true).contains("\"com.test.app\""))
+
+        var badArchive = options
+        badArchive.archive = "rar"
+        XCTAssertThrowsError(try command.run(badArchive)) { error in
+            XCTAssertEqual(error as? PackError, .invalidOptions("--archive requires a format: tar.gz or zip"))
+        }
+
+        options.composePath = (tmpDir as NSString).appendingPathComponent("missing.yml")
+        XCTAssertThrowsError(try command.run(options)) { error in
+            guard case PackError.invalidCompose(let message) = error else { return XCTFail("Expected PackError.invalidCompose, got: \(error)") }
+            XCTAssertTrue(message.contains("missing.yml"), message)
+        }
+    }
+
+    /// An `--artifacts` directory in `dir` with stub podman, gvproxy and vfkit scripts.
+    private func makeArtifacts(in dir: String) throws -> String {
+        let fm = FileManager.default
+        let artifacts = (dir as NSString).appendingPathComponent("artifacts")
+        try fm.createDirectory(atPath: artifacts, withIntermediateDirectories: true)
+        for name in ["podman", "gvproxy", "vfkit"] {
+            let path = (artifacts as NSString).appendingPathComponent(name)
+            try "#!/bin/sh\necho prebuilt \(name)\n".write(toFile: path, atomically: true, encoding: .utf8)
+            try fm.setAttributes([.posixPermissions: 0o755], ofItemAtPath: path)
+        }
+        return artifacts
+    }
+
+    /// A universal (x86_64 + arm64) Mach-O header in `dir` to pass as `runtimeBinary`; pack
+    /// checks the architectures but never runs it.
+    private func makeRuntimeBinary(in dir: String) throws -> String {
+        let runtime = (dir as NSString).appendingPathComponent("containerfy-universal")
+        let slices: [UInt8] = [0x01, 0x00, 0x00, 0x07] + Array(repeating: 0, count: 16) + [0x01, 0x00, 0x00, 0x0C] + Array(repeating: 0, count: 16)
+        FileManager.default.createFile(atPath: runtime, contents: Data([0xCA, 0xFE, 0xBA, 0xBE, 0x00, 0x00, 0x00, 0x02] + slices) + Data(count: 64))
+        try FileManager.default.setAttributes([.posixPermissions: 0o755], ofItemAtPath: runtime)
+        return runtime
+    }
+
+    func testPrebuiltArtifactsAreBundled() throws {
+        let (tmpDir, composePath) = try makeProject()
+        let shell = MockShellExecutor()
+        let command = PackCommand(signer: CodeSigner(shell: shell), onEvent: { _ in })
+        var options = PackOptions(composePath: composePath)
+        options.outputPath = (tmpDir as NSString).appendingPathComponent("TestApp")
+        options.artifactsDir = try makeArtifacts(in: tmpDir)
+        options.runtimeBinary = try makeRuntimeBinary(in: tmpDir)
+
+        let result = try command.run(options)
+        // Only the ad-hoc signing of the copied binaries; no image tooling runs
+        XCTAssertEqual(Set(shell.calls.map(\.executable)), ["/usr/bin/codesign"])
+        let bundled = try String(contentsOfFile: result.path + "/Contents/MacOS/podman", encoding: .utf8)
+        XCTAssertEqual(bundled, "#!/bin/sh\necho prebuilt podman\n")
+    }
+
+    func testRuntimeBinaryForOtherArchitectureIsRejected() throws {
+        let (tmpDir, composePath) = try makeProject()
+        let fm = FileManager.default
+        // A thin binary for the other architecture would launch as "damaged"
+        let foreign = (tmpDir as NSString).appendingPathComponent("containerfy-foreign")
+        let foreignCPU: UInt8 = BundleAssembler.targetArchitecture == "arm64" ? 0x07 : 0x0C
+        fm.createFile(atPath: foreign, contents: Data([0xCF, 0xFA, 0xED, 0xFE, foreignCPU, 0x00, 0x00, 0x01]) + Data(count: 64))
+        try fm.setAttributes([.posixPermissions: 0o755], ofItemAtPath: foreign)
+
+        let command = PackCommand(signer: CodeSigner(shell: MockShellExecutor()), onEvent: { _ in })
+        var options = PackOptions(composePath: composePath)
+        options.outputPath = (tmpDir as NSString).appendingPathComponent("Foreign")
+        options.artifactsDir = try makeArtifacts(in: tmpDir)
+        options.runtimeBinary = foreign
+        XCTAssertThrowsError(try command.run(options)) { error in
+            XCTAssertTrue(error.localizedDescription.contains("but the bundle targets \(BundleAssembler.targetArchitecture)"), error.localizedDescription)
+        }
+        XCTAssertFalse(fm.fileExists(atPath: options.outputPath! + ".app"))
+    }
+
+    func testMissingPrebuiltArtifactFailsBeforeWriting() throws {
+        let (tmpDir, composePath) = try makeProject()
+        let artifacts = try makeArtifacts(in: tmpDir)
+        try FileManager.default.removeItem(atPath: (artifacts as NSString).appendingPathComponent("vfkit"))
+
+        let command = PackCommand(signer: CodeSigner(shell: MockShellExecutor()), onEvent: { _ in })
+        var options = PackOptions(composePath: composePath)
+        options.outputPath = (tmpDir as NSString).appendingPathComponent("Other")
+        options.artifactsDir = artifacts
+        XCTAssertThrowsError(try command.run(options)) { error in
+            XCTAssertEqual(error as? PackError, .missingBinaries("Missing: --artifacts: vfkit not found in \(artifacts)"))
+        }
+        XCTAssertFalse(FileManager.default.fileExists(atPath: options.outputPath! + ".app"))
+    }
+
+    func testRuntimeBinaryOverrideIsBundled() throws {
+        let (tmpDir, composePath) = try makeProject()
+        let fm = FileManager.default
+        let runtime = try makeRuntimeBinary(in: tmpDir)
+
+        let command = PackCommand(signer: CodeSigner(shell: MockShellExecutor()), onEvent: { _ in })
+        var options = PackOptions(composePath: composePath)
+        options.outputPath = (tmpDir as NSString).appendingPathComponent("TestApp")
+        options.placeholderArtifacts = true
+        options.runtimeBinary = runtime
+        options.requireBinary = true
+
+        let result = try command.run(options)
+        XCTAssertEqual(fm.contents(atPath: result.path + "/Contents/MacOS/Containerfy"), fm.contents(atPath: runtime))
+    }
+
+    func testRuntimeBinaryMustBeMachO() throws {
+        let (tmpDir, composePath) = try makeProject()
+        // A script is executable but not Mach-O
+        let script = (tmpDir as NSString).appendingPathComponent("containerfy.sh")
+        try "#!/bin/sh\n".write(toFile: script, atomically: true, encoding: .utf8)
+        try FileManager.default.setAttributes([.posixPermissions: 0o755], ofItemAtPath: script)
+
+        let command = PackCommand(signer: CodeSigner(shell: MockShellExecutor()), onEvent: { _ in })
+        var options = PackOptions(composePath: composePath)
+        options.outputPath = (tmpDir as NSString).appendingPathComponent("Script")
+        options.placeholderArtifacts = true
+        options.runtimeBinary = script
+        XCTAssertThrowsError(try command.run(options)) { error in
+            XCTAssertTrue(error.localizedDescription.contains("not an executable Mach-O binary"), error.localizedDescription)
+        }
+    }
+
+    func testMissingRuntimeBinaryFailsBeforeWriting() throws {
+        let (tmpDir, composePath) = try makeProject()
+        let command = PackCommand(signer: CodeSigner(shell: MockShellExecutor()), onEvent: { _ in })
+        var options = PackOptions(composePath: composePath)
+        options.outputPath = (tmpDir as NSString).appendingPathComponent("Missing")
+        options.placeholderArtifacts = true
+        options.runtimeBinary = (tmpDir as NSString).appendingPathComponent("missing")
+        XCTAssertThrowsError(try command.run(options)) { error in
+            guard case PackError.missingBinaries(let message) = error else { return XCTFail("Expected PackError.missingBinaries, got: \(error)") }
+            XCTAssertTrue(message.contains("--runtime-binary: \(tmpDir)/missing not found"), message)
+        }
+        XCTAssertFalse(FileManager.default.fileExists(atPath: options.outputPath! + ".app"))
+    }
+
+    func testTmpdirHoldsScratchFilesWithoutChangingTheEnvironment() throws {
+        let (tmpDir, composePath) = try makeProject()
+        let fm = FileManager.default
+        let scratch = (tmpDir as NSString).appendingPathComponent("scratch")
+        try fm.createDirectory(atPath: scratch, withIntermediateDirectories: true)
+
+        let before = ProcessInfo.processInfo.environment["TMPDIR"]
+        let shell = MockShellExecutor()
+        let command = PackCommand(signer: CodeSigner(shell: shell), onEvent: { _ in })
+        XCTAssertEqual(command.run(arguments: [
+            "--compose", composePath, "--output", (tmpDir as NSString).appendingPathComponent("TestApp"),
+            "--placeholder-artifacts", "--tmpdir", scratch,
+        ]), 0)
+        XCTAssertEqual(ProcessInfo.processInfo.environment["TMPDIR"], before)
+        // vfkit's entitlements are written to --tmpdir for codesign, then removed
+        let entitlements = try XCTUnwrap(shell.calls.lazy.compactMap { call in
+            call.arguments.firstIndex(of: "--entitlements").map { call.arguments[$0 + 1] }
+        }.first)
+        XCTAssertTrue(entitlements.hasPrefix(scratch + "/"), entitlements)
+        XCTAssertEqual(try fm.contentsOfDirectory(atPath: scratch), [])
+    }
+
+    func testLogFileRecordsStepsWhateverTheConsoleLevel() throws {
+        let (tmpDir, composePath) = try makeProject()
+        let fm = FileManager.default
+        let logPath = (tmpDir as NSString).appendingPathComponent("logs/pack.log")
+
+        let command = PackCommand(signer: CodeSigner(shell: MockShellExecutor()), onEvent: { _ in })
+        XCTAssertEqual(command.run(arguments: [
+            "--compose", composePath, "--output", (tmpDir as NSString).appendingPathComponent("TestApp"),
+            "--placeholder-artifacts", "--quiet", "--log-file", logPath,
+        ]), 0)
+
+        let log = try String(contentsOfFile: logPath, encoding: .utf8)
+        let lines = log.split(separator: "\n").map(String.init)
+        XCTAssertTrue(lines.first?.contains("pack --compose \(composePath)") == true, log)
+        XCTAssertTrue(log.contains("[1/3] parse started: Parsing \(composePath)..."), log)
+        XCTAssertTrue(log.contains("[2/3] locate-binaries completed"), log)
+        XCTAssertTrue(log.contains("[3/3] assemble started"), log)
+        XCTAssertTrue(log.contains("$ /usr/bin/codesign --force --sign -"), "ad-hoc signing should be logged: \(log)")
+        XCTAssertTrue(lines.last?.hasSuffix(" pack succeeded") == true, log)
+        // Every line is timestamped
+        XCTAssertTrue(lines.allSatisfy { $0.first?.isNumber == true && $0.contains("T") }, log)
+
+        // A failed run still ends its log, with the error in it
+        XCTAssertEqual(command.run(arguments: [
+            "--compose", (tmpDir as NSString).appendingPathComponent("missing.yml"), "--log-file", logPath,
+        ]), 1)
+        let failed = try String(contentsOfFile: logPath, encoding: .utf8)
+        XCTAssertTrue(failed.contains("Error: "), failed)
+        XCTAssertTrue(failed.hasSuffix(" pack failed (exit 1)\n"), failed)
+        XCTAssertFalse(failed.contains("pack succeeded"), "the log is truncated for each run")
+
+        // "--log-file" as the value of another flag is not the flag
+        let cwd = fm.currentDirectoryPath
+        XCTAssertTrue(fm.changeCurrentDirectoryPath(tmpDir))
+        defer { fm.changeCurrentDirectoryPath(cwd) }
+        XCTAssertEqual(command.run(arguments: [
+            "--compose", composePath, "--volume-name", "--log-file", "--dry-run", "--placeholder-artifacts",
+        ]), 0)
+        XCTAssertFalse(fm.fileExists(atPath: (tmpDir as NSString).appendingPathComponent("--dry-run")))
+        XCTAssertFalse(fm.fileExists(atPath: (tmpDir as NSString).appendingPathComponent("testapp.app")))
+    }
+
+    func testOutputTemplateExpansion() throws {
+        XCTAssertEqual(
+            try PackCommand.expandOutputTemplate("dist/{name}-{version}-{platform}", name: "MyApp", version: "1.2.3", platform: "macos-arm64"),
+            "dist/MyApp-1.2.3-macos-arm64"
+        )
+        XCTAssertEqual(try PackCommand.expandOutputTemplate("/tmp/../builds/{name}", name: "MyApp", version: "1.0.0"), "/tmp/../builds/MyApp")
+        // Without placeholders the path is used as given, as before
+        XCTAssertEqual(try PackCommand.expandOutputTemplate("../MyApp", name: "MyApp", version: "1.0.0"), "../MyApp")
+
+        XCTAssertThrowsError(try PackCommand.expandOutputTemplate("{name}-{arch}", name: "MyApp", version: "1.0.0")) { error in
+            XCTAssertTrue(error.localizedDescription.contains("{arch}"), error.localizedDescription)
+        }
+        for escaping in ["../{name}", "dist/../../{name}", "./{version}/../.."] {
+            XCTAssertThrowsError(try PackCommand.expandOutputTemplate(escaping, name: "MyApp", version: "1.0.0"), escaping) { error in
+                guard case PackCommand.OutputTemplateError.escapesDirectory? = error as? PackCommand.OutputTemplateError else {
+                    return XCTFail("Expected escapesDirectory, got: \(error)")
+                }
+            }
+        }
+    }
+
+    func testOutputTemplateAndDefaultDerivation() throws {
+        let (tmpDir, _) = try makeProject(compose: Self.compose.replacingOccurrences(of: "1.0.0", with: "2.1.0"))
+        let fm = FileManager.default
+
+        // Relative outputs resolve against the working directory
+        let previousDir = fm.currentDirectoryPath
+        XCTAssertTrue(fm.changeCurrentDirectoryPath(tmpDir))
+        defer { fm.changeCurrentDirectoryPath(previousDir) }
+
+        let command = PackCommand(signer: CodeSigner(shell: MockShellExecutor()), onEvent: { _ in })
+        var options = PackOptions(composePath: "docker-compose.yml")
+        options.placeholderArtifacts = true
+        options.runtimeBinary = try makeRuntimeBinary(in: tmpDir)
+
+        XCTAssertEqual(try command.run(options).path, "./testapp.app")
+        XCTAssertTrue(fm.fileExists(atPath: "testapp.app/Contents/Info.plist"))
+
+        options.outputPath = "dist/{name}-{version}"
+        XCTAssertEqual(try command.run(options).path, "dist/testapp-2.1.0.app")
+        XCTAssertTrue(fm.fileExists(atPath: "dist/testapp-2.1.0.app/Contents/Info.plist"))
+    }
+
+    func testJSONRejectsAll() {
+        let command = PackCommand(signer: CodeSigner(shell: MockShellExecutor()))
+        XCTAssertEqual(command.run(arguments: ["--json", "--all", NSTemporaryDirectory()]), 1)
+    }
+
+    func testJSONEventAndResultLines() {
+        let event = PackEvent(phase: .locateBinaries, step: 2, totalSteps: 3, status: .started, message: "Locating podman binaries...")
+        XCTAssertEqual(
+            PackEvent.jsonLine(event),
+            #"{"message":"Locating podman binaries...","phase":"locate-binaries","status":"started","step":2,"total_steps":3,"type":"event"}"#
+        )
+
+        let result = PackResult(
+            path: "out/My App.app", name: "myapp", version: "1.2.0", identifier: "com.example.myapp",
+            images: ["nginx:1.27"], signed: false, notarized: false, checksum: nil
+        )
+        XCTAssertEqual(
+            PackEvent.jsonLine(result),
+            #"{"identifier":"com.example.myapp","images":["nginx:1.27"],"name":"myapp","notarized":false,"path":"out/My App.app","signed":false,"type":"result","version":"1.2.0"}"#
+        )
+    }
+
+    func testDiscoverAppsFindsComposeSubdirectories() throws {
         let tmpDir = NSTemporaryDirectory() + "pack-test-\(ProcessInfo.processInfo.globallyUniqueString)"
         let fm = FileManager.default
+        defer { try? fm.removeItem(atPath: tmpDir) }
+        for (dir, file) in [("beta", "compose.yaml"), ("alpha", "docker-compose.yml"), ("docs", "README.md"), (".hidden", "compose.yaml")] {
+            let sub = (tmpDir as NSString).appendingPathComponent(dir)
+            try fm.createDirectory(atPath: sub, withIntermediateDirectories: true)
+            fm.createFile(atPath: (sub as NSString).appendingPathComponent(file), contents: Data())
+        }
+
+        let apps = PackCommand.discoverApps(in: tmpDir)
+        XCTAssertEqual(apps.map { (($0 as NSString).deletingLastPathComponent as NSString).lastPathComponent }, ["alpha", "beta"])
+    }
+
+    func testAllRejectsCompose() {
+        let command = PackCommand(signer: CodeSigner(shell: MockShellExecutor()))
+        XCTAssertEqual(command.run(arguments: ["--all", "/tmp", "--compose", "x.yml"]), 1)
+        XCTAssertEqual(command.run(arguments: ["--keep-going"]), 1)
+    }
+
+    func testAssessGatekeeperReportsRejectionReason() throws {
+        let shell = MockShellExecutor()
+        shell.resultToReturn = ProcessResult(exitCode: 3, stdout: "", stderr: """
+            /tmp/App.app: rejected
+            source=no usable signature
+            """)
+        let verdict = try CodeSigner(shell: shell).assessGatekeeper(appPath: "/tmp/App.app")
+        XCTAssertEqual(verdict, CodeSigner.GatekeeperVerdict(accepted: false, reason: "no usable signature"))
+        XCTAssertEqual(shell.calls.first?.executable, "/usr/sbin/spctl")
+    }
+
+    func testAssessGatekeeperAcceptsNotarizedApp() throws {
+        let shell = MockShellExecutor()
+        shell.resultToReturn = ProcessResult(exitCode: 0, stdout: "", stderr: """
+            /tmp/App.app: accepted
+            source=Notarized Developer ID
+            """)
+        let verdict = try CodeSigner(shell: shell).assessGatekeeper(appPath: "/tmp/App.app")
+        XCTAssertEqual(verdict, CodeSigner.GatekeeperVerdict(accepted: true, reason: "Notarized Developer ID"))
+    }
+
+    func testValidateExitCodes() throws {
+        let tmpDir = NSTemporaryDirectory() + "validate-test-\(ProcessInfo.processInfo.globallyUniqueString)"
+        let fm = FileManager.default
         try fm.createDirectory(atPath: tmpDir, withIntermediateDirectories: true)
         defer { try? fm.removeItem(atPath: tmpDir) }
 
         let composePath = (tmpDir as NSString).appendingPathComponent("docker-compose.yml")
-        let yaml = """
+        try """
         services:
           web:
             image: nginx:latest
             ports:
-              - "8080:80"
+              - "80:80"
         x-containerfy:
           name: testapp
           version: "1.0.0"
@@ -35,15 +635,18 @@ final class PackCommandTests: XCTestCase {
             memory_mb:
               min: 1024
             disk_mb: 4096
-        """
-        try yaml.write(toFile: composePath, atomically: true, encoding: .utf8)
+        """.write(toFile: composePath, atomically: true, encoding: .utf8)
 
-        // Pack will fail at "Locating podman binaries" step if podman is not installed,
-        // or succeed if it is. Either way, compose parsing should succeed.
-        let signer = CodeSigner(shell: MockShellExecutor())
-        let command = PackCommand(signer: signer)
-        let exitCode = command.run(arguments: ["--compose", composePath])
-        // We just verify it doesn't crash — exit code depends on whether podman is installed
-        XCTAssertTrue(exitCode == 0 || exitCode == 1)
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", composePath]), 0)
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", composePath, "--json"]), 0)
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", composePath, "--strict"]), 1, "Privileged port fails under --strict")
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", composePath, "--require-pinned"]), 1)
+        XCTAssertEqual(ValidateCommand().run(arguments: [
+            "--compose", composePath, "--require-pinned", "--override-image", "web=nginx:1.27",
+        ]), 0, "Overrides are validated like pack's")
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", composePath, "--override-image", "web"]), 1)
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", composePath, "--identifier", "not a bundle id"]), 1)
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", composePath, "--profile", "debug"]), 0)
+        XCTAssertEqual(ValidateCommand().run(arguments: ["--compose", "/nonexistent/docker-compose.yml"]), 1)
     }
 }
@@ -0,0 +1,139 @@
+import XCTest
+@testable import ContainerfyCore
+
+final class RemoteComposeTests: XCTestCase {
+
+    private var tempDir: String!
+
+    override func setUp() {
+        super.setUp()
+        tempDir = NSTemporaryDirectory() + "containerfy-remote-test-\(UUID().uuidString)"
+        try? FileManager.default.createDirectory(atPath: tempDir, withIntermediateDirectories: true)
+    }
+
+    override func tearDown() {
+        try? FileManager.default.removeItem(atPath: tempDir)
+        super.tearDown()
+    }
+
+    /// Serves `body` with `status` for every request.
+    private func server(status: Int = 200, body: String, finalURL: URL? = nil) -> RemoteCompose.Transport {
+        return { request, maxBytes in
+            // Like the URLSession transport, read no more than one byte past the limit
+            return (status, Data(body.utf8).prefix(maxBytes + 1), finalURL ?? request.url)
+        }
+    }
+
+    private let compose = """
+    services:
+      web:
+        image: nginx:1.25
+        ports:
+          - "8080:80"
+    x-containerfy:
+      name: remoteapp
+      version: "1.0.0"
+      identifier: com.example.remote
+      vm:
+        cpu:
+          min: 2
+        memory_mb:
+          min: 1024
+        disk_mb: 4096
+    """
+
+    func testDownloadSavesTheComposeFileUnderItsOwnName() throws {
+        let path = try RemoteCompose.download(
+            "https://example.com/app/compose.yaml", into: tempDir, transport: server(body: compose)
+        )
+        XCTAssertEqual((path as NSString).lastPathComponent, "compose.yaml")
+        XCTAssertEqual(try String(contentsOfFile: path, encoding: .utf8), compose)
+
+        var options = ComposeConfigParser.BuildOptions()
+        options.remoteSource = "https://example.com/app/compose.yaml"
+        let config = try ComposeConfigParser.parseBuild(composePath: path, options: options)
+        XCTAssertEqual(config.identifier, "com.example.remote")
+    }
+
+    func testNotFoundFails() {
+        XCTAssertThrowsError(try RemoteCompose.download(
+            "https://example.com/missing.yml", into: tempDir, transport: server(status: 404, body: "not found")
+        )) { error in
+            guard case RemoteCompose.FetchError.badStatus(_, 404)? = error as? RemoteCompose.FetchError else {
+                return XCTFail("expected badStatus(404), got \(error)")
+            }
+        }
+        XCTAssertEqual(try FileManager.default.contentsOfDirectory(atPath: tempDir), [])
+    }
+
+    func testOversizeResponseFails() {
+        XCTAssertThrowsError(try RemoteCompose.download(
+            "https://example.com/huge.yml", into: tempDir, maxBytes: 16, transport: server(body: compose)
+        )) { error in
+            guard case RemoteCompose.FetchError.tooLarge(_, 16)? = error as? RemoteCompose.FetchError else {
+                return XCTFail("expected tooLarge, got \(error)")
+            }
+        }
+    }
+
+    func testPlainHTTPRejectedUnlessAllowed() throws {
+        var requested: [URL] = []
+        XCTAssertThrowsError(try RemoteCompose.download("http://example.com/compose.yml", into: tempDir) { request, _ in
+            requested.append(request.url!)
+            return (200, Data(), request.url)
+        }) { error in
+            guard case RemoteCompose.FetchError.insecure? = error as? RemoteCompose.FetchError else {
+                return XCTFail("expected insecure, got \(error)")
+            }
+        }
+        XCTAssertTrue(requested.isEmpty, "nothing should be fetched over plain HTTP")
+
+        // A redirect from HTTPS down to HTTP is rejected too
+        XCTAssertThrowsError(try RemoteCompose.download(
+            "https://example.com/compose.yml", into: tempDir,
+            transport: server(body: compose, finalURL: URL(string: "http://example.com/compose.yml"))
+        ))
+
+        XCTAssertNoThrow(try RemoteCompose.download(
+            "http://example.com/compose.yml", into: tempDir, allowHTTP: true, transport: server(body: compose)
+        ))
+    }
+
+    func testLocalFileReferencesRejectedForRemoteCompose() throws {
+        let path = (tempDir as NSString).appendingPathComponent("docker-compose.yml")
+        try """
+        services:
+          web:
+            image: nginx:1.25
+            env_file: app.env
+        secrets:
+          token:
+            file: ./token.txt
+        x-containerfy:
+          name: remoteapp
+          version: "1.0.0"
+          identifier: com.example.remote
+          license: LICENSE.txt
+          vm:
+            cpu:
+              min: 2
+            memory_mb:
+              min: 1024
+            disk_mb: 4096
+        """.write(toFile: path, atomically: true, encoding: .utf8)
+
+        var options = ComposeConfigParser.BuildOptions()
+        options.remoteSource = "https://example.com/docker-compose.yml"
+        XCTAssertThrowsError(try ComposeConfigParser.parseBuild(composePath: path, options: options)) { error in
+            guard let ce = error as? ComposeError, case .multiple(let errors) = ce else {
+                return XCTFail("expected .multiple, got \(error)")
+            }
+            let fields = errors.compactMap { error -> String? in
+                if case .invalidValue(let field, _, _) = error { return field }
+                return nil
+            }
+            XCTAssertEqual(fields, ["x-containerfy.license", "secrets.token.file", "services.web.env_file"])
+            XCTAssertTrue(ce.localizedDescription.contains("fetched from https://example.com/docker-compose.yml"))
+        }
+    }
+}
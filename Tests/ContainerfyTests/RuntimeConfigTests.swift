@@ -0,0 +1,81 @@
+import XCTest
+@testable import ContainerfyCore
+
+final class RuntimeConfigTests: XCTestCase {
+
+    private var tempDir: URL!
+
+    override func setUp() {
+        super.setUp()
+        tempDir = FileManager.default.temporaryDirectory
+            .appendingPathComponent("containerfy-runtime-tests-\(UUID().uuidString)")
+        try! FileManager.default.createDirectory(at: tempDir, withIntermediateDirectories: true)
+    }
+
+    override func tearDown() {
+        try? FileManager.default.removeItem(at: tempDir)
+        super.tearDown()
+    }
+
+    private func buildConfig() throws -> ComposeConfig {
+        let yaml = """
+        services:
+          web:
+            image: nginx:1.27
+            restart: always
+            ports:
+              - "8080:80"
+          db:
+            image: postgres:16
+        x-containerfy:
+          name: testapp
+          display_name: Test App
+          version: "1.2.3"
+          identifier: com.example.testapp
+          vm:
+            cpu:
+              min: 2
+              recommended: 4
+            memory_mb:
+              min: 1024
+            disk_mb: 8192
+        """
+        let path = tempDir.appendingPathComponent("docker-compose.yml").path
+        FileManager.default.createFile(atPath: path, contents: yaml.data(using: .utf8))
+        return try ComposeConfigParser.parseBuild(composePath: path)
+    }
+
+    func testRuntimeConfigCapturesResolvedConfig() throws {
+        let runtime = RuntimeConfig(config: try buildConfig())
+        XCTAssertEqual(runtime.name, "testapp")
+        XCTAssertEqual(runtime.displayName, "Test App")
+        XCTAssertEqual(runtime.vm, RuntimeConfig.VM(cpuMin: 2, cpuRecommended: 4, memoryMBMin: 1024, memoryMBRecommended: 1024, diskMB: 8192))
+        XCTAssertEqual(runtime.services.map(\.name), ["db", "web"])
+        XCTAssertEqual(runtime.services[1].ports, [RuntimeConfig.Port(host: 8080, container: 80, protocol: "tcp")])
+        XCTAssertEqual(runtime.services[1].restart, "always")
+    }
+
+    func testRoundTripMatchesRuntimeView() throws {
+        let runtime = RuntimeConfig(config: try buildConfig())
+        try runtime.write(toResourcesPath: tempDir.path)
+        let loaded = try RuntimeConfig.load(path: tempDir.appendingPathComponent(RuntimeConfig.fileName).path)
+        XCTAssertEqual(loaded, runtime)
+
+        let view = loaded.composeConfig
+        XCTAssertEqual(view.name, "testapp")
+        XCTAssertEqual(view.cpuRecommended, 4)
+        XCTAssertEqual(view.services.map(\.name), ["web"], "Only services with ports get menu items")
+        XCTAssertEqual(view.services.first?.openURL?.absoluteString, "http://127.0.0.1:8080")
+    }
+
+    func testNewerSchemaIsRejected() throws {
+        var runtime = RuntimeConfig(config: try buildConfig())
+        runtime.schemaVersion = RuntimeConfig.currentSchemaVersion + 1
+        try runtime.write(toResourcesPath: tempDir.path)
+        XCTAssertThrowsError(try RuntimeConfig.load(path: tempDir.appendingPathComponent(RuntimeConfig.fileName).path)) { error in
+            guard case RuntimeConfig.RuntimeConfigError.unsupportedSchema = error else {
+                return XCTFail("Expected unsupportedSchema, got: \(error)")
+            }
+        }
+    }
+}
@@ -112,4 +112,34 @@ final class StateFileTests: XCTestCase {
         XCTAssertNotNil(persisted?.vmStartTime)
         XCTAssertEqual(persisted!.vmStartTime!.timeIntervalSince1970, 1000000, accuracy: 1)
     }
+
+    // MARK: - Legacy Support Directory
+
+    func testLegacyStateMovesIntoPerAppDirectory() throws {
+        let legacy = tempDir.appendingPathComponent("Containerfy")
+        let perApp = tempDir.appendingPathComponent("com.test.app")
+        try FileManager.default.createDirectory(at: legacy, withIntermediateDirectories: true)
+        try FileManager.default.createDirectory(at: perApp, withIntermediateDirectories: true)
+        StateFile(fileURL: legacy.appendingPathComponent("state.json"), currentPID: 4242).persist(state: .running)
+
+        Paths.migrateLegacyState(from: legacy, to: perApp)
+        XCTAssertEqual(StateFile(fileURL: perApp.appendingPathComponent("state.json"), currentPID: 1).read()?.pid, 4242)
+        XCTAssertFalse(FileManager.default.fileExists(atPath: legacy.path), "the emptied legacy directory is removed")
+    }
+
+    func testLegacyDirectoryWithOtherFilesIsKept() throws {
+        let legacy = tempDir.appendingPathComponent("Containerfy")
+        let perApp = tempDir.appendingPathComponent("com.test.app")
+        try FileManager.default.createDirectory(at: legacy, withIntermediateDirectories: true)
+        try FileManager.default.createDirectory(at: perApp, withIntermediateDirectories: true)
+        StateFile(fileURL: legacy.appendingPathComponent("state.json"), currentPID: 4242).persist(state: .running)
+        FileManager.default.createFile(atPath: legacy.appendingPathComponent("docker-compose.yml").path, contents: Data())
+        // An app that already has its own state keeps it
+        StateFile(fileURL: perApp.appendingPathComponent("state.json"), currentPID: 7).persist(state: .stopped)
+
+        Paths.migrateLegacyState(from: legacy, to: perApp)
+        XCTAssertEqual(StateFile(fileURL: perApp.appendingPathComponent("state.json"), currentPID: 1).read()?.pid, 7)
+        XCTAssertTrue(FileManager.default.fileExists(atPath: legacy.appendingPathComponent("state.json").path))
+        XCTAssertTrue(FileManager.default.fileExists(atPath: legacy.appendingPathComponent("docker-compose.yml").path))
+    }
 }
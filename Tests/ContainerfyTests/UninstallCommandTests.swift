@@ -0,0 +1,141 @@
+import XCTest
+@testable import ContainerfyCore
+
+final class UninstallCommandTests: XCTestCase {
+
+    private var tmpDir: String!
+    private var appPath: String { (tmpDir as NSString).appendingPathComponent("MyApp.app") }
+    private var home: String { (tmpDir as NSString).appendingPathComponent("home") }
+    private var supportRoot: String { (home as NSString).appendingPathComponent("Library/Application Support") }
+    private var supportDir: String { (supportRoot as NSString).appendingPathComponent("com.test.app") }
+    private var otherApp: String { (supportRoot as NSString).appendingPathComponent("com.other.app/state.json") }
+
+    override func setUp() {
+        super.setUp()
+        tmpDir = NSTemporaryDirectory() + "uninstall-test-\(ProcessInfo.processInfo.globallyUniqueString)"
+        let fm = FileManager.default
+        try? fm.createDirectory(atPath: (appPath as NSString).appendingPathComponent("Contents/MacOS"), withIntermediateDirectories: true)
+        try? fm.createDirectory(atPath: (appPath as NSString).appendingPathComponent("Contents/Resources"), withIntermediateDirectories: true)
+        fm.createFile(atPath: (appPath as NSString).appendingPathComponent("Contents/MacOS/podman"), contents: Data())
+        for path in [supportDir + "/state.json", supportDir + "/seed-data.tar", otherApp] {
+            try? fm.createDirectory(atPath: (path as NSString).deletingLastPathComponent, withIntermediateDirectories: true)
+            fm.createFile(atPath: path, contents: Data("{}".utf8))
+        }
+    }
+
+    override func tearDown() {
+        try? FileManager.default.removeItem(atPath: tmpDir)
+        super.tearDown()
+    }
+
+    private func writeInstalledPaths(_ installed: InstalledPaths) throws {
+        let resources = (appPath as NSString).appendingPathComponent("Contents/Resources")
+        try BundleLayout(
+            schemaVersion: 1, compose: "docker-compose.yml", runtime: nil, envFiles: [],
+            labels: nil, caCertificates: nil, license: nil, installedPaths: InstalledPaths.fileName
+        ).write(toResourcesPath: resources)
+        try installed.write(toResourcesPath: resources)
+    }
+
+    private func installed(
+        directory: String = "~/Library/Application Support/com.test.app", files: [String] = ["state.json", "seed-data.tar"],
+        machine: String = "containerfy-testapp"
+    ) -> InstalledPaths {
+        InstalledPaths(schemaVersion: 1, supportDirectory: directory, files: files, podmanMachine: machine)
+    }
+
+    func testRemovesMachineAndListedFilesOnly() throws {
+        try writeInstalledPaths(installed())
+        FileManager.default.createFile(atPath: supportDir + "/notes.txt", contents: Data())
+        let shell = MockShellExecutor()
+
+        XCTAssertEqual(UninstallCommand(shell: shell, home: home).run(arguments: [appPath]), 0)
+        XCTAssertEqual(shell.calls.map(\.executable), [appPath + "/Contents/MacOS/podman"])
+        XCTAssertEqual(shell.calls.first?.arguments, ["machine", "rm", "-f", "containerfy-testapp"])
+        XCTAssertFalse(FileManager.default.fileExists(atPath: supportDir + "/state.json"))
+        XCTAssertFalse(FileManager.default.fileExists(atPath: supportDir + "/seed-data.tar"))
+        // Files the app didn't create keep the directory, and other apps are untouched
+        XCTAssertTrue(FileManager.default.fileExists(atPath: supportDir + "/notes.txt"))
+        XCTAssertTrue(FileManager.default.fileExists(atPath: otherApp))
+
+        try FileManager.default.removeItem(atPath: supportDir + "/notes.txt")
+        XCTAssertEqual(UninstallCommand(shell: shell, home: home).run(arguments: [appPath]), 0)
+        XCTAssertFalse(FileManager.default.fileExists(atPath: supportDir))
+        XCTAssertTrue(FileManager.default.fileExists(atPath: otherApp))
+    }
+
+    func testDryRunRemovesNothing() throws {
+        try writeInstalledPaths(installed())
+        let shell = MockShellExecutor()
+
+        XCTAssertEqual(UninstallCommand(shell: shell, home: home).run(arguments: [appPath, "--dry-run"]), 0)
+        XCTAssertTrue(shell.calls.isEmpty)
+        XCTAssertTrue(FileManager.default.fileExists(atPath: supportDir + "/state.json"))
+    }
+
+    func testMissingMachineIsNotAnError() throws {
+        try writeInstalledPaths(installed())
+        let shell = MockShellExecutor()
+        shell.resultToReturn = ProcessResult(exitCode: 125, stdout: "", stderr: "Error: containerfy-testapp: VM does not exist")
+
+        XCTAssertEqual(UninstallCommand(shell: shell, home: home).run(arguments: [appPath]), 0)
+        XCTAssertFalse(FileManager.default.fileExists(atPath: supportDir))
+    }
+
+    func testRefusesPathsOutsideTheSupportDirectory() throws {
+        let tampered = [
+            installed(files: ["../com.other.app/state.json"]),
+            installed(files: [""]),
+            installed(directory: "~/Library/Application Support/com.test.app/../com.other.app"),
+            installed(directory: "~/Library/Application Support"),
+            installed(directory: "~/Documents"),
+        ]
+        for manifest in tampered {
+            XCTAssertThrowsError(try manifest.removablePaths(home: home)) { error in
+                guard case InstalledPaths.InstalledPathsError.outsideSupportDirectory = error else {
+                    return XCTFail("unexpected error: \(error)")
+                }
+            }
+            try writeInstalledPaths(manifest)
+            let shell = MockShellExecutor()
+            XCTAssertEqual(UninstallCommand(shell: shell, home: home).run(arguments: [appPath]), 1)
+            XCTAssertTrue(shell.calls.isEmpty)
+        }
+        XCTAssertTrue(FileManager.default.fileExists(atPath: otherApp))
+        XCTAssertTrue(FileManager.default.fileExists(atPath: supportDir + "/state.json"))
+    }
+
+    func testRefusesMachinesContainerfyDidNotCreate() throws {
+        for machine in ["podman-machine-default", "containerfy-", "containerfy--all", "containerfy-a b", "xcontainerfy-testapp"] {
+            try writeInstalledPaths(installed(machine: machine))
+            XCTAssertThrowsError(try UninstallCommand.load(appPath: appPath), machine) { error in
+                guard case InstalledPaths.InstalledPathsError.unexpectedMachine(machine) = error else {
+                    return XCTFail("unexpected error: \(error)")
+                }
+            }
+            let shell = MockShellExecutor()
+            XCTAssertEqual(UninstallCommand(shell: shell, home: home).run(arguments: [appPath]), 1)
+            XCTAssertTrue(shell.calls.isEmpty)
+        }
+        XCTAssertTrue(FileManager.default.fileExists(atPath: supportDir + "/state.json"))
+    }
+
+    func testRefusesSymlinkedSupportDirectory() throws {
+        try FileManager.default.removeItem(atPath: supportDir)
+        try FileManager.default.createSymbolicLink(atPath: supportDir, withDestinationPath: (otherApp as NSString).deletingLastPathComponent)
+        try writeInstalledPaths(installed())
+
+        XCTAssertEqual(UninstallCommand(shell: MockShellExecutor(), home: home).run(arguments: [appPath]), 1)
+        XCTAssertTrue(FileManager.default.fileExists(atPath: otherApp))
+    }
+
+    func testBundleWithoutInstalledPathsIsRejected() throws {
+        try BundleLayout(schemaVersion: 1, compose: "docker-compose.yml", runtime: nil, envFiles: [], labels: nil, caCertificates: nil, license: nil)
+            .write(toResourcesPath: (appPath as NSString).appendingPathComponent("Contents/Resources"))
+
+        XCTAssertThrowsError(try UninstallCommand.load(appPath: appPath)) { error in
+            XCTAssertTrue(error.localizedDescription.contains("packed by an older containerfy"), error.localizedDescription)
+        }
+        XCTAssertEqual(UninstallCommand(shell: MockShellExecutor(), home: home).run(arguments: [tmpDir]), 1)
+    }
+}
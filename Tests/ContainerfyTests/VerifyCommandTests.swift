@@ -0,0 +1,135 @@
+import XCTest
+@testable import ContainerfyCore
+
+final class VerifyCommandTests: XCTestCase {
+
+    private var appPath: String!
+
+    override func setUp() {
+        super.setUp()
+        appPath = NSTemporaryDirectory() + "verify-test-\(ProcessInfo.processInfo.globallyUniqueString)/MyApp.app"
+        let resources = (appPath as NSString).appendingPathComponent("Contents/Resources")
+        try? FileManager.default.createDirectory(atPath: resources, withIntermediateDirectories: true)
+    }
+
+    override func tearDown() {
+        try? FileManager.default.removeItem(atPath: (appPath as NSString).deletingLastPathComponent)
+        super.tearDown()
+    }
+
+    private var composePath: String {
+        (appPath as NSString).appendingPathComponent("Contents/Resources/docker-compose.yml")
+    }
+
+    private func writeBundle(compose: String, digest: String?) throws {
+        try compose.write(toFile: composePath, atomically: true, encoding: .utf8)
+        var plist: [String: Any] = ["CFBundleIdentifier": "com.test.app"]
+        plist[BundleAssembler.composeDigestKey] = digest
+        let data = try PropertyListSerialization.data(fromPropertyList: plist, format: .xml, options: 0)
+        FileManager.default.createFile(atPath: (appPath as NSString).appendingPathComponent("Contents/Info.plist"), contents: data)
+    }
+
+    func testMatchingDigestPasses() throws {
+        try writeBundle(compose: "services: {}\n", digest: nil)
+        let digest = try Checksum.sha256(ofFile: composePath)
+        try writeBundle(compose: "services: {}\n", digest: digest)
+
+        XCTAssertNoThrow(try VerifyCommand.verifyComposeDigest(appPath: appPath))
+        XCTAssertEqual(VerifyCommand().run(arguments: [appPath]), 0)
+    }
+
+    func testModifiedComposeFails() throws {
+        try writeBundle(compose: "services: {}\n", digest: nil)
+        let digest = try Checksum.sha256(ofFile: composePath)
+        try writeBundle(compose: "services: {evil: {image: x}}\n", digest: digest)
+
+        XCTAssertThrowsError(try VerifyCommand.verifyComposeDigest(appPath: appPath)) { error in
+            guard case VerifyCommand.VerifyError.composeModified = error else {
+                return XCTFail("Expected composeModified, got: \(error)")
+            }
+        }
+        XCTAssertEqual(VerifyCommand().run(arguments: [appPath]), 1)
+    }
+
+    func testMissingDigestFails() throws {
+        try writeBundle(compose: "services: {}\n", digest: nil)
+        XCTAssertThrowsError(try VerifyCommand.verifyComposeDigest(appPath: appPath)) { error in
+            guard case VerifyCommand.VerifyError.missingDigest = error else {
+                return XCTFail("Expected missingDigest, got: \(error)")
+            }
+        }
+    }
+
+    func testComposeLocatedThroughLayout() throws {
+        let resources = (appPath as NSString).appendingPathComponent("Contents/Resources")
+        let renamed = (resources as NSString).appendingPathComponent("compose.yaml")
+        try "services: {}\n".write(toFile: renamed, atomically: true, encoding: .utf8)
+        try writeBundle(compose: "unrelated\n", digest: try Checksum.sha256(ofFile: renamed))
+        try BundleLayout(schemaVersion: 1, compose: "compose.yaml", runtime: nil, envFiles: [], labels: nil, caCertificates: nil, license: nil)
+            .write(toResourcesPath: resources)
+
+        XCTAssertNoThrow(try VerifyCommand.verifyComposeDigest(appPath: appPath))
+    }
+
+    // MARK: - Manifest
+
+    private func writeManifestBundle() throws -> String {
+        let resources = (appPath as NSString).appendingPathComponent("Contents/Resources")
+        try writeBundle(compose: "services: {}\n", digest: nil)
+        try writeBundle(compose: "services: {}\n", digest: try Checksum.sha256(ofFile: composePath))
+        try "TOKEN=abc\n".write(toFile: (resources as NSString).appendingPathComponent("app.env"), atomically: true, encoding: .utf8)
+        try BundleLayout(
+            schemaVersion: 1, compose: "docker-compose.yml", runtime: nil, envFiles: ["app.env"],
+            labels: nil, caCertificates: nil, license: nil, manifest: BundleManifest.fileName
+        ).write(toResourcesPath: resources)
+        try BundleManifest.generate(resourcesPath: resources).write(toResourcesPath: resources)
+        return resources
+    }
+
+    func testManifestListsResourcesDeterministically() throws {
+        let resources = try writeManifestBundle()
+        let manifest = try BundleManifest.load(path: (resources as NSString).appendingPathComponent(BundleManifest.fileName))
+        XCTAssertEqual(manifest.files.map(\.path), ["app.env", "docker-compose.yml", "layout.json"])
+        XCTAssertEqual(manifest.files[0].size, 10)
+        XCTAssertEqual(try BundleManifest.generate(resourcesPath: resources), manifest)
+
+        XCTAssertEqual(try VerifyCommand.verifyManifest(appPath: appPath), 3)
+        XCTAssertEqual(VerifyCommand().run(arguments: [appPath]), 0)
+    }
+
+    func testTamperedResourceFailsManifest() throws {
+        let resources = try writeManifestBundle()
+        try "TOKEN=evil\n".write(toFile: (resources as NSString).appendingPathComponent("app.env"), atomically: true, encoding: .utf8)
+
+        XCTAssertThrowsError(try VerifyCommand.verifyManifest(appPath: appPath)) { error in
+            guard case BundleManifest.ManifestError.modifiedFile(let path, _, _) = error else {
+                return XCTFail("Expected modifiedFile, got: \(error)")
+            }
+            XCTAssertEqual(path, "app.env")
+        }
+        XCTAssertEqual(VerifyCommand().run(arguments: [appPath]), 1)
+    }
+
+    func testMissingAndAddedResourcesFailManifest() throws {
+        let resources = try writeManifestBundle()
+        try FileManager.default.removeItem(atPath: (resources as NSString).appendingPathComponent("app.env"))
+        XCTAssertThrowsError(try VerifyCommand.verifyManifest(appPath: appPath)) { error in
+            guard case BundleManifest.ManifestError.missingFile("app.env") = error else {
+                return XCTFail("Expected missingFile, got: \(error)")
+            }
+        }
+
+        try "TOKEN=abc\n".write(toFile: (resources as NSString).appendingPathComponent("app.env"), atomically: true, encoding: .utf8)
+        try "x".write(toFile: (resources as NSString).appendingPathComponent("extra.sh"), atomically: true, encoding: .utf8)
+        XCTAssertThrowsError(try VerifyCommand.verifyManifest(appPath: appPath)) { error in
+            guard case BundleManifest.ManifestError.unexpectedFile("extra.sh") = error else {
+                return XCTFail("Expected unexpectedFile, got: \(error)")
+            }
+        }
+    }
+
+    func testBundleWithoutManifestSkipsCheck() throws {
+        try writeBundle(compose: "services: {}\n", digest: nil)
+        XCTAssertNil(try VerifyCommand.verifyManifest(appPath: appPath))
+    }
+}